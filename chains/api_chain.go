@@ -2,17 +2,36 @@ package chains
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/nexptr/llmchain/llms"
 	"github.com/nexptr/llmchain/prompts"
 	"github.com/nexptr/llmchain/schema"
 )
 
-// BaseChat base chat Lang chain,this chain just do nothing
+const (
+	// APIChainType the type of APIChain in ChainDef.
+	APIChainType = `api_chain`
+
+	// APIRequestKey the output of the request sent by APIChain.
+	APIRequestKey = `api_request`
+	// APIResponseKey the output of the response got by APIChain.
+	APIResponseKey = `api_response`
+)
+
+// APIChain answer the question by API: llm generate the request from the API docs, and summarize the
+// response of request to answer.
+//
+// inputs: InputKey the question. outputs: OutputKey the answer, APIRequestKey and APIResponseKey.
 type APIChain struct {
 	name string
+	docs string
+
+	memory schema.Memory
 
 	reqTempl *prompts.Template
 
@@ -20,120 +39,367 @@ type APIChain struct {
 
 	client *http.Client
 	l      llms.LLM
+
+	// AllowedDomains the hosts allowed to request: example.com, example.com:8080 or *.example.com,
+	// default is the hosts of urls in docs.
+	AllowedDomains []string
+	// Headers set to every request, example: the API key not exposed to llm.
+	Headers map[string]string
+	// Timeout of every request, default 10s.
+	Timeout time.Duration
+	// MaxResponseBytes the response is truncated to, default 64KB.
+	MaxResponseBytes int64
+	// Validator check the request generated before sending, example: against the OpenAPI spec.
+	Validator func(req *APIRequest) error
 }
 
-// Chat implements Chain.
-func (*APIChain) Chat(ctx context.Context, inputs map[string]any, options ...ChainCallOption) (map[string]any, error) {
-	panic("unimplemented")
+var _ Chain = &APIChain{}
+
+// ErrDomainNotAllowed the host of request generated is not in AllowedDomains.
+var ErrDomainNotAllowed = errors.New(`domain not allowed`)
+
+func NewAPIChain(name, docs string) *APIChain {
+
+	docsVar := prompts.H{`APIDocs`: docs}
+
+	q, _ := prompts.New(apiReqTemplate, `Input`)
+
+	p, _ := prompts.New(apiRespTemplate, `Request`, `APIResp`)
+
+	return &APIChain{
+		name:             name,
+		docs:             docs,
+		reqTempl:         q.Partial(docsVar),
+		respTempl:        p.Partial(docsVar),
+		AllowedDomains:   docsDomains(docs),
+		Timeout:          10 * time.Second,
+		MaxResponseBytes: 64 << 10,
+	}
+}
+
+// Name implements llmchain.Chain
+func (c *APIChain) GetName() string {
+	return c.name
 }
 
 // GetInputKeys implements Chain.
 func (*APIChain) GetInputKeys() []string {
-	panic("unimplemented")
+	return []string{InputKey}
 }
 
 // GetMemory implements Chain.
-func (*APIChain) GetMemory() schema.Memory {
-	panic("unimplemented")
+func (c *APIChain) GetMemory() schema.Memory {
+	return c.memory
 }
 
 // GetOutputKeys implements Chain.
 func (*APIChain) GetOutputKeys() []string {
-	panic("unimplemented")
+	return []string{OutputKey}
 }
 
-var _ Chain = &APIChain{}
+// Chat implements Chain.
+func (c *APIChain) Chat(ctx context.Context, inputs map[string]any, options ...ChainCallOption) (map[string]any, error) {
 
-func NewAPIChain(name, docs string) *APIChain {
+	opts := initChainCallOptions(options...)
 
-	reqTempl := fmt.Sprintf(apiReqTemplate, docs)
-	respTempl := fmt.Sprintf(apiRespTemplate, docs)
+	llm := c.l
+	if llm == nil {
+		llm = opts.LLM
+	}
+	if llm == nil {
+		return nil, fmt.Errorf(`chain '%s': no model`, c.name)
+	}
 
-	q, _ := prompts.New(reqTempl, `Input`)
+	question, ok := inputs[InputKey].(string)
+	if !ok {
+		return nil, fmt.Errorf(`chain '%s': input '%s' is %T, expect string`, c.name, InputKey, inputs[InputKey])
+	}
 
-	p, _ := prompts.New(respTempl, `Request`, `APIResp`)
+	callOpts := []llms.CallOption{}
+	if len(opts.StopWords) > 0 {
+		callOpts = append(callOpts, llms.WithStopWords(opts.StopWords))
+	}
 
-	return &APIChain{
-		name:      name,
-		reqTempl:  q,
-		respTempl: p,
+	req, resp, summary, err := c.request(ctx, llm, question, callOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.StreamingFunc != nil {
+		callOpts = append(callOpts, llms.WithSreamCallBack(streamCallback(opts.StreamingFunc)))
+	}
+
+	answer, err := llm.Call(ctx, summary, callOpts...)
+	if err != nil {
+		return nil, err
 	}
+
+	return map[string]any{OutputKey: answer, APIRequestKey: req, APIResponseKey: resp}, nil
 }
 
-// Name implements llmchain.Chain
-func (c *APIChain) GetName() string {
-	return c.name
+// request generate the request by llm and send it, return the summary prompt of response.
+func (c *APIChain) request(ctx context.Context, llm llms.LLM, question string, options ...llms.CallOption) (*APIRequest, string, string, error) {
+
+	p, err := c.reqTempl.Render(prompts.H{`Input`: question})
+	if err != nil {
+		return nil, ``, ``, fmt.Errorf(`chain '%s': %v`, c.name, err)
+	}
+
+	//since we have api req prompt, send to llm to get truely req
+	reqStr, err := llm.Call(ctx, p, options...)
+	if err != nil {
+		return nil, ``, ``, err
+	}
+
+	req, err := ParseAPIRequest(reqStr)
+	if err != nil {
+		return nil, ``, ``, fmt.Errorf(`chain '%s': %v`, c.name, err)
+	}
+
+	//send real req with http client
+	respStr, err := c.Send(ctx, req)
+	if err != nil {
+		return req, ``, ``, fmt.Errorf(`chain '%s': %w`, c.name, err)
+	}
+
+	sp, err := c.respTempl.Render(prompts.H{`Input`: question, `Request`: req.String(), `APIResp`: respStr})
+	if err != nil {
+		return req, respStr, ``, fmt.Errorf(`chain '%s': %v`, c.name, err)
+	}
+
+	return req, respStr, sp, nil
 }
 
 // ChatPrompt implements llmchain.Chain,考虑到message是多轮对话，我们这里应该只是对最后一个User的问题进行转化。但是这样可能，导致之前对历史问题丢失上下文。
 // 这里当前处置手段是，当前的默认策略为：
 // 将当前对话转化为：历史原始问题+历史答案，+封装后的最后的问题
-func (*APIChain) ChatPrompt(ctx context.Context, messages []schema.Message) ([]schema.Message, error) {
-	panic("unimplemented")
+func (c *APIChain) ChatPrompt(ctx context.Context, messages []schema.Message) ([]schema.Message, error) {
+
+	if c.l == nil {
+		return nil, fmt.Errorf(`chain '%s': no model`, c.name)
+	}
+
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role != `user` {
+			continue
+		}
+
+		_, _, summary, err := c.request(ctx, c.l, messages[i].Content)
+		if err != nil {
+			return nil, err
+		}
+
+		ret := append([]schema.Message{}, messages...)
+		ret[i].Content = summary
+		return ret, nil
+	}
+
+	return nil, fmt.Errorf(`chain '%s': no user message`, c.name)
 }
 
-// Prompt implements llmchain.Chain
-func (*APIChain) Prompt(input string) string {
-	panic("unimplemented")
+// Prompt implements llmchain.Chain, return the prompt of generating api request.
+func (c *APIChain) Prompt(input string) string {
+
+	p, err := c.reqTempl.Render(prompts.H{`Input`: input})
+	if err != nil {
+		return input
+	}
+	return p
 }
 
 // Prompt implements llmchain.Chain
-func (c *APIChain) PromptArgs(args map[string]string) (string, error) {
+func (c *APIChain) PromptArgs(args prompts.H) (string, error) {
 
-	//input should be APIdocs and Question
+	if c.l == nil {
+		return ``, fmt.Errorf(`chain '%s': no model`, c.name)
+	}
 
-	p, err := c.reqTempl.Render(args)
-	if err != nil {
+	input, ok := args[`Input`].(string)
+	if !ok {
+		return ``, fmt.Errorf(`chain '%s': field 'Input' not set`, c.name)
+	}
 
+	_, _, sp, err := c.request(context.Background(), c.l, input)
+	if err != nil {
 		return "", err
 	}
 
 	//since we have api req prompt, send to llm to get truely req
-	reqStr, err := c.l.Call(context.Background(), p)
+	return c.l.Call(context.Background(), sp)
+}
+
+// Send validate req and send it to the allowed domains, the response is truncated to
+// MaxResponseBytes. The non 2xx response is returned with its status, so llm knows the failure.
+func (c *APIChain) Send(ctx context.Context, req *APIRequest) (string, error) {
+
+	if c.Validator != nil {
+		if err := c.Validator(req); err != nil {
+			return ``, fmt.Errorf(`invalid api request: %w`, err)
+		}
+	}
 
+	client := http.DefaultClient
+	if c.client != nil {
+		client = c.client
+	}
+
+	httpReq, err := http.NewRequest(req.Method, req.URL, strings.NewReader(req.Body))
 	if err != nil {
+		return ``, err
+	}
 
-		return "", err
+	if !domainAllowed(httpReq.URL, c.AllowedDomains) {
+		return ``, fmt.Errorf(`%w: '%s', allowed: %v`, ErrDomainNotAllowed, httpReq.URL.Host, c.AllowedDomains)
 	}
 
-	//send real req with http client
-	respStr, err := c.sendReqWithHttpClient(reqStr)
+	// redirects are checked by the allowlist too.
+	cl := *client
+	cl.CheckRedirect = func(r *http.Request, via []*http.Request) error {
+		if !domainAllowed(r.URL, c.AllowedDomains) {
+			return fmt.Errorf(`%w: redirect to '%s'`, ErrDomainNotAllowed, r.URL.Host)
+		}
+		if client.CheckRedirect != nil {
+			return client.CheckRedirect(r, via)
+		}
+		if len(via) >= 10 {
+			return errors.New(`stopped after 10 redirects`)
+		}
+		return nil
+	}
 
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+	httpReq = httpReq.WithContext(ctx)
+
+	for k, v := range req.Headers {
+		httpReq.Header.Set(k, v)
+	}
+	for k, v := range c.Headers {
+		httpReq.Header.Set(k, v)
+	}
+
+	resp, err := cl.Do(httpReq)
 	if err != nil {
+		return ``, err
+	}
+	defer resp.Body.Close()
 
-		return "", err
+	limit := c.MaxResponseBytes
+	if limit <= 0 {
+		limit = 64 << 10
 	}
 
-	sp, err := c.respTempl.Render(prompts.H{`Request`: reqStr, `APIResp`: respStr})
+	data, truncated, err := readLimited(resp.Body, limit)
 	if err != nil {
+		return ``, err
+	}
 
-		return "", err
+	ret := string(data)
+	if truncated {
+		ret += "\n...(truncated)"
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		ret = fmt.Sprintf("HTTP %s\n%s", resp.Status, ret)
 	}
 
-	//since we have api req prompt, send to llm to get truely req
-	return c.l.Call(context.Background(), sp)
+	return ret, nil
 }
 
 // WithLLM implements llmchain.Chain
-func (c *APIChain) sendReqWithHttpClient(req string) (string, error) {
-	if c.client == nil {
-		c.client = http.DefaultClient
+func (c *APIChain) WithLLM(llm llms.LLM) {
+	c.l = llm
+}
+
+// WithHTTPClient set the client sending requests, the redirects are checked by AllowedDomains too.
+func (c *APIChain) WithHTTPClient(client *http.Client) *APIChain {
+	c.client = client
+	return c
+}
+
+// WithMemory set memory of chain, return the chain.
+func (c *APIChain) WithMemory(memory schema.Memory) *APIChain {
+	c.memory = memory
+	return c
+}
+
+// apiChainParameters the ChainDef.Parameters of APIChain.
+type apiChainParameters struct {
+	Docs             string            `yaml:"docs"`
+	AllowedDomains   []string          `yaml:"allowed_domains,omitempty"`
+	Headers          map[string]string `yaml:"headers,omitempty"`
+	Timeout          time.Duration     `yaml:"timeout,omitempty"`
+	MaxResponseBytes int64             `yaml:"max_response_bytes,omitempty"`
+}
+
+// Def implements Definer.
+func (c *APIChain) Def() (*ChainDef, error) {
+
+	mem, err := memoryConfig(c.memory)
+	if err != nil {
+		return nil, err
 	}
 
-	//todo parse reqstring to real url and data
-	return `ok`, nil
+	params := map[string]any{`docs`: c.docs}
+	if len(c.AllowedDomains) > 0 {
+		params[`allowed_domains`] = c.AllowedDomains
+	}
+	if len(c.Headers) > 0 {
+		params[`headers`] = c.Headers
+	}
+	if c.Timeout > 0 {
+		params[`timeout`] = c.Timeout.String()
+	}
+	if c.MaxResponseBytes > 0 {
+		params[`max_response_bytes`] = c.MaxResponseBytes
+	}
 
+	def := &ChainDef{Name: c.name, Type: APIChainType, Memory: mem, Parameters: params}
+	if c.l != nil {
+		def.Model = c.l.Name()
+	}
+	return def, nil
 }
 
-// WithLLM implements llmchain.Chain
-func (c *APIChain) WithLLM(llm llms.LLM) {
-	c.l = llm
+func init() {
+	RegisterChainType(APIChainType, func(def *ChainDef, llm llms.LLM) (Chain, error) {
+
+		params := apiChainParameters{}
+		if err := def.DecodeParameters(&params); err != nil {
+			return nil, err
+		}
+		if params.Docs == `` {
+			return nil, fmt.Errorf(`parameters: docs is required`)
+		}
+
+		mem, err := def.BuildMemory()
+		if err != nil {
+			return nil, err
+		}
+
+		c := NewAPIChain(def.Name, params.Docs).WithMemory(mem)
+		c.l = llm
+		if len(params.AllowedDomains) > 0 {
+			c.AllowedDomains = params.AllowedDomains
+		}
+		c.Headers = params.Headers
+		if params.Timeout > 0 {
+			c.Timeout = params.Timeout
+		}
+		if params.MaxResponseBytes > 0 {
+			c.MaxResponseBytes = params.MaxResponseBytes
+		}
+		return c, nil
+	})
 }
 
 const apiReqTemplate = `You are given the below API Documentation:
-%s
+{{.APIDocs}}
 Using this documentation, generate the full request to call for answering the user question.
 You should build the API request in order to get a response that is as short as possible, while still getting the necessary information to answer the question. Pay attention to deliberately exclude any unnecessary pieces of data in the API call.
+Respond with the full url for GET requests, or a JSON object of "method", "url", "headers" and "body" for other methods.
 
 Question:{{.Input}}
 API request:`
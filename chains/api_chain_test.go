@@ -0,0 +1,123 @@
+package chains_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/nexptr/llmchain/chains"
+	"github.com/nexptr/llmchain/llms"
+)
+
+// apiLLM return the request on first call, and the summary prompt on the next calls.
+type apiLLM struct {
+	nameLLM
+	request string
+	prompts []string
+}
+
+func (l *apiLLM) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	l.prompts = append(l.prompts, prompt)
+	if len(l.prompts) == 1 {
+		return l.request, nil
+	}
+	return prompt, nil
+}
+
+func TestAPIChain(t *testing.T) {
+
+	var body, apiKey string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		body = string(data)
+		apiKey = r.Header.Get(`X-API-Key`)
+		switch r.URL.Path {
+		case `/weather`:
+			io.WriteString(w, `{"city":"`+r.URL.Query().Get(`city`)+`","temp":21}`)
+		case `/large`:
+			io.WriteString(w, strings.Repeat(`x`, 100))
+		default:
+			http.Error(w, `not found`, http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	docs := "BASE URL: " + ts.URL + "\nGET /weather?city=<city> return the weather of city."
+
+	newChain := func(request string) (*chains.APIChain, *apiLLM) {
+		llm := &apiLLM{nameLLM: nameLLM{`m`}, request: request}
+		c := chains.NewAPIChain(`weather`, docs)
+		c.WithLLM(llm)
+		c.Headers = map[string]string{`X-API-Key`: `secret`}
+		return c, llm
+	}
+
+	t.Run(`get`, func(t *testing.T) {
+		c, llm := newChain(ts.URL + `/weather?city=Paris`)
+
+		if p := c.Prompt(`weather of Paris?`); !strings.Contains(p, docs) || !strings.Contains(p, `Question:weather of Paris?`) {
+			t.Fatalf(`unexpected prompt %s`, p)
+		}
+
+		out, err := chains.Call(context.Background(), c, map[string]any{chains.InputKey: `weather of Paris?`})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if resp := out[chains.APIResponseKey]; resp != `{"city":"Paris","temp":21}` {
+			t.Fatalf(`unexpected response %v`, resp)
+		}
+		if apiKey != `secret` {
+			t.Fatalf(`header not sent: %q`, apiKey)
+		}
+		summary := out[chains.OutputKey].(string)
+		if len(llm.prompts) != 2 || !strings.Contains(summary, `{"city":"Paris","temp":21}`) || !strings.HasSuffix(summary, `Summary:`) {
+			t.Fatalf(`unexpected summary prompt %s`, summary)
+		}
+	})
+
+	t.Run(`post`, func(t *testing.T) {
+		c, _ := newChain("```json\n{\"method\":\"POST\",\"url\":\"" + ts.URL + "/missing\",\"body\":\"{\\\"a\\\":1}\"}\n```")
+
+		out, err := chains.Call(context.Background(), c, map[string]any{chains.InputKey: `post it`})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if body != `{"a":1}` {
+			t.Fatalf(`unexpected body %q`, body)
+		}
+		// the failure is passed to llm to summarize.
+		if resp := out[chains.APIResponseKey].(string); !strings.HasPrefix(resp, `HTTP 404 Not Found`) {
+			t.Fatalf(`unexpected response %q`, resp)
+		}
+	})
+
+	t.Run(`domain not allowed`, func(t *testing.T) {
+		c, llm := newChain(`http://evil.example.com/weather?city=Paris`)
+
+		_, err := chains.Call(context.Background(), c, map[string]any{chains.InputKey: `weather of Paris?`})
+		if !errors.Is(err, chains.ErrDomainNotAllowed) {
+			t.Fatalf(`unexpected error %v`, err)
+		}
+		if len(llm.prompts) != 1 {
+			t.Fatalf(`summary should not be called`)
+		}
+	})
+
+	t.Run(`truncated`, func(t *testing.T) {
+		c, _ := newChain(ts.URL + `/large`)
+		c.MaxResponseBytes = 10
+
+		out, err := chains.Call(context.Background(), c, map[string]any{chains.InputKey: `large`})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp := out[chains.APIResponseKey]; resp != "xxxxxxxxxx\n...(truncated)" {
+			t.Fatalf(`unexpected response %q`, resp)
+		}
+	})
+}
@@ -0,0 +1,201 @@
+package chains
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// APIRequest the http request generated by llm for APIChain.
+type APIRequest struct {
+	Method  string            `json:"method"`
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body,omitempty"`
+}
+
+// String return the request as `METHOD URL`, used by the summary prompt.
+func (r *APIRequest) String() string {
+	if r.Body == `` {
+		return r.Method + ` ` + r.URL
+	}
+	return r.Method + ` ` + r.URL + "\n\n" + r.Body
+}
+
+var (
+	codeFence   = regexp.MustCompile("(?s)^```[a-zA-Z]*\\s*\n?(.*?)\\s*```$")
+	httpMethods = map[string]bool{
+		http.MethodGet: true, http.MethodPost: true, http.MethodPut: true,
+		http.MethodPatch: true, http.MethodDelete: true, http.MethodHead: true,
+	}
+)
+
+// ParseAPIRequest parse the request generated by llm, which is one of:
+//
+//	https://api.example.com/weather?city=Paris
+//
+//	POST https://api.example.com/orders
+//	Content-Type: application/json
+//
+//	{"item": "book"}
+//
+//	{"method": "POST", "url": "https://api.example.com/orders", "headers": {}, "body": {"item": "book"}}
+func ParseAPIRequest(text string) (*APIRequest, error) {
+
+	text = strings.TrimSpace(text)
+	if m := codeFence.FindStringSubmatch(text); m != nil {
+		text = strings.TrimSpace(m[1])
+	}
+
+	if text == `` {
+		return nil, fmt.Errorf(`empty api request`)
+	}
+
+	var (
+		req *APIRequest
+		err error
+	)
+
+	if strings.HasPrefix(text, `{`) {
+		req, err = parseJSONRequest(text)
+	} else {
+		req, err = parseTextRequest(text)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	req.Method = strings.ToUpper(req.Method)
+	if req.Method == `` {
+		req.Method = http.MethodGet
+	}
+	if !httpMethods[req.Method] {
+		return nil, fmt.Errorf(`unsupported method '%s'`, req.Method)
+	}
+
+	u, err := url.Parse(req.URL)
+	if err != nil {
+		return nil, fmt.Errorf(`invalid url '%s': %v`, req.URL, err)
+	}
+	if u.Scheme != `http` && u.Scheme != `https` || u.Host == `` {
+		return nil, fmt.Errorf(`invalid url '%s': absolute http(s) url is required`, req.URL)
+	}
+
+	return req, nil
+}
+
+func parseJSONRequest(text string) (*APIRequest, error) {
+
+	raw := struct {
+		Method  string            `json:"method"`
+		URL     string            `json:"url"`
+		Headers map[string]string `json:"headers"`
+		Body    json.RawMessage   `json:"body"`
+	}{}
+
+	if err := json.Unmarshal([]byte(text), &raw); err != nil {
+		return nil, fmt.Errorf(`invalid json api request: %v`, err)
+	}
+
+	req := &APIRequest{Method: raw.Method, URL: raw.URL, Headers: raw.Headers}
+
+	// body of string or JSON value
+	if len(raw.Body) > 0 && string(raw.Body) != `null` {
+		s := ``
+		if json.Unmarshal(raw.Body, &s) == nil {
+			req.Body = s
+		} else {
+			req.Body = string(raw.Body)
+			if req.Headers == nil {
+				req.Headers = map[string]string{}
+			}
+			if _, ok := req.Headers[`Content-Type`]; !ok {
+				req.Headers[`Content-Type`] = `application/json`
+			}
+		}
+	}
+
+	return req, nil
+}
+
+func parseTextRequest(text string) (*APIRequest, error) {
+
+	head, body, _ := strings.Cut(strings.ReplaceAll(text, "\r\n", "\n"), "\n\n")
+	lines := strings.Split(head, "\n")
+
+	req := &APIRequest{Body: strings.TrimSpace(body)}
+
+	fields := strings.Fields(lines[0])
+	switch len(fields) {
+	case 1:
+		req.URL = fields[0]
+	case 2, 3: // METHOD URL [HTTP/1.1]
+		req.Method, req.URL = fields[0], fields[1]
+	default:
+		return nil, fmt.Errorf(`invalid api request line '%s'`, lines[0])
+	}
+
+	for _, line := range lines[1:] {
+		k, v, ok := strings.Cut(line, `:`)
+		if !ok {
+			return nil, fmt.Errorf(`invalid api request header '%s'`, line)
+		}
+		if req.Headers == nil {
+			req.Headers = map[string]string{}
+		}
+		req.Headers[http.CanonicalHeaderKey(strings.TrimSpace(k))] = strings.TrimSpace(v)
+	}
+
+	return req, nil
+}
+
+// urlPattern the urls in api docs.
+var urlPattern = regexp.MustCompile(`https?://[^\s/"'<>()\x60]+`)
+
+// docsDomains return hosts of the urls in docs.
+func docsDomains(docs string) []string {
+
+	seen := map[string]bool{}
+	ret := []string{}
+	for _, s := range urlPattern.FindAllString(docs, -1) {
+		u, err := url.Parse(s)
+		if err != nil || u.Hostname() == `` || seen[u.Hostname()] {
+			continue
+		}
+		seen[u.Hostname()] = true
+		ret = append(ret, u.Hostname())
+	}
+	return ret
+}
+
+// domainAllowed report whether host of u is one of domains: the exact host, host:port, or the
+// sub domains of *.example.com
+func domainAllowed(u *url.URL, domains []string) bool {
+
+	host := strings.ToLower(u.Hostname())
+
+	for _, d := range domains {
+		d = strings.ToLower(d)
+		switch {
+		case d == host, d == strings.ToLower(u.Host):
+			return true
+		case strings.HasPrefix(d, `*.`) && strings.HasSuffix(host, d[1:]):
+			return true
+		}
+	}
+	return false
+}
+
+// readLimited read at most limit bytes of r, truncated reports whether r has more.
+func readLimited(r io.Reader, limit int64) (data []byte, truncated bool, err error) {
+
+	data, err = io.ReadAll(io.LimitReader(r, limit+1))
+	if int64(len(data)) > limit {
+		return data[:limit], true, err
+	}
+	return data, false, err
+}
@@ -2,6 +2,7 @@ package chains
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/nexptr/llmchain/llms"
 	"github.com/nexptr/llmchain/schema"
@@ -11,34 +12,94 @@ const (
 	BaseChatChain = `base_chat_chain`
 )
 
-// BaseChat base chat Lang chain,this chain just do nothing
+// BaseChat base chat Lang chain, the messages are passed to llm as is. The history messages loaded
+// from memory (configured to return messages) are prepended.
+//
+// inputs: InputKey the user input, MessagesKey optional []schema.Message of the chat request,
+// the user input is the only message if not set.
+// outputs: OutputKey the schema.Message answered.
 type BaseChat struct {
-	name string
+	name   string
+	llm    llms.LLM
+	memory schema.Memory
 }
 
 // Chat implements Chain.
-func (*BaseChat) Chat(ctx context.Context, inputs map[string]any, options ...ChainCallOption) (map[string]any, error) {
-	panic("unimplemented")
+func (c *BaseChat) Chat(ctx context.Context, inputs map[string]any, options ...ChainCallOption) (map[string]any, error) {
+
+	opts := initChainCallOptions(options...)
+
+	llm := c.llm
+	if llm == nil {
+		llm = opts.LLM
+	}
+	if llm == nil {
+		return nil, fmt.Errorf(`chain '%s': no model`, c.name)
+	}
+
+	messages, err := c.messages(inputs)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := llm.Chat(ctx, &schema.ChatRequest{Model: llm.Name(), Messages: messages, Stop: opts.StopWords})
+	if err != nil {
+		return nil, err
+	}
+	if resp == nil || len(resp.Choices) == 0 || resp.Choices[0].Message == nil {
+		return nil, fmt.Errorf(`chain '%s': model '%s' returned empty response`, c.name, llm.Name())
+	}
+
+	return map[string]any{OutputKey: *resp.Choices[0].Message}, nil
+}
+
+// messages return the history of memory and the messages of inputs.
+func (c *BaseChat) messages(inputs map[string]any) ([]schema.Message, error) {
+
+	messages := []schema.Message{}
+
+	if c.memory != nil {
+		for _, k := range c.memory.MemoryVariables() {
+			if history, ok := inputs[k].([]schema.Message); ok {
+				messages = append(messages, history...)
+			}
+		}
+	}
+
+	switch v := inputs[MessagesKey].(type) {
+	case []schema.Message:
+		return append(messages, v...), nil
+	case nil:
+	default:
+		return nil, fmt.Errorf(`chain '%s': input '%s' is %T, expect []schema.Message`, c.name, MessagesKey, v)
+	}
+
+	input, ok := inputs[InputKey].(string)
+	if !ok {
+		return nil, fmt.Errorf(`chain '%s': input '%s' is %T, expect string`, c.name, InputKey, inputs[InputKey])
+	}
+
+	return append(messages, schema.BuildUserMessage(input)), nil
 }
 
 // GetInputKeys implements Chain.
 func (*BaseChat) GetInputKeys() []string {
-	panic("unimplemented")
+	return []string{InputKey}
 }
 
 // GetMemory implements Chain.
-func (*BaseChat) GetMemory() schema.Memory {
-	panic("unimplemented")
+func (c *BaseChat) GetMemory() schema.Memory {
+	return c.memory
 }
 
 // GetName implements Chain.
-func (*BaseChat) GetName() string {
-	panic("unimplemented")
+func (c *BaseChat) GetName() string {
+	return c.name
 }
 
 // GetOutputKeys implements Chain.
 func (*BaseChat) GetOutputKeys() []string {
-	panic("unimplemented")
+	return []string{OutputKey}
 }
 
 var _ Chain = &BaseChat{}
@@ -48,6 +109,38 @@ func NewBaseChatChain() *BaseChat {
 	return &BaseChat{name: `base_chat_chain`}
 }
 
+// WithMemory set memory of chain, return the chain.
+func (c *BaseChat) WithMemory(memory schema.Memory) *BaseChat {
+	c.memory = memory
+	return c
+}
+
+// Def implements Definer.
+func (c *BaseChat) Def() (*ChainDef, error) {
+
+	mem, err := memoryConfig(c.memory)
+	if err != nil {
+		return nil, err
+	}
+
+	def := &ChainDef{Name: c.name, Type: BaseChatChain, Memory: mem}
+	if c.llm != nil {
+		def.Model = c.llm.Name()
+	}
+	return def, nil
+}
+
+func init() {
+	RegisterChainType(BaseChatChain, func(def *ChainDef, llm llms.LLM) (Chain, error) {
+
+		mem, err := def.BuildMemory()
+		if err != nil {
+			return nil, err
+		}
+		return &BaseChat{name: def.Name, llm: llm, memory: mem}, nil
+	})
+}
+
 // Prompt implements llmchain.Chain args key:input
 func (*BaseChat) Prompt(input string) string {
 	//do nothing
@@ -60,9 +153,9 @@ func (c *BaseChat) Name() string {
 	return c.name
 }
 
-// WithLLM implements llmchain.Chain
-func (*BaseChat) WithLLM(llm llms.LLM) {
-	//do nothing
+// WithLLM bind llm to chain, the model of WithModel is used if not bound.
+func (c *BaseChat) WithLLM(llm llms.LLM) {
+	c.llm = llm
 }
 
 // ChatPrompt implements llmchain.Chain
@@ -77,9 +170,9 @@ func (*BaseChat) ChatPrompt(ctx context.Context, messages []schema.Message) ([]s
 }
 
 // PromptArgs implements llmchain.Chain
-func (*BaseChat) PromptArgs(args map[string]string) (string, error) {
+func (*BaseChat) PromptArgs(args map[string]any) (string, error) {
 
-	input, ok := args[`input`]
+	input, ok := args[`input`].(string)
 
 	if !ok {
 		//TODO
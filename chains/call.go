@@ -0,0 +1,124 @@
+package chains
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// Call run chain with inputs, it's the way to run chains instead of Chain.Chat:
+//
+//  1. the input keys of chain, except the memory variables, must be set;
+//  2. the variables of memory are loaded with inputs, inputs take precedence;
+//  3. the output keys of chain must be returned;
+//  4. the inputs and outputs are saved to memory.
+func Call(ctx context.Context, chain Chain, inputs map[string]any, options ...ChainCallOption) (map[string]any, error) {
+
+	opts := initChainCallOptions(options...)
+
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+
+	memory := chain.GetMemory()
+
+	provided := map[string]bool{}
+	for k := range inputs {
+		provided[k] = true
+	}
+	if memory != nil {
+		for _, k := range memory.MemoryVariables() {
+			provided[k] = true
+		}
+	}
+	if missing := missingKeys(chain.GetInputKeys(), provided); len(missing) > 0 {
+		return nil, fmt.Errorf(`chain '%s': missing input keys %v`, chain.GetName(), missing)
+	}
+
+	full := inputs
+	if memory != nil {
+		vars, err := memory.LoadMemoryVariables(inputs)
+		if err != nil {
+			return nil, fmt.Errorf(`chain '%s': load memory: %v`, chain.GetName(), err)
+		}
+		full = make(map[string]any, len(inputs)+len(vars))
+		for k, v := range vars {
+			full[k] = v
+		}
+		for k, v := range inputs {
+			full[k] = v
+		}
+	}
+
+	outputs, err := chain.Chat(ctx, full, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	returned := map[string]bool{}
+	for k := range outputs {
+		returned[k] = true
+	}
+	if missing := missingKeys(chain.GetOutputKeys(), returned); len(missing) > 0 {
+		return nil, fmt.Errorf(`chain '%s': missing output keys %v`, chain.GetName(), missing)
+	}
+
+	if memory != nil {
+		if err := memory.SaveContext(inputs, outputs); err != nil {
+			return nil, fmt.Errorf(`chain '%s': save memory: %v`, chain.GetName(), err)
+		}
+	}
+
+	return outputs, nil
+}
+
+// Run call chain of single input (except the memory variables) and single output of string.
+func Run(ctx context.Context, chain Chain, input any, options ...ChainCallOption) (string, error) {
+
+	memVars := map[string]bool{}
+	if memory := chain.GetMemory(); memory != nil {
+		for _, k := range memory.MemoryVariables() {
+			memVars[k] = true
+		}
+	}
+
+	keys := []string{}
+	for _, k := range chain.GetInputKeys() {
+		if !memVars[k] {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) != 1 {
+		return ``, fmt.Errorf(`chain '%s': Run expects single input key, got %v`, chain.GetName(), keys)
+	}
+
+	outputKeys := chain.GetOutputKeys()
+	if len(outputKeys) != 1 {
+		return ``, fmt.Errorf(`chain '%s': Run expects single output key, got %v`, chain.GetName(), outputKeys)
+	}
+
+	outputs, err := Call(ctx, chain, map[string]any{keys[0]: input}, options...)
+	if err != nil {
+		return ``, err
+	}
+
+	out, ok := outputs[outputKeys[0]].(string)
+	if !ok {
+		return ``, fmt.Errorf(`chain '%s': output '%s' is %T, not string`, chain.GetName(), outputKeys[0], outputs[outputKeys[0]])
+	}
+	return out, nil
+}
+
+func missingKeys(keys []string, present map[string]bool) []string {
+
+	missing := []string{}
+	for _, k := range keys {
+		if !present[k] {
+			missing = append(missing, k)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
@@ -0,0 +1,111 @@
+package chains_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nexptr/llmchain/chains"
+	"github.com/nexptr/llmchain/memory"
+	"github.com/nexptr/llmchain/schema"
+)
+
+// echoLLM answer the contents of chat messages joined by |
+type echoLLM struct {
+	nameLLM
+	req *schema.ChatRequest
+}
+
+func (l *echoLLM) Chat(ctx context.Context, req *schema.ChatRequest) (*schema.ChatResponse, error) {
+	l.req = req
+	contents := []string{}
+	for _, m := range req.Messages {
+		contents = append(contents, m.Content)
+	}
+	msg := schema.BuildAIMessage(strings.Join(contents, `|`))
+	return &schema.ChatResponse{Choices: []schema.Choice{{Message: &msg}}}, nil
+}
+
+// keysChain return outputs of keys, the value is the inputs seen.
+type keysChain struct {
+	memory  schema.Memory
+	outputs []string
+}
+
+func (c *keysChain) GetName() string { return `keys` }
+
+func (c *keysChain) GetMemory() schema.Memory { return c.memory }
+
+func (c *keysChain) GetInputKeys() []string { return []string{`question`, `history`} }
+
+func (c *keysChain) GetOutputKeys() []string { return []string{`answer`} }
+
+func (c *keysChain) Chat(ctx context.Context, inputs map[string]any, options ...chains.ChainCallOption) (map[string]any, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		return nil, errors.New(`no deadline`)
+	}
+	ret := map[string]any{}
+	for _, k := range c.outputs {
+		ret[k] = inputs[`history`].(string) + `>` + inputs[`question`].(string)
+	}
+	return ret, nil
+}
+
+func TestCall(t *testing.T) {
+
+	ctx := context.Background()
+	mem := memory.NewBuffer(memory.Config{InputKey: `question`, OutputKey: `answer`})
+	c := &keysChain{memory: mem, outputs: []string{`answer`}}
+
+	// history is provided by memory.
+	out, err := chains.Call(ctx, c, map[string]any{`question`: `q1`}, chains.WithTimeout(time.Second))
+	if err != nil || out[`answer`] != `>q1` {
+		t.Fatalf(`unexpected outputs %v: %v`, out, err)
+	}
+
+	answer, err := chains.Run(ctx, c, `q2`, chains.WithTimeout(time.Second))
+	if err != nil || answer != "Human: q1\nAI: >q1>q2" {
+		t.Fatalf(`unexpected answer %q: %v`, answer, err)
+	}
+
+	if _, err := chains.Call(ctx, &keysChain{}, map[string]any{`question`: `q`}); err == nil || !strings.Contains(err.Error(), `missing input keys [history]`) {
+		t.Fatalf(`unexpected error %v`, err)
+	}
+
+	c.outputs = []string{`result`}
+	if _, err := chains.Call(ctx, c, map[string]any{`question`: `q`}, chains.WithTimeout(time.Second)); err == nil || !strings.Contains(err.Error(), `missing output keys [answer]`) {
+		t.Fatalf(`unexpected error %v`, err)
+	}
+	if len(mem.Messages()) != 4 {
+		t.Fatalf(`failed call is saved to memory: %v`, mem.Messages())
+	}
+}
+
+func TestBaseChat(t *testing.T) {
+
+	ctx := context.Background()
+	llm := &echoLLM{nameLLM: nameLLM{`echo`}}
+
+	c := chains.NewBaseChatChain().WithMemory(memory.NewBuffer(memory.Config{ReturnMessages: true}))
+
+	if _, err := chains.Call(ctx, c, map[string]any{chains.InputKey: `hi`}); err == nil {
+		t.Fatal(`expect error of no model`)
+	}
+
+	out, err := chains.Call(ctx, c, map[string]any{chains.InputKey: `hi`}, chains.WithModel(llm), chains.WithStopWords([]string{`</s>`}))
+	if err != nil || out[chains.OutputKey].(schema.Message).Content != `hi` || llm.req.Stop[0] != `</s>` {
+		t.Fatalf(`unexpected outputs %v: %v`, out, err)
+	}
+
+	// the history of memory is prepended to messages.
+	c.WithLLM(llm)
+	out, err = chains.Call(ctx, c, map[string]any{
+		chains.InputKey:    `again`,
+		chains.MessagesKey: []schema.Message{{Role: `system`, Content: `sys`}, schema.BuildUserMessage(`again`)},
+	})
+	if err != nil || out[chains.OutputKey].(schema.Message).Content != `hi|hi|sys|again` {
+		t.Fatalf(`unexpected outputs %v: %v`, out, err)
+	}
+}
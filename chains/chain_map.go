@@ -15,6 +15,11 @@ func RegChain(c Chain) {
 
 }
 
+// UnregChain remove the Chain of name.
+func UnregChain(name string) {
+	delete(chainsMap, name)
+}
+
 // Get return Chain by name
 func GetChain(name string) (Chain, bool) {
 
@@ -1,9 +1,87 @@
 package chains_test
 
 import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
 	"testing"
+
+	"github.com/nexptr/llmchain/chains"
+	"github.com/nexptr/llmchain/llms"
+	"github.com/nexptr/llmchain/outputparsers"
+	"github.com/nexptr/llmchain/prompts"
+	"github.com/nexptr/llmchain/schema"
 )
 
+// promptLLM answer the prompt in upper case, the chunks are streamed word by word.
+type promptLLM struct {
+	nameLLM
+	prompts []string
+	options llms.CallOptions
+}
+
+func (l *promptLLM) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+
+	l.prompts = append(l.prompts, prompt)
+	l.options = llms.InitCallOptions(options...)
+
+	answer := strings.ToUpper(prompt)
+	if l.options.CallBackFn != nil {
+		for _, w := range strings.SplitAfter(answer, ` `) {
+			l.options.CallBackFn(&schema.ChatResponse{Choices: []schema.Choice{{Delta: &schema.Message{Content: w}}}}, false, nil)
+		}
+		l.options.CallBackFn(nil, true, nil)
+	}
+	return answer, nil
+}
+
 func TestLLMChain_Run(t *testing.T) {
 
+	ctx := context.Background()
+	llm := &promptLLM{nameLLM: nameLLM{`upper`}}
+
+	prompt, _ := prompts.New(`colors like {{.color}}`)
+	c := chains.NewLLMChain(llm, prompt)
+
+	chunks := []string{}
+	out, err := chains.Run(ctx, c, `red`, chains.WithStopWords([]string{`\n`}), chains.WithStreamingFunc(func(chunk string) {
+		chunks = append(chunks, chunk)
+	}))
+	if err != nil || out != `COLORS LIKE RED` {
+		t.Fatalf(`unexpected output %q: %v`, out, err)
+	}
+	if !reflect.DeepEqual(llm.options.StopWords, []string{`\n`}) {
+		t.Fatalf(`stop words not propagated: %v`, llm.options.StopWords)
+	}
+	if !reflect.DeepEqual(chunks, []string{`COLORS `, `LIKE `, `RED`}) {
+		t.Fatalf(`unexpected chunks %q`, chunks)
+	}
+
+	// the output is parsed, and the format instructions are filled.
+	prompt, _ = prompts.New("colors like {{.color}}, {{.format_instructions}}")
+	c = chains.NewLLMChain(llm, prompt)
+	c.OutputKey = `colors`
+	c.OutputParser = outputparsers.Any[[]string](outputparsers.CommaSeparatedList{})
+
+	if keys := c.GetInputKeys(); !reflect.DeepEqual(keys, []string{`color`}) {
+		t.Fatalf(`unexpected input keys %v`, keys)
+	}
+
+	outs, err := c.Apply(ctx, []map[string]any{{`color`: `red`}, {`color`: `blue`}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if colors := outs[1][`colors`].([]string); colors[0] != `COLORS LIKE BLUE` || !strings.HasPrefix(colors[1], `YOUR RESPONSE SHOULD BE A LIST`) {
+		t.Fatalf(`unexpected outputs %v`, outs)
+	}
+
+	prompt, _ = prompts.New(`{{.color}}`)
+	c = chains.NewLLMChain(llm, prompt)
+	c.OutputParser = outputparsers.Any[bool](outputparsers.Boolean{})
+	_, err = c.Apply(ctx, []map[string]any{{`color`: `yes`}, {`color`: `red`}})
+	var perr *outputparsers.ParseError
+	if !errors.As(err, &perr) || !strings.HasPrefix(err.Error(), `inputs[1]: chain 'llm_chain'`) {
+		t.Fatalf(`unexpected error %v`, err)
+	}
 }
@@ -2,18 +2,29 @@ package chains
 
 import (
 	"context"
+	"time"
 
+	"github.com/nexptr/llmchain/llms"
 	"github.com/nexptr/llmchain/schema"
 )
 
 // H is a shortcut for map[string]string
 type H = map[string]string
 
+const (
+	// InputKey is the default input key of chains, the raw user input string.
+	InputKey = `input`
+	// MessagesKey carries the []schema.Message of a chat request.
+	MessagesKey = `messages`
+	// OutputKey is the default output key of chains.
+	OutputKey = `output`
+)
+
 // Chain is the interface all chains must implement.
 type Chain interface {
 	GetName() string
 	// Chat runs the logic of the chain and returns the output. This method should
-	// not be called directly. Use rather the Chat function that handles the memory
+	// not be called directly. Use rather the Call function that handles the memory
 	// of the chain.
 	Chat(ctx context.Context, inputs map[string]any, options ...ChainCallOption) (map[string]any, error)
 	// GetMemory gets the memory of the chain.
@@ -29,6 +40,24 @@ type ChainCallOption func(*chainCallOptions)
 
 type chainCallOptions struct {
 	StopWords []string
+
+	// LLM the model resolved for current request, chains without a bound llm use it.
+	LLM llms.LLM
+
+	// Timeout of the call, applied by Call.
+	Timeout time.Duration
+
+	// StreamingFunc receive the chunks of llm output.
+	StreamingFunc func(chunk string)
+}
+
+// initChainCallOptions return the options applied.
+func initChainCallOptions(options ...ChainCallOption) chainCallOptions {
+	opts := chainCallOptions{}
+	for _, fn := range options {
+		fn(&opts)
+	}
+	return opts
 }
 
 // WithStopWords is a ChainCallOption that can be used to set the stop words of the chain.
@@ -37,3 +66,24 @@ func WithStopWords(stopWords []string) ChainCallOption {
 		options.StopWords = stopWords
 	}
 }
+
+// WithTimeout is a ChainCallOption that set the timeout of the call.
+func WithTimeout(timeout time.Duration) ChainCallOption {
+	return func(options *chainCallOptions) {
+		options.Timeout = timeout
+	}
+}
+
+// WithStreamingFunc is a ChainCallOption that stream the chunks of llm output to fn.
+func WithStreamingFunc(fn func(chunk string)) ChainCallOption {
+	return func(options *chainCallOptions) {
+		options.StreamingFunc = fn
+	}
+}
+
+// WithModel is a ChainCallOption that set the llm used by the chain for this call.
+func WithModel(llm llms.LLM) ChainCallOption {
+	return func(options *chainCallOptions) {
+		options.LLM = llm
+	}
+}
@@ -0,0 +1,101 @@
+package chains
+
+import (
+	"fmt"
+
+	"github.com/nexptr/llmchain/llms"
+	"github.com/nexptr/llmchain/prompts"
+	"github.com/nexptr/llmchain/schema"
+	"github.com/nexptr/llmchain/tokenizer"
+)
+
+const (
+	// InputDocumentsKey the input of []schema.Document combined by the document chains.
+	InputDocumentsKey = `input_documents`
+
+	// DocumentVariable the variable of prompts filled by the document content by default.
+	DocumentVariable = `context`
+)
+
+// inputDocuments return the documents of inputs.
+func inputDocuments(name string, inputs map[string]any) ([]schema.Document, error) {
+
+	docs, ok := inputs[InputDocumentsKey].([]schema.Document)
+	if !ok {
+		return nil, fmt.Errorf(`chain '%s': input '%s' is %T, expect []schema.Document`, name, InputDocumentsKey, inputs[InputDocumentsKey])
+	}
+	if len(docs) == 0 {
+		return nil, fmt.Errorf(`chain '%s': no documents`, name)
+	}
+	return docs, nil
+}
+
+// promptInputKeys return InputDocumentsKey and the variables of templates, except the filled ones.
+func promptInputKeys(filled []string, templates ...*prompts.Template) []string {
+
+	skip := map[string]bool{InputDocumentsKey: true}
+	for _, k := range filled {
+		skip[k] = true
+	}
+
+	ret := []string{InputDocumentsKey}
+	for _, t := range templates {
+		if t == nil {
+			continue
+		}
+		for _, v := range t.Variables() {
+			if !skip[v] {
+				skip[v] = true
+				ret = append(ret, v)
+			}
+		}
+	}
+	return ret
+}
+
+// renderWith render tmpl with the variables of inputs used, vars take precedence.
+func renderWith(tmpl *prompts.Template, inputs map[string]any, vars prompts.H) (string, error) {
+
+	data := prompts.H{}
+	for _, k := range tmpl.Variables() {
+		if v, ok := vars[k]; ok {
+			data[k] = v
+		} else if v, ok := inputs[k]; ok {
+			data[k] = v
+		}
+	}
+	return tmpl.Render(data)
+}
+
+// documentBudget return the tokens left for document of tmpl rendered with vars, which fill the
+// document empty, within maxTokens (default 3000). It fails if no tokens left.
+func documentBudget(tk tokenizer.Tokenizer, tmpl *prompts.Template, inputs map[string]any, vars prompts.H, maxTokens int) (int, error) {
+
+	empty, err := renderWith(tmpl, inputs, vars)
+	if err != nil {
+		return 0, err
+	}
+
+	if maxTokens <= 0 {
+		maxTokens = 3000
+	}
+
+	n := tk.Count(empty)
+	if n >= maxTokens {
+		return 0, fmt.Errorf(`prompt of %d tokens leaves no tokens for documents within MaxTokens %d`, n, maxTokens)
+	}
+	return maxTokens - n, nil
+}
+
+// llmCallOptions return the options of LLM.Call, the chunks are streamed if stream.
+func llmCallOptions(base []llms.CallOption, opts chainCallOptions, stream bool) []llms.CallOption {
+
+	ret := append([]llms.CallOption{}, base...)
+	if len(opts.StopWords) > 0 {
+		ret = append(ret, llms.WithStopWords(opts.StopWords))
+	}
+	if stream && opts.StreamingFunc != nil {
+		ret = append(ret, llms.WithSreamCallBack(streamCallback(opts.StreamingFunc)))
+	}
+	return ret
+}
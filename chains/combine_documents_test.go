@@ -0,0 +1,210 @@
+package chains_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nexptr/llmchain/chains"
+	"github.com/nexptr/llmchain/llms"
+	"github.com/nexptr/llmchain/prompts"
+	"github.com/nexptr/llmchain/schema"
+)
+
+// reduceLLM answer `map: X` by m(X), `collapse: X` by the number of parts of X, and `combine: X`
+// by final[X]. It fails on the prompt of fail.
+type reduceLLM struct {
+	nameLLM
+	fail string
+
+	mu       sync.Mutex
+	inflight int
+	max      int
+}
+
+func (l *reduceLLM) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+
+	l.mu.Lock()
+	l.inflight++
+	if l.inflight > l.max {
+		l.max = l.inflight
+	}
+	l.mu.Unlock()
+
+	defer func() {
+		l.mu.Lock()
+		l.inflight--
+		l.mu.Unlock()
+	}()
+
+	time.Sleep(5 * time.Millisecond)
+
+	if prompt == l.fail {
+		return ``, errors.New(`boom`)
+	}
+
+	verb, text, _ := strings.Cut(prompt, `: `)
+	switch verb {
+	case `map`:
+		return `m(` + text + `)`, nil
+	case `collapse`:
+		return fmt.Sprintf(`c%d`, len(strings.Split(text, "\n\n"))), nil
+	}
+	return `final[` + text + `]`, nil
+}
+
+func TestMapReduceDocumentsChain(t *testing.T) {
+
+	ctx := context.Background()
+
+	docs := []schema.Document{}
+	for i := 0; i < 8; i++ {
+		docs = append(docs, schema.Document{PageContent: fmt.Sprintf(`d%d`, i)})
+	}
+
+	newChain := func(llm llms.LLM) *chains.MapReduceDocumentsChain {
+		c := chains.NewMapReduceDocumentsChain(llm)
+		c.MapPrompt = prompts.PromptTemplate(`map: {{.context}}`, `context`)
+		c.CollapsePrompt = prompts.PromptTemplate(`collapse: {{.context}}`, `context`)
+		c.CombinePrompt = prompts.PromptTemplate(`combine: {{.context}}`, `context`)
+		c.MaxTokens = 10
+		c.MaxConcurrency = 3
+		c.ReturnIntermediateSteps = true
+		return c
+	}
+
+	llm := &reduceLLM{nameLLM: nameLLM{`reduce`}}
+	c := newChain(llm)
+
+	out, err := chains.Call(ctx, c, map[string]any{chains.InputDocumentsKey: docs})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 8 results of 5 chars exceed the budget, collapsed by groups of 4.
+	if out[chains.OutputKey] != "final[c4\n\nc4]" {
+		t.Fatalf(`unexpected output %q`, out[chains.OutputKey])
+	}
+	want := []string{`m(d0)`, `m(d1)`, `m(d2)`, `m(d3)`, `m(d4)`, `m(d5)`, `m(d6)`, `m(d7)`}
+	if steps := out[chains.IntermediateStepsKey]; !reflect.DeepEqual(steps, want) {
+		t.Fatalf(`unexpected steps %v`, steps)
+	}
+	if llm.max > 3 {
+		t.Fatalf(`%d calls in parallel, expect at most 3`, llm.max)
+	}
+
+	c = newChain(&reduceLLM{nameLLM: nameLLM{`reduce`}, fail: `map: d3`})
+	if _, err := chains.Call(ctx, c, map[string]any{chains.InputDocumentsKey: docs}); err == nil ||
+		err.Error() != `chain 'map_reduce_documents_chain': map: documents[3]: boom` {
+		t.Fatalf(`unexpected error %v`, err)
+	}
+
+	if _, err := chains.Call(ctx, c, map[string]any{chains.InputDocumentsKey: `text`}); err == nil ||
+		err.Error() != `chain 'map_reduce_documents_chain': input 'input_documents' is string, expect []schema.Document` {
+		t.Fatalf(`unexpected error %v`, err)
+	}
+}
+
+func TestMapReduceDocumentsChain_Budget(t *testing.T) {
+
+	ctx := context.Background()
+	llm := &reduceLLM{nameLLM: nameLLM{`reduce`}}
+
+	// the prompts exceed MaxTokens.
+	c := chains.NewMapReduceDocumentsChain(llm)
+	c.MaxTokens = 8
+	docs := []schema.Document{{PageContent: `d0`}, {PageContent: `d1`}}
+	if _, err := chains.Call(ctx, c, map[string]any{chains.InputDocumentsKey: docs}); err == nil ||
+		!strings.Contains(err.Error(), `leaves no tokens for documents within MaxTokens 8`) {
+		t.Fatalf(`unexpected error %v`, err)
+	}
+
+	// the document exceeding MapPrompt is truncated to 8 tokens of 32 chars.
+	c = chains.NewMapReduceDocumentsChain(llm)
+	c.MapPrompt = prompts.PromptTemplate(`map: {{.context}}`, `context`)
+	c.CombinePrompt = prompts.PromptTemplate(`{{.context}}`, `context`)
+	c.MaxTokens = 10
+	c.ReturnIntermediateSteps = true
+
+	docs = []schema.Document{{PageContent: strings.Repeat(`x`, 100)}}
+	out, err := chains.Call(ctx, c, map[string]any{chains.InputDocumentsKey: docs})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{`m(` + strings.Repeat(`x`, 32) + `)`}
+	if steps := out[chains.IntermediateStepsKey]; !reflect.DeepEqual(steps, want) {
+		t.Fatalf(`unexpected steps %v`, steps)
+	}
+}
+
+func TestRefineDocumentsChain(t *testing.T) {
+
+	ctx := context.Background()
+	llm := &promptLLM{nameLLM: nameLLM{`upper`}}
+
+	c := chains.NewRefineDocumentsChain(nil)
+	c.InitialPrompt = prompts.PromptTemplate(`{{.question}} {{.context}}`, `question`, `context`)
+	c.RefinePrompt = prompts.PromptTemplate(`refine {{.existing_answer}} with {{.context}}`, `existing_answer`, `context`)
+	c.ReturnIntermediateSteps = true
+
+	if keys := c.GetInputKeys(); !reflect.DeepEqual(keys, []string{chains.InputDocumentsKey, `question`}) {
+		t.Fatalf(`unexpected input keys %v`, keys)
+	}
+
+	docs := []schema.Document{{PageContent: `a`}, {PageContent: `b`}, {PageContent: `c`}}
+
+	chunks := []string{}
+	out, err := chains.Call(ctx, c, map[string]any{chains.InputDocumentsKey: docs, `question`: `sum`},
+		chains.WithModel(llm), chains.WithStreamingFunc(func(chunk string) { chunks = append(chunks, chunk) }))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{`SUM A`, `REFINE SUM A WITH B`, `REFINE REFINE SUM A WITH B WITH C`}
+	if out[chains.OutputKey] != want[2] || !reflect.DeepEqual(out[chains.IntermediateStepsKey], want) {
+		t.Fatalf(`unexpected outputs %v`, out)
+	}
+	// only the last call streams.
+	if strings.Join(chunks, ``) != want[2] {
+		t.Fatalf(`unexpected chunks %q`, chunks)
+	}
+
+	c.LLM = &failLLM{}
+	if _, err := chains.Call(ctx, c, map[string]any{chains.InputDocumentsKey: docs, `question`: `sum`}); err == nil ||
+		err.Error() != `chain 'refine_documents_chain': documents[0]: boom` {
+		t.Fatalf(`unexpected error %v`, err)
+	}
+}
+
+func TestRefineDocumentsChain_Budget(t *testing.T) {
+
+	ctx := context.Background()
+	llm := &promptLLM{nameLLM: nameLLM{`upper`}}
+
+	c := chains.NewRefineDocumentsChain(llm)
+	c.InitialPrompt = prompts.PromptTemplate(`{{.context}}`, `context`)
+	c.RefinePrompt = prompts.PromptTemplate(`{{.existing_answer}} {{.context}}`, `existing_answer`, `context`)
+	c.MaxTokens = 4
+
+	// the document is truncated to 4 tokens of 16 chars.
+	docs := []schema.Document{{PageContent: strings.Repeat(`x`, 40)}}
+	out, err := chains.Call(ctx, c, map[string]any{chains.InputDocumentsKey: docs})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if llm.prompts[0] != strings.Repeat(`x`, 16) || out[chains.OutputKey] != strings.Repeat(`X`, 16) {
+		t.Fatalf(`unexpected prompts %q, output %v`, llm.prompts, out[chains.OutputKey])
+	}
+
+	// the answer leaves no tokens for the next document.
+	docs = append(docs, schema.Document{PageContent: `y`})
+	if _, err := chains.Call(ctx, c, map[string]any{chains.InputDocumentsKey: docs}); err == nil ||
+		err.Error() != `chain 'refine_documents_chain': documents[1]: prompt of 5 tokens leaves no tokens for documents within MaxTokens 4` {
+		t.Fatalf(`unexpected error %v`, err)
+	}
+}
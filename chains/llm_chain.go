@@ -0,0 +1,254 @@
+package chains
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/nexptr/llmchain/llms"
+	"github.com/nexptr/llmchain/outputparsers"
+	"github.com/nexptr/llmchain/prompts"
+	"github.com/nexptr/llmchain/schema"
+)
+
+const (
+	// LLMChainType the type of LLMChain in ChainDef.
+	LLMChainType = `llm_chain`
+
+	// FormatInstructionsKey the variable of prompt filled by the format instructions of output parser.
+	FormatInstructionsKey = `format_instructions`
+)
+
+// LLMChain render Prompt with inputs and call LLM, the output is parsed by OutputParser if set.
+//
+//	prompt, _ := prompts.New("Name 3 colors like {{.color}}.\n{{.format_instructions}}")
+//	c := chains.NewLLMChain(llm, prompt)
+//	c.OutputParser = outputparsers.Any[[]string](outputparsers.CommaSeparatedList{})
+//	out, err := chains.Call(ctx, c, map[string]any{`color`: `red`})
+type LLMChain struct {
+	name string
+
+	Prompt *prompts.Template
+	// LLM the model of chain, the model of WithModel is used if nil.
+	LLM llms.LLM
+	// OutputKey the key of output, default OutputKey.
+	OutputKey string
+	// OutputParser parse the output, the text is returned if nil.
+	OutputParser outputparsers.OutputParser[any]
+	// CallOptions the options of LLM.Call, example: llms.WithTemperature
+	CallOptions []llms.CallOption
+
+	memory schema.Memory
+}
+
+var _ Chain = &LLMChain{}
+
+// NewLLMChain return chain of prompt and llm.
+func NewLLMChain(llm llms.LLM, prompt *prompts.Template) *LLMChain {
+	return &LLMChain{name: LLMChainType, LLM: llm, Prompt: prompt, OutputKey: OutputKey}
+}
+
+// WithName set the name of chain, return the chain.
+func (c *LLMChain) WithName(name string) *LLMChain {
+	c.name = name
+	return c
+}
+
+// WithMemory set memory of chain, return the chain.
+func (c *LLMChain) WithMemory(memory schema.Memory) *LLMChain {
+	c.memory = memory
+	return c
+}
+
+// GetName implements Chain.
+func (c *LLMChain) GetName() string {
+	return c.name
+}
+
+// GetMemory implements Chain.
+func (c *LLMChain) GetMemory() schema.Memory {
+	return c.memory
+}
+
+// GetInputKeys implements Chain, the variables of prompt, except the format instructions filled by
+// the output parser.
+func (c *LLMChain) GetInputKeys() []string {
+
+	ret := []string{}
+	for _, v := range c.Prompt.Variables() {
+		if v == FormatInstructionsKey && c.OutputParser != nil {
+			continue
+		}
+		ret = append(ret, v)
+	}
+	return ret
+}
+
+// GetOutputKeys implements Chain.
+func (c *LLMChain) GetOutputKeys() []string {
+	return []string{c.outputKey()}
+}
+
+func (c *LLMChain) outputKey() string {
+	if c.OutputKey == `` {
+		return OutputKey
+	}
+	return c.OutputKey
+}
+
+// Chat implements Chain.
+func (c *LLMChain) Chat(ctx context.Context, inputs map[string]any, options ...ChainCallOption) (map[string]any, error) {
+
+	opts := initChainCallOptions(options...)
+
+	llm := c.LLM
+	if llm == nil {
+		llm = opts.LLM
+	}
+	if llm == nil {
+		return nil, fmt.Errorf(`chain '%s': no model`, c.name)
+	}
+
+	prompt, err := c.render(inputs)
+	if err != nil {
+		return nil, fmt.Errorf(`chain '%s': %v`, c.name, err)
+	}
+
+	callOpts := append([]llms.CallOption{}, c.CallOptions...)
+	if len(opts.StopWords) > 0 {
+		callOpts = append(callOpts, llms.WithStopWords(opts.StopWords))
+	}
+	if opts.StreamingFunc != nil {
+		callOpts = append(callOpts, llms.WithSreamCallBack(streamCallback(opts.StreamingFunc)))
+	}
+
+	text, err := llm.Call(ctx, prompt, callOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.OutputParser == nil {
+		return map[string]any{c.outputKey(): text}, nil
+	}
+
+	var out any
+	if p, ok := c.OutputParser.(outputparsers.ContextParser[any]); ok {
+		out, err = p.ParseContext(ctx, text)
+	} else {
+		out, err = c.OutputParser.Parse(text)
+	}
+	if err != nil {
+		return nil, fmt.Errorf(`chain '%s': %w`, c.name, err)
+	}
+
+	return map[string]any{c.outputKey(): out}, nil
+}
+
+// render the prompt with the variables of inputs, other inputs like memory variables not used are ignored.
+func (c *LLMChain) render(inputs map[string]any) (string, error) {
+
+	vars := prompts.H{}
+	for _, k := range c.Prompt.Variables() {
+		if v, ok := inputs[k]; ok {
+			vars[k] = v
+		}
+	}
+
+	if _, ok := vars[FormatInstructionsKey]; !ok && c.OutputParser != nil {
+		for _, k := range c.Prompt.Variables() {
+			if k == FormatInstructionsKey {
+				vars[k] = c.OutputParser.FormatInstructions()
+			}
+		}
+	}
+
+	return c.Prompt.Render(vars)
+}
+
+// streamCallback pass the content of chunks to fn.
+func streamCallback(fn func(chunk string)) schema.SreamCallBack {
+	return func(res *schema.ChatResponse, done bool, err error) {
+		if done || res == nil {
+			return
+		}
+		for _, choice := range res.Choices {
+			if choice.Delta != nil && choice.Delta.Content != `` {
+				fn(choice.Delta.Content)
+			}
+		}
+	}
+}
+
+// Apply call chain with every inputs in order, the outputs are returned in the same order.
+func (c *LLMChain) Apply(ctx context.Context, inputs []map[string]any, options ...ChainCallOption) ([]map[string]any, error) {
+
+	ret := make([]map[string]any, 0, len(inputs))
+	for i, in := range inputs {
+		out, err := Call(ctx, c, in, options...)
+		if err != nil {
+			return nil, fmt.Errorf(`inputs[%d]: %w`, i, err)
+		}
+		ret = append(ret, out)
+	}
+	return ret, nil
+}
+
+// llmChainParameters the ChainDef.Parameters of LLMChain.
+type llmChainParameters struct {
+	OutputKey string `yaml:"output_key"`
+}
+
+// Def implements Definer, the output parser and call options are not serialized.
+func (c *LLMChain) Def() (*ChainDef, error) {
+
+	if c.OutputParser != nil {
+		return nil, fmt.Errorf(`output parser can not be serialized`)
+	}
+
+	prompt, err := prompts.DefOf(c.Prompt)
+	if err != nil {
+		return nil, err
+	}
+
+	mem, err := memoryConfig(c.memory)
+	if err != nil {
+		return nil, err
+	}
+
+	def := &ChainDef{Name: c.name, Type: LLMChainType, Prompt: prompt, Memory: mem}
+	if c.LLM != nil {
+		def.Model = c.LLM.Name()
+	}
+	if key := c.outputKey(); key != OutputKey {
+		def.Parameters = map[string]any{`output_key`: key}
+	}
+	return def, nil
+}
+
+func init() {
+	RegisterChainType(LLMChainType, func(def *ChainDef, llm llms.LLM) (Chain, error) {
+
+		if def.Prompt == nil {
+			return nil, fmt.Errorf(`prompt is required`)
+		}
+		prompt, err := buildTemplate(def.Prompt)
+		if err != nil {
+			return nil, fmt.Errorf(`prompt: %v`, err)
+		}
+
+		params := llmChainParameters{}
+		if err := def.DecodeParameters(&params); err != nil {
+			return nil, err
+		}
+
+		mem, err := def.BuildMemory()
+		if err != nil {
+			return nil, err
+		}
+
+		c := NewLLMChain(llm, prompt).WithName(def.Name).WithMemory(mem)
+		if params.OutputKey != `` {
+			c.OutputKey = params.OutputKey
+		}
+		return c, nil
+	})
+}
@@ -0,0 +1,180 @@
+package chains
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/nexptr/llmchain/llms"
+	"github.com/nexptr/llmchain/memory"
+	"github.com/nexptr/llmchain/prompts"
+	"github.com/nexptr/llmchain/schema"
+	"github.com/nexptr/llmchain/utils"
+	"gopkg.in/yaml.v3"
+)
+
+// ChainDef the serialized form of chains, the chain is built by the builder registered for Type.
+//
+//	name: weather
+//	type: api_chain
+//	model: gpt-3.5-turbo
+//	memory:
+//	  window: 5
+//	parameters:
+//	  docs: ...
+type ChainDef struct {
+	Name string `yaml:"name" json:"name"`
+	Type string `yaml:"type" json:"type"`
+	// Model name or alias of the model, the model of call options is used if empty.
+	Model string `yaml:"model,omitempty" json:"model,omitempty"`
+	// Prompt of chains rendering a prompt.
+	Prompt *prompts.PromptDef `yaml:"prompt,omitempty" json:"prompt,omitempty"`
+	// Memory of chain, no memory if nil.
+	Memory *memory.Config `yaml:"memory,omitempty" json:"memory,omitempty"`
+	// Parameters the settings of chain type.
+	Parameters map[string]any `yaml:"parameters,omitempty" json:"parameters,omitempty"`
+}
+
+// Definer the chain which can be serialized by Save.
+type Definer interface {
+	Def() (*ChainDef, error)
+}
+
+// ChainBuilder build chain of def, llm is the model of def.Model, nil if not set.
+type ChainBuilder func(def *ChainDef, llm llms.LLM) (Chain, error)
+
+var chainBuilders = struct {
+	sync.RWMutex
+	m map[string]ChainBuilder
+}{m: map[string]ChainBuilder{}}
+
+// RegisterChainType register builder of chain type, the same type is replaced.
+func RegisterChainType(typ string, builder ChainBuilder) {
+	chainBuilders.Lock()
+	defer chainBuilders.Unlock()
+	chainBuilders.m[typ] = builder
+}
+
+// ChainTypes return the sorted registered chain types.
+func ChainTypes() []string {
+
+	chainBuilders.RLock()
+	defer chainBuilders.RUnlock()
+
+	ret := make([]string, 0, len(chainBuilders.m))
+	for typ := range chainBuilders.m {
+		ret = append(ret, typ)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// Build return chain of d, the model is looked up in models by name or alias.
+func (d *ChainDef) Build(models map[string]llms.LLM) (Chain, error) {
+
+	if d.Name == `` {
+		return nil, fmt.Errorf(`chain name is required`)
+	}
+
+	chainBuilders.RLock()
+	builder, ok := chainBuilders.m[d.Type]
+	chainBuilders.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf(`chain '%s': unknown type '%s', registered: %v`, d.Name, d.Type, ChainTypes())
+	}
+
+	var llm llms.LLM
+	if d.Model != `` {
+		if llm, ok = models[d.Model]; !ok {
+			if llm, ok = models[llms.ResolveAlias(d.Model)]; !ok {
+				return nil, fmt.Errorf(`chain '%s': model '%s' not found`, d.Name, d.Model)
+			}
+		}
+	}
+
+	c, err := builder(d, llm)
+	if err != nil {
+		return nil, fmt.Errorf(`chain '%s': %v`, d.Name, err)
+	}
+	return c, nil
+}
+
+// BuildMemory return memory of d.Memory, nil if not set.
+func (d *ChainDef) BuildMemory() (schema.Memory, error) {
+	if d.Memory == nil {
+		return nil, nil
+	}
+	return memory.New(*d.Memory)
+}
+
+// DecodeParameters decode Parameters to out, which is a pointer of struct with yaml tags.
+func (d *ChainDef) DecodeParameters(out any) error {
+
+	b, err := yaml.Marshal(d.Parameters)
+	if err != nil {
+		return err
+	}
+	if err := yaml.Unmarshal(b, out); err != nil {
+		return fmt.Errorf(`parameters: %v`, err)
+	}
+	return nil
+}
+
+// buildTemplate return the template of def, the prompt must be of type prompts.PromptTypeTemplate.
+func buildTemplate(def *prompts.PromptDef) (*prompts.Template, error) {
+
+	p, err := def.Build()
+	if err != nil {
+		return nil, err
+	}
+	t, ok := p.(*prompts.Template)
+	if !ok {
+		return nil, fmt.Errorf(`expect type %s, got %T`, prompts.PromptTypeTemplate, p)
+	}
+	return t, nil
+}
+
+// memoryConfig return the config of m to serialize, nil if m is nil.
+func memoryConfig(m schema.Memory) (*memory.Config, error) {
+
+	if m == nil {
+		return nil, nil
+	}
+	cfg, ok := memory.ConfigOf(m)
+	if !ok {
+		return nil, fmt.Errorf(`memory %T can not be serialized`, m)
+	}
+	return &cfg, nil
+}
+
+// Save write chain to file as JSON (.json) or YAML, the chain must implement Definer.
+func Save(file string, chain Chain) error {
+
+	d, ok := chain.(Definer)
+	if !ok {
+		return fmt.Errorf(`chain '%s': %T can not be serialized`, chain.GetName(), chain)
+	}
+
+	def, err := d.Def()
+	if err != nil {
+		return fmt.Errorf(`chain '%s': %v`, chain.GetName(), err)
+	}
+
+	return utils.WriteFile(file, def)
+}
+
+// Load read chain definition of JSON (.json) or YAML file and build it with models.
+func Load(file string, models map[string]llms.LLM) (Chain, error) {
+
+	def := &ChainDef{}
+	if err := utils.ReadFile(file, def); err != nil {
+		return nil, err
+	}
+
+	c, err := def.Build(models)
+	if err != nil {
+		return nil, fmt.Errorf(`%s: %v`, file, err)
+	}
+	return c, nil
+}
@@ -0,0 +1,171 @@
+package chains_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/nexptr/llmchain/chains"
+	"github.com/nexptr/llmchain/llms"
+	"github.com/nexptr/llmchain/memory"
+	"github.com/nexptr/llmchain/prompts"
+	"github.com/nexptr/llmchain/schema"
+)
+
+// nameLLM a model only has name.
+type nameLLM struct {
+	name string
+}
+
+func (l *nameLLM) Name() string { return l.name }
+
+func (l *nameLLM) Free() {}
+
+func (l *nameLLM) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return ``, errors.New(`not implemented`)
+}
+
+func (l *nameLLM) Chat(ctx context.Context, req *schema.ChatRequest) (*schema.ChatResponse, error) {
+	return nil, errors.New(`not implemented`)
+}
+
+func (l *nameLLM) Completion(ctx context.Context, req *schema.CompletionRequest) (*schema.CompletionResponse, error) {
+	return nil, errors.New(`not implemented`)
+}
+
+func (l *nameLLM) Embeddings(ctx context.Context, req *schema.EmbeddingsRequest) (*schema.EmbeddingsResponse, error) {
+	return nil, errors.New(`not implemented`)
+}
+
+func TestSaveLoad(t *testing.T) {
+
+	dir := t.TempDir()
+	models := map[string]llms.LLM{`gpt-x`: &nameLLM{`gpt-x`}}
+
+	file := filepath.Join(dir, `weather.yaml`)
+	os.WriteFile(file, []byte(`
+name: weather
+type: api_chain
+model: gpt-x
+memory:
+  window: 3
+parameters:
+  docs: GET https://api.example.com/weather?city={city}
+`), 0o644)
+
+	c, err := chains.Load(file, models)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.GetName() != `weather` {
+		t.Fatalf(`unexpected name %s`, c.GetName())
+	}
+	if cfg, ok := memory.ConfigOf(c.GetMemory()); !ok || cfg.Window != 3 {
+		t.Fatalf(`unexpected memory %+v`, c.GetMemory())
+	}
+
+	// round trip by JSON
+	saved := filepath.Join(dir, `weather.json`)
+	if err := chains.Save(saved, c); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := chains.Load(saved, models)
+	if err != nil {
+		t.Fatal(err)
+	}
+	def, _ := loaded.(chains.Definer).Def()
+	if def.Type != chains.APIChainType || def.Model != `gpt-x` || def.Parameters[`docs`] != `GET https://api.example.com/weather?city={city}` || def.Memory.Window != 3 {
+		t.Fatalf(`unexpected definition %+v`, def)
+	}
+
+	prompt, _ := prompts.New(`Translate to {{.lang}}: {{.input}}`)
+	translate := chains.NewLLMChain(models[`gpt-x`], prompt).WithName(`translate`)
+	translate.OutputKey = `text`
+
+	saved = filepath.Join(dir, `translate.yaml`)
+	if err := chains.Save(saved, translate); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err = chains.Load(saved, models)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.GetName() != `translate` || !reflect.DeepEqual(loaded.GetInputKeys(), []string{`lang`, `input`}) || loaded.GetOutputKeys()[0] != `text` {
+		t.Fatalf(`unexpected chain %+v`, loaded)
+	}
+
+	cases := map[string]string{
+		"name: foo\ntype: unknown\n":                                `unknown type 'unknown'`,
+		"name: foo\ntype: api_chain\nmodel: missing\n":              `model 'missing' not found`,
+		"name: foo\ntype: api_chain\n":                              `docs is required`,
+		"name: foo\ntype: base_chat_chain\nmemory: {type: redis}\n": `unknown type 'redis'`,
+		"name: foo\ntype: llm_chain\nprompt: {type: chat}\n":        `expect type prompt`,
+	}
+	for conf, want := range cases {
+		os.WriteFile(file, []byte(conf), 0o644)
+		if _, err := chains.Load(file, models); err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf(`expect error %s, got %v`, want, err)
+		}
+	}
+}
+
+func TestLoad_DocumentChains(t *testing.T) {
+
+	dir := t.TempDir()
+	models := map[string]llms.LLM{`reduce`: &reduceLLM{nameLLM: nameLLM{`reduce`}}}
+
+	file := filepath.Join(dir, `summary.yaml`)
+	os.WriteFile(file, []byte(`
+name: summary
+type: map_reduce_documents_chain
+model: reduce
+prompt:
+  template: 'map: {{.text}}'
+parameters:
+  combine_prompt:
+    template: 'combine: {{.text}}'
+  document_variable: text
+  max_tokens: 100
+  return_intermediate_steps: true
+`), 0o644)
+
+	c, err := chains.Load(file, models)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	docs := []schema.Document{{PageContent: `a`}, {PageContent: `b`}}
+	out, err := chains.Call(context.Background(), c, map[string]any{chains.InputDocumentsKey: docs})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out[chains.OutputKey] != "final[m(a)\n\nm(b)]" || !reflect.DeepEqual(out[chains.IntermediateStepsKey], []string{`m(a)`, `m(b)`}) {
+		t.Fatalf(`unexpected outputs %v`, out)
+	}
+
+	os.WriteFile(file, []byte(`
+name: refine
+type: refine_documents_chain
+parameters:
+  refine_prompt:
+    template: '{{.answer}} {{.context}}'
+  answer_variable: answer
+`), 0o644)
+
+	c, err = chains.Load(file, models)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.GetName() != `refine` || !reflect.DeepEqual(c.GetInputKeys(), []string{chains.InputDocumentsKey}) {
+		t.Fatalf(`unexpected chain %+v`, c)
+	}
+
+	os.WriteFile(file, []byte("name: foo\ntype: refine_documents_chain\nparameters:\n  refine_prompt: {type: chat}\n"), 0o644)
+	if _, err := chains.Load(file, models); err == nil || !strings.Contains(err.Error(), `refine_prompt: expect type prompt`) {
+		t.Fatalf(`unexpected error %v`, err)
+	}
+}
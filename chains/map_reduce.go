@@ -0,0 +1,382 @@
+package chains
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/nexptr/llmchain/llms"
+	"github.com/nexptr/llmchain/prompts"
+	"github.com/nexptr/llmchain/schema"
+	"github.com/nexptr/llmchain/tokenizer"
+)
+
+// MapReduceDocumentsChainType the type of MapReduceDocumentsChain in ChainDef and its name by default.
+const MapReduceDocumentsChainType = `map_reduce_documents_chain`
+
+// MapReduceDocumentsChain run MapPrompt on every document concurrently, the results are collapsed
+// by CollapsePrompt recursively until they fit MaxTokens, then combined by CombinePrompt.
+//
+// inputs: InputDocumentsKey the []schema.Document, and the other variables of prompts.
+// outputs: OutputKey the combined text, IntermediateStepsKey the map results if ReturnIntermediateSteps.
+//
+//	c := chains.NewMapReduceDocumentsChain(llm)
+//	out, err := chains.Call(ctx, c, map[string]any{chains.InputDocumentsKey: docs})
+type MapReduceDocumentsChain struct {
+	name string
+
+	// LLM the model of chain, the model of WithModel is used if nil.
+	LLM llms.LLM
+	// MapPrompt rendered with every document as DocumentVariable, default prompts.SummaryPrompt.
+	MapPrompt *prompts.Template
+	// CombinePrompt rendered with the joined results as DocumentVariable, default prompts.SummaryPrompt.
+	CombinePrompt *prompts.Template
+	// CollapsePrompt rendered with groups of results not fit, CombinePrompt if nil.
+	CollapsePrompt *prompts.Template
+	// DocumentVariable the variable of prompts filled by document, default DocumentVariable.
+	DocumentVariable string
+	// MaxTokens the budget of prompts, the documents exceeding MapPrompt are truncated, default 3000.
+	MaxTokens int
+	// MaxConcurrency the number of llm calls in parallel, default 4.
+	MaxConcurrency int
+	// MaxCollapseDepth the times of collapse, default 5.
+	MaxCollapseDepth int
+	// Separator joins the results, default "\n\n".
+	Separator string
+	// ReturnIntermediateSteps return the map results as IntermediateStepsKey.
+	ReturnIntermediateSteps bool
+	// CallOptions the options of LLM.Call, example: llms.WithTemperature
+	CallOptions []llms.CallOption
+
+	memory schema.Memory
+}
+
+var _ Chain = &MapReduceDocumentsChain{}
+
+// NewMapReduceDocumentsChain return chain summarizing documents by llm, llm may be nil.
+func NewMapReduceDocumentsChain(llm llms.LLM) *MapReduceDocumentsChain {
+	return &MapReduceDocumentsChain{
+		name:             MapReduceDocumentsChainType,
+		LLM:              llm,
+		MapPrompt:        prompts.SummaryPrompt,
+		CombinePrompt:    prompts.SummaryPrompt,
+		DocumentVariable: DocumentVariable,
+		MaxTokens:        3000,
+		MaxConcurrency:   4,
+		MaxCollapseDepth: 5,
+		Separator:        "\n\n",
+	}
+}
+
+// WithName set the name of chain, return the chain.
+func (c *MapReduceDocumentsChain) WithName(name string) *MapReduceDocumentsChain {
+	c.name = name
+	return c
+}
+
+// WithMemory set memory of chain, return the chain.
+func (c *MapReduceDocumentsChain) WithMemory(memory schema.Memory) *MapReduceDocumentsChain {
+	c.memory = memory
+	return c
+}
+
+// GetName implements Chain.
+func (c *MapReduceDocumentsChain) GetName() string {
+	return c.name
+}
+
+// GetMemory implements Chain.
+func (c *MapReduceDocumentsChain) GetMemory() schema.Memory {
+	return c.memory
+}
+
+// GetInputKeys implements Chain.
+func (c *MapReduceDocumentsChain) GetInputKeys() []string {
+	return promptInputKeys([]string{c.documentVariable()}, c.MapPrompt, c.CombinePrompt, c.CollapsePrompt)
+}
+
+// GetOutputKeys implements Chain.
+func (c *MapReduceDocumentsChain) GetOutputKeys() []string {
+	if c.ReturnIntermediateSteps {
+		return []string{OutputKey, IntermediateStepsKey}
+	}
+	return []string{OutputKey}
+}
+
+func (c *MapReduceDocumentsChain) documentVariable() string {
+	if c.DocumentVariable == `` {
+		return DocumentVariable
+	}
+	return c.DocumentVariable
+}
+
+func (c *MapReduceDocumentsChain) separator() string {
+	if c.Separator == `` {
+		return "\n\n"
+	}
+	return c.Separator
+}
+
+// Chat implements Chain.
+func (c *MapReduceDocumentsChain) Chat(ctx context.Context, inputs map[string]any, options ...ChainCallOption) (map[string]any, error) {
+
+	opts := initChainCallOptions(options...)
+
+	llm := c.LLM
+	if llm == nil {
+		llm = opts.LLM
+	}
+	if llm == nil {
+		return nil, fmt.Errorf(`chain '%s': no model`, c.name)
+	}
+
+	docs, err := inputDocuments(c.name, inputs)
+	if err != nil {
+		return nil, err
+	}
+
+	tk := llms.TokenizerOf(llm)
+	budget, err := c.budget(tk, c.MapPrompt, inputs)
+	if err != nil {
+		return nil, fmt.Errorf(`chain '%s': map: %v`, c.name, err)
+	}
+
+	texts := make([]string, len(docs))
+	for i, d := range docs {
+		texts[i] = tokenizer.Truncate(tk, d.PageContent, budget)
+	}
+
+	callOpts := llmCallOptions(c.CallOptions, opts, false)
+
+	mapped, err := c.mapTexts(ctx, llm, c.MapPrompt, texts, inputs, callOpts)
+	if err != nil {
+		return nil, fmt.Errorf(`chain '%s': map: %w`, c.name, err)
+	}
+
+	collapsed, err := c.collapse(ctx, llm, tk, mapped, inputs, callOpts, 0)
+	if err != nil {
+		return nil, fmt.Errorf(`chain '%s': %w`, c.name, err)
+	}
+
+	prompt, err := renderWith(c.CombinePrompt, inputs, prompts.H{c.documentVariable(): strings.Join(collapsed, c.separator())})
+	if err != nil {
+		return nil, fmt.Errorf(`chain '%s': combine: %v`, c.name, err)
+	}
+
+	out, err := llm.Call(ctx, prompt, llmCallOptions(c.CallOptions, opts, true)...)
+	if err != nil {
+		return nil, fmt.Errorf(`chain '%s': combine: %w`, c.name, err)
+	}
+
+	ret := map[string]any{OutputKey: strings.TrimSpace(out)}
+	if c.ReturnIntermediateSteps {
+		ret[IntermediateStepsKey] = mapped
+	}
+	return ret, nil
+}
+
+// collapse the texts by groups until they fit the budget of CombinePrompt.
+func (c *MapReduceDocumentsChain) collapse(ctx context.Context, llm llms.LLM, tk tokenizer.Tokenizer, texts []string, inputs map[string]any, callOpts []llms.CallOption, depth int) ([]string, error) {
+
+	budget, err := c.budget(tk, c.CombinePrompt, inputs)
+	if err != nil {
+		return nil, fmt.Errorf(`combine: %v`, err)
+	}
+	if tk.Count(strings.Join(texts, c.separator())) <= budget {
+		return texts, nil
+	}
+
+	maxDepth := c.MaxCollapseDepth
+	if maxDepth <= 0 {
+		maxDepth = 5
+	}
+	if depth >= maxDepth {
+		return nil, fmt.Errorf(`collapse: results still exceed %d tokens after %d collapses`, budget, depth)
+	}
+
+	collapsePrompt := c.CollapsePrompt
+	if collapsePrompt == nil {
+		collapsePrompt = c.CombinePrompt
+	}
+
+	if budget, err = c.budget(tk, collapsePrompt, inputs); err != nil {
+		return nil, fmt.Errorf(`collapse: %v`, err)
+	}
+
+	groups := c.group(tk, texts, budget)
+
+	collapsed, err := c.mapTexts(ctx, llm, collapsePrompt, groups, inputs, callOpts)
+	if err != nil {
+		return nil, fmt.Errorf(`collapse: %w`, err)
+	}
+
+	return c.collapse(ctx, llm, tk, collapsed, inputs, callOpts, depth+1)
+}
+
+// budget return the tokens left for document of tmpl, it fails if no tokens left.
+func (c *MapReduceDocumentsChain) budget(tk tokenizer.Tokenizer, tmpl *prompts.Template, inputs map[string]any) (int, error) {
+	return documentBudget(tk, tmpl, inputs, prompts.H{c.documentVariable(): ``}, c.MaxTokens)
+}
+
+// group join texts in order as long as they fit budget, the text not fit alone is truncated.
+func (c *MapReduceDocumentsChain) group(tk tokenizer.Tokenizer, texts []string, budget int) []string {
+
+	sep := c.separator()
+
+	groups := []string{}
+	current := []string{}
+	for _, text := range texts {
+
+		if tk.Count(text) > budget {
+			text = tokenizer.Truncate(tk, text, budget)
+		}
+
+		if len(current) > 0 && tk.Count(strings.Join(append(current, text), sep)) > budget {
+			groups = append(groups, strings.Join(current, sep))
+			current = current[:0]
+		}
+		current = append(current, text)
+	}
+	if len(current) > 0 {
+		groups = append(groups, strings.Join(current, sep))
+	}
+	return groups
+}
+
+// mapTexts call llm with tmpl for every text by a pool of MaxConcurrency workers, the results are
+// in the order of texts. The first error cancels the others.
+func (c *MapReduceDocumentsChain) mapTexts(ctx context.Context, llm llms.LLM, tmpl *prompts.Template, texts []string, inputs map[string]any, callOpts []llms.CallOption) ([]string, error) {
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	workers := c.MaxConcurrency
+	if workers <= 0 {
+		workers = 4
+	}
+	if workers > len(texts) {
+		workers = len(texts)
+	}
+
+	var (
+		results  = make([]string, len(texts))
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+		jobs     = make(chan int)
+	)
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				out, err := c.mapText(ctx, llm, tmpl, texts[i], inputs, callOpts)
+				if err != nil {
+					once.Do(func() {
+						firstErr = fmt.Errorf(`documents[%d]: %w`, i, err)
+						cancel()
+					})
+					continue
+				}
+				results[i] = out
+			}
+		}()
+	}
+
+feed:
+	for i := range texts {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func (c *MapReduceDocumentsChain) mapText(ctx context.Context, llm llms.LLM, tmpl *prompts.Template, text string, inputs map[string]any, callOpts []llms.CallOption) (string, error) {
+
+	prompt, err := renderWith(tmpl, inputs, prompts.H{c.documentVariable(): text})
+	if err != nil {
+		return ``, err
+	}
+
+	out, err := llm.Call(ctx, prompt, callOpts...)
+	if err != nil {
+		return ``, err
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// mapReduceParameters the ChainDef.Parameters of MapReduceDocumentsChain, ChainDef.Prompt is the
+// MapPrompt.
+type mapReduceParameters struct {
+	CombinePrompt           *prompts.PromptDef `yaml:"combine_prompt"`
+	CollapsePrompt          *prompts.PromptDef `yaml:"collapse_prompt"`
+	DocumentVariable        string             `yaml:"document_variable"`
+	MaxTokens               int                `yaml:"max_tokens"`
+	MaxConcurrency          int                `yaml:"max_concurrency"`
+	MaxCollapseDepth        int                `yaml:"max_collapse_depth"`
+	Separator               string             `yaml:"separator"`
+	ReturnIntermediateSteps bool               `yaml:"return_intermediate_steps"`
+}
+
+func init() {
+	RegisterChainType(MapReduceDocumentsChainType, func(def *ChainDef, llm llms.LLM) (Chain, error) {
+
+		params := mapReduceParameters{}
+		if err := def.DecodeParameters(&params); err != nil {
+			return nil, err
+		}
+
+		mem, err := def.BuildMemory()
+		if err != nil {
+			return nil, err
+		}
+
+		c := NewMapReduceDocumentsChain(llm).WithName(def.Name).WithMemory(mem)
+		if def.Prompt != nil {
+			if c.MapPrompt, err = buildTemplate(def.Prompt); err != nil {
+				return nil, fmt.Errorf(`prompt: %v`, err)
+			}
+		}
+		if params.CombinePrompt != nil {
+			if c.CombinePrompt, err = buildTemplate(params.CombinePrompt); err != nil {
+				return nil, fmt.Errorf(`combine_prompt: %v`, err)
+			}
+		}
+		if params.CollapsePrompt != nil {
+			if c.CollapsePrompt, err = buildTemplate(params.CollapsePrompt); err != nil {
+				return nil, fmt.Errorf(`collapse_prompt: %v`, err)
+			}
+		}
+		if params.DocumentVariable != `` {
+			c.DocumentVariable = params.DocumentVariable
+		}
+		if params.MaxTokens > 0 {
+			c.MaxTokens = params.MaxTokens
+		}
+		if params.MaxConcurrency > 0 {
+			c.MaxConcurrency = params.MaxConcurrency
+		}
+		if params.MaxCollapseDepth > 0 {
+			c.MaxCollapseDepth = params.MaxCollapseDepth
+		}
+		if params.Separator != `` {
+			c.Separator = params.Separator
+		}
+		c.ReturnIntermediateSteps = params.ReturnIntermediateSteps
+		return c, nil
+	})
+}
@@ -0,0 +1,220 @@
+package chains
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/nexptr/llmchain/llms"
+	"github.com/nexptr/llmchain/prompts"
+	"github.com/nexptr/llmchain/schema"
+	"github.com/nexptr/llmchain/tokenizer"
+)
+
+const (
+	// RefineDocumentsChainType the type of RefineDocumentsChain in ChainDef and its name by default.
+	RefineDocumentsChainType = `refine_documents_chain`
+
+	// AnswerVariable the variable of refine prompt filled by the existing answer by default.
+	AnswerVariable = `existing_answer`
+)
+
+// RefineDocumentsChain answer by InitialPrompt with the first document, then refine the answer by
+// RefinePrompt with every next document in order.
+//
+// inputs: InputDocumentsKey the []schema.Document, and the other variables of prompts.
+// outputs: OutputKey the final answer, IntermediateStepsKey the answers of every document if
+// ReturnIntermediateSteps.
+type RefineDocumentsChain struct {
+	name string
+
+	// LLM the model of chain, the model of WithModel is used if nil.
+	LLM llms.LLM
+	// InitialPrompt rendered with the first document as DocumentVariable, default prompts.SummaryPrompt.
+	InitialPrompt *prompts.Template
+	// RefinePrompt rendered with the next document as DocumentVariable and the answer as
+	// AnswerVariable, default prompts.RefinePrompt.
+	RefinePrompt *prompts.Template
+	// DocumentVariable the variable of prompts filled by document, default DocumentVariable.
+	DocumentVariable string
+	// AnswerVariable the variable of RefinePrompt filled by answer, default AnswerVariable.
+	AnswerVariable string
+	// MaxTokens the budget of prompts, every document is truncated to the tokens left by the prompt
+	// with the answer, default 3000.
+	MaxTokens int
+	// ReturnIntermediateSteps return the answers of every document as IntermediateStepsKey.
+	ReturnIntermediateSteps bool
+	// CallOptions the options of LLM.Call, example: llms.WithTemperature
+	CallOptions []llms.CallOption
+
+	memory schema.Memory
+}
+
+var _ Chain = &RefineDocumentsChain{}
+
+// NewRefineDocumentsChain return chain refining the summary of documents by llm, llm may be nil.
+func NewRefineDocumentsChain(llm llms.LLM) *RefineDocumentsChain {
+	return &RefineDocumentsChain{
+		name:             RefineDocumentsChainType,
+		LLM:              llm,
+		InitialPrompt:    prompts.SummaryPrompt,
+		RefinePrompt:     prompts.RefinePrompt,
+		DocumentVariable: DocumentVariable,
+		AnswerVariable:   AnswerVariable,
+		MaxTokens:        3000,
+	}
+}
+
+// WithName set the name of chain, return the chain.
+func (c *RefineDocumentsChain) WithName(name string) *RefineDocumentsChain {
+	c.name = name
+	return c
+}
+
+// WithMemory set memory of chain, return the chain.
+func (c *RefineDocumentsChain) WithMemory(memory schema.Memory) *RefineDocumentsChain {
+	c.memory = memory
+	return c
+}
+
+// GetName implements Chain.
+func (c *RefineDocumentsChain) GetName() string {
+	return c.name
+}
+
+// GetMemory implements Chain.
+func (c *RefineDocumentsChain) GetMemory() schema.Memory {
+	return c.memory
+}
+
+// GetInputKeys implements Chain.
+func (c *RefineDocumentsChain) GetInputKeys() []string {
+	return promptInputKeys([]string{c.documentVariable(), c.answerVariable()}, c.InitialPrompt, c.RefinePrompt)
+}
+
+// GetOutputKeys implements Chain.
+func (c *RefineDocumentsChain) GetOutputKeys() []string {
+	if c.ReturnIntermediateSteps {
+		return []string{OutputKey, IntermediateStepsKey}
+	}
+	return []string{OutputKey}
+}
+
+func (c *RefineDocumentsChain) documentVariable() string {
+	if c.DocumentVariable == `` {
+		return DocumentVariable
+	}
+	return c.DocumentVariable
+}
+
+func (c *RefineDocumentsChain) answerVariable() string {
+	if c.AnswerVariable == `` {
+		return AnswerVariable
+	}
+	return c.AnswerVariable
+}
+
+// Chat implements Chain, only the last call streams.
+func (c *RefineDocumentsChain) Chat(ctx context.Context, inputs map[string]any, options ...ChainCallOption) (map[string]any, error) {
+
+	opts := initChainCallOptions(options...)
+
+	llm := c.LLM
+	if llm == nil {
+		llm = opts.LLM
+	}
+	if llm == nil {
+		return nil, fmt.Errorf(`chain '%s': no model`, c.name)
+	}
+
+	docs, err := inputDocuments(c.name, inputs)
+	if err != nil {
+		return nil, err
+	}
+
+	tk := llms.TokenizerOf(llm)
+
+	var answer string
+	steps := make([]string, 0, len(docs))
+	for i, d := range docs {
+
+		tmpl, vars := c.InitialPrompt, prompts.H{c.documentVariable(): ``}
+		if i > 0 {
+			tmpl = c.RefinePrompt
+			vars[c.answerVariable()] = answer
+		}
+
+		budget, err := documentBudget(tk, tmpl, inputs, vars, c.MaxTokens)
+		if err != nil {
+			return nil, fmt.Errorf(`chain '%s': documents[%d]: %v`, c.name, i, err)
+		}
+		vars[c.documentVariable()] = tokenizer.Truncate(tk, d.PageContent, budget)
+
+		prompt, err := renderWith(tmpl, inputs, vars)
+		if err != nil {
+			return nil, fmt.Errorf(`chain '%s': documents[%d]: %v`, c.name, i, err)
+		}
+
+		out, err := llm.Call(ctx, prompt, llmCallOptions(c.CallOptions, opts, i == len(docs)-1)...)
+		if err != nil {
+			return nil, fmt.Errorf(`chain '%s': documents[%d]: %w`, c.name, i, err)
+		}
+
+		answer = strings.TrimSpace(out)
+		steps = append(steps, answer)
+	}
+
+	ret := map[string]any{OutputKey: answer}
+	if c.ReturnIntermediateSteps {
+		ret[IntermediateStepsKey] = steps
+	}
+	return ret, nil
+}
+
+// refineParameters the ChainDef.Parameters of RefineDocumentsChain, ChainDef.Prompt is the
+// InitialPrompt.
+type refineParameters struct {
+	RefinePrompt            *prompts.PromptDef `yaml:"refine_prompt"`
+	DocumentVariable        string             `yaml:"document_variable"`
+	AnswerVariable          string             `yaml:"answer_variable"`
+	MaxTokens               int                `yaml:"max_tokens"`
+	ReturnIntermediateSteps bool               `yaml:"return_intermediate_steps"`
+}
+
+func init() {
+	RegisterChainType(RefineDocumentsChainType, func(def *ChainDef, llm llms.LLM) (Chain, error) {
+
+		params := refineParameters{}
+		if err := def.DecodeParameters(&params); err != nil {
+			return nil, err
+		}
+
+		mem, err := def.BuildMemory()
+		if err != nil {
+			return nil, err
+		}
+
+		c := NewRefineDocumentsChain(llm).WithName(def.Name).WithMemory(mem)
+		if def.Prompt != nil {
+			if c.InitialPrompt, err = buildTemplate(def.Prompt); err != nil {
+				return nil, fmt.Errorf(`prompt: %v`, err)
+			}
+		}
+		if params.RefinePrompt != nil {
+			if c.RefinePrompt, err = buildTemplate(params.RefinePrompt); err != nil {
+				return nil, fmt.Errorf(`refine_prompt: %v`, err)
+			}
+		}
+		if params.DocumentVariable != `` {
+			c.DocumentVariable = params.DocumentVariable
+		}
+		if params.AnswerVariable != `` {
+			c.AnswerVariable = params.AnswerVariable
+		}
+		if params.MaxTokens > 0 {
+			c.MaxTokens = params.MaxTokens
+		}
+		c.ReturnIntermediateSteps = params.ReturnIntermediateSteps
+		return c, nil
+	})
+}
@@ -0,0 +1,193 @@
+package chains
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/nexptr/llmchain/llms"
+	"github.com/nexptr/llmchain/prompts"
+	"github.com/nexptr/llmchain/schema"
+	"github.com/nexptr/llmchain/tokenizer"
+)
+
+const (
+	// RetrievalQAType the name of RetrievalQA by default.
+	RetrievalQAType = `retrieval_qa`
+
+	// SourceDocumentsKey the output of the []schema.Document the answer based on.
+	SourceDocumentsKey = `source_documents`
+)
+
+// RetrievalQA answer the question by the documents of Retriever: the page contents are stuffed into
+// Prompt as variable context within MaxTokens, the question is variable question.
+//
+// inputs: InputKey the question. outputs: OutputKey the answer, SourceDocumentsKey the documents
+// stuffed.
+//
+// The Retriever can not be serialized, so RetrievalQA has no ChainDef type, it is built in code
+// and registered by RegChain:
+//
+//	qa := chains.NewRetrievalQA(vstore.ToRetriever(store, 4), llm)
+//	chains.RegChain(qa.WithName(`docs`))
+type RetrievalQA struct {
+	name string
+
+	Retriever schema.Retriever
+	// LLM the model of chain, the model of WithModel is used if nil.
+	LLM llms.LLM
+	// Prompt with variables context and question, default prompts.QAPrompt.
+	Prompt *prompts.Template
+	// MaxTokens the budget of prompt, the documents not fit are dropped, default 3000.
+	MaxTokens int
+	// Separator joins the page contents, default "\n\n".
+	Separator string
+	// CallOptions the options of LLM.Call, example: llms.WithTemperature
+	CallOptions []llms.CallOption
+
+	memory schema.Memory
+}
+
+var _ Chain = &RetrievalQA{}
+
+// NewRetrievalQA return chain answering by the documents of retriever, llm may be nil.
+func NewRetrievalQA(retriever schema.Retriever, llm llms.LLM) *RetrievalQA {
+	return &RetrievalQA{
+		name:      RetrievalQAType,
+		Retriever: retriever,
+		LLM:       llm,
+		Prompt:    prompts.QAPrompt,
+		MaxTokens: 3000,
+		Separator: "\n\n",
+	}
+}
+
+// WithName set the name of chain, return the chain.
+func (c *RetrievalQA) WithName(name string) *RetrievalQA {
+	c.name = name
+	return c
+}
+
+// WithMemory set memory of chain, return the chain.
+func (c *RetrievalQA) WithMemory(memory schema.Memory) *RetrievalQA {
+	c.memory = memory
+	return c
+}
+
+// GetName implements Chain.
+func (c *RetrievalQA) GetName() string {
+	return c.name
+}
+
+// GetMemory implements Chain.
+func (c *RetrievalQA) GetMemory() schema.Memory {
+	return c.memory
+}
+
+// GetInputKeys implements Chain.
+func (c *RetrievalQA) GetInputKeys() []string {
+	return []string{InputKey}
+}
+
+// GetOutputKeys implements Chain.
+func (c *RetrievalQA) GetOutputKeys() []string {
+	return []string{OutputKey, SourceDocumentsKey}
+}
+
+// Chat implements Chain.
+func (c *RetrievalQA) Chat(ctx context.Context, inputs map[string]any, options ...ChainCallOption) (map[string]any, error) {
+
+	opts := initChainCallOptions(options...)
+
+	llm := c.LLM
+	if llm == nil {
+		llm = opts.LLM
+	}
+	if llm == nil {
+		return nil, fmt.Errorf(`chain '%s': no model`, c.name)
+	}
+
+	question, ok := inputs[InputKey].(string)
+	if !ok {
+		return nil, fmt.Errorf(`chain '%s': input '%s' is %T, expect string`, c.name, InputKey, inputs[InputKey])
+	}
+
+	docs, err := c.Retriever.GetRelevantDocuments(ctx, question)
+	if err != nil {
+		return nil, fmt.Errorf(`chain '%s': retrieve documents: %w`, c.name, err)
+	}
+
+	prompt, used, err := c.stuff(llms.TokenizerOf(llm), question, docs)
+	if err != nil {
+		return nil, fmt.Errorf(`chain '%s': %v`, c.name, err)
+	}
+
+	callOpts := append([]llms.CallOption{}, c.CallOptions...)
+	if len(opts.StopWords) > 0 {
+		callOpts = append(callOpts, llms.WithStopWords(opts.StopWords))
+	}
+	if opts.StreamingFunc != nil {
+		callOpts = append(callOpts, llms.WithSreamCallBack(streamCallback(opts.StreamingFunc)))
+	}
+
+	answer, err := llm.Call(ctx, prompt, callOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]any{OutputKey: strings.TrimSpace(answer), SourceDocumentsKey: used}, nil
+}
+
+// stuff render the prompt with documents in order as long as they fit MaxTokens, the first
+// document is truncated if it does not fit alone. The documents used are returned.
+func (c *RetrievalQA) stuff(tk tokenizer.Tokenizer, question string, docs []schema.Document) (string, []schema.Document, error) {
+
+	prompt := c.Prompt
+	if prompt == nil {
+		prompt = prompts.QAPrompt
+	}
+
+	sep := c.Separator
+	if sep == `` {
+		sep = "\n\n"
+	}
+
+	empty, err := prompt.Render(prompts.H{`context`: ``, `question`: question})
+	if err != nil {
+		return ``, nil, err
+	}
+
+	remaining := c.MaxTokens - tk.Count(empty)
+	if c.MaxTokens <= 0 {
+		remaining = 3000 - tk.Count(empty)
+	}
+
+	contents := []string{}
+	used := []schema.Document{}
+	for _, d := range docs {
+
+		n := tk.Count(d.PageContent)
+		if len(contents) > 0 {
+			n += tk.Count(sep)
+		}
+
+		if n > remaining {
+			if len(contents) == 0 && remaining > 0 {
+				d.PageContent = tokenizer.Truncate(tk, d.PageContent, remaining)
+				contents = append(contents, d.PageContent)
+				used = append(used, d)
+			}
+			break
+		}
+
+		remaining -= n
+		contents = append(contents, d.PageContent)
+		used = append(used, d)
+	}
+
+	text, err := prompt.Render(prompts.H{`context`: strings.Join(contents, sep), `question`: question})
+	if err != nil {
+		return ``, nil, err
+	}
+	return text, used, nil
+}
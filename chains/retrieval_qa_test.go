@@ -0,0 +1,64 @@
+package chains_test
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/nexptr/llmchain/chains"
+	"github.com/nexptr/llmchain/prompts"
+	"github.com/nexptr/llmchain/schema"
+)
+
+// staticRetriever return the documents for any query.
+type staticRetriever []schema.Document
+
+func (r staticRetriever) GetRelevantDocuments(ctx context.Context, query string) ([]schema.Document, error) {
+	return r, nil
+}
+
+func TestRetrievalQA(t *testing.T) {
+
+	ctx := context.Background()
+	llm := &promptLLM{nameLLM: nameLLM{`upper`}}
+
+	docs := staticRetriever{
+		{PageContent: `go is a language`, Metadata: map[string]any{`source`: `a.md`}},
+		{PageContent: `go has goroutines`, Metadata: map[string]any{`source`: `b.md`}},
+		{PageContent: strings.Repeat(`padding `, 100), Metadata: map[string]any{`source`: `c.md`}},
+	}
+
+	prompt, _ := prompts.New("{{.context}}\nQ: {{.question}}", `context`, `question`)
+	qa := chains.NewRetrievalQA(docs, nil)
+	qa.Prompt = prompt
+	qa.MaxTokens = 40
+
+	out, err := chains.Call(ctx, qa, map[string]any{chains.InputKey: `what is go?`}, chains.WithModel(llm))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if llm.prompts[0] != "go is a language\n\ngo has goroutines\nQ: what is go?" {
+		t.Fatalf(`unexpected prompt %q`, llm.prompts[0])
+	}
+	if out[chains.OutputKey] != "GO IS A LANGUAGE\n\nGO HAS GOROUTINES\nQ: WHAT IS GO?" {
+		t.Fatalf(`unexpected answer %v`, out[chains.OutputKey])
+	}
+	if used := out[chains.SourceDocumentsKey]; !reflect.DeepEqual(used, []schema.Document(docs[:2])) {
+		t.Fatalf(`unexpected source documents %v`, used)
+	}
+
+	// the first document is truncated to the budget.
+	qa.Retriever = docs[2:]
+	if _, err := chains.Call(ctx, qa, map[string]any{chains.InputKey: `what is go?`}, chains.WithModel(llm)); err != nil {
+		t.Fatal(err)
+	}
+	if p := llm.prompts[1]; !strings.HasPrefix(p, `padding padding`) || len(p) >= len(docs[2].PageContent) {
+		t.Fatalf(`document not truncated: %q`, p)
+	}
+
+	if _, err := chains.Call(ctx, chains.NewRetrievalQA(docs, nil), map[string]any{chains.InputKey: `what is go?`}); err == nil || err.Error() != `chain 'retrieval_qa': no model` {
+		t.Fatalf(`unexpected error %v`, err)
+	}
+}
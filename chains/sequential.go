@@ -0,0 +1,360 @@
+package chains
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/nexptr/llmchain/schema"
+)
+
+const (
+	// SimpleSequentialChainType the name of SimpleSequentialChain by default.
+	SimpleSequentialChainType = `simple_sequential_chain`
+	// SequentialChainType the name of SequentialChain by default.
+	SequentialChainType = `sequential_chain`
+
+	// IntermediateStepsKey the output of the step outputs, returned by WithIntermediateSteps.
+	IntermediateStepsKey = `intermediate_steps`
+)
+
+// SequentialOption set the options of sequential chains.
+type SequentialOption func(*sequentialOptions)
+
+type sequentialOptions struct {
+	name              string
+	memory            schema.Memory
+	intermediateSteps bool
+}
+
+// WithSequentialName set the name of sequential chain.
+func WithSequentialName(name string) SequentialOption {
+	return func(o *sequentialOptions) {
+		o.name = name
+	}
+}
+
+// WithSequentialMemory set the memory of sequential chain, the memory variables are available to
+// all steps.
+func WithSequentialMemory(memory schema.Memory) SequentialOption {
+	return func(o *sequentialOptions) {
+		o.memory = memory
+	}
+}
+
+// WithIntermediateSteps return the outputs of every step as IntermediateStepsKey.
+func WithIntermediateSteps() SequentialOption {
+	return func(o *sequentialOptions) {
+		o.intermediateSteps = true
+	}
+}
+
+func initSequentialOptions(name string, options []SequentialOption) sequentialOptions {
+	opts := sequentialOptions{name: name}
+	for _, fn := range options {
+		fn(&opts)
+	}
+	return opts
+}
+
+// memoryVariables return the variables of memory as set.
+func memoryVariables(memory schema.Memory) map[string]bool {
+	ret := map[string]bool{}
+	if memory != nil {
+		for _, k := range memory.MemoryVariables() {
+			ret[k] = true
+		}
+	}
+	return ret
+}
+
+// stepOptions return the options of step i, only the last step streams.
+func stepOptions(i, n int, options []ChainCallOption) []ChainCallOption {
+	if i == n-1 {
+		return options
+	}
+	return append(append([]ChainCallOption{}, options...), WithStreamingFunc(nil))
+}
+
+// SimpleSequentialChain pipe the single string output of every chain to the single input of next,
+// the input is InputKey and the output is OutputKey. The intermediate steps are []string. It has
+// no ChainDef type, the sequence is composed of chains built in code.
+//
+//	c, err := chains.NewSimpleSequentialChain([]chains.Chain{outline, article})
+//	article, err := chains.Run(ctx, c, `a poem about go`)
+type SimpleSequentialChain struct {
+	Chains []Chain
+	// TrimOutputs trim the spaces of outputs before passing to next.
+	TrimOutputs bool
+
+	opts sequentialOptions
+}
+
+var _ Chain = &SimpleSequentialChain{}
+
+// NewSimpleSequentialChain return chain of chains, every chain must have single input key, except
+// the memory variables, and single output key.
+func NewSimpleSequentialChain(chains []Chain, options ...SequentialOption) (*SimpleSequentialChain, error) {
+
+	opts := initSequentialOptions(SimpleSequentialChainType, options)
+
+	if len(chains) == 0 {
+		return nil, fmt.Errorf(`chain '%s': no chains`, opts.name)
+	}
+
+	for i, c := range chains {
+		memVars := memoryVariables(c.GetMemory())
+
+		inputs := []string{}
+		for _, k := range c.GetInputKeys() {
+			if !memVars[k] {
+				inputs = append(inputs, k)
+			}
+		}
+		if len(inputs) != 1 {
+			return nil, fmt.Errorf(`chain '%s': step %d '%s': expect single input key, got %v`, opts.name, i, c.GetName(), inputs)
+		}
+		if outputs := c.GetOutputKeys(); len(outputs) != 1 {
+			return nil, fmt.Errorf(`chain '%s': step %d '%s': expect single output key, got %v`, opts.name, i, c.GetName(), outputs)
+		}
+	}
+
+	return &SimpleSequentialChain{Chains: chains, opts: opts}, nil
+}
+
+// GetName implements Chain.
+func (c *SimpleSequentialChain) GetName() string {
+	return c.opts.name
+}
+
+// GetMemory implements Chain.
+func (c *SimpleSequentialChain) GetMemory() schema.Memory {
+	return c.opts.memory
+}
+
+// GetInputKeys implements Chain.
+func (c *SimpleSequentialChain) GetInputKeys() []string {
+	return []string{InputKey}
+}
+
+// GetOutputKeys implements Chain.
+func (c *SimpleSequentialChain) GetOutputKeys() []string {
+	if c.opts.intermediateSteps {
+		return []string{OutputKey, IntermediateStepsKey}
+	}
+	return []string{OutputKey}
+}
+
+// Chat implements Chain.
+func (c *SimpleSequentialChain) Chat(ctx context.Context, inputs map[string]any, options ...ChainCallOption) (map[string]any, error) {
+
+	input, ok := inputs[InputKey].(string)
+	if !ok {
+		return nil, fmt.Errorf(`chain '%s': input '%s' is %T, expect string`, c.opts.name, InputKey, inputs[InputKey])
+	}
+
+	steps := make([]string, 0, len(c.Chains))
+	for i, step := range c.Chains {
+
+		out, err := Run(ctx, step, input, stepOptions(i, len(c.Chains), options)...)
+		if err != nil {
+			return nil, fmt.Errorf(`chain '%s': step %d '%s': %w`, c.opts.name, i, step.GetName(), err)
+		}
+		if c.TrimOutputs {
+			out = strings.TrimSpace(out)
+		}
+
+		steps = append(steps, out)
+		input = out
+	}
+
+	ret := map[string]any{OutputKey: input}
+	if c.opts.intermediateSteps {
+		ret[IntermediateStepsKey] = steps
+	}
+	return ret, nil
+}
+
+// Step a chain of SequentialChain, the keys of chain are mapped to the keys of sequence.
+type Step struct {
+	Chain Chain
+	// Inputs map the input key of chain to the key of sequence, the same key if not mapped.
+	Inputs map[string]string
+	// Outputs map the output key of chain to the key of sequence, the same key if not mapped.
+	Outputs map[string]string
+}
+
+func (s Step) input(k string) string {
+	if v, ok := s.Inputs[k]; ok {
+		return v
+	}
+	return k
+}
+
+func (s Step) output(k string) string {
+	if v, ok := s.Outputs[k]; ok {
+		return v
+	}
+	return k
+}
+
+// SequentialChain run steps in order, the inputs of every step are taken from the inputs of
+// sequence, the memory variables and the outputs of previous steps. The keys are validated on
+// construction. The intermediate steps are []map[string]any of the mapped step outputs. It has no
+// ChainDef type, the steps are chains built in code.
+//
+//	c, err := chains.NewSequentialChain([]chains.Step{
+//		{Chain: synopsis, Outputs: map[string]string{chains.OutputKey: `synopsis`}},
+//		{Chain: review, Inputs: map[string]string{`text`: `synopsis`}, Outputs: map[string]string{chains.OutputKey: `review`}},
+//	}, []string{`title`}, []string{`synopsis`, `review`})
+type SequentialChain struct {
+	Steps []Step
+
+	inputKeys  []string
+	outputKeys []string
+
+	opts sequentialOptions
+}
+
+var _ Chain = &SequentialChain{}
+
+// NewSequentialChain return chain of steps with inputKeys, outputKeys are the keys returned, the
+// outputs of last step if empty. It fails if a step input is not available, a step output
+// overrides an existing key, or an output key is not produced.
+func NewSequentialChain(steps []Step, inputKeys, outputKeys []string, options ...SequentialOption) (*SequentialChain, error) {
+
+	opts := initSequentialOptions(SequentialChainType, options)
+
+	if len(steps) == 0 {
+		return nil, fmt.Errorf(`chain '%s': no steps`, opts.name)
+	}
+
+	available := memoryVariables(opts.memory)
+	for _, k := range inputKeys {
+		if available[k] {
+			return nil, fmt.Errorf(`chain '%s': input key '%s' overlaps the memory variables`, opts.name, k)
+		}
+		available[k] = true
+	}
+
+	var lastOutputs []string
+	for i, s := range steps {
+
+		name := s.Chain.GetName()
+		memVars := memoryVariables(s.Chain.GetMemory())
+
+		inputs := map[string]bool{}
+		for _, k := range s.Chain.GetInputKeys() {
+			inputs[k] = true
+			if !memVars[k] && !available[s.input(k)] {
+				return nil, fmt.Errorf(`chain '%s': step %d '%s': input key '%s' is not available, have %v`, opts.name, i, name, s.input(k), sortedKeys(available))
+			}
+		}
+		for k := range s.Inputs {
+			if !inputs[k] {
+				return nil, fmt.Errorf(`chain '%s': step %d '%s': mapped input key '%s' is not an input of chain`, opts.name, i, name, k)
+			}
+		}
+
+		outputs := map[string]bool{}
+		lastOutputs = lastOutputs[:0]
+		for _, k := range s.Chain.GetOutputKeys() {
+			outputs[k] = true
+			if available[s.output(k)] {
+				return nil, fmt.Errorf(`chain '%s': step %d '%s': output key '%s' already exists`, opts.name, i, name, s.output(k))
+			}
+			available[s.output(k)] = true
+			lastOutputs = append(lastOutputs, s.output(k))
+		}
+		for k := range s.Outputs {
+			if !outputs[k] {
+				return nil, fmt.Errorf(`chain '%s': step %d '%s': mapped output key '%s' is not an output of chain`, opts.name, i, name, k)
+			}
+		}
+	}
+
+	if len(outputKeys) == 0 {
+		outputKeys = lastOutputs
+	}
+	for _, k := range outputKeys {
+		if !available[k] {
+			return nil, fmt.Errorf(`chain '%s': output key '%s' is not produced, have %v`, opts.name, k, sortedKeys(available))
+		}
+	}
+
+	return &SequentialChain{Steps: steps, inputKeys: inputKeys, outputKeys: outputKeys, opts: opts}, nil
+}
+
+// GetName implements Chain.
+func (c *SequentialChain) GetName() string {
+	return c.opts.name
+}
+
+// GetMemory implements Chain.
+func (c *SequentialChain) GetMemory() schema.Memory {
+	return c.opts.memory
+}
+
+// GetInputKeys implements Chain.
+func (c *SequentialChain) GetInputKeys() []string {
+	return c.inputKeys
+}
+
+// GetOutputKeys implements Chain.
+func (c *SequentialChain) GetOutputKeys() []string {
+	if c.opts.intermediateSteps {
+		return append(append([]string{}, c.outputKeys...), IntermediateStepsKey)
+	}
+	return c.outputKeys
+}
+
+// Chat implements Chain.
+func (c *SequentialChain) Chat(ctx context.Context, inputs map[string]any, options ...ChainCallOption) (map[string]any, error) {
+
+	values := make(map[string]any, len(inputs))
+	for k, v := range inputs {
+		values[k] = v
+	}
+
+	steps := make([]map[string]any, 0, len(c.Steps))
+	for i, s := range c.Steps {
+
+		stepInputs := map[string]any{}
+		for _, k := range s.Chain.GetInputKeys() {
+			if v, ok := values[s.input(k)]; ok {
+				stepInputs[k] = v
+			}
+		}
+
+		outputs, err := Call(ctx, s.Chain, stepInputs, stepOptions(i, len(c.Steps), options)...)
+		if err != nil {
+			return nil, fmt.Errorf(`chain '%s': step %d '%s': %w`, c.opts.name, i, s.Chain.GetName(), err)
+		}
+
+		mapped := map[string]any{}
+		for _, k := range s.Chain.GetOutputKeys() {
+			mapped[s.output(k)] = outputs[k]
+			values[s.output(k)] = outputs[k]
+		}
+		steps = append(steps, mapped)
+	}
+
+	ret := make(map[string]any, len(c.outputKeys)+1)
+	for _, k := range c.outputKeys {
+		ret[k] = values[k]
+	}
+	if c.opts.intermediateSteps {
+		ret[IntermediateStepsKey] = steps
+	}
+	return ret, nil
+}
+
+func sortedKeys(m map[string]bool) []string {
+	ret := make([]string, 0, len(m))
+	for k := range m {
+		ret = append(ret, k)
+	}
+	sort.Strings(ret)
+	return ret
+}
@@ -0,0 +1,141 @@
+package chains_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/nexptr/llmchain/chains"
+	"github.com/nexptr/llmchain/llms"
+	"github.com/nexptr/llmchain/prompts"
+)
+
+// failLLM always fails.
+type failLLM struct {
+	nameLLM
+}
+
+func (l *failLLM) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return ``, errors.New(`boom`)
+}
+
+func newLLMChain(t *testing.T, llm llms.LLM, name, tmpl string) *chains.LLMChain {
+	prompt, err := prompts.New(tmpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return chains.NewLLMChain(llm, prompt).WithName(name)
+}
+
+func TestSimpleSequentialChain(t *testing.T) {
+
+	ctx := context.Background()
+	llm := &promptLLM{nameLLM: nameLLM{`upper`}}
+
+	c, err := chains.NewSimpleSequentialChain([]chains.Chain{
+		newLLMChain(t, llm, `outline`, `outline of {{.topic}}`),
+		newLLMChain(t, llm, `article`, `article of {{.outline}}`),
+	}, chains.WithIntermediateSteps())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chunks := []string{}
+	out, err := chains.Call(ctx, c, map[string]any{chains.InputKey: `go`}, chains.WithStreamingFunc(func(chunk string) {
+		chunks = append(chunks, chunk)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out[chains.OutputKey] != `ARTICLE OF OUTLINE OF GO` {
+		t.Fatalf(`unexpected output %v`, out)
+	}
+	if steps := out[chains.IntermediateStepsKey]; !reflect.DeepEqual(steps, []string{`OUTLINE OF GO`, `ARTICLE OF OUTLINE OF GO`}) {
+		t.Fatalf(`unexpected steps %v`, steps)
+	}
+	// only the last step streams.
+	if strings.Join(chunks, ``) != `ARTICLE OF OUTLINE OF GO` {
+		t.Fatalf(`unexpected chunks %q`, chunks)
+	}
+
+	if _, err := chains.NewSimpleSequentialChain([]chains.Chain{newLLMChain(t, llm, `two`, `{{.a}} {{.b}}`)}); err == nil ||
+		err.Error() != `chain 'simple_sequential_chain': step 0 'two': expect single input key, got [a b]` {
+		t.Fatalf(`unexpected error %v`, err)
+	}
+
+	c, _ = chains.NewSimpleSequentialChain([]chains.Chain{
+		newLLMChain(t, llm, `outline`, `outline of {{.topic}}`),
+		newLLMChain(t, &failLLM{}, `article`, `article of {{.outline}}`),
+	})
+	if _, err := chains.Run(ctx, c, `go`); err == nil || err.Error() != `chain 'simple_sequential_chain': step 1 'article': boom` {
+		t.Fatalf(`unexpected error %v`, err)
+	}
+}
+
+func TestSequentialChain(t *testing.T) {
+
+	ctx := context.Background()
+	llm := &promptLLM{nameLLM: nameLLM{`upper`}}
+
+	synopsis := newLLMChain(t, llm, `synopsis`, `synopsis of {{.title}} in {{.era}}`)
+	review := newLLMChain(t, llm, `review`, `review of {{.text}}`)
+	review.OutputKey = `review`
+
+	steps := []chains.Step{
+		{Chain: synopsis, Outputs: map[string]string{chains.OutputKey: `synopsis`}},
+		{Chain: review, Inputs: map[string]string{`text`: `synopsis`}},
+	}
+
+	c, err := chains.NewSequentialChain(steps, []string{`title`, `era`}, []string{`synopsis`, `review`}, chains.WithIntermediateSteps())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := chains.Call(ctx, c, map[string]any{`title`: `tragedy`, `era`: `victorian`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{
+		`synopsis`: `SYNOPSIS OF TRAGEDY IN VICTORIAN`,
+		`review`:   `REVIEW OF SYNOPSIS OF TRAGEDY IN VICTORIAN`,
+		chains.IntermediateStepsKey: []map[string]any{
+			{`synopsis`: `SYNOPSIS OF TRAGEDY IN VICTORIAN`},
+			{`review`: `REVIEW OF SYNOPSIS OF TRAGEDY IN VICTORIAN`},
+		},
+	}
+	if !reflect.DeepEqual(out, want) {
+		t.Fatalf(`unexpected outputs %v`, out)
+	}
+
+	// the outputs of last step by default.
+	c, _ = chains.NewSequentialChain(steps, []string{`title`, `era`}, nil)
+	if keys := c.GetOutputKeys(); !reflect.DeepEqual(keys, []string{`review`}) {
+		t.Fatalf(`unexpected output keys %v`, keys)
+	}
+
+	tests := []struct {
+		steps   []chains.Step
+		inputs  []string
+		outputs []string
+		err     string
+	}{
+		{steps, []string{`title`}, nil, `chain 'sequential_chain': step 0 'synopsis': input key 'era' is not available, have [title]`},
+		{steps[:1], []string{`title`, `era`, `synopsis`}, nil, `chain 'sequential_chain': step 0 'synopsis': output key 'synopsis' already exists`},
+		{steps, []string{`title`, `era`}, []string{`summary`}, `chain 'sequential_chain': output key 'summary' is not produced, have [era review synopsis title]`},
+		{[]chains.Step{{Chain: review, Inputs: map[string]string{`body`: `title`}}}, []string{`title`}, nil, `chain 'sequential_chain': step 0 'review': input key 'text' is not available, have [title]`},
+		{[]chains.Step{{Chain: synopsis, Inputs: map[string]string{`body`: `title`}}}, []string{`title`, `era`}, nil, `chain 'sequential_chain': step 0 'synopsis': mapped input key 'body' is not an input of chain`},
+	}
+	for _, tt := range tests {
+		if _, err := chains.NewSequentialChain(tt.steps, tt.inputs, tt.outputs); err == nil || err.Error() != tt.err {
+			t.Errorf(`expect error %q, got %v`, tt.err, err)
+		}
+	}
+
+	failing := newLLMChain(t, &failLLM{}, `review`, `review of {{.text}}`)
+	c, _ = chains.NewSequentialChain([]chains.Step{steps[0], {Chain: failing, Inputs: map[string]string{`text`: `synopsis`}}}, []string{`title`, `era`}, nil)
+	if _, err := chains.Call(ctx, c, map[string]any{`title`: `tragedy`, `era`: `victorian`}); err == nil || err.Error() != `chain 'sequential_chain': step 1 'review': boom` {
+		t.Fatalf(`unexpected error %v`, err)
+	}
+}
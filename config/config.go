@@ -0,0 +1,343 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/nexptr/llmchain/chains"
+	"github.com/nexptr/llmchain/llms"
+	"github.com/nexptr/llmchain/prompts"
+	"gopkg.in/yaml.v3"
+
+	// register builtin providers
+	_ "github.com/nexptr/llmchain/llms/fschat"
+	_ "github.com/nexptr/llmchain/llms/local"
+	_ "github.com/nexptr/llmchain/llms/openai"
+)
+
+// Config the configure file of llmchain app.
+//
+//	addr: :8080
+//	models:
+//	  - name: gpt-3.5-turbo
+//	    type: openai
+//	    aliases: [chatgpt]
+//	    parameters:
+//	      api_key: ${OPENAI_API_KEY}
+//	chat_templates:
+//	  - name: my-llama
+//	    models: [my-llama-*]
+//	    user_format: "[INST] {content} [/INST]"
+//	prompts:
+//	  dir: ./prompts
+//	  models:
+//	    my-llama:
+//	      chat: llama/chat
+//	chains:
+//	  - ./chains/weather.yaml
+type Config struct {
+	// Addr http listen addr, default :8080
+	Addr string `yaml:"addr"`
+
+	Models []llms.ModelOptions `yaml:"models"`
+
+	// ChatTemplates extra chat templates of local and fastchat models, replace the builtin ones of same name.
+	ChatTemplates []*prompts.ChatTemplate `yaml:"chat_templates"`
+
+	Prompts PromptsConfig `yaml:"prompts"`
+
+	// Chains files of chain definitions (YAML or JSON), see chains.ChainDef.
+	Chains []string `yaml:"chains"`
+
+	file string
+	// pos position of every Models item in file, used by errors.
+	pos []position
+}
+
+// PromptsConfig the prompt library, the templates are bound to models by name or pattern.
+type PromptsConfig struct {
+	// Dir directory of *.tmpl files, referenced by path without extension, example: llama/chat
+	Dir string `yaml:"dir"`
+	// WatchInterval poll interval of Dir to reload the changed templates, 0 disables watching.
+	WatchInterval time.Duration `yaml:"watch_interval"`
+	// Models the templates keyed by model name or pattern (llama-*)
+	Models map[string]prompts.TemplateConfig `yaml:"models"`
+}
+
+type position struct {
+	line, column int
+}
+
+// Error configure error with file position.
+type Error struct {
+	File   string
+	Line   int
+	Column int
+	Msg    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf(`%s:%d:%d: %s`, e.File, e.Line, e.Column, e.Msg)
+}
+
+func newError(file string, n *yaml.Node, format string, args ...any) *Error {
+	return &Error{File: file, Line: n.Line, Column: n.Column, Msg: fmt.Sprintf(format, args...)}
+}
+
+// Load read and verify configure file.
+func Load(file string) (*Config, error) {
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return Parse(file, data)
+}
+
+// Parse parse configure content, file is only used by error messages.
+func Parse(file string, data []byte) (*Config, error) {
+
+	root := &yaml.Node{}
+	if err := yaml.Unmarshal(data, root); err != nil {
+		return nil, fmt.Errorf(`%s: %v`, file, err)
+	}
+
+	if err := interpolate(file, root); err != nil {
+		return nil, err
+	}
+
+	conf := &Config{Addr: `:8080`, file: file}
+
+	if len(root.Content) == 0 {
+		return conf, nil
+	}
+
+	doc := root.Content[0]
+	if doc.Kind != yaml.MappingNode {
+		return nil, newError(file, doc, `configure must be a mapping`)
+	}
+
+	if err := doc.Decode(conf); err != nil {
+		return nil, fmt.Errorf(`%s: %v`, file, err)
+	}
+
+	if err := conf.verify(doc); err != nil {
+		return nil, err
+	}
+
+	return conf, nil
+}
+
+// verify check models, doc is the root mapping node of configure.
+func (c *Config) verify(doc *yaml.Node) error {
+
+	if templates := mappingValue(doc, `chat_templates`); templates != nil {
+		for i, n := range templates.Content {
+			if i < len(c.ChatTemplates) {
+				if err := c.ChatTemplates[i].Validate(); err != nil {
+					return newError(c.file, n, `chat_templates[%d]: %v`, i, err)
+				}
+			}
+		}
+	}
+
+	if p := mappingValue(doc, `prompts`); p != nil && c.Prompts.Dir == `` && len(c.Prompts.Models) > 0 {
+		return newError(c.file, p, `prompts: dir is required by models`)
+	}
+
+	models := mappingValue(doc, `models`)
+	if models == nil {
+		return nil
+	}
+	if models.Kind != yaml.SequenceNode {
+		return newError(c.file, models, `models must be a list`)
+	}
+
+	names := map[string]*yaml.Node{}
+
+	for i, n := range models.Content {
+
+		opt := c.Models[i]
+		c.pos = append(c.pos, position{n.Line, n.Column})
+
+		if n.Kind != yaml.MappingNode {
+			return newError(c.file, n, `models[%d]: must be a mapping`, i)
+		}
+
+		nameNode := mappingValue(n, `name`)
+		if nameNode == nil || opt.Name == `` {
+			return newError(c.file, n, `models[%d]: name is required`, i)
+		}
+
+		if prev, ok := names[opt.Name]; ok {
+			return newError(c.file, nameNode, `models[%d]: duplicate model name '%s', first defined at line %d`, i, opt.Name, prev.Line)
+		}
+		names[opt.Name] = nameNode
+
+		if !llms.HasProvider(opt.Provider()) {
+			if t := mappingValue(n, `type`); t != nil {
+				return newError(c.file, t, `models[%d]: unknown model type '%s', registered: %v`, i, opt.Type, llms.Providers())
+			}
+			return newError(c.file, nameNode, `models[%d]: type is required for model '%s'`, i, opt.Name)
+		}
+
+		for _, alias := range opt.Aliases {
+			if prev, ok := names[alias]; ok {
+				return newError(c.file, mappingValue(n, `aliases`), `models[%d]: alias '%s' conflicts with name defined at line %d`, i, alias, prev.Line)
+			}
+			names[alias] = nameNode
+		}
+
+		if p := mappingValue(n, `parameters`); p != nil && p.Kind != yaml.MappingNode {
+			return newError(c.file, p, `models[%d]: parameters must be a mapping`, i)
+		}
+	}
+
+	return nil
+}
+
+// LoadModels instantiate all models, return registry keyed by model name.
+// models and aliases declared by configure are registered to llms, so llms.ProviderOf knows them.
+func (c *Config) LoadModels() (map[string]llms.LLM, error) {
+
+	// templates are used by models, register them first.
+	for _, t := range c.ChatTemplates {
+		prompts.RegisterChatTemplate(t)
+	}
+
+	ret := make(map[string]llms.LLM, len(c.Models))
+
+	for i, opt := range c.Models {
+
+		llm, err := llms.NewModel(opt)
+		if err != nil {
+			for _, m := range ret {
+				m.Free()
+			}
+			if i < len(c.pos) {
+				return nil, &Error{File: c.file, Line: c.pos[i].line, Column: c.pos[i].column, Msg: fmt.Sprintf(`models[%d]: %v`, i, err)}
+			}
+			return nil, err
+		}
+
+		ret[opt.Name] = llm
+
+		llms.RegisterModel(opt.Name, opt.Provider())
+		for _, alias := range opt.Aliases {
+			llms.RegisterAlias(alias, opt.Name)
+		}
+	}
+
+	return ret, nil
+}
+
+// LoadPrompts load the prompt library of Prompts.Dir with the templates bound to models, nil if
+// Dir is empty. The library is watched by caller, see Prompts.WatchInterval.
+func (c *Config) LoadPrompts(opts ...prompts.LibraryOption) (*prompts.Library, error) {
+
+	if c.Prompts.Dir == `` {
+		return nil, nil
+	}
+
+	lib, err := prompts.LoadLibrary(c.Prompts.Dir, opts...)
+	if err != nil {
+		return nil, fmt.Errorf(`prompts: %v`, err)
+	}
+
+	patterns := make([]string, 0, len(c.Prompts.Models))
+	for p := range c.Prompts.Models {
+		patterns = append(patterns, p)
+	}
+	sort.Strings(patterns)
+
+	for _, p := range patterns {
+		if err := lib.Bind(p, c.Prompts.Models[p]); err != nil {
+			return nil, fmt.Errorf(`prompts: %v`, err)
+		}
+	}
+
+	return lib, nil
+}
+
+// LoadChains build the chains of Chains files with models returned by LoadModels, the relative
+// files are resolved against the directory of configure file.
+func (c *Config) LoadChains(models map[string]llms.LLM) ([]chains.Chain, error) {
+
+	ret := make([]chains.Chain, 0, len(c.Chains))
+
+	for _, file := range c.Chains {
+
+		if !filepath.IsAbs(file) && c.file != `` {
+			file = filepath.Join(filepath.Dir(c.file), file)
+		}
+
+		chain, err := chains.Load(file, models)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, chain)
+	}
+
+	return ret, nil
+}
+
+func mappingValue(n *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// envPattern ${NAME} or ${NAME:-default}
+var envPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// interpolate replace ${ENV} of all scalar values in place.
+func interpolate(file string, n *yaml.Node) error {
+
+	if n.Kind == yaml.ScalarNode {
+
+		if !envPattern.MatchString(n.Value) {
+			return nil
+		}
+
+		var missing string
+
+		n.Value = envPattern.ReplaceAllStringFunc(n.Value, func(s string) string {
+			m := envPattern.FindStringSubmatch(s)
+			if v, ok := os.LookupEnv(m[1]); ok {
+				return v
+			}
+			if m[2] != `` {
+				return m[3]
+			}
+			if missing == `` {
+				missing = m[1]
+			}
+			return ``
+		})
+
+		if missing != `` {
+			return newError(file, n, `environment variable '%s' not set`, missing)
+		}
+
+		// resolve the tag again for plain scalar, ${PORT} may be an int.
+		if n.Style&(yaml.DoubleQuotedStyle|yaml.SingleQuotedStyle) == 0 {
+			n.Tag = ``
+		}
+		return nil
+	}
+
+	for _, c := range n.Content {
+		if err := interpolate(file, c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
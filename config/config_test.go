@@ -0,0 +1,134 @@
+package config_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nexptr/llmchain/config"
+	"github.com/nexptr/llmchain/llms"
+	"github.com/nexptr/llmchain/llms/balancer"
+	"github.com/nexptr/llmchain/llms/fschat"
+	"github.com/nexptr/llmchain/llms/local"
+	"github.com/nexptr/llmchain/llms/openai"
+)
+
+const conf = `
+addr: :9090
+models:
+  - name: gpt-3.5-turbo
+    aliases: [chatgpt]
+    parameters:
+      api_key: ${TEST_OPENAI_KEY}
+      api_host: ${TEST_OPENAI_HOST:-https://api.openai.com/v1}
+  - name: my-vicuna
+    type: fschat
+    parameters:
+      api_host: [http://127.0.0.1:21002, http://127.0.0.1:21003]
+      balancer:
+        strategy: weighted
+        weights: {http://127.0.0.1:21002: 2}
+        eject_duration: 10s
+  - name: chatglm2-6b
+    type: local
+    parameters:
+      hosts: [127.0.0.1:50051]
+  - name: gpt-4
+    retry:
+      max_retries: 2
+      initial_backoff: 200ms
+      max_backoff: 5s
+      multiplier: 2
+    parameters:
+      api_key: ${TEST_OPENAI_KEY}
+`
+
+func TestParse(t *testing.T) {
+
+	t.Setenv(`TEST_OPENAI_KEY`, `sk-test`)
+
+	c, err := config.Parse(`conf.yaml`, []byte(conf))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.Addr != `:9090` || len(c.Models) != 4 {
+		t.Fatalf(`unexpected config: %+v`, c)
+	}
+
+	models, err := c.LoadModels()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ai, ok := models[`gpt-3.5-turbo`].(*openai.OpenAI)
+	if !ok || ai.APIKey != `sk-test` || ai.APIHost != `https://api.openai.com/v1` {
+		t.Fatalf(`unexpected openai model: %+v`, models[`gpt-3.5-turbo`])
+	}
+
+	vicuna, ok := models[`my-vicuna`].(*fschat.FSChat)
+	if !ok || vicuna.Name() != `my-vicuna` || len(vicuna.Endpoints) != 2 ||
+		vicuna.Balancer.Strategy != balancer.Weighted || vicuna.Balancer.EjectDuration != 10*time.Second {
+		t.Fatalf(`unexpected fschat model: %+v`, models[`my-vicuna`])
+	}
+
+	if _, ok := models[`chatglm2-6b`].(*local.LLaMA); !ok {
+		t.Fatalf(`unexpected local model: %+v`, models[`chatglm2-6b`])
+	}
+
+	retry := c.Models[3].Retry
+	if retry == nil || retry.MaxRetries != 2 || retry.InitialBackoff != 200*time.Millisecond || retry.MaxBackoff != 5*time.Second {
+		t.Fatalf(`unexpected retry policy: %+v`, retry)
+	}
+	if _, ok := models[`gpt-4`].(*openai.OpenAI); ok {
+		t.Fatal(`model with retry policy should be wrapped`)
+	}
+
+	// declared models are registered
+	if llms.ProviderOf(`my-vicuna`) != `fschat` || llms.ResolveAlias(`chatgpt`) != `gpt-3.5-turbo` {
+		t.Fatalf(`models not registered: %s %s`, llms.ProviderOf(`my-vicuna`), llms.ResolveAlias(`chatgpt`))
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+
+	cases := []struct {
+		name, conf, want string
+	}{
+		{`missing env`, "models:\n  - name: gpt-4\n    parameters:\n      api_key: ${TEST_MISSING_KEY}\n", `conf.yaml:4:16: environment variable 'TEST_MISSING_KEY' not set`},
+		{`unknown type`, "models:\n  - name: foo\n    type: bar\n", `conf.yaml:3:11: models[0]: unknown model type 'bar'`},
+		{`unknown model`, "models:\n  - name: foo\n", `conf.yaml:2:11: models[0]: type is required for model 'foo'`},
+		{`no name`, "models:\n  - type: openai\n", `conf.yaml:2:5: models[0]: name is required`},
+		{`duplicate`, "models:\n  - name: gpt-4\n  - name: gpt-4\n", `conf.yaml:3:11: models[1]: duplicate model name 'gpt-4', first defined at line 2`},
+		{`template no name`, "chat_templates:\n  - models: [foo-*]\n", `conf.yaml:2:5: chat_templates[0]: name is required`},
+		{`prompts no dir`, "prompts:\n  models:\n    foo: {chat: foo/chat}\n", `conf.yaml:2:3: prompts: dir is required by models`},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := config.Parse(`conf.yaml`, []byte(c.conf))
+
+			var cerr *config.Error
+			if !errors.As(err, &cerr) {
+				t.Fatalf(`expect config.Error, got %v`, err)
+			}
+			if !strings.HasPrefix(err.Error(), c.want) {
+				t.Fatalf("unexpected error:\n got: %s\nwant: %s", err, c.want)
+			}
+		})
+	}
+}
+
+func TestLoadModelsError(t *testing.T) {
+
+	c, err := config.Parse(`conf.yaml`, []byte("models:\n  - name: vicuna\n    type: fschat\n    parameters:\n      history:\n        strategy: forget\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = c.LoadModels()
+	if err == nil || err.Error() != `conf.yaml:2:5: models[0]: history: unknown strategy 'forget'` {
+		t.Fatalf(`unexpected error %v`, err)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+
+	"github.com/nexptr/llmchain"
+	"github.com/nexptr/llmchain/chains"
+	"github.com/nexptr/llmchain/config"
+	"github.com/nexptr/llmchain/llms"
+	"github.com/nexptr/llmchain/prompts"
+	"github.com/nexptr/llmchain/server"
+)
+
+func main() {
+
+	confFile := flag.String(`conf`, `./conf.yaml`, `configure file`)
+	flag.Parse()
+
+	log.Printf(`llmchain %s (%s %s)`, llmchain.VERSION, llmchain.GitHash, llmchain.BuildStamp)
+
+	conf, err := config.Load(*confFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	models, err := conf.LoadModels()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	list := make([]llms.LLM, 0, len(models))
+	for _, m := range models {
+		list = append(list, m)
+	}
+
+	loaded, err := conf.LoadChains(models)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, c := range loaded {
+		chains.RegChain(c)
+	}
+
+	opts := []server.Option{server.WithModels(list...)}
+
+	lib, err := conf.LoadPrompts(prompts.WithReloadHandler(func(err error) {
+		if err != nil {
+			log.Printf(`reload prompts: %v`, err)
+			return
+		}
+		log.Printf(`prompts reloaded`)
+	}))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if lib != nil {
+		opts = append(opts, server.WithPromptLibrary(lib))
+		if conf.Prompts.WatchInterval > 0 {
+			go lib.Watch(context.Background(), conf.Prompts.WatchInterval)
+		}
+	}
+
+	s := server.New(opts...)
+	defer s.Free()
+
+	log.Printf(`listen on %s`, conf.Addr)
+	if err := s.Run(conf.Addr); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,297 @@
+// Package balancer spread requests over the endpoints of a model, endpoints failing the active
+// health checks or failing continuously are taken out of rotation until they recover.
+package balancer
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/nexptr/llmchain/llms"
+)
+
+// Strategy of picking endpoint.
+type Strategy string
+
+const (
+	// RoundRobin pick endpoints in turn.
+	RoundRobin Strategy = `round_robin`
+	// LeastInFlight pick the endpoint with least running requests, fit for long generations.
+	LeastInFlight Strategy = `least_in_flight`
+	// Weighted smooth weighted round robin by Options.Weights, example: GPUs of different size.
+	Weighted Strategy = `weighted`
+)
+
+// ErrNoEndpoint no endpoint configured.
+var ErrNoEndpoint = errors.New(`balancer: no endpoint`)
+
+// HealthCheck return nil if the endpoint addr is healthy.
+type HealthCheck func(ctx context.Context, addr string) error
+
+// Options of Balancer, used as the `balancer` parameter of providers.
+type Options struct {
+	// Strategy default is round_robin.
+	Strategy Strategy `json:"strategy" yaml:"strategy"`
+	// Weights of endpoints for the weighted strategy, keyed by address, default weight is 1.
+	Weights map[string]int `json:"weights" yaml:"weights"`
+	// HealthCheckInterval interval of active health checks, 0 disable active health checks.
+	HealthCheckInterval time.Duration `json:"health_check_interval" yaml:"health_check_interval"`
+	// HealthCheckTimeout timeout of every health check, default is 5s.
+	HealthCheckTimeout time.Duration `json:"health_check_timeout" yaml:"health_check_timeout"`
+	// MaxFailures consecutive failures to eject endpoint, 0 disable passive ejection.
+	MaxFailures int `json:"max_failures" yaml:"max_failures"`
+	// EjectDuration how long an ejected endpoint is out of rotation, default is 30s.
+	EjectDuration time.Duration `json:"eject_duration" yaml:"eject_duration"`
+}
+
+// DefaultOptions round robin, eject endpoint for 30s after 3 consecutive failures.
+func DefaultOptions() Options {
+	return Options{
+		Strategy:      RoundRobin,
+		MaxFailures:   3,
+		EjectDuration: 30 * time.Second,
+	}
+}
+
+type endpoint struct {
+	addr   string
+	weight int
+
+	inFlight int
+	// current weight of smooth weighted round robin.
+	current int
+
+	// unhealthy marked by the active health check.
+	unhealthy bool
+	failures  int
+	ejected   time.Time
+}
+
+// available report whether endpoint is in rotation at now.
+func (e *endpoint) available(now time.Time) bool {
+	return !e.unhealthy && !now.Before(e.ejected)
+}
+
+// Balancer pick endpoint for every request, it's safe for concurrent use.
+type Balancer struct {
+	opts Options
+
+	mu        sync.Mutex
+	endpoints []*endpoint
+	next      int
+
+	check  HealthCheck
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// New return Balancer of addrs, check is used by the active health checks and could be nil.
+// Close the Balancer to stop the health checks.
+func New(addrs []string, opts Options, check HealthCheck) *Balancer {
+
+	if opts.Strategy == `` {
+		opts.Strategy = RoundRobin
+	}
+	if opts.EjectDuration <= 0 {
+		opts.EjectDuration = 30 * time.Second
+	}
+	if opts.HealthCheckTimeout <= 0 {
+		opts.HealthCheckTimeout = 5 * time.Second
+	}
+
+	b := &Balancer{opts: opts, check: check}
+
+	for _, addr := range addrs {
+		weight, ok := opts.Weights[addr]
+		if !ok || weight <= 0 {
+			weight = 1
+		}
+		b.endpoints = append(b.endpoints, &endpoint{addr: addr, weight: weight})
+	}
+
+	if check != nil && opts.HealthCheckInterval > 0 && len(addrs) > 0 {
+		ctx, cancel := context.WithCancel(context.Background())
+		b.cancel = cancel
+		b.wg.Add(1)
+		go b.healthCheck(ctx)
+	}
+
+	return b
+}
+
+// Pick return the endpoint for the next request, done must be called with the result of request
+// once finished, which releases the in-flight slot and counts the failures for passive ejection.
+// When no endpoint is available, all endpoints are used rather than failing the request.
+func (b *Balancer) Pick() (addr string, done func(err error), err error) {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.endpoints) == 0 {
+		return ``, nil, ErrNoEndpoint
+	}
+
+	now := time.Now()
+	candidates := make([]*endpoint, 0, len(b.endpoints))
+	for _, e := range b.endpoints {
+		if e.available(now) {
+			candidates = append(candidates, e)
+		}
+	}
+	if len(candidates) == 0 {
+		candidates = b.endpoints
+	}
+
+	var picked *endpoint
+
+	switch b.opts.Strategy {
+	case LeastInFlight:
+		// start from next, so the ties are broken in turn.
+		for i := range candidates {
+			e := candidates[(b.next+i)%len(candidates)]
+			if picked == nil || e.inFlight < picked.inFlight {
+				picked = e
+			}
+		}
+		b.next++
+	case Weighted:
+		total := 0
+		for _, e := range candidates {
+			e.current += e.weight
+			total += e.weight
+			if picked == nil || e.current > picked.current {
+				picked = e
+			}
+		}
+		picked.current -= total
+	default:
+		picked = candidates[b.next%len(candidates)]
+		b.next++
+	}
+
+	picked.inFlight++
+
+	var once sync.Once
+	return picked.addr, func(err error) {
+		once.Do(func() { b.done(picked, err) })
+	}, nil
+}
+
+func (b *Balancer) done(e *endpoint, err error) {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	e.inFlight--
+
+	if !IsEndpointFailure(err) {
+		e.failures = 0
+		return
+	}
+
+	e.failures++
+	if b.opts.MaxFailures > 0 && e.failures >= b.opts.MaxFailures {
+		e.ejected = time.Now().Add(b.opts.EjectDuration)
+		e.failures = 0
+	}
+}
+
+// IsEndpointFailure report whether err means the endpoint is broken, rather than the request is bad.
+func IsEndpointFailure(err error) bool {
+
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var e *llms.Error
+	if !errors.As(err, &e) {
+		// network errors
+		return true
+	}
+
+	return errors.Is(e, llms.ErrUnavailable) || errors.Is(e, llms.ErrTimeout) ||
+		errors.Is(e, llms.ErrInternal) || errors.Is(e, llms.ErrOutOfMemory)
+}
+
+// Available return the addresses in rotation.
+func (b *Balancer) Available() []string {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	ret := []string{}
+	for _, e := range b.endpoints {
+		if e.available(now) {
+			ret = append(ret, e.addr)
+		}
+	}
+	return ret
+}
+
+// Addrs return all addresses of balancer.
+func (b *Balancer) Addrs() []string {
+	ret := make([]string, 0, len(b.endpoints))
+	for _, e := range b.endpoints {
+		ret = append(ret, e.addr)
+	}
+	return ret
+}
+
+func (b *Balancer) healthCheck(ctx context.Context) {
+
+	defer b.wg.Done()
+
+	ticker := time.NewTicker(b.opts.HealthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		b.checkAll(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkAll check all endpoints concurrently, an endpoint passing the check is restored even if ejected.
+func (b *Balancer) checkAll(ctx context.Context) {
+
+	var wg sync.WaitGroup
+
+	for _, e := range b.endpoints {
+		wg.Add(1)
+		go func(e *endpoint) {
+			defer wg.Done()
+
+			cctx, cancel := context.WithTimeout(ctx, b.opts.HealthCheckTimeout)
+			err := b.check(cctx, e.addr)
+			cancel()
+
+			if ctx.Err() != nil {
+				return
+			}
+
+			b.mu.Lock()
+			e.unhealthy = err != nil
+			if err == nil {
+				e.failures = 0
+				e.ejected = time.Time{}
+			}
+			b.mu.Unlock()
+		}(e)
+	}
+
+	wg.Wait()
+}
+
+// Close stop the active health checks.
+func (b *Balancer) Close() {
+	if b.cancel != nil {
+		b.cancel()
+		b.wg.Wait()
+	}
+}
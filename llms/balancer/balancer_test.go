@@ -0,0 +1,138 @@
+package balancer_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nexptr/llmchain/llms"
+	"github.com/nexptr/llmchain/llms/balancer"
+)
+
+func pickN(t *testing.T, b *balancer.Balancer, n int, err error) map[string]int {
+	ret := map[string]int{}
+	for i := 0; i < n; i++ {
+		addr, done, e := b.Pick()
+		if e != nil {
+			t.Fatal(e)
+		}
+		ret[addr]++
+		done(err)
+	}
+	return ret
+}
+
+func TestBalancer_RoundRobin(t *testing.T) {
+
+	b := balancer.New([]string{`a`, `b`, `c`}, balancer.Options{}, nil)
+
+	got := pickN(t, b, 9, nil)
+	if got[`a`] != 3 || got[`b`] != 3 || got[`c`] != 3 {
+		t.Fatalf(`unexpected distribution %v`, got)
+	}
+}
+
+func TestBalancer_Weighted(t *testing.T) {
+
+	b := balancer.New([]string{`a`, `b`}, balancer.Options{
+		Strategy: balancer.Weighted,
+		Weights:  map[string]int{`a`: 3},
+	}, nil)
+
+	got := pickN(t, b, 8, nil)
+	if got[`a`] != 6 || got[`b`] != 2 {
+		t.Fatalf(`unexpected distribution %v`, got)
+	}
+}
+
+func TestBalancer_LeastInFlight(t *testing.T) {
+
+	b := balancer.New([]string{`a`, `b`}, balancer.Options{Strategy: balancer.LeastInFlight}, nil)
+
+	// hold a, the following requests go to b until a is released.
+	a, doneA, _ := b.Pick()
+	other, doneB, _ := b.Pick()
+	if a == other {
+		t.Fatalf(`expect different endpoints, got %s twice`, a)
+	}
+	doneA(nil)
+
+	next, done, _ := b.Pick()
+	if next != a {
+		t.Fatalf(`expect %s, got %s`, a, next)
+	}
+	done(nil)
+	doneB(nil)
+}
+
+func TestBalancer_PassiveEjection(t *testing.T) {
+
+	b := balancer.New([]string{`a`, `b`}, balancer.Options{MaxFailures: 2, EjectDuration: time.Minute}, nil)
+
+	unavailable := &llms.Error{Kind: llms.ErrUnavailable}
+
+	for i := 0; i < 4; i++ {
+		addr, done, _ := b.Pick()
+		if addr == `a` {
+			done(unavailable)
+		} else {
+			done(nil)
+		}
+	}
+
+	if got := b.Available(); len(got) != 1 || got[0] != `b` {
+		t.Fatalf(`expect a ejected, available %v`, got)
+	}
+	if got := pickN(t, b, 3, nil); got[`b`] != 3 {
+		t.Fatalf(`unexpected distribution %v`, got)
+	}
+
+	// bad requests do not eject the endpoint.
+	pickN(t, b, 5, &llms.Error{Kind: llms.ErrContextLengthExceeded})
+	if got := b.Available(); len(got) != 1 {
+		t.Fatalf(`unexpected available %v`, got)
+	}
+
+	// all endpoints ejected, requests are spread to all of them rather than failing.
+	pickN(t, b, 2, unavailable)
+	if got := pickN(t, b, 4, nil); got[`a`] != 2 || got[`b`] != 2 {
+		t.Fatalf(`unexpected distribution %v`, got)
+	}
+}
+
+func TestBalancer_HealthCheck(t *testing.T) {
+
+	var healthy atomic.Bool
+
+	b := balancer.New([]string{`a`, `b`}, balancer.Options{HealthCheckInterval: 10 * time.Millisecond}, func(ctx context.Context, addr string) error {
+		if addr == `a` && !healthy.Load() {
+			return errors.New(`down`)
+		}
+		return nil
+	})
+	defer b.Close()
+
+	waitAvailable(t, b, 1)
+
+	healthy.Store(true)
+	waitAvailable(t, b, 2)
+}
+
+func waitAvailable(t *testing.T, b *balancer.Balancer, n int) {
+	deadline := time.Now().Add(time.Second)
+	for len(b.Available()) != n {
+		if time.Now().After(deadline) {
+			t.Fatalf(`expect %d available, got %v`, n, b.Available())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestBalancer_NoEndpoint(t *testing.T) {
+
+	if _, _, err := balancer.New(nil, balancer.Options{}, nil).Pick(); !errors.Is(err, balancer.ErrNoEndpoint) {
+		t.Fatalf(`unexpected error %v`, err)
+	}
+}
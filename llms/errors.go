@@ -0,0 +1,190 @@
+package llms
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// sentinel errors classify the provider errors, use errors.Is(err, llms.ErrRateLimited)
+var (
+	ErrRateLimited           = errors.New(`rate limited`)
+	ErrQuotaExceeded         = errors.New(`quota exceeded`)
+	ErrContextLengthExceeded = errors.New(`context length exceeded`)
+	ErrOutOfMemory           = errors.New(`out of memory`)
+	ErrUnauthorized          = errors.New(`unauthorized`)
+	ErrInvalidRequest        = errors.New(`invalid request`)
+	ErrModelNotFound         = errors.New(`model not found`)
+	ErrUnavailable           = errors.New(`service unavailable`)
+	ErrTimeout               = errors.New(`timeout`)
+	ErrInternal              = errors.New(`internal error`)
+)
+
+// Error the classified error returned by providers.
+type Error struct {
+	// Provider name of provider, example: openai, fschat, local
+	Provider string
+	// StatusCode HTTP status code of HTTP providers.
+	StatusCode int
+	// GRPCCode gRPC status code of gRPC providers.
+	GRPCCode codes.Code
+	// Type and Code are the error type and code returned by provider, example: insufficient_quota
+	Type string
+	Code string
+	// Message error message returned by provider.
+	Message string
+	// Retryable whether the request may succeed if retried.
+	Retryable bool
+	// RetryAfter wait duration suggested by provider, example: the Retry-After header.
+	RetryAfter time.Duration
+	// Kind one of the sentinel errors, example: ErrRateLimited
+	Kind error
+}
+
+func (e *Error) Error() string {
+
+	b := strings.Builder{}
+	b.WriteString(e.Provider)
+	b.WriteString(`: `)
+	if e.Kind != nil {
+		b.WriteString(e.Kind.Error())
+	} else {
+		b.WriteString(`error`)
+	}
+	if e.StatusCode != 0 {
+		fmt.Fprintf(&b, ` (status %d)`, e.StatusCode)
+	}
+	if e.GRPCCode != codes.OK {
+		fmt.Fprintf(&b, ` (grpc %s)`, e.GRPCCode)
+	}
+	if e.Message != `` {
+		b.WriteString(`: `)
+		b.WriteString(e.Message)
+	}
+	return b.String()
+}
+
+// Unwrap return Kind, so errors.Is(err, ErrRateLimited) works.
+func (e *Error) Unwrap() error {
+	return e.Kind
+}
+
+// IsRetryable report whether err is a retryable llms.Error
+func IsRetryable(err error) bool {
+	var e *Error
+	return errors.As(err, &e) && e.Retryable
+}
+
+// NewHTTPError classify error of HTTP providers by status code and the error type/code in body,
+// header is used for Retry-After, could be nil.
+func NewHTTPError(provider string, statusCode int, typ, code, message string, header http.Header) *Error {
+
+	e := &Error{
+		Provider:   provider,
+		StatusCode: statusCode,
+		Type:       typ,
+		Code:       code,
+		Message:    message,
+	}
+
+	switch {
+	case code == `context_length_exceeded` || strings.Contains(message, `maximum context length`):
+		e.Kind = ErrContextLengthExceeded
+	case code == `insufficient_quota` || typ == `insufficient_quota`:
+		e.Kind = ErrQuotaExceeded
+	case statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden:
+		e.Kind = ErrUnauthorized
+	case statusCode == http.StatusTooManyRequests:
+		e.Kind, e.Retryable = ErrRateLimited, true
+	case statusCode == http.StatusNotFound || code == `model_not_found`:
+		e.Kind = ErrModelNotFound
+	case statusCode == http.StatusRequestTimeout || statusCode == http.StatusGatewayTimeout:
+		e.Kind, e.Retryable = ErrTimeout, true
+	case statusCode == http.StatusBadGateway || statusCode == http.StatusServiceUnavailable:
+		e.Kind, e.Retryable = ErrUnavailable, true
+	case statusCode >= 500:
+		e.Kind, e.Retryable = ErrInternal, true
+	case statusCode >= 400:
+		e.Kind = ErrInvalidRequest
+	default:
+		e.Kind = ErrInternal
+	}
+
+	if header != nil {
+		e.RetryAfter = parseRetryAfter(header.Get(`Retry-After`))
+	}
+
+	return e
+}
+
+// NewGRPCError classify error of gRPC providers, err is returned as it is if not a gRPC status error.
+func NewGRPCError(provider string, err error) error {
+
+	if err == nil {
+		return nil
+	}
+
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+
+	s, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+
+	e := &Error{
+		Provider: provider,
+		GRPCCode: s.Code(),
+		Code:     s.Code().String(),
+		Message:  s.Message(),
+	}
+
+	switch s.Code() {
+	case codes.Canceled:
+		return context.Canceled
+	case codes.Unavailable:
+		e.Kind, e.Retryable = ErrUnavailable, true
+	case codes.DeadlineExceeded:
+		e.Kind, e.Retryable = ErrTimeout, true
+	case codes.ResourceExhausted:
+		e.Kind, e.Retryable = ErrRateLimited, true
+	case codes.Unauthenticated, codes.PermissionDenied:
+		e.Kind = ErrUnauthorized
+	case codes.NotFound, codes.Unimplemented:
+		e.Kind = ErrModelNotFound
+	case codes.InvalidArgument, codes.OutOfRange, codes.FailedPrecondition:
+		e.Kind = ErrInvalidRequest
+	default:
+		e.Kind = ErrInternal
+	}
+
+	return e
+}
+
+// parseRetryAfter parse Retry-After header, delay-seconds or HTTP-date.
+func parseRetryAfter(v string) time.Duration {
+
+	if v == `` {
+		return 0
+	}
+
+	if secs, err := strconv.ParseFloat(v, 64); err == nil && secs > 0 {
+		return time.Duration(secs * float64(time.Second))
+	}
+
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+
+	return 0
+}
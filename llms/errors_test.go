@@ -0,0 +1,76 @@
+package llms_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/nexptr/llmchain/llms"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestNewHTTPError(t *testing.T) {
+
+	cases := []struct {
+		status    int
+		typ, code string
+		msg       string
+		kind      error
+		retryable bool
+	}{
+		{http.StatusTooManyRequests, `requests`, `rate_limit_exceeded`, ``, llms.ErrRateLimited, true},
+		{http.StatusTooManyRequests, `insufficient_quota`, `insufficient_quota`, ``, llms.ErrQuotaExceeded, false},
+		{http.StatusBadRequest, `invalid_request_error`, `context_length_exceeded`, ``, llms.ErrContextLengthExceeded, false},
+		{http.StatusBadRequest, `invalid_request_error`, ``, `This model's maximum context length is 4097 tokens`, llms.ErrContextLengthExceeded, false},
+		{http.StatusBadRequest, `invalid_request_error`, ``, ``, llms.ErrInvalidRequest, false},
+		{http.StatusUnauthorized, `invalid_request_error`, `invalid_api_key`, ``, llms.ErrUnauthorized, false},
+		{http.StatusNotFound, `invalid_request_error`, `model_not_found`, ``, llms.ErrModelNotFound, false},
+		{http.StatusServiceUnavailable, ``, ``, ``, llms.ErrUnavailable, true},
+		{http.StatusInternalServerError, `server_error`, ``, ``, llms.ErrInternal, true},
+	}
+
+	for _, c := range cases {
+		err := fmt.Errorf(`wrapped: %w`, llms.NewHTTPError(`openai`, c.status, c.typ, c.code, c.msg, nil))
+		if !errors.Is(err, c.kind) {
+			t.Errorf(`%d %s: expect %v, got %v`, c.status, c.code, c.kind, err)
+		}
+		if llms.IsRetryable(err) != c.retryable {
+			t.Errorf(`%d %s: expect retryable %v`, c.status, c.code, c.retryable)
+		}
+	}
+}
+
+func TestNewHTTPError_RetryAfter(t *testing.T) {
+
+	header := http.Header{}
+	header.Set(`Retry-After`, `2`)
+
+	e := llms.NewHTTPError(`openai`, http.StatusTooManyRequests, ``, ``, `slow down`, header)
+	if e.RetryAfter != 2*time.Second {
+		t.Fatalf(`unexpected RetryAfter %v`, e.RetryAfter)
+	}
+	if e.Error() != `openai: rate limited (status 429): slow down` {
+		t.Fatalf(`unexpected message %q`, e.Error())
+	}
+}
+
+func TestNewGRPCError(t *testing.T) {
+
+	err := llms.NewGRPCError(`local`, status.Error(codes.Unavailable, `connection refused`))
+	if !errors.Is(err, llms.ErrUnavailable) || !llms.IsRetryable(err) {
+		t.Fatalf(`unexpected error %v`, err)
+	}
+
+	var e *llms.Error
+	if !errors.As(err, &e) || e.GRPCCode != codes.Unavailable || e.Provider != `local` {
+		t.Fatalf(`unexpected error %#v`, err)
+	}
+
+	plain := errors.New(`plain`)
+	if llms.NewGRPCError(`local`, plain) != plain {
+		t.Fatal(`non gRPC error should be returned as it is`)
+	}
+}
@@ -1,16 +1,24 @@
 package fschat
 
 import (
+	"bufio"
 	"context"
 	"fmt"
+	"io"
 	"net/http"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/nexptr/llmchain/llms"
+	"github.com/nexptr/llmchain/llms/balancer"
 	"github.com/nexptr/llmchain/schema"
+	"github.com/nexptr/llmchain/tokenizer"
 )
 
 var _ llms.LLM = &FSChat{}
+var _ llms.Streamer = &FSChat{}
+var _ llms.Tokenized = &FSChat{}
 
 // TODO: FSChat 实现直接发送请求到 Vicuna 模型，当前系统是通过OPEN AI兼容接口请求，此类方法需要额外启动一个python的web后端，完成
 // FSChat 实现以后后端可以少开启一个服务
@@ -22,9 +30,33 @@ type FSChat struct {
 	// e.g., https://api.openai.com/v1
 	Endpoints []string `json:"api_host" yaml:"api_host"`
 
+	// Encoding tokenizer encoding name (cl100k_base) or rank file path, estimated if empty.
+	Encoding string `json:"tokenizer" yaml:"tokenizer"`
+
+	// Template name of chat template, default is the template matching the model name.
+	Template string `json:"template" yaml:"template"`
+
+	// TokenizerConfig Hugging Face tokenizer_config.json or model directory, the chat_template in it is
+	// used if Template is empty. {prompts.HFDir}/{model} is looked up if not set.
+	TokenizerConfig string `json:"tokenizer_config" yaml:"tokenizer_config"`
+
+	// ContextLength max tokens of prompt and completion, default is 4096.
+	ContextLength int `json:"context_length" yaml:"context_length"`
+
+	// History strategy of trimming history to fit the context, default is token_budget.
+	History llms.HistoryOptions `json:"history" yaml:"history"`
+
+	// Balancer options of balancing requests over Endpoints, default is balancer.DefaultOptions().
+	Balancer balancer.Options `json:"balancer" yaml:"balancer"`
+
 	// HTTPClient (optional) to proxy HTTP request.
 	// If nil, *http.DefaultClient will be used.
 	HTTPClient *http.Client `json:"-" yaml:"-"`
+
+	lbOnce sync.Once
+	lb     *balancer.Balancer
+
+	trimmer llms.LazyHistoryTrimmer
 }
 
 // New return OpenAI compatiable client
@@ -40,9 +72,9 @@ func New(opts ...ModelOption) *FSChat {
 }
 
 // Call implements llms.LLM.
-func (l *FSChat) Call(ctx context.Context, prompt string) (string, error) {
+func (l *FSChat) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
 
-	req := l.defaultChatRequest(prompt)
+	req := l.defaultChatRequest(prompt, options...)
 
 	data, err := l.Chat(ctx, req)
 
@@ -65,48 +97,34 @@ func (l *FSChat) Call(ctx context.Context, prompt string) (string, error) {
 // Chat implements llms.LLM.
 func (l *FSChat) Chat(ctx context.Context, req *schema.ChatRequest) (resp *schema.ChatResponse, err error) {
 
-	if req.N > 1 {
-		fmt.Printf(`current input N is %d , we will replace by 1 right now`, req.N)
-	}
-
-	prompt := l.PromptMessage(req.Messages)
-	//TODO： 再统一的地方处理
-	if req.MaxTokens == 0 {
-		req.MaxTokens = 512
-	}
-
-	vreq := map[string]any{
-		"model":          l.Model,
-		"prompt":         prompt,
-		"temperature":    req.Temperature,
-		"top_p":          req.TopP,
-		"max_new_tokens": req.MaxTokens,
-		"stream":         req.Stream,
+	if req.StreamCallback != nil {
+		stream, err := l.ChatStream(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		return llms.ConsumeStream(stream, req.StreamCallback)
 	}
 
-	if req.StreamCallback != nil {
-		req.Stream = true // Nosy ;)
-		p := `/worker_generate_stream`
-		return call(ctx, l, http.MethodPost, p, vreq, resp, req.StreamCallback)
+	prompt, vreq, err := l.generateParams(ctx, req)
+	if err != nil {
+		return nil, err
 	}
 
 	p := `/worker_generate_completion`
 
 	vResp := fschatResp{}
 
-	vResp, err = call(ctx, l, http.MethodPost, p, vreq, vResp, nil)
+	vResp, err = call(ctx, l, http.MethodPost, p, vreq, vResp)
 
 	if err != nil {
 		return
 	}
 
-	//|| len(vResp.Text) < len(prompt)
-
 	if vResp.ErrorCode != 0 {
-		return nil, fmt.Errorf(vResp.Text)
+		return nil, workerError(vResp.ErrorCode, vResp.Text)
 	}
 
-	msg := schema.BuildAIMessage(vResp.Text[len(prompt):])
+	msg := schema.BuildAIMessage(strings.TrimPrefix(vResp.Text, prompt))
 
 	resp = &schema.ChatResponse{
 		ID:      "TODO",
@@ -126,9 +144,155 @@ func (l *FSChat) Chat(ctx context.Context, req *schema.ChatRequest) (resp *schem
 
 }
 
-// Completion implements llms.LLM.
-func (*FSChat) Completion(ctx context.Context, req *schema.CompletionRequest) (*schema.CompletionResponse, error) {
-	panic("unimplemented")
+// ChatStream implements llms.Streamer.
+func (l *FSChat) ChatStream(ctx context.Context, req *schema.ChatRequest) (*llms.ChatStream, error) {
+
+	_, vreq, err := l.generateParams(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	vreq[`stream`] = true
+
+	httpReq, done, err := l.build(ctx, http.MethodPost, `/worker_generate_stream`, vreq)
+	if err != nil {
+		return nil, err
+	}
+
+	httpres, err := l.do(httpReq)
+	if err != nil {
+		done(err)
+		return nil, err
+	}
+
+	r := bufio.NewReader(httpres.Body)
+	text := &streamText{}
+	var streamErr error
+
+	return llms.NewChatStream(func() (*schema.ChatResponse, error) {
+		chunk, err := readChunk(r, text)
+		if err != nil && err != io.EOF {
+			streamErr = err
+		}
+		return chunk, err
+	}, func() error {
+		done(streamErr)
+		return httpres.Body.Close()
+	}), nil
+}
+
+// generateParams return prompt and the worker generate params of req.
+func (l *FSChat) generateParams(ctx context.Context, req *schema.ChatRequest) (string, map[string]any, error) {
+
+	if req.N > 1 {
+		fmt.Printf(`current input N is %d , we will replace by 1 right now`, req.N)
+	}
+
+	contextLength := l.contextLength()
+
+	maxTokens := req.MaxTokens
+	if maxTokens == 0 {
+		maxTokens = defaultMaxNewTokens
+	}
+
+	trimmer, err := l.trimmer.Trimmer(l.History, l)
+	if err != nil {
+		return ``, nil, err
+	}
+
+	messages, err := trimmer.Trim(ctx, req.Messages, llms.TrimOptions{
+		Tokenizer:     l.Tokenizer(),
+		ContextLength: contextLength,
+		MaxTokens:     maxTokens,
+	})
+	if err != nil {
+		return ``, nil, err
+	}
+
+	prompt, err := l.PromptMessage(messages)
+	if err != nil {
+		return ``, nil, err
+	}
+
+	return prompt, map[string]any{
+		"model":          l.Model,
+		"prompt":         prompt,
+		"temperature":    req.Temperature,
+		"top_p":          req.TopP,
+		"max_new_tokens": l.maxNewTokens(prompt, maxTokens),
+		"stop":           l.stopWords(req),
+		"stream":         req.Stream,
+	}, nil
+}
+
+// maxNewTokens return maxTokens bounded by the context left of prompt, the generation never exceeds
+// the context.
+func (l *FSChat) maxNewTokens(prompt string, maxTokens int) int {
+
+	if rest := l.contextLength() - l.Tokenizer().Count(prompt); rest < maxTokens {
+		maxTokens = rest
+	}
+	if maxTokens < 1 {
+		maxTokens = 1
+	}
+	return maxTokens
+}
+
+// Tokenizer implements llms.Tokenized.
+func (l *FSChat) Tokenizer() tokenizer.Tokenizer {
+	return tokenizer.GetOrEstimate(l.Encoding)
+}
+
+func (l *FSChat) contextLength() int {
+	if l.ContextLength > 0 {
+		return l.ContextLength
+	}
+	return defaultContextLength
+}
+
+// Completion implements llms.LLM, the prompt is generated as is without chat template.
+func (l *FSChat) Completion(ctx context.Context, req *schema.CompletionRequest) (*schema.CompletionResponse, error) {
+
+	maxTokens := req.MaxTokens
+	if maxTokens == 0 {
+		maxTokens = defaultMaxNewTokens
+	}
+
+	vreq := map[string]any{
+		"model":          l.Model,
+		"prompt":         req.Prompt,
+		"temperature":    req.Temperature,
+		"top_p":          req.TopP,
+		"max_new_tokens": l.maxNewTokens(req.Prompt, maxTokens),
+		"stop":           req.Stop,
+		"echo":           req.Echo,
+	}
+
+	vResp, err := call(ctx, l, http.MethodPost, `/worker_generate_completion`, vreq, fschatResp{})
+	if err != nil {
+		return nil, err
+	}
+	if vResp.ErrorCode != 0 {
+		return nil, workerError(vResp.ErrorCode, vResp.Text)
+	}
+
+	text := vResp.Text
+	if !req.Echo {
+		text = strings.TrimPrefix(text, req.Prompt)
+	}
+
+	return &schema.CompletionResponse{
+		Object:  schema.OTTextCompletion,
+		Created: time.Now().Unix(),
+		Model:   l.Model,
+		Choices: []schema.Choice{
+			{
+				Index:        0,
+				FinishReason: vResp.FinishReason,
+				Text:         text,
+			},
+		},
+		Usage: vResp.Usage,
+	}, nil
 }
 
 // Embeddings implements llms.LLM.
@@ -141,7 +305,7 @@ func (l *FSChat) Embeddings(ctx context.Context, req *schema.EmbeddingsRequest)
 		TokenNum  int         `json:"token_num"`
 	}{}
 
-	retData, err = call(ctx, l, http.MethodPost, p, req, retData, nil)
+	retData, err = call(ctx, l, http.MethodPost, p, req, retData)
 
 	if err != nil {
 		return
@@ -165,8 +329,10 @@ func (l *FSChat) Embeddings(ctx context.Context, req *schema.EmbeddingsRequest)
 }
 
 // Free implements llms.LLM.
-func (*FSChat) Free() {
-	//Do Nothing
+func (l *FSChat) Free() {
+	if l.lb != nil {
+		l.lb.Close()
+	}
 }
 
 // Name implements llms.LLM.
@@ -8,12 +8,13 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"math/rand"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/nexptr/llmchain/llms"
+	"github.com/nexptr/llmchain/llms/balancer"
 	"github.com/nexptr/llmchain/schema"
 )
 
@@ -29,31 +30,36 @@ type MultipartFormDataRequestBody interface {
 	ToMultipartFormData() (*bytes.Buffer, string, error)
 }
 
-func call[T any](ctx context.Context, client *FSChat, method string, p string, body interface{}, resp T, cb schema.SreamCallBack) (T, error) {
-	req, err := client.build(ctx, method, p, body)
+func call[T any](ctx context.Context, client *FSChat, method string, p string, body interface{}, resp T) (T, error) {
+	req, done, err := client.build(ctx, method, p, body)
 	if err != nil {
 		return resp, err
 	}
-	err = execute(client, req, &resp, cb)
+	err = execute(client, req, &resp)
+	done(err)
 
 	return resp, err
 }
 
-func execute[T any](client *FSChat, req *http.Request, response *T, cb schema.SreamCallBack) error {
-	if client.HTTPClient == nil {
-		client.HTTPClient = http.DefaultClient
+func (l *FSChat) do(req *http.Request) (*http.Response, error) {
+	if l.HTTPClient == nil {
+		l.HTTPClient = http.DefaultClient
 	}
-	httpres, err := client.HTTPClient.Do(req)
+	httpres, err := l.HTTPClient.Do(req)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if httpres.StatusCode >= 400 {
 		defer httpres.Body.Close()
-		return client.apiError(httpres)
+		return nil, l.apiError(httpres)
 	}
-	if cb != nil {
-		go listen(httpres, cb)
-		return nil
+	return httpres, nil
+}
+
+func execute[T any](client *FSChat, req *http.Request, response *T) error {
+	httpres, err := client.do(req)
+	if err != nil {
+		return err
 	}
 	defer httpres.Body.Close()
 	if err := json.NewDecoder(httpres.Body).Decode(response); err != nil {
@@ -70,95 +76,107 @@ type fschatResp struct {
 	FinishReason string `json:"finish_reason,omitempty"`
 }
 
-// https://developer.mozilla.org/en-US/docs/Web/API/Server-sent_events/Using_server-sent_events#event_stream_format
-func listen(res *http.Response, cb schema.SreamCallBack) {
-
-	var rErr error
-
-	defer func() {
-
-		cb(nil, true, rErr)
+// streamText worker streams the new text of every step, and the whole completion in the last
+// chunk which has finish_reason.
+type streamText struct {
+	sent strings.Builder
+}
 
-		res.Body.Close()
-	}()
+// delta return the text not delivered yet.
+func (t *streamText) delta(text string, finished bool) string {
+	if finished {
+		sent := t.sent.String()
+		if !strings.HasPrefix(text, sent) {
+			return ``
+		}
+		text = text[len(sent):]
+	}
+	t.sent.WriteString(text)
+	return text
+}
 
-	r := bufio.NewReader(res.Body)
+// readChunk read next '\0' delimited chunk of worker_generate_stream, io.EOF when stream finished.
+func readChunk(r *bufio.Reader, text *streamText) (*schema.ChatResponse, error) {
 
 	for {
+		line, err := r.ReadBytes(0)
 
-		line, err := r.ReadSlice(0)
-
-		if err != nil {
-			if err != io.EOF {
-				rErr = err
-			}
-
-			return
-		}
-
-		if len(line) == 0 {
-			continue
+		if len(line) > 0 && line[len(line)-1] == 0 {
+			line = line[:len(line)-1]
 		}
 
-		entry := fschatResp{}
+		if len(bytes.TrimSpace(line)) > 0 {
 
-		if err := json.Unmarshal(line[:len(line)-1], &entry); err != nil {
-			rErr = err
-			return
-		}
+			entry := fschatResp{}
 
-		if entry.ErrorCode != 0 {
-			rErr = fmt.Errorf(entry.Text)
-			return
-		}
+			if err := json.Unmarshal(line, &entry); err != nil {
+				return nil, err
+			}
 
-		msg := schema.BuildAIMessage(entry.Text)
+			if entry.ErrorCode != 0 {
+				return nil, workerError(entry.ErrorCode, entry.Text)
+			}
 
-		retD := &schema.ChatResponse{
-			ID: "todo",
-			// Created: 0,
-			Choices: []schema.Choice{{
-				FinishReason: entry.FinishReason,
-			}},
-			Usage: entry.Usage,
+			msg := schema.BuildAIMessage(text.delta(entry.Text, entry.FinishReason != ``))
+
+			return &schema.ChatResponse{
+				ID:      "todo",
+				Created: time.Now().Unix(),
+				Choices: []schema.Choice{{
+					Delta:        &msg,
+					FinishReason: entry.FinishReason,
+				}},
+				Usage: entry.Usage,
+			}, nil
 		}
 
-		if entry.FinishReason != `` {
-			retD.Choices[0].Message = &msg
-			cb(retD, false, nil)
-		} else {
-			retD.Choices[0].Delta = &msg
-			cb(retD, false, nil)
+		if err != nil {
+			return nil, err
 		}
-
 	}
+}
 
+// balancer return the balancer of Endpoints, built on first use.
+func (l *FSChat) balancer() *balancer.Balancer {
+	l.lbOnce.Do(func() {
+		l.lb = balancer.New(l.Endpoints, l.Balancer, l.healthCheck)
+	})
+	return l.lb
 }
 
-func (l *FSChat) endpoint(p string) (string, error) {
+// healthCheck check worker by /worker_get_status
+func (l *FSChat) healthCheck(ctx context.Context, addr string) error {
 
-	if len(l.Endpoints) == 0 {
-		return ``, errors.New(`无可用模型地址`)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, addr+`/worker_get_status`, nil)
+	if err != nil {
+		return err
 	}
-	// 生成随机索引
-	r := rand.New(rand.NewSource(time.Now().UnixNano()))
-	index := r.Intn(len(l.Endpoints))
 
-	return strings.Join([]string{l.Endpoints[index], strings.TrimLeft(p, "/")}, "/"), nil
+	res, err := l.do(req)
+	if err != nil {
+		return err
+	}
+	return res.Body.Close()
 }
 
-func (l *FSChat) build(ctx context.Context, method, p string, body interface{}) (req *http.Request, err error) {
-	endpoint, err := l.endpoint(p)
+// build return request to the endpoint picked by balancer, done must be called with the result of request.
+func (l *FSChat) build(ctx context.Context, method, p string, body interface{}) (req *http.Request, done func(error), err error) {
+
+	addr, done, err := l.balancer().Pick()
 	if err != nil {
-		return nil, err
+		return nil, nil, errors.New(`无可用模型地址`)
 	}
+	endpoint := strings.Join([]string{addr, strings.TrimLeft(p, "/")}, "/")
+
 	r, contenttype, err := l.bodyToReader(body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to build request buf from given body: %v", err)
+		done(nil)
+		return nil, nil, fmt.Errorf("failed to build request buf from given body: %v", err)
 	}
 	req, err = http.NewRequest(method, endpoint, r)
 	if err != nil {
-		return nil, fmt.Errorf("failed to init request: %v", err)
+		done(nil)
+		return nil, nil, fmt.Errorf("failed to init request: %v", err)
 	}
 	req.Header.Add("Content-Type", contenttype)
 	// req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", l.APIKey))
@@ -168,7 +186,7 @@ func (l *FSChat) build(ctx context.Context, method, p string, body interface{})
 	if ctx != nil {
 		req = req.WithContext(ctx)
 	}
-	return req, nil
+	return req, done, nil
 }
 
 func (l *FSChat) bodyToReader(body interface{}) (io.Reader, string, error) {
@@ -197,8 +215,72 @@ func (l *FSChat) bodyToReader(body interface{}) (io.Reader, string, error) {
 
 func (l *FSChat) apiError(res *http.Response) error {
 
-	return fmt.Errorf("status: %s, status_code: %d", res.Status, res.StatusCode)
+	body, _ := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+
+	entry := fschatResp{}
+	if err := json.Unmarshal(body, &entry); err == nil && entry.ErrorCode != 0 {
+		e := workerError(entry.ErrorCode, entry.Text)
+		e.StatusCode = res.StatusCode
+		return e
+	}
+
+	msg := strings.TrimSpace(string(body))
+	if msg == `` {
+		msg = res.Status
+	}
+	return llms.NewHTTPError(llms.ModelFSChat.String(), res.StatusCode, ``, ``, msg, res.Header)
+}
+
+// error codes of FastChat worker, see fastchat/constants.py
+const (
+	errValidationTypeError     = 40001
+	errInvalidAuthKey          = 40101
+	errIncorrectAuthKey        = 40102
+	errNoPermission            = 40103
+	errInvalidModel            = 40301
+	errParamOutOfRange         = 40302
+	errContextOverflow         = 40303
+	errRateLimit               = 42901
+	errQuotaExceeded           = 42902
+	errEngineOverloaded        = 42903
+	errCudaOutOfMemory         = 50002
+	errControllerNoWorker      = 50005
+	errControllerWorkerTimeout = 50006
+)
+
+// workerError classify the error_code returned by FastChat worker.
+func workerError(code int, text string) *llms.Error {
+
+	e := &llms.Error{
+		Provider: llms.ModelFSChat.String(),
+		Code:     strconv.Itoa(code),
+		Message:  text,
+	}
+
+	switch code {
+	case errContextOverflow:
+		e.Kind = llms.ErrContextLengthExceeded
+	case errRateLimit:
+		e.Kind, e.Retryable = llms.ErrRateLimited, true
+	case errQuotaExceeded:
+		e.Kind = llms.ErrQuotaExceeded
+	case errEngineOverloaded, errControllerNoWorker:
+		e.Kind, e.Retryable = llms.ErrUnavailable, true
+	case errControllerWorkerTimeout:
+		e.Kind, e.Retryable = llms.ErrTimeout, true
+	case errCudaOutOfMemory:
+		e.Kind, e.Retryable = llms.ErrOutOfMemory, true
+	case errInvalidAuthKey, errIncorrectAuthKey, errNoPermission:
+		e.Kind = llms.ErrUnauthorized
+	case errInvalidModel:
+		e.Kind = llms.ErrModelNotFound
+	case errValidationTypeError, errParamOutOfRange:
+		e.Kind = llms.ErrInvalidRequest
+	default:
+		e.Kind = llms.ErrInternal
+	}
 
+	return e
 }
 
 func (l *FSChat) defaultChatRequest(prompt string, options ...llms.CallOption) *schema.ChatRequest {
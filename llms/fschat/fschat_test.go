@@ -0,0 +1,229 @@
+package fschat_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nexptr/llmchain/llms"
+	"github.com/nexptr/llmchain/llms/balancer"
+	"github.com/nexptr/llmchain/llms/fschat"
+	"github.com/nexptr/llmchain/schema"
+)
+
+func TestFSChat_ChatStream(t *testing.T) {
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != `/worker_generate_stream` {
+			http.NotFound(w, r)
+			return
+		}
+		// every step returns new text, and the last one returns the whole completion.
+		for _, v := range []map[string]any{
+			{`text`: `你好`, `error_code`: 0},
+			{`text`: `，世界`, `error_code`: 0},
+			{`text`: `你好，世界！`, `error_code`: 0, `finish_reason`: `stop`},
+		} {
+			b, _ := json.Marshal(v)
+			w.Write(append(b, 0))
+		}
+	}))
+	defer ts.Close()
+
+	l := fschat.New(fschat.WithAPIHost(ts.URL))
+
+	stream, err := l.ChatStream(context.Background(), &schema.ChatRequest{Messages: []schema.Message{schema.BuildUserMessage(`hi`)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	text, finish := ``, ``
+	for {
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		text += chunk.Choices[0].Delta.Content
+		finish = chunk.Choices[0].FinishReason
+	}
+
+	if text != `你好，世界！` || finish != `stop` {
+		t.Fatalf(`unexpected text %q finish %q`, text, finish)
+	}
+}
+
+func TestFSChat_Balancer(t *testing.T) {
+
+	hits := map[string]int{}
+	worker := func(name string, status int) *httptest.Server {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hits[name]++
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(map[string]any{`text`: `hi ok`, `error_code`: 0})
+		}))
+		t.Cleanup(ts.Close)
+		return ts
+	}
+
+	good, bad := worker(`good`, http.StatusOK), worker(`bad`, http.StatusServiceUnavailable)
+
+	l := fschat.New(fschat.WithAPIHost(bad.URL + `,` + good.URL))
+	l.Balancer = balancer.Options{MaxFailures: 1, EjectDuration: time.Minute}
+	defer l.Free()
+
+	for i := 0; i < 6; i++ {
+		l.Chat(context.Background(), &schema.ChatRequest{Messages: []schema.Message{schema.BuildUserMessage(`hi`)}})
+	}
+
+	// bad worker is ejected after the first failure.
+	if hits[`bad`] != 1 || hits[`good`] != 5 {
+		t.Fatalf(`unexpected hits %v`, hits)
+	}
+}
+
+func TestFSChat_BalancerDefault(t *testing.T) {
+
+	hits := map[string]int{}
+	worker := func(name string, status int) *httptest.Server {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hits[name]++
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(map[string]any{`text`: `hi ok`, `error_code`: 0})
+		}))
+		t.Cleanup(ts.Close)
+		return ts
+	}
+
+	good, bad := worker(`good`, http.StatusOK), worker(`bad`, http.StatusServiceUnavailable)
+
+	l, err := fschat.FromYaml(llms.ModelOptions{Name: `vicuna`, Settings: map[string]any{`api_host`: []string{bad.URL, good.URL}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Free()
+
+	for i := 0; i < 10; i++ {
+		l.Chat(context.Background(), &schema.ChatRequest{Messages: []schema.Message{schema.BuildUserMessage(`hi`)}})
+	}
+
+	// bad worker is ejected after the default 3 consecutive failures.
+	if hits[`bad`] != 3 || hits[`good`] != 7 {
+		t.Fatalf(`unexpected hits %v`, hits)
+	}
+}
+
+func TestFSChat_ContextLength(t *testing.T) {
+
+	var params map[string]any
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&params)
+		json.NewEncoder(w).Encode(map[string]any{`text`: params[`prompt`].(string) + `ok`, `error_code`: 0})
+	}))
+	defer ts.Close()
+
+	l := fschat.New(fschat.WithAPIHost(ts.URL))
+	l.ContextLength = 64
+
+	long := strings.Repeat(`历史消息`, 10)
+	resp, err := l.Chat(context.Background(), &schema.ChatRequest{Messages: []schema.Message{
+		schema.BuildUserMessage(long),
+		schema.BuildAIMessage(long),
+		schema.BuildUserMessage(`最近的问题`),
+		schema.BuildAIMessage(`最近的回答`),
+		schema.BuildUserMessage(`你好`),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prompt := params[`prompt`].(string)
+	if strings.Contains(prompt, long) || !strings.Contains(prompt, `最近的问题`) || !strings.HasSuffix(prompt, `USER: 你好 ASSISTANT:`) {
+		t.Fatalf(`unexpected prompt %q`, prompt)
+	}
+	if n := int(params[`max_new_tokens`].(float64)); n < 1 || n+l.Tokenizer().Count(prompt) > 64 {
+		t.Fatalf(`max_new_tokens %d exceeds context`, n)
+	}
+	if resp.Choices[0].Message.Content != `ok` {
+		t.Fatalf(`unexpected content %q`, resp.Choices[0].Message.Content)
+	}
+}
+
+func TestFSChat_InvalidHistory(t *testing.T) {
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{`text`: `ok`, `error_code`: 0})
+	}))
+	defer ts.Close()
+
+	// built in code, the history options are not verified by FromYaml.
+	l := fschat.New(fschat.WithAPIHost(ts.URL))
+	l.History = llms.HistoryOptions{Strategy: llms.HistoryWindow}
+
+	_, err := l.Chat(context.Background(), &schema.ChatRequest{Messages: []schema.Message{schema.BuildUserMessage(`hi`)}})
+	if err == nil || err.Error() != `history: turns of window must be positive, got 0` {
+		t.Fatalf(`unexpected error %v`, err)
+	}
+}
+
+func TestFSChat_Template(t *testing.T) {
+
+	var params map[string]any
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&params)
+		json.NewEncoder(w).Encode(map[string]any{`text`: `ok`, `error_code`: 0})
+	}))
+	defer ts.Close()
+
+	l := fschat.New(fschat.WithAPIHost(ts.URL))
+	l.Template = `chatml`
+
+	_, err := l.Chat(context.Background(), &schema.ChatRequest{
+		Messages: []schema.Message{schema.BuildUserMessage(`你好`)},
+		Stop:     []string{`END`},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "<|im_start|>system\nYou are a helpful assistant.<|im_end|>\n<|im_start|>user\n你好<|im_end|>\n<|im_start|>assistant\n"
+	if params[`prompt`] != want {
+		t.Fatalf(`unexpected prompt %q`, params[`prompt`])
+	}
+	if stop := fmt.Sprint(params[`stop`]); stop != `[END <|im_end|> <|endoftext|>]` {
+		t.Fatalf(`unexpected stop %s`, stop)
+	}
+}
+
+func TestFSChat_Completion(t *testing.T) {
+
+	var path string
+	var params map[string]any
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		json.NewDecoder(r.Body).Decode(&params)
+		json.NewEncoder(w).Encode(map[string]any{`text`: params[`prompt`].(string) + ` world`, `error_code`: 0, `finish_reason`: `stop`})
+	}))
+	defer ts.Close()
+
+	l := fschat.New(fschat.WithAPIHost(ts.URL))
+
+	resp, err := l.Completion(context.Background(), &schema.CompletionRequest{Prompt: `hello`, Stop: []string{`END`}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != `/worker_generate_completion` || params[`prompt`] != `hello` || fmt.Sprint(params[`stop`]) != `[END]` {
+		t.Fatalf(`unexpected request %s %v`, path, params)
+	}
+	if c := resp.Choices[0]; c.Text != ` world` || c.FinishReason != `stop` || resp.Object != schema.OTTextCompletion {
+		t.Fatalf(`unexpected response %+v`, resp)
+	}
+}
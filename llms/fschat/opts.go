@@ -7,13 +7,30 @@ import (
 	"strings"
 
 	"github.com/nexptr/llmchain/llms"
+	"github.com/nexptr/llmchain/llms/balancer"
+	"github.com/nexptr/llmchain/prompts"
 )
 
 const DefaultVicunaAddr = `http://127.0.0.1:21002`
 
+const (
+	defaultContextLength = 4096
+	defaultMaxNewTokens  = 512
+)
+
 // CallOption is a function that configures a LLM.
 type ModelOption func(*FSChat)
 
+func init() {
+	llms.RegisterProvider(llms.ModelFSChat.String(), func(opt llms.ModelOptions) (llms.LLM, error) {
+		l, err := FromYaml(opt)
+		if err != nil {
+			return nil, err
+		}
+		return l, nil
+	})
+}
+
 func FromYaml(opt llms.ModelOptions) (*FSChat, error) {
 
 	client := defaultFSChat()
@@ -26,6 +43,14 @@ func FromYaml(opt llms.ModelOptions) (*FSChat, error) {
 
 	client.Model = opt.Name
 
+	if _, err := llms.NewHistoryTrimmer(client.History, client); err != nil {
+		return nil, err
+	}
+
+	if _, err := prompts.ResolveChatTemplate(client.Model, client.Template, client.TokenizerConfig); err != nil {
+		return nil, err
+	}
+
 	return client, nil
 
 }
@@ -57,6 +82,8 @@ func defaultFSChat() *FSChat {
 	return &FSChat{
 		Model:     "vicuna-13b-v1.5-16k",
 		Endpoints: []string{DefaultVicunaAddr},
+		History:   llms.HistoryOptions{Strategy: llms.HistoryTokenBudget},
+		Balancer:  balancer.DefaultOptions(),
 	}
 }
 
@@ -0,0 +1,312 @@
+package llms
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/nexptr/llmchain/schema"
+	"github.com/nexptr/llmchain/tokenizer"
+)
+
+// strategies of HistoryOptions
+const (
+	// HistoryNone send the messages as they are.
+	HistoryNone = `none`
+	// HistoryDropOldest keep the system prompt and drop the oldest turns until messages fit the context.
+	HistoryDropOldest = `drop_oldest`
+	// HistoryWindow keep the system prompt and the last N turns.
+	HistoryWindow = `window`
+	// HistoryTokenBudget like drop_oldest, but reserve room for the completion (MaxTokens).
+	HistoryTokenBudget = `token_budget`
+	// HistorySummarize summarize the turns overflowing the token budget by the LLM.
+	HistorySummarize = `summarize`
+)
+
+const defaultSummarizePrompt = `Summarize the following conversation concisely, keep the facts and the user's intent.`
+
+// HistoryOptions configures the history trimmer of model, used as the `history` parameter of providers.
+type HistoryOptions struct {
+	// Strategy one of none, drop_oldest, window, token_budget and summarize.
+	Strategy string `json:"strategy" yaml:"strategy"`
+	// Turns kept by the window strategy.
+	Turns int `json:"turns" yaml:"turns"`
+	// Reserve min tokens reserved for the completion by token_budget and summarize.
+	Reserve int `json:"reserve" yaml:"reserve"`
+	// Prompt instruction of summarize.
+	Prompt string `json:"prompt" yaml:"prompt"`
+}
+
+// TrimOptions the context window of a request.
+type TrimOptions struct {
+	Tokenizer tokenizer.Tokenizer
+	// ContextLength max tokens of prompt and completion.
+	ContextLength int
+	// MaxTokens max tokens of the completion requested.
+	MaxTokens int
+}
+
+// HistoryTrimmer trim chat history to fit the context window of model. The system prompt and the
+// last turn are always kept, a turn is a user message with the following replies.
+type HistoryTrimmer interface {
+	Trim(ctx context.Context, messages []schema.Message, opts TrimOptions) ([]schema.Message, error)
+}
+
+// NewHistoryTrimmer return trimmer of opts, llm is used by the summarize strategy.
+func NewHistoryTrimmer(opts HistoryOptions, llm LLM) (HistoryTrimmer, error) {
+
+	switch opts.Strategy {
+	case ``, HistoryNone:
+		return NoTrimmer{}, nil
+	case HistoryDropOldest:
+		return DropOldestTrimmer{}, nil
+	case HistoryWindow:
+		if opts.Turns <= 0 {
+			return nil, fmt.Errorf(`history: turns of window must be positive, got %d`, opts.Turns)
+		}
+		return WindowTrimmer{Turns: opts.Turns}, nil
+	case HistoryTokenBudget:
+		return TokenBudgetTrimmer{Reserve: opts.Reserve}, nil
+	case HistorySummarize:
+		if llm == nil {
+			return nil, fmt.Errorf(`history: summarize requires a model`)
+		}
+		return &SummaryTrimmer{LLM: llm, Prompt: opts.Prompt, Reserve: opts.Reserve}, nil
+	default:
+		return nil, fmt.Errorf(`history: unknown strategy '%s'`, opts.Strategy)
+	}
+}
+
+// LazyHistoryTrimmer build the trimmer of providers on first use. The options of providers built in
+// code are not verified like FromYaml, so the error of invalid options is returned on every use.
+type LazyHistoryTrimmer struct {
+	once    sync.Once
+	trimmer HistoryTrimmer
+	err     error
+}
+
+// Trimmer return the trimmer of opts built by the first call, the later opts are ignored.
+func (t *LazyHistoryTrimmer) Trimmer(opts HistoryOptions, llm LLM) (HistoryTrimmer, error) {
+	t.once.Do(func() {
+		t.trimmer, t.err = NewHistoryTrimmer(opts, llm)
+	})
+	return t.trimmer, t.err
+}
+
+// splitTurns split messages to the leading system messages and turns.
+func splitTurns(messages []schema.Message) (system []schema.Message, turns [][]schema.Message) {
+
+	i := 0
+	for i < len(messages) && messages[i].Role == `system` {
+		i++
+	}
+	system = messages[:i]
+
+	for ; i < len(messages); i++ {
+		if messages[i].Role == `user` || len(turns) == 0 {
+			turns = append(turns, []schema.Message{})
+		}
+		turns[len(turns)-1] = append(turns[len(turns)-1], messages[i])
+	}
+
+	return
+}
+
+func joinTurns(system []schema.Message, turns [][]schema.Message) []schema.Message {
+	ret := append([]schema.Message{}, system...)
+	for _, t := range turns {
+		ret = append(ret, t...)
+	}
+	return ret
+}
+
+// fitTurns return index of the first turn kept, so that system and turns[index:] fit budget tokens.
+// The last turn is always kept.
+func fitTurns(tk tokenizer.Tokenizer, system []schema.Message, turns [][]schema.Message, budget int) int {
+
+	if len(turns) == 0 {
+		return 0
+	}
+
+	used := tokenizer.CountMessages(tk, system) + tokenizer.CountMessages(tk, turns[len(turns)-1]) - 3
+
+	i := len(turns) - 1
+	for ; i > 0; i-- {
+		n := tokenizer.CountMessages(tk, turns[i-1]) - 3
+		if used+n > budget {
+			break
+		}
+		used += n
+	}
+
+	return i
+}
+
+func tokenizerOf(opts TrimOptions) tokenizer.Tokenizer {
+	if opts.Tokenizer == nil {
+		return tokenizer.Estimator{}
+	}
+	return opts.Tokenizer
+}
+
+// NoTrimmer keep all messages.
+type NoTrimmer struct{}
+
+// Trim implements HistoryTrimmer.
+func (NoTrimmer) Trim(ctx context.Context, messages []schema.Message, opts TrimOptions) ([]schema.Message, error) {
+	return messages, nil
+}
+
+// DropOldestTrimmer keep the system prompt and drop the oldest turns until messages fit ContextLength,
+// the completion takes the rest of the context.
+type DropOldestTrimmer struct{}
+
+// Trim implements HistoryTrimmer.
+func (DropOldestTrimmer) Trim(ctx context.Context, messages []schema.Message, opts TrimOptions) ([]schema.Message, error) {
+
+	if opts.ContextLength <= 0 {
+		return messages, nil
+	}
+
+	system, turns := splitTurns(messages)
+	i := fitTurns(tokenizerOf(opts), system, turns, opts.ContextLength)
+
+	return joinTurns(system, turns[i:]), nil
+}
+
+// WindowTrimmer keep the system prompt and the last Turns turns.
+type WindowTrimmer struct {
+	Turns int
+}
+
+// Trim implements HistoryTrimmer.
+func (w WindowTrimmer) Trim(ctx context.Context, messages []schema.Message, opts TrimOptions) ([]schema.Message, error) {
+
+	system, turns := splitTurns(messages)
+	if len(turns) > w.Turns {
+		turns = turns[len(turns)-w.Turns:]
+	}
+
+	return joinTurns(system, turns), nil
+}
+
+// TokenBudgetTrimmer keep the system prompt and drop the oldest turns until messages fit
+// ContextLength - max(MaxTokens, Reserve).
+type TokenBudgetTrimmer struct {
+	// Reserve min tokens reserved for the completion.
+	Reserve int
+}
+
+func (t TokenBudgetTrimmer) budget(opts TrimOptions) int {
+
+	reserve := opts.MaxTokens
+	if reserve < t.Reserve {
+		reserve = t.Reserve
+	}
+	// keep at least half of context for the prompt.
+	if reserve > opts.ContextLength/2 {
+		reserve = opts.ContextLength / 2
+	}
+
+	return opts.ContextLength - reserve
+}
+
+// Trim implements HistoryTrimmer.
+func (t TokenBudgetTrimmer) Trim(ctx context.Context, messages []schema.Message, opts TrimOptions) ([]schema.Message, error) {
+
+	if opts.ContextLength <= 0 {
+		return messages, nil
+	}
+
+	system, turns := splitTurns(messages)
+	i := fitTurns(tokenizerOf(opts), system, turns, t.budget(opts))
+
+	return joinTurns(system, turns[i:]), nil
+}
+
+// SummaryTrimmer replace the turns overflowing the token budget with a summary by LLM, the summary
+// is inserted as a system message after the system prompt.
+type SummaryTrimmer struct {
+	LLM LLM
+	// Prompt instruction of summarize.
+	Prompt string
+	// Reserve min tokens reserved for the completion.
+	Reserve int
+}
+
+// Trim implements HistoryTrimmer.
+func (s *SummaryTrimmer) Trim(ctx context.Context, messages []schema.Message, opts TrimOptions) ([]schema.Message, error) {
+
+	if opts.ContextLength <= 0 {
+		return messages, nil
+	}
+
+	tk := tokenizerOf(opts)
+	budget := TokenBudgetTrimmer{Reserve: s.Reserve}.budget(opts)
+
+	system, turns := splitTurns(messages)
+	i := fitTurns(tk, system, turns, budget)
+	if i == 0 {
+		return messages, nil
+	}
+
+	summary, err := s.summarize(ctx, tk, turns[:i], budget/2)
+	if err != nil {
+		return nil, fmt.Errorf(`history: summarize: %w`, err)
+	}
+
+	system = append(append([]schema.Message{}, system...), schema.Message{
+		Role:    `system`,
+		Content: `Summary of the earlier conversation: ` + summary,
+	})
+
+	// the summary takes room too, drop more turns if needed.
+	kept := turns[i:]
+	return joinTurns(system, kept[fitTurns(tk, system, kept, budget):]), nil
+}
+
+// summarize the turns, transcript is cut to the latest max tokens.
+func (s *SummaryTrimmer) summarize(ctx context.Context, tk tokenizer.Tokenizer, turns [][]schema.Message, max int) (string, error) {
+
+	sb := strings.Builder{}
+	for _, turn := range turns {
+		for _, msg := range turn {
+			sb.WriteString(msg.Role)
+			sb.WriteString(`: `)
+			sb.WriteString(msg.Content)
+			sb.WriteString("\n")
+		}
+	}
+
+	transcript := tokenizer.TruncateLeft(tk, sb.String(), max)
+
+	prompt := s.Prompt
+	if prompt == `` {
+		prompt = defaultSummarizePrompt
+	}
+
+	resp, err := s.LLM.Chat(ctx, &schema.ChatRequest{
+		Model: s.LLM.Name(),
+		Messages: []schema.Message{
+			{Role: `system`, Content: prompt},
+			schema.BuildUserMessage(transcript),
+		},
+	})
+	if err != nil {
+		return ``, err
+	}
+
+	if resp == nil {
+		return ``, fmt.Errorf(`history: model '%s' returned empty summary`, s.LLM.Name())
+	}
+
+	ret := ``
+	for _, c := range resp.Choices {
+		if c.Message != nil {
+			ret += c.Message.Content
+		}
+	}
+
+	return strings.TrimSpace(ret), nil
+}
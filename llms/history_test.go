@@ -0,0 +1,115 @@
+package llms_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/nexptr/llmchain/llms"
+	"github.com/nexptr/llmchain/schema"
+	"github.com/nexptr/llmchain/tokenizer"
+)
+
+// 3 turns, the second one has no reply. Estimated tokens: system 10, turns 36, 16, 16.
+func history() []schema.Message {
+	long := strings.Repeat(`x`, 40)
+	return []schema.Message{
+		{Role: `system`, Content: `be nice`},
+		schema.BuildUserMessage(`first ` + long),
+		schema.BuildAIMessage(`first answer ` + long),
+		schema.BuildUserMessage(`second ` + long),
+		schema.BuildUserMessage(`third ` + long),
+	}
+}
+
+func contents(messages []schema.Message) string {
+	ret := []string{}
+	for _, m := range messages {
+		ret = append(ret, strings.Fields(m.Content)[0])
+	}
+	return strings.Join(ret, ` `)
+}
+
+func TestHistoryTrimmer(t *testing.T) {
+
+	cases := []struct {
+		opts   llms.HistoryOptions
+		trim   llms.TrimOptions
+		expect string
+	}{
+		{llms.HistoryOptions{}, llms.TrimOptions{ContextLength: 10}, `be first first second third`},
+		{llms.HistoryOptions{Strategy: llms.HistoryDropOldest}, llms.TrimOptions{ContextLength: 60}, `be second third`},
+		{llms.HistoryOptions{Strategy: llms.HistoryDropOldest}, llms.TrimOptions{ContextLength: 1000}, `be first first second third`},
+		// the last turn is always kept.
+		{llms.HistoryOptions{Strategy: llms.HistoryDropOldest}, llms.TrimOptions{ContextLength: 1}, `be third`},
+		{llms.HistoryOptions{Strategy: llms.HistoryWindow, Turns: 2}, llms.TrimOptions{}, `be second third`},
+		{llms.HistoryOptions{Strategy: llms.HistoryTokenBudget}, llms.TrimOptions{ContextLength: 100, MaxTokens: 40}, `be second third`},
+		{llms.HistoryOptions{Strategy: llms.HistoryTokenBudget, Reserve: 40}, llms.TrimOptions{ContextLength: 80}, `be third`},
+	}
+
+	for _, c := range cases {
+		trimmer, err := llms.NewHistoryTrimmer(c.opts, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.trim.Tokenizer = tokenizer.Estimator{}
+		messages, err := trimmer.Trim(context.Background(), history(), c.trim)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := contents(messages); got != c.expect {
+			t.Errorf(`%+v %+v: expect %q, got %q`, c.opts, c.trim, c.expect, got)
+		}
+	}
+}
+
+// summaryLLM summarize the first word of every line.
+type summaryLLM struct {
+	thirdParty
+	model      string
+	transcript string
+}
+
+func (s *summaryLLM) Chat(ctx context.Context, req *schema.ChatRequest) (*schema.ChatResponse, error) {
+	s.model = req.Model
+	s.transcript = req.Messages[len(req.Messages)-1].Content
+	msg := schema.BuildAIMessage(`talked about first`)
+	return &schema.ChatResponse{Choices: []schema.Choice{{Message: &msg}}}, nil
+}
+
+func TestHistoryTrimmer_Summarize(t *testing.T) {
+
+	llm := &summaryLLM{thirdParty: thirdParty{`summarizer`}}
+	trimmer, err := llms.NewHistoryTrimmer(llms.HistoryOptions{Strategy: llms.HistorySummarize}, llm)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	messages, err := trimmer.Trim(context.Background(), history(), llms.TrimOptions{Tokenizer: tokenizer.Estimator{}, ContextLength: 110, MaxTokens: 40})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if llm.model != `summarizer` {
+		t.Fatalf(`summary request without model: %q`, llm.model)
+	}
+	if !strings.HasPrefix(llm.transcript, `user: first`) {
+		t.Fatalf(`unexpected transcript %q`, llm.transcript)
+	}
+	if got := contents(messages); got != `be Summary second third` || messages[1].Role != `system` {
+		t.Fatalf(`unexpected messages %q`, got)
+	}
+}
+
+func TestNewHistoryTrimmer_Errors(t *testing.T) {
+
+	for _, opts := range []llms.HistoryOptions{
+		{Strategy: `unknown`},
+		{Strategy: llms.HistoryWindow},
+		{Strategy: llms.HistorySummarize},
+	} {
+		if _, err := llms.NewHistoryTrimmer(opts, nil); err == nil {
+			t.Errorf(`%+v: expect error`, opts)
+		}
+	}
+}
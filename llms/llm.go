@@ -4,6 +4,7 @@ import (
 	"context"
 
 	"github.com/nexptr/llmchain/schema"
+	"github.com/nexptr/llmchain/tokenizer"
 )
 
 // LLM common interface for lang model
@@ -15,8 +16,8 @@ type LLM interface {
 	//Free free model
 	Free()
 
-	//Call 实现最基本的输入输出。
-	Call(ctx context.Context, prompt string) (string, error)
+	//Call 实现最基本的输入输出。options: stop words, max tokens, temperature and stream callback.
+	Call(ctx context.Context, prompt string, options ...CallOption) (string, error)
 
 	//Chat chatGPT compatible chat/completions input/output
 	Chat(ctx context.Context, req *schema.ChatRequest) (*schema.ChatResponse, error)
@@ -27,3 +28,16 @@ type LLM interface {
 	//Chat chatGPT compatible embeddings input/output
 	Embeddings(ctx context.Context, req *schema.EmbeddingsRequest) (*schema.EmbeddingsResponse, error)
 }
+
+// Tokenized is implemented by LLMs which know their tokenizer.
+type Tokenized interface {
+	Tokenizer() tokenizer.Tokenizer
+}
+
+// TokenizerOf return the tokenizer of llm, the estimator if llm does not implement Tokenized.
+func TokenizerOf(llm LLM) tokenizer.Tokenizer {
+	if t, ok := llm.(Tokenized); ok {
+		return t.Tokenizer()
+	}
+	return tokenizer.Estimator{}
+}
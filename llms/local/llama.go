@@ -2,14 +2,20 @@ package local
 
 import (
 	"context"
-	"fmt"
+	"io"
+	"sync"
 	"time"
 
 	"github.com/nexptr/llmchain/llms"
+	"github.com/nexptr/llmchain/llms/balancer"
 	"github.com/nexptr/llmchain/schema"
+	"github.com/nexptr/llmchain/tokenizer"
+	grpc "google.golang.org/grpc"
 )
 
 var _ llms.LLM = &LLaMA{}
+var _ llms.Streamer = &LLaMA{}
+var _ llms.Tokenized = &LLaMA{}
 
 type LLaMA struct {
 
@@ -19,8 +25,31 @@ type LLaMA struct {
 	// Hosts of server including the version.
 	Hosts []string `json:"hosts" yaml:"hosts"`
 
-	// ChatServiceClient send requsts to gRPC server.
-	client ChatServiceClient `json:"-" yaml:"-"`
+	// Encoding tokenizer encoding name (cl100k_base) or rank file path, estimated if empty.
+	Encoding string `json:"tokenizer" yaml:"tokenizer"`
+
+	// Template name of chat template, default is the template matching the model name.
+	Template string `json:"template" yaml:"template"`
+
+	// TokenizerConfig Hugging Face tokenizer_config.json or model directory, the chat_template in it is
+	// used if Template is empty. {prompts.HFDir}/{model} is looked up if not set.
+	TokenizerConfig string `json:"tokenizer_config" yaml:"tokenizer_config"`
+
+	// ContextLength max tokens of prompt and completion, default is 4096.
+	ContextLength int `json:"context_length" yaml:"context_length"`
+
+	// History strategy of trimming history to fit the context, default is token_budget.
+	History llms.HistoryOptions `json:"history" yaml:"history"`
+
+	// Balancer options of balancing requests over Hosts, default is balancer.DefaultOptions().
+	Balancer balancer.Options `json:"balancer" yaml:"balancer"`
+
+	mu sync.Mutex
+	// conns one gRPC connection per host.
+	conns map[string]*grpc.ClientConn
+	lb    *balancer.Balancer
+
+	trimmer llms.LazyHistoryTrimmer
 }
 
 // New return OpenAI compatiable client
@@ -36,9 +65,9 @@ func New(opts ...ModelOption) *LLaMA {
 }
 
 // Call implements llms.LLM.
-func (l *LLaMA) Call(ctx context.Context, prompt string) (string, error) {
+func (l *LLaMA) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
 
-	req := l.defaultChatRequest(prompt)
+	req := l.defaultChatRequest(prompt, options...)
 
 	data, err := l.Chat(ctx, req)
 
@@ -62,17 +91,20 @@ func (l *LLaMA) Call(ctx context.Context, prompt string) (string, error) {
 func (l *LLaMA) Chat(ctx context.Context, req *schema.ChatRequest) (resp *schema.ChatResponse, err error) {
 
 	if req.StreamCallback != nil {
-		req.Stream = true // Nosy ;)
-		return call(ctx, l, req, resp, req.StreamCallback)
+		stream, err := l.ChatStream(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		return llms.ConsumeStream(stream, req.StreamCallback)
 	}
 
 	vResp := &GenerationReply{}
-	vResp, err = call(ctx, l, req, vResp, nil)
+	vResp, err = call(ctx, l, req, vResp)
 	if err != nil {
 		return
 	}
 	if vResp.ErrorCode != ErrorCode_Zero {
-		return nil, fmt.Errorf(vResp.Text)
+		return nil, replyError(vResp.ErrorCode, vResp.Text)
 	}
 
 	msg := schema.BuildAIMessage(vResp.Text)
@@ -98,50 +130,106 @@ func (l *LLaMA) Chat(ctx context.Context, req *schema.ChatRequest) (resp *schema
 	return
 }
 
+// ChatStream implements llms.Streamer.
+func (l *LLaMA) ChatStream(ctx context.Context, req *schema.ChatRequest) (*llms.ChatStream, error) {
+
+	in, err := l.generationRequest(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	client, done, err := l.build(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// cancel the gRPC stream when closed.
+	ctx, cancel := context.WithCancel(ctx)
+
+	c, err := client.Chat(ctx, in)
+	if err != nil {
+		cancel()
+		err = grpcError(err)
+		done(err)
+		return nil, err
+	}
+
+	text := &streamText{}
+	var streamErr error
+
+	return llms.NewChatStream(func() (*schema.ChatResponse, error) {
+		chunk, err := recvChunk(c, text)
+		if err != nil && err != io.EOF {
+			streamErr = err
+		}
+		return chunk, err
+	}, func() error {
+		cancel()
+		done(streamErr)
+		return nil
+	}), nil
+}
+
 // Completion implements llms.LLM.
 func (l *LLaMA) Completion(ctx context.Context, req *schema.CompletionRequest) (resp *schema.CompletionResponse, err error) {
-	if err := l.build(ctx); err != nil {
+	client, done, err := l.build(ctx)
+	if err != nil {
 		return nil, err
 	}
 
 	in := NewGenerationRequestByCompletionRequest(req)
 
-	reply, err := l.client.Completion(ctx, in)
+	reply, err := client.Completion(ctx, in)
 	if err != nil {
+		err = grpcError(err)
+		done(err)
 		return nil, err
 	}
+	done(nil)
 
 	if reply.ErrorCode != ErrorCode_Zero {
-		return nil, fmt.Errorf(reply.Text)
-	} else {
-		msg := schema.BuildAIMessage(reply.Text)
-		resp = &schema.CompletionResponse{
-			Choices: []schema.Choice{
-				{
-					Message:      &msg,
-					FinishReason: reply.FinishReason,
-				},
+		return nil, replyError(reply.ErrorCode, reply.Text)
+	}
+
+	resp = &schema.CompletionResponse{
+		Object:  schema.OTTextCompletion,
+		Created: time.Now().Unix(),
+		Model:   l.Model,
+		Choices: []schema.Choice{
+			{
+				Index:        0,
+				FinishReason: reply.FinishReason,
+				Text:         reply.Text,
 			},
-		}
+		},
+		Usage: schema.Usage{
+			PromptTokens:     int(reply.GetUsage().GetPromptTokens()),
+			CompletionTokens: int(reply.GetUsage().GetCompletionTokens()),
+			TotalTokens:      int(reply.GetUsage().GetTotalTokens()),
+		},
 	}
 	return
 }
 
 // Embeddings implements llms.LLM.
 func (l *LLaMA) Embeddings(ctx context.Context, req *schema.EmbeddingsRequest) (resp *schema.EmbeddingsResponse, err error) {
-	if err := l.build(ctx); err != nil {
+	client, done, err := l.build(ctx)
+	if err != nil {
 		return nil, err
 	}
 
 	in := NewEmbeddingsRequest(req)
 
-	reply, err := l.client.Embedings(ctx, in)
+	reply, err := client.Embedings(ctx, in)
 	if err != nil {
+		err = grpcError(err)
+		done(err)
 		return nil, err
 	}
+	done(nil)
 
 	if reply.ErrorCode != ErrorCode_Zero {
-		return nil, fmt.Errorf(reply.ErrorCode.String())
+		return nil, replyError(reply.ErrorCode, reply.ErrorCode.String())
 	}
 
 	resp = &schema.EmbeddingsResponse{
@@ -160,10 +248,33 @@ func (l *LLaMA) Embeddings(ctx context.Context, req *schema.EmbeddingsRequest) (
 	return
 }
 
-// Free implements llms.LLM.
+// Free implements llms.LLM, close the health checks and connections of all hosts.
 func (l *LLaMA) Free() {
-	// TODO
-	panic("unimplemented")
+
+	l.mu.Lock()
+	lb, conns := l.lb, l.conns
+	l.lb, l.conns = nil, nil
+	l.mu.Unlock()
+
+	// the health checks lock l.mu, so close lb without holding it.
+	if lb != nil {
+		lb.Close()
+	}
+	for _, conn := range conns {
+		conn.Close()
+	}
+}
+
+// Tokenizer implements llms.Tokenized.
+func (l *LLaMA) Tokenizer() tokenizer.Tokenizer {
+	return tokenizer.GetOrEstimate(l.Encoding)
+}
+
+func (l *LLaMA) contextLength() int {
+	if l.ContextLength > 0 {
+		return l.ContextLength
+	}
+	return defaultContextLength
 }
 
 // Name implements llms.LLM.
@@ -4,14 +4,16 @@ import (
 	context "context"
 	"encoding/json"
 	"fmt"
-	"io"
-	"math/rand"
+	"strings"
 	"time"
 
 	"github.com/nexptr/llmchain/llms"
+	"github.com/nexptr/llmchain/llms/balancer"
 	"github.com/nexptr/llmchain/schema"
 	grpc "google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/proto"
 )
 
 func (l *LLaMA) defaultChatRequest(prompt string, options ...llms.CallOption) *schema.ChatRequest {
@@ -44,38 +46,120 @@ func (l *LLaMA) defaultChatRequest(prompt string, options ...llms.CallOption) *s
 	return req
 }
 
-func (l *LLaMA) build(ctx context.Context) error {
-	if l.client == nil {
-		endpoint, err := l.endpoint()
-		if err != nil {
-			return err
-		}
-		client_conn, err := grpc.DialContext(ctx, endpoint, grpc.WithTransportCredentials(insecure.NewCredentials()))
-		if err != nil {
-			return err
+// build pick the host by balancer and return its client, done must be called with the result of request.
+func (l *LLaMA) build(ctx context.Context) (ChatServiceClient, func(error), error) {
+
+	l.mu.Lock()
+	if l.lb == nil {
+		l.conns = make(map[string]*grpc.ClientConn, len(l.Hosts))
+		for _, host := range l.Hosts {
+			// one connection per host, grpc dials lazily and reconnects by itself.
+			conn, err := grpc.DialContext(ctx, host, grpc.WithTransportCredentials(insecure.NewCredentials()))
+			if err != nil {
+				l.mu.Unlock()
+				l.Free()
+				return nil, nil, err
+			}
+			l.conns[host] = conn
 		}
-		l.client = NewChatServiceClient(client_conn)
+		l.lb = balancer.New(l.Hosts, l.Balancer, l.healthCheck)
+	}
+	lb, conns := l.lb, l.conns
+	l.mu.Unlock()
+
+	host, done, err := lb.Pick()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return NewChatServiceClient(conns[host]), done, nil
+}
+
+// healthCheck report the host unhealthy when its connection is failing.
+func (l *LLaMA) healthCheck(ctx context.Context, host string) error {
+
+	l.mu.Lock()
+	conn := l.conns[host]
+	l.mu.Unlock()
+
+	if conn == nil {
+		return fmt.Errorf(`no connection to %s`, host)
+	}
+
+	state := conn.GetState()
+	if state == connectivity.Idle {
+		conn.Connect()
+	}
+	if state == connectivity.TransientFailure || state == connectivity.Shutdown {
+		return fmt.Errorf(`connection to %s is %s`, host, state)
 	}
 	return nil
 }
 
-// endpoint 默认轮训后段模型
-func (l *LLaMA) endpoint() (string, error) {
-	if len(l.Hosts) == 1 {
-		return l.Hosts[0], nil
+// NewGenerationRequestByChatRequest return request of model, messages are sent as they are.
+func NewGenerationRequestByChatRequest(model_name string, req *schema.ChatRequest) (*GenerationRequest, error) {
+
+	prompt, err := PromptMessage(model_name, req.Messages)
+	if err != nil {
+		return nil, err
+	}
+
+	request := newGenerationRequest(model_name, req)
+	request.Prompt = prompt
+	return request, nil
+}
+
+// generationRequest return request with history trimmed, max_new_tokens never exceeds the context.
+func (l *LLaMA) generationRequest(ctx context.Context, req *schema.ChatRequest) (*GenerationRequest, error) {
+
+	request := newGenerationRequest(l.Model, req)
+	tk, contextLength := l.Tokenizer(), l.contextLength()
+
+	trimmer, err := l.trimmer.Trimmer(l.History, l)
+	if err != nil {
+		return nil, err
+	}
+
+	messages, err := trimmer.Trim(ctx, req.Messages, llms.TrimOptions{
+		Tokenizer:     tk,
+		ContextLength: contextLength,
+		MaxTokens:     int(request.MaxNewTokens),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	tmpl, err := l.chatTemplate()
+	if err != nil {
+		return nil, err
+	}
+	if request.Prompt, err = renderPrompt(tmpl, messages); err != nil {
+		return nil, err
+	}
+
+	// the server supports one stop word only.
+	if stop := append(append([]string{}, req.Stop...), tmpl.Stop...); len(stop) > 0 {
+		request.Stop = stop[0]
+	}
+
+	if rest := int32(contextLength - tk.Count(request.Prompt)); rest < request.MaxNewTokens {
+		request.MaxNewTokens = rest
+	}
+	if request.MaxNewTokens < 1 {
+		request.MaxNewTokens = 1
 	}
-	// 生成随机索引
-	r := rand.New(rand.NewSource(time.Now().UnixNano()))
-	index := r.Intn(len(l.Hosts))
 
-	return l.Hosts[index], nil
+	return request, nil
 }
 
-func NewGenerationRequestByChatRequest(model_name string, req *schema.ChatRequest) *GenerationRequest {
-	request, ok := defaultChatRequest[model_name]
+// newGenerationRequest return request with the params of req, prompt is not set.
+func newGenerationRequest(model_name string, req *schema.ChatRequest) *GenerationRequest {
+	defaults, ok := defaultChatRequest[model_name]
 	if !ok {
-		request = defaultChatRequest["default"]
+		defaults = defaultChatRequest["default"]
 	}
+	// the defaults are shared, never modify them.
+	request := proto.Clone(defaults).(*GenerationRequest)
 
 	if req.Temperature > 0 {
 		request.Temperature = req.Temperature
@@ -97,8 +181,6 @@ func NewGenerationRequestByChatRequest(model_name string, req *schema.ChatReques
 		request.RepetitionPenalty = req.PresencePenalty
 	}
 
-	request.Prompt = PromptMessage(model_name, req.Messages)
-
 	return request
 }
 
@@ -132,31 +214,31 @@ func NewEmbeddingsRequest(req *schema.EmbeddingsRequest) *EmbedingsMessage {
 	return request
 }
 
-func call[T any](ctx context.Context, l *LLaMA, req *schema.ChatRequest, resp T, cb schema.SreamCallBack) (T, error) {
-	if err := l.build(ctx); err != nil {
+func call[T any](ctx context.Context, l *LLaMA, req *schema.ChatRequest, resp T) (T, error) {
+	client, done, err := l.build(ctx)
+	if err != nil {
 		return resp, err
 	}
 
-	in := NewGenerationRequestByChatRequest(l.Model, req)
-	if cb != nil {
-		c, err := l.client.Chat(ctx, in)
-		if err != nil {
-			return resp, err
-		}
-		go listen(c, cb)
-		return resp, nil
+	in, err := l.generationRequest(ctx, req)
+	if err != nil {
+		done(nil)
+		return resp, err
 	}
 
-	reply, err := l.client.Completion(ctx, in)
+	reply, err := client.Completion(ctx, in)
 	if err != nil {
+		err = grpcError(err)
+		done(err)
 		return resp, err
 	}
+	done(nil)
 	if reply.Usage == nil {
 		reply.Usage = &TokenUsage{}
 	}
 
 	if reply.ErrorCode != ErrorCode_Zero {
-		return resp, fmt.Errorf(reply.Text)
+		return resp, replyError(reply.ErrorCode, reply.Text)
 	} else {
 		by, _ := json.Marshal(reply)
 		if err := json.Unmarshal(by, resp); err != nil {
@@ -167,48 +249,74 @@ func call[T any](ctx context.Context, l *LLaMA, req *schema.ChatRequest, resp T,
 	return resp, nil
 }
 
-func listen(client ChatService_ChatClient, cb schema.SreamCallBack) {
-
-	var rErr error
-	defer func() {
-		cb(nil, true, rErr)
-	}()
+// streamText server streams the new text of every step, and the whole completion in the last
+// reply which has finish_reason.
+type streamText struct {
+	sent strings.Builder
+}
 
-	for {
-		reply, err := client.Recv()
-		if err != nil {
-			if err != io.EOF {
-				rErr = err
-			}
-			return
-		}
-		if reply.ErrorCode != ErrorCode_Zero {
-			rErr = fmt.Errorf(reply.Text)
-			return
-		}
-		if reply.Usage == nil {
-			reply.Usage = &TokenUsage{}
+// delta return the text not delivered yet.
+func (t *streamText) delta(text string, finished bool) string {
+	if finished {
+		sent := t.sent.String()
+		if !strings.HasPrefix(text, sent) {
+			return ``
 		}
+		text = text[len(sent):]
+	}
+	t.sent.WriteString(text)
+	return text
+}
 
-		msg := schema.BuildAIMessage(reply.Text)
-		retD := &schema.ChatResponse{
-			ID: "todo",
-			Choices: []schema.Choice{{
-				FinishReason: reply.FinishReason,
-			}},
-			Usage: schema.Usage{
-				PromptTokens:     int(reply.Usage.PromptTokens),
-				CompletionTokens: int(reply.Usage.CompletionTokens),
-				TotalTokens:      int(reply.Usage.TotalTokens),
-			},
-		}
+// recvChunk receive next reply of Chat stream, io.EOF when stream finished.
+func recvChunk(client ChatService_ChatClient, text *streamText) (*schema.ChatResponse, error) {
 
-		if reply.FinishReason != `` {
-			retD.Choices[0].Message = &msg
-			cb(retD, false, nil)
-		} else {
-			retD.Choices[0].Delta = &msg
-			cb(retD, false, nil)
-		}
+	reply, err := client.Recv()
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	if reply.ErrorCode != ErrorCode_Zero {
+		return nil, replyError(reply.ErrorCode, reply.Text)
+	}
+	if reply.Usage == nil {
+		reply.Usage = &TokenUsage{}
+	}
+
+	msg := schema.BuildAIMessage(text.delta(reply.Text, reply.FinishReason != ``))
+
+	return &schema.ChatResponse{
+		ID:      "todo",
+		Created: time.Now().Unix(),
+		Choices: []schema.Choice{{
+			Delta:        &msg,
+			FinishReason: reply.FinishReason,
+		}},
+		Usage: schema.Usage{
+			PromptTokens:     int(reply.Usage.PromptTokens),
+			CompletionTokens: int(reply.Usage.CompletionTokens),
+			TotalTokens:      int(reply.Usage.TotalTokens),
+		},
+	}, nil
+}
+
+func grpcError(err error) error {
+	return llms.NewGRPCError(llms.ModelLLaMACPP.String(), err)
+}
+
+// replyError classify the ErrorCode replied by server.
+func replyError(code ErrorCode, text string) error {
+
+	e := &llms.Error{
+		Provider: llms.ModelLLaMACPP.String(),
+		Code:     code.String(),
+		Message:  text,
+		Kind:     llms.ErrInternal,
+	}
+
+	if code == ErrorCode_OutOfMemory {
+		// memory is released once the running requests finished.
+		e.Kind, e.Retryable = llms.ErrOutOfMemory, true
 	}
+
+	return e
 }
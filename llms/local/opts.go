@@ -2,16 +2,30 @@ package local
 
 import (
 	"github.com/nexptr/llmchain/llms"
+	"github.com/nexptr/llmchain/llms/balancer"
+	"github.com/nexptr/llmchain/prompts"
 )
 
 const (
 	defaultLLaMAAddr  = `127.0.0.1:50051`
 	defaultLLaMAModel = `langchat-16k-v1`
+
+	defaultContextLength = 4096
 )
 
 // CallOption is a function that configures a LLM.
 type ModelOption func(*LLaMA)
 
+func init() {
+	llms.RegisterProvider(llms.ModelLLaMACPP.String(), func(opt llms.ModelOptions) (llms.LLM, error) {
+		l, err := FromYaml(opt)
+		if err != nil {
+			return nil, err
+		}
+		return l, nil
+	})
+}
+
 func FromYaml(opt llms.ModelOptions) (*LLaMA, error) {
 
 	client := defaultLLaMA()
@@ -24,6 +38,14 @@ func FromYaml(opt llms.ModelOptions) (*LLaMA, error) {
 
 	client.Model = opt.Name
 
+	if _, err := llms.NewHistoryTrimmer(client.History, client); err != nil {
+		return nil, err
+	}
+
+	if _, err := prompts.ResolveChatTemplate(client.Model, client.Template, client.TokenizerConfig); err != nil {
+		return nil, err
+	}
+
 	return client, nil
 
 }
@@ -46,8 +68,10 @@ func WithModel(o string) ModelOption {
 
 func defaultLLaMA() *LLaMA {
 	return &LLaMA{
-		Hosts: []string{defaultLLaMAAddr},
-		Model: "defaultLLaMAModel",
+		Hosts:    []string{defaultLLaMAAddr},
+		Model:    "defaultLLaMAModel",
+		History:  llms.HistoryOptions{Strategy: llms.HistoryTokenBudget},
+		Balancer: balancer.DefaultOptions(),
 	}
 }
 
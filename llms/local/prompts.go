@@ -1,118 +1,27 @@
 package local
 
 import (
+	"github.com/nexptr/llmchain/llms"
+	"github.com/nexptr/llmchain/prompts"
 	"github.com/nexptr/llmchain/schema"
 )
 
-const sysPrompt = `你是一个全能的助手，协助回答用户问题。`
-
-func PromptMessage(model string, messages []schema.Message) string {
-
-	// cuted := messages[len(messages)-1:]
-	cuted := cutHistoryByLen(messages, 8000)
-
-	switch model {
-
-	case `chatglm2-6b`:
-		return chatglm2Prompt(cuted)
-
-	default:
-		return vicunaPrompt(cuted)
-	}
-
+// PromptMessage build prompt by the chat template of model, messages are trimmed by the history
+// trimmer before.
+func PromptMessage(model string, messages []schema.Message) (string, error) {
+	return renderPrompt(prompts.ChatTemplateOf(model), messages)
 }
 
-func cutHistoryByLen(messages []schema.Message, max int) []schema.Message {
-
-	//TODO: 如果聊天内容大于max删除部分历史聊天记录.
-	//这里默认预设条件，1. messages 最后一次一定是user，
-
-	// curr, max := 0, 1024
-	msg_len := 0 //消息长度
-	index := []int{}
-	msg := []schema.Message{} //计算长度后返回的消息数组
-	for i := len(messages) - 1; i >= 0; i-- {
-		if i == len(messages)-1 {
-			if messages[i].Role == `user` { //用户给出的最后一条消息
-				index = append(index, i)
-				msg_len += len(messages[i].Content)
-			} /* else {
-				// todo 如果最后一条不是用户的消息
-			} */
-		} else {
-			if messages[i].Role == `user` && messages[i+1].Role != `user` { //消息成对添加
-				index = append(index, []int{i + 1, i}...) //倒序添加索引
-				msg_len += len(messages[i].Content) + len(messages[i+1].Content)
-			}
-		}
-
-		if msg_len >= max {
-			break
-		}
-	}
-	for i := len(index) - 1; i >= 0; i-- {
-		msg = append(msg, messages[index[i]])
-	}
-
-	return msg
-}
-
-// vicunaPrompt message
-func chatglm2Prompt(messages []schema.Message) string {
-
-	//内置
-	prompt := sysPrompt //Below is an instruction that describes a task. Write a response that appropriately completes the request.
-
-	// Vicuna v1.1 template
-	for _, msg := range messages {
-
-		if len(msg.Content) > 0 {
-			if msg.Role == `system` {
-				//当前drop 掉system 信息
-				// ret[i] = SystemChatMessage{d.Content}
-			} else if msg.Role == `user` {
-
-				prompt += msg.Content + ` `
-
-			} else if msg.Role == `assistant` {
-				prompt += msg.Content + ` `
-			}
-		}
-
+func renderPrompt(tmpl *prompts.ChatTemplate, messages []schema.Message) (string, error) {
+	prompt, err := tmpl.Render(messages)
+	if err != nil {
+		return ``, &llms.Error{Provider: llms.ModelLLaMACPP.String(), Kind: llms.ErrInvalidRequest, Message: err.Error()}
 	}
-
-	prompt += `ASSISTANT: `
-
-	return prompt
-
+	return prompt, nil
 }
 
-// vicunaPrompt message
-func vicunaPrompt(messages []schema.Message) string {
-
-	//内置
-	prompt := sysPrompt //Below is an instruction that describes a task. Write a response that appropriately completes the request.
-
-	// Vicuna v1.1 template
-	for _, msg := range messages {
-
-		if len(msg.Content) > 0 {
-			if msg.Role == `system` {
-				//当前drop 掉system 信息
-				// ret[i] = SystemChatMessage{d.Content}
-			} else if msg.Role == `user` {
-
-				prompt += `USER: ` + msg.Content + ` `
-
-			} else if msg.Role == `assistant` {
-				prompt += `ASSISTANT: ` + msg.Content + `</s>`
-			}
-		}
-
-	}
-
-	prompt += `ASSISTANT: `
-
-	return prompt
-
+// chatTemplate return the template named by Template, or the chat_template of TokenizerConfig,
+// or the template of model.
+func (l *LLaMA) chatTemplate() (*prompts.ChatTemplate, error) {
+	return prompts.ResolveChatTemplate(l.Model, l.Template, l.TokenizerConfig)
 }
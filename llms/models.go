@@ -24,11 +24,9 @@ const (
 	VICUNA_13B ModelType = `ggml-vicuna-13b` //
 )
 
-// modelMap store the model name -> model type maps
-var modelMap map[ModelType]LLMType
-
 func init() {
-	modelMap = map[ModelType]LLMType{
+
+	for name, t := range map[ModelType]LLMType{
 		"gpt-4":               ModelOpenAI,
 		"gpt-4-0314":          ModelOpenAI,
 		"gpt-4-32k":           ModelOpenAI,
@@ -52,22 +50,71 @@ func init() {
 		"ggml-llama-13b":      ModelLLaMACPP,
 		"ggml-vicuna-13b":     ModelLLaMACPP,
 		"vicuna-13b-v1.5-16k": ModelFSChat,
+	} {
+		RegisterModel(name, t.String())
 	}
+
+	// the new released snapshots of OpenAI, example: gpt-4-0613, gpt-3.5-turbo-16k
+	RegisterModel(`gpt-4*`, ModelOpenAI.String())
+	RegisterModel(`gpt-3.5-turbo*`, ModelOpenAI.String())
+	RegisterModel(`text-embedding-*`, ModelOpenAI.String())
+	RegisterModel(`ggml-*`, ModelLLaMACPP.String())
 }
 
-func GetModelType(model ModelType) LLMType {
+// llmTypeNames provider names used in configure file.
+var llmTypeNames = map[LLMType]string{
+	ModelOpenAI:   `openai`,
+	ModelFSChat:   `fschat`,
+	ModelLLaMACPP: `local`,
+	ModelGPT4All:  `gpt4all`,
+}
 
-	t, ok := modelMap[model]
+// String return the provider name of LLMType
+func (t LLMType) String() string {
+	if name, ok := llmTypeNames[t]; ok {
+		return name
+	}
+	return `unknown`
+}
 
-	if ok {
-		return t
+// ParseLLMType return LLMType by provider name, example: openai, fschat, local
+func ParseLLMType(name string) LLMType {
+	for t, n := range llmTypeNames {
+		if n == name {
+			return t
+		}
 	}
 	return ModelUnknown
 }
 
+// GetModelType return the builtin LLMType of model, third-party providers are ModelUnknown,
+// use ProviderOf instead.
+func GetModelType(model ModelType) LLMType {
+	return ParseLLMType(ProviderOf(model))
+}
+
 type ModelOptions struct {
-	Name     ModelType   `yaml:"name"`
-	Settings interface{} `yaml:"parameters"`
+	Name ModelType `yaml:"name"`
+	// Type provider name of model (openai, fschat, local), if empty detect by ProviderOf(Name)
+	Type string `yaml:"type"`
+	// Aliases other names of the model.
+	Aliases []string `yaml:"aliases"`
+	// Retry wrap the model by WithRetry if not nil.
+	Retry    *RetryPolicy `yaml:"retry"`
+	Settings interface{}  `yaml:"parameters"`
+}
+
+// LLMType return the LLMType of model by Type or Name.
+func (o ModelOptions) LLMType() LLMType {
+	return ParseLLMType(o.Provider())
+}
+
+// Provider return the provider name of model by Type or Name.
+func (o ModelOptions) Provider() string {
+	if o.Type != `` {
+		return o.Type
+	}
+	return ProviderOf(o.Name)
 }
 
 // takes interface, marshals back to []byte, then unmarshals to desired struct
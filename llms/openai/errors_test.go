@@ -0,0 +1,57 @@
+package openai_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nexptr/llmchain/llms"
+	"github.com/nexptr/llmchain/llms/openai"
+)
+
+func TestOpenAI_ChatError(t *testing.T) {
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(`Retry-After`, `3`)
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"error":{"message":"Rate limit reached","type":"requests","param":null,"code":"rate_limit_exceeded"}}`))
+	}))
+	defer ts.Close()
+
+	ai := openai.New(openai.WithAPIHost(ts.URL))
+
+	_, err := ai.Chat(context.Background(), chatRequest())
+	if !errors.Is(err, llms.ErrRateLimited) {
+		t.Fatalf(`expect rate limited, got %v`, err)
+	}
+
+	var e *llms.Error
+	if !errors.As(err, &e) {
+		t.Fatalf(`expect llms.Error, got %T`, err)
+	}
+	if e.StatusCode != http.StatusTooManyRequests || e.Code != `rate_limit_exceeded` || e.Message != `Rate limit reached` {
+		t.Fatalf(`unexpected error %#v`, e)
+	}
+	if !e.Retryable || e.RetryAfter != 3*time.Second {
+		t.Fatalf(`unexpected retry %v %v`, e.Retryable, e.RetryAfter)
+	}
+}
+
+func TestOpenAI_ChatStreamError(t *testing.T) {
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":{"message":"This model's maximum context length is 4097 tokens.","type":"invalid_request_error","code":"context_length_exceeded"}}`))
+	}))
+	defer ts.Close()
+
+	ai := openai.New(openai.WithAPIHost(ts.URL))
+
+	_, err := ai.ChatStream(context.Background(), chatRequest())
+	if !errors.Is(err, llms.ErrContextLengthExceeded) || llms.IsRetryable(err) {
+		t.Fatalf(`unexpected error %v`, err)
+	}
+}
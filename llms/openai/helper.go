@@ -5,14 +5,16 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"strings"
-)
 
-type callback[T any] func(response T, done bool, err error)
+	"github.com/nexptr/llmchain/llms"
+	"github.com/nexptr/llmchain/schema"
+)
 
 var (
 	StreamPrefixDATA  = []byte("data: ")
@@ -24,21 +26,25 @@ type MultipartFormDataRequestBody interface {
 	ToMultipartFormData() (*bytes.Buffer, string, error)
 }
 
-func execute[T any](client *OpenAI, req *http.Request, response *T, cb callback[T]) error {
-	if client.HTTPClient == nil {
-		client.HTTPClient = http.DefaultClient
+func (l *OpenAI) do(req *http.Request) (*http.Response, error) {
+	if l.HTTPClient == nil {
+		l.HTTPClient = http.DefaultClient
 	}
-	httpres, err := client.HTTPClient.Do(req)
+	httpres, err := l.HTTPClient.Do(req)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if httpres.StatusCode >= 400 {
 		defer httpres.Body.Close()
-		return client.apiError(httpres)
+		return nil, l.apiError(httpres)
 	}
-	if cb != nil {
-		go listen(httpres, cb)
-		return nil
+	return httpres, nil
+}
+
+func execute[T any](client *OpenAI, req *http.Request, response *T) error {
+	httpres, err := client.do(req)
+	if err != nil {
+		return err
 	}
 	defer httpres.Body.Close()
 	if err := json.NewDecoder(httpres.Body).Decode(response); err != nil {
@@ -47,44 +53,52 @@ func execute[T any](client *OpenAI, req *http.Request, response *T, cb callback[
 	return nil
 }
 
+// streamChunk the data of server-sent event, some compatible servers send error in data.
+type streamChunk struct {
+	schema.ChatResponse
+	Error *schema.APIError `json:"error,omitempty"`
+}
+
+// readEvent read next chunk from server-sent events, io.EOF when [DONE] received or body closed.
 // https://developer.mozilla.org/en-US/docs/Web/API/Server-sent_events/Using_server-sent_events#event_stream_format
-func listen[T any](res *http.Response, cb callback[T]) {
-	defer res.Body.Close()
-	scanner := bufio.NewScanner(res.Body)
-	for scanner.Scan() {
-		var entry T
-		b := scanner.Bytes()
+func readEvent(r *bufio.Reader) (*schema.ChatResponse, error) {
+	for {
+		line, err := r.ReadBytes('\n')
+		b := bytes.TrimSpace(line)
+
 		switch {
 		case len(b) == 0:
-			continue
+			// ignore empty line
 		case bytes.HasPrefix(b, StreamPrefixDATA):
-			if bytes.HasSuffix(b, StreamDataDONE) {
-				cb(entry, true, nil)
-				return
+			data := b[len(StreamPrefixDATA):]
+			if bytes.Equal(data, StreamDataDONE) {
+				return nil, io.EOF
+			}
+			chunk := &streamChunk{}
+			if err := json.Unmarshal(data, chunk); err != nil {
+				return nil, fmt.Errorf("failed to decode stream chunk: %v", err)
 			}
-			if err := json.Unmarshal(b[len(StreamPrefixDATA):], &entry); err != nil {
-				cb(entry, true, err)
-				return
+			if chunk.Error != nil {
+				return nil, apiError(0, chunk.Error, nil)
 			}
-			cb(entry, false, nil)
-			// TODO: Any error case?
-			// case bytes.HasPrefix(b, StreamPrefixERROR):
-			// 	cb(entry, true, fmt.Errorf(string(b)))
-			// 	return
-			// TODO: Any other case?
-			// default:
-			// 	cb(entry, true, fmt.Errorf(string(b)))
-			// 	return
+			return &chunk.ChatResponse, nil
+		case bytes.HasPrefix(b, StreamPrefixERROR):
+			return nil, errors.New(string(b[len(StreamPrefixERROR):]))
+			// other fields (event, id, retry) and comments are ignored.
+		}
+
+		if err != nil {
+			return nil, err
 		}
 	}
 }
 
-func call[T any](ctx context.Context, client *OpenAI, method string, p string, body interface{}, resp T, cb callback[T]) (T, error) {
+func call[T any](ctx context.Context, client *OpenAI, method string, p string, body interface{}, resp T) (T, error) {
 	req, err := client.build(ctx, method, p, body)
 	if err != nil {
 		return resp, err
 	}
-	err = execute(client, req, &resp, cb)
+	err = execute(client, req, &resp)
 	return resp, err
 }
 
@@ -152,14 +166,25 @@ func (l *OpenAI) bodyToReader(body interface{}) (io.Reader, string, error) {
 
 func (l *OpenAI) apiError(res *http.Response) error {
 
-	return fmt.Errorf("status: %s, status_code: %d", res.Status, res.StatusCode)
-	// errbody := struct {
-	// 	Error APIError `json:"error"`
-	// }{APIError{Status: res.Status, StatusCode: res.StatusCode}}
+	body, _ := io.ReadAll(io.LimitReader(res.Body, 1<<20))
 
-	// if err := json.NewDecoder(res.Body).Decode(&errbody); err != nil {
-	// 	return fmt.Errorf("failed to decode error body: %v", err)
-	// }
+	errbody := schema.ErrorResponse{}
+	if err := json.Unmarshal(body, &errbody); err != nil || errbody.Error == nil {
+		msg := strings.TrimSpace(string(body))
+		if msg == `` {
+			msg = res.Status
+		}
+		return llms.NewHTTPError(llms.ModelOpenAI.String(), res.StatusCode, ``, ``, msg, res.Header)
+	}
 
-	// return errbody.Error
+	return apiError(res.StatusCode, errbody.Error, res.Header)
+}
+
+// apiError convert the OpenAI error body to llms.Error
+func apiError(statusCode int, e *schema.APIError, header http.Header) error {
+	code := ``
+	if e.Code != nil {
+		code = fmt.Sprint(e.Code)
+	}
+	return llms.NewHTTPError(llms.ModelOpenAI.String(), statusCode, e.Type, code, e.Message, header)
 }
@@ -1,15 +1,20 @@
 package openai
 
 import (
+	"bufio"
 	"context"
 	"encoding/json"
 	"net/http"
+	"strings"
 
 	"github.com/nexptr/llmchain/llms"
 	"github.com/nexptr/llmchain/schema"
+	"github.com/nexptr/llmchain/tokenizer"
 )
 
 var _ llms.LLM = &OpenAI{}
+var _ llms.Streamer = &OpenAI{}
+var _ llms.Tokenized = &OpenAI{}
 
 type OpenAI struct {
 	Model string `json:"model" yaml:"model"`
@@ -27,9 +32,17 @@ type OpenAI struct {
 	//Proxy maybe we need proxy for chatGPT (example: http://127.0.0.1:7890 )
 	Proxy string `json:"proxy" yaml:"proxy"`
 
+	// ContextLength max tokens of prompt and completion, default by model, example: 8192 of gpt-4
+	ContextLength int `json:"context_length" yaml:"context_length"`
+
+	// History strategy of trimming history to fit the context, default is none.
+	History llms.HistoryOptions `json:"history" yaml:"history"`
+
 	// HTTPClient (optional) to proxy HTTP request.
 	// If nil, *http.DefaultClient will be used.
 	HTTPClient *http.Client `json:"-" yaml:"-"`
+
+	trimmer llms.LazyHistoryTrimmer
 }
 
 func FromYaml(opt llms.ModelOptions) (*OpenAI, error) {
@@ -44,6 +57,10 @@ func FromYaml(opt llms.ModelOptions) (*OpenAI, error) {
 
 	client.Model = opt.Name
 
+	if _, err := llms.NewHistoryTrimmer(client.History, client); err != nil {
+		return nil, err
+	}
+
 	return client, nil
 
 }
@@ -60,6 +77,11 @@ func New(opts ...ModelOption) *OpenAI {
 	return client
 }
 
+// Tokenizer implements llms.Tokenized.
+func (l *OpenAI) Tokenizer() tokenizer.Tokenizer {
+	return tokenizer.ForModel(l.Model)
+}
+
 // String dump openAI
 func (l *OpenAI) Name() string {
 	return l.Model
@@ -79,9 +101,9 @@ func (l *OpenAI) String() string {
 	return string(j)
 }
 
-func (l *OpenAI) Call(ctx context.Context, prompt string) (string, error) {
+func (l *OpenAI) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
 
-	req := l.defaultChatRequest(prompt)
+	req := l.defaultChatRequest(prompt, options...)
 
 	resp, err := l.Chat(ctx, req)
 
@@ -107,11 +129,92 @@ func (l *OpenAI) Chat(ctx context.Context, rawReq *schema.ChatRequest) (resp *sc
 	p := "/chat/completions"
 
 	if rawReq.StreamCallback != nil {
-		rawReq.Stream = true // Nosy ;)
-		return call(ctx, l, http.MethodPost, p, rawReq, resp, rawReq.StreamCallback)
+		stream, err := l.ChatStream(ctx, rawReq)
+		if err != nil {
+			return nil, err
+		}
+		return llms.ConsumeStream(stream, rawReq.StreamCallback)
+	}
+
+	req, err := l.trimHistory(ctx, rawReq)
+	if err != nil {
+		return nil, err
+	}
+	return call(ctx, l, http.MethodPost, p, req, resp)
+
+}
+
+// ChatStream implements llms.Streamer
+func (l *OpenAI) ChatStream(ctx context.Context, rawReq *schema.ChatRequest) (*llms.ChatStream, error) {
+
+	trimmed, err := l.trimHistory(ctx, rawReq)
+	if err != nil {
+		return nil, err
+	}
+
+	req := *trimmed
+	req.Stream = true // Nosy ;)
+
+	httpReq, err := l.build(ctx, http.MethodPost, "/chat/completions", &req)
+	if err != nil {
+		return nil, err
+	}
+
+	httpres, err := l.do(httpReq)
+	if err != nil {
+		return nil, err
 	}
-	return call(ctx, l, http.MethodPost, p, rawReq, resp, nil)
 
+	r := bufio.NewReader(httpres.Body)
+
+	return llms.NewChatStream(func() (*schema.ChatResponse, error) {
+		return readEvent(r)
+	}, httpres.Body.Close), nil
+}
+
+// trimHistory return req with messages trimmed by History, req is not modified.
+func (l *OpenAI) trimHistory(ctx context.Context, req *schema.ChatRequest) (*schema.ChatRequest, error) {
+
+	trimmer, err := l.trimmer.Trimmer(l.History, l)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := trimmer.(llms.NoTrimmer); ok {
+		return req, nil
+	}
+
+	messages, err := trimmer.Trim(ctx, req.Messages, llms.TrimOptions{
+		Tokenizer:     l.Tokenizer(),
+		ContextLength: l.contextLength(),
+		MaxTokens:     req.MaxTokens,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	trimmed := *req
+	trimmed.Messages = messages
+	return &trimmed, nil
+}
+
+// contextLength return ContextLength or the context length of model.
+func (l *OpenAI) contextLength() int {
+
+	if l.ContextLength > 0 {
+		return l.ContextLength
+	}
+
+	switch {
+	case strings.HasPrefix(l.Model, `gpt-4-32k`):
+		return 32768
+	case strings.HasPrefix(l.Model, `gpt-4`):
+		return 8192
+	case strings.HasPrefix(l.Model, `gpt-3.5-turbo-16k`):
+		return 16384
+	default:
+		return 4096
+	}
 }
 
 // Completion implements schema.LLM
@@ -124,34 +227,47 @@ func (l *OpenAI) Completion(ctx context.Context, rawReq *schema.CompletionReques
 	// 	rawReq = defaultCompletionRequest(prompt)
 	// }
 
-	return call(ctx, l, http.MethodPost, p, rawReq, resp, nil)
+	return call(ctx, l, http.MethodPost, p, rawReq, resp)
 }
 
-func (l *OpenAI) defaultChatRequest(prompt string) *schema.ChatRequest {
+func (l *OpenAI) defaultChatRequest(prompt string, options ...llms.CallOption) *schema.ChatRequest {
+
+	// not llms.InitCallOptions, max_tokens is left to OpenAI unless set.
+	opts := llms.CallOptions{Temperature: 0.8, StopWords: []string{}}
+	for _, fn := range options {
+		fn(&opts)
+	}
 
 	msg := schema.Message{Role: `user`, Content: prompt}
 
-	return &schema.ChatRequest{
+	req := &schema.ChatRequest{
 		Model:       l.Model,
 		Messages:    []schema.Message{msg},
-		Temperature: 0.8,
+		Temperature: float32(opts.Temperature),
 		TopP:        1,
 		N:           1,
 		Stream:      false,
 		// StreamCallback: ,
-		Stop:             []string{},
-		MaxTokens:        0,
+		Stop:             opts.StopWords,
+		MaxTokens:        opts.MaxTokens,
 		PresencePenalty:  0,
 		FrequencyPenalty: 0,
 		LogitBias:        nil,
 		User:             "",
 	}
+
+	if opts.CallBackFn != nil {
+		req.Stream = true
+		req.StreamCallback = opts.CallBackFn
+	}
+
+	return req
 }
 
 // Embeddings implements LLM
 func (l *OpenAI) Embeddings(ctx context.Context, req *schema.EmbeddingsRequest) (resp *schema.EmbeddingsResponse, err error) {
 
 	p := "/embeddings"
-	return call(ctx, l, http.MethodPost, p, req, resp, nil)
+	return call(ctx, l, http.MethodPost, p, req, resp)
 
 }
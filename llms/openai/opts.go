@@ -3,6 +3,8 @@ package openai
 import (
 	"net/http"
 	"net/url"
+
+	"github.com/nexptr/llmchain/llms"
 )
 
 const DefaultOpenAIAPIURL = `https://api.openai.com/v1`
@@ -10,6 +12,16 @@ const DefaultOpenAIAPIURL = `https://api.openai.com/v1`
 // CallOption is a function that configures a LLM.
 type ModelOption func(*OpenAI)
 
+func init() {
+	llms.RegisterProvider(llms.ModelOpenAI.String(), func(opt llms.ModelOptions) (llms.LLM, error) {
+		l, err := FromYaml(opt)
+		if err != nil {
+			return nil, err
+		}
+		return l, nil
+	})
+}
+
 func defaultOpenAI() *OpenAI {
 	return &OpenAI{
 		APIHost: DefaultOpenAIAPIURL,
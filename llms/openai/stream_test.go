@@ -0,0 +1,119 @@
+package openai_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nexptr/llmchain/llms/openai"
+	"github.com/nexptr/llmchain/schema"
+)
+
+func sseServer(t *testing.T, hang chan struct{}) *httptest.Server {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(`Content-Type`, `text/event-stream`)
+		for _, word := range []string{`hello`, ` world`} {
+			fmt.Fprintf(w, "data: {\"choices\":[{\"delta\":{\"role\":\"assistant\",\"content\":%q}}]}\n\n", word)
+			w.(http.Flusher).Flush()
+			if hang != nil {
+				<-r.Context().Done()
+				close(hang)
+				return
+			}
+		}
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{},\"finish_reason\":\"stop\"}]}\n\ndata: [DONE]\n\n")
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func chatRequest() *schema.ChatRequest {
+	return &schema.ChatRequest{Model: `gpt-3.5-turbo`, Messages: []schema.Message{schema.BuildUserMessage(`hi`)}}
+}
+
+func TestOpenAI_ChatStream(t *testing.T) {
+
+	ts := sseServer(t, nil)
+	ai := openai.New(openai.WithAPIHost(ts.URL))
+
+	stream, err := ai.ChatStream(context.Background(), chatRequest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+
+	text := ``
+	for {
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		text += chunk.Choices[0].Delta.Content
+	}
+
+	if text != `hello world` {
+		t.Fatalf(`unexpected text %q`, text)
+	}
+}
+
+func TestOpenAI_ChatStreamCallback(t *testing.T) {
+
+	ts := sseServer(t, nil)
+	ai := openai.New(openai.WithAPIHost(ts.URL))
+
+	req := chatRequest()
+	chunks, done := 0, false
+	req.StreamCallback = func(res *schema.ChatResponse, d bool, err error) {
+		if d {
+			done = true
+			return
+		}
+		chunks++
+	}
+
+	// callback api blocks until the stream finished
+	resp, err := ai.Chat(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !done || chunks != 3 || resp.Choices[0].Message.Content != `hello world` || resp.Choices[0].FinishReason != `stop` {
+		t.Fatalf(`unexpected result: done=%v chunks=%d resp=%s`, done, chunks, resp.String())
+	}
+}
+
+func TestOpenAI_ChatStreamCancel(t *testing.T) {
+
+	hang := make(chan struct{})
+	ts := sseServer(t, hang)
+	ai := openai.New(openai.WithAPIHost(ts.URL))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := ai.ChatStream(ctx, chatRequest())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := stream.Recv(); err != nil {
+		t.Fatal(err)
+	}
+
+	cancel()
+
+	if _, err := stream.Recv(); !errors.Is(err, context.Canceled) {
+		t.Fatalf(`expect context canceled, got %v`, err)
+	}
+
+	select {
+	case <-hang:
+	case <-time.After(5 * time.Second):
+		t.Fatal(`upstream request not canceled`)
+	}
+}
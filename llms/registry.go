@@ -0,0 +1,178 @@
+package llms
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Factory instantiate LLM by ModelOptions, example: openai.FromYaml
+type Factory func(opt ModelOptions) (LLM, error)
+
+type modelPattern struct {
+	pattern  string
+	provider string
+}
+
+var registry = struct {
+	sync.RWMutex
+	providers map[string]Factory
+	// models exact model name -> provider name
+	models map[ModelType]string
+	// patterns wildcard model name -> provider name, longest pattern first
+	patterns []modelPattern
+	// aliases alias -> model name
+	aliases map[string]ModelType
+}{
+	providers: map[string]Factory{},
+	models:    map[ModelType]string{},
+	aliases:   map[string]ModelType{},
+}
+
+// RegisterProvider register provider factory by name, providers register themselves in init:
+//
+//	llms.RegisterProvider(`openai`, func(opt llms.ModelOptions) (llms.LLM, error) { return FromYaml(opt) })
+//
+// same name will be replaced by later register.
+func RegisterProvider(name string, factory Factory) {
+	registry.Lock()
+	defer registry.Unlock()
+	registry.providers[name] = factory
+}
+
+// HasProvider report whether provider has been registered.
+func HasProvider(name string) bool {
+	registry.RLock()
+	defer registry.RUnlock()
+	_, ok := registry.providers[name]
+	return ok
+}
+
+// Providers return sorted names of registered providers.
+func Providers() []string {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	names := make([]string, 0, len(registry.providers))
+	for name := range registry.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// RegisterModel bind model name to provider, model support wildcard '*' and '?', example: gpt-4*
+func RegisterModel(model ModelType, provider string) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	if !strings.ContainsAny(model, `*?`) {
+		registry.models[model] = provider
+		return
+	}
+
+	for i, p := range registry.patterns {
+		if p.pattern == model {
+			registry.patterns[i].provider = provider
+			return
+		}
+	}
+
+	registry.patterns = append(registry.patterns, modelPattern{pattern: model, provider: provider})
+	sort.SliceStable(registry.patterns, func(i, j int) bool {
+		return len(registry.patterns[i].pattern) > len(registry.patterns[j].pattern)
+	})
+}
+
+// RegisterAlias register alias of model, example: gpt4 -> gpt-4
+func RegisterAlias(alias string, model ModelType) {
+	registry.Lock()
+	defer registry.Unlock()
+	registry.aliases[alias] = model
+}
+
+// ResolveAlias return the model name of alias, name is returned if it's not an alias.
+func ResolveAlias(name string) ModelType {
+	registry.RLock()
+	defer registry.RUnlock()
+	if m, ok := registry.aliases[name]; ok {
+		return m
+	}
+	return name
+}
+
+// ProviderOf return provider name of model by exact name, alias or wildcard pattern. empty if not found.
+func ProviderOf(model ModelType) string {
+
+	model = ResolveAlias(model)
+
+	registry.RLock()
+	defer registry.RUnlock()
+
+	if p, ok := registry.models[model]; ok {
+		return p
+	}
+
+	for _, p := range registry.patterns {
+		if wildcardMatch(p.pattern, model) {
+			return p.provider
+		}
+	}
+	return ``
+}
+
+// NewModel instantiate model by the registered provider factory.
+func NewModel(opt ModelOptions) (LLM, error) {
+
+	provider := opt.Provider()
+
+	registry.RLock()
+	factory, ok := registry.providers[provider]
+	registry.RUnlock()
+
+	if !ok {
+		if provider == `` {
+			return nil, fmt.Errorf(`provider of model '%s' unknown`, opt.Name)
+		}
+		return nil, fmt.Errorf(`provider '%s' of model '%s' not registered`, provider, opt.Name)
+	}
+
+	llm, err := factory(opt)
+	if err != nil || opt.Retry == nil {
+		return llm, err
+	}
+
+	return WithRetry(llm, *opt.Retry), nil
+}
+
+// wildcardMatch match name with pattern, '*' matches any sequence and '?' matches any single char.
+func wildcardMatch(pattern, name string) bool {
+
+	p, n := []rune(pattern), []rune(name)
+	// star the last '*' position in pattern, and matched name position.
+	star, match := -1, 0
+	i, j := 0, 0
+
+	for j < len(n) {
+		switch {
+		case i < len(p) && (p[i] == '?' || p[i] == n[j]):
+			i++
+			j++
+		case i < len(p) && p[i] == '*':
+			star, match = i, j
+			i++
+		case star != -1:
+			i = star + 1
+			match++
+			j = match
+		default:
+			return false
+		}
+	}
+
+	for i < len(p) && p[i] == '*' {
+		i++
+	}
+	return i == len(p)
+}
@@ -0,0 +1,84 @@
+package llms_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nexptr/llmchain/llms"
+	"github.com/nexptr/llmchain/schema"
+)
+
+type thirdParty struct {
+	name string
+}
+
+func (t *thirdParty) Name() string { return t.name }
+func (t *thirdParty) Free()        {}
+func (t *thirdParty) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return prompt, nil
+}
+func (t *thirdParty) Chat(ctx context.Context, req *schema.ChatRequest) (*schema.ChatResponse, error) {
+	return nil, nil
+}
+func (t *thirdParty) Completion(ctx context.Context, req *schema.CompletionRequest) (*schema.CompletionResponse, error) {
+	return nil, nil
+}
+func (t *thirdParty) Embeddings(ctx context.Context, req *schema.EmbeddingsRequest) (*schema.EmbeddingsResponse, error) {
+	return nil, nil
+}
+
+func TestProviderOf(t *testing.T) {
+
+	cases := map[string]string{
+		`gpt-4`:                  `openai`,
+		`gpt-4-0613`:             `openai`,
+		`gpt-3.5-turbo-16k`:      `openai`,
+		`text-embedding-ada-002`: `openai`,
+		`ggml-llama-7b`:          `local`,
+		`ggml-foo/bar`:           `local`,
+		`vicuna-13b-v1.5-16k`:    `fschat`,
+		`not-a-model`:            ``,
+	}
+
+	for model, want := range cases {
+		if got := llms.ProviderOf(model); got != want {
+			t.Errorf(`ProviderOf(%s) = %s, want %s`, model, got, want)
+		}
+	}
+
+	if llms.GetModelType(`gpt-4-0613`) != llms.ModelOpenAI {
+		t.Errorf(`GetModelType(gpt-4-0613) = %v`, llms.GetModelType(`gpt-4-0613`))
+	}
+}
+
+func TestRegisterProvider(t *testing.T) {
+
+	llms.RegisterProvider(`third-party`, func(opt llms.ModelOptions) (llms.LLM, error) {
+		return &thirdParty{name: opt.Name}, nil
+	})
+	llms.RegisterModel(`tp-*-chat`, `third-party`)
+	llms.RegisterModel(`tp-exact`, `third-party`)
+	llms.RegisterAlias(`tp`, `tp-exact`)
+
+	for _, model := range []string{`tp-7b-chat`, `tp-exact`, `tp`} {
+		if got := llms.ProviderOf(model); got != `third-party` {
+			t.Errorf(`ProviderOf(%s) = %s`, model, got)
+		}
+	}
+
+	if llms.ResolveAlias(`tp`) != `tp-exact` {
+		t.Errorf(`unexpected alias %s`, llms.ResolveAlias(`tp`))
+	}
+
+	llm, err := llms.NewModel(llms.ModelOptions{Name: `tp-13b-chat`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if llm.Name() != `tp-13b-chat` {
+		t.Errorf(`unexpected model %s`, llm.Name())
+	}
+
+	if _, err := llms.NewModel(llms.ModelOptions{Name: `x`, Type: `missing`}); err == nil {
+		t.Error(`expect error for unregistered provider`)
+	}
+}
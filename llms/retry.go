@@ -0,0 +1,257 @@
+package llms
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/nexptr/llmchain/schema"
+	"github.com/nexptr/llmchain/tokenizer"
+)
+
+// RetryPolicy configures WithRetry, only errors reported by IsRetryable are retried.
+type RetryPolicy struct {
+	// MaxRetries max retries after the first attempt, 0 disable retry.
+	MaxRetries int `json:"max_retries" yaml:"max_retries"`
+	// InitialBackoff wait duration before the first retry.
+	InitialBackoff time.Duration `json:"initial_backoff" yaml:"initial_backoff"`
+	// MaxBackoff upper bound of the backoff, Retry-After of provider is not bounded by it.
+	MaxBackoff time.Duration `json:"max_backoff" yaml:"max_backoff"`
+	// Multiplier backoff is multiplied by it after every retry.
+	Multiplier float64 `json:"multiplier" yaml:"multiplier"`
+	// Jitter randomize backoff in [backoff*(1-Jitter), backoff*(1+Jitter)], between 0 and 1.
+	Jitter float64 `json:"jitter" yaml:"jitter"`
+}
+
+// DefaultRetryPolicy retry 3 times, backoff 0.5s, 1s, 2s with 20% jitter.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxRetries:     3,
+		InitialBackoff: 500 * time.Millisecond,
+		MaxBackoff:     30 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.2,
+	}
+}
+
+// backoff return the wait duration before retry attempt (start from 0), Retry-After of err is honoured.
+func (p RetryPolicy) backoff(attempt int, err error) time.Duration {
+
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	d := float64(p.InitialBackoff) * math.Pow(multiplier, float64(attempt))
+	if p.MaxBackoff > 0 && d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		d *= 1 - p.Jitter + 2*p.Jitter*rand.Float64()
+	}
+
+	wait := time.Duration(d)
+	var e *Error
+	if errors.As(err, &e) && e.RetryAfter > wait {
+		wait = e.RetryAfter
+	}
+
+	return wait
+}
+
+var _ LLM = &retryLLM{}
+var _ Streamer = &retryLLM{}
+var _ Tokenized = &retryLLM{}
+
+// retryLLM retry the transient errors of LLM.
+type retryLLM struct {
+	LLM
+	policy RetryPolicy
+}
+
+// WithRetry wrap llm to retry Chat, Completion and Embeddings with jittered exponential backoff.
+// The retries stop once the next backoff exceeds the deadline of ctx, and a stream is never retried
+// after the first chunk has been delivered.
+func WithRetry(llm LLM, policy RetryPolicy) LLM {
+	return &retryLLM{LLM: llm, policy: policy}
+}
+
+// do call fn until it succeeds, the error is not retryable or retries are exhausted.
+func (r *retryLLM) do(ctx context.Context, fn func() error) error {
+
+	for attempt := 0; ; attempt++ {
+
+		err := fn()
+		if err == nil || attempt >= r.policy.MaxRetries || !IsRetryable(err) {
+			return err
+		}
+
+		wait := r.policy.backoff(attempt, err)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			return err
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// Tokenizer implements Tokenized.
+func (r *retryLLM) Tokenizer() tokenizer.Tokenizer {
+	return TokenizerOf(r.LLM)
+}
+
+// Call implements LLM, the stream callback is retried only if no chunk has been delivered.
+func (r *retryLLM) Call(ctx context.Context, prompt string, options ...CallOption) (ret string, err error) {
+
+	opts := InitCallOptions(options...)
+	if opts.CallBackFn == nil {
+		err = r.do(ctx, func() (err error) {
+			ret, err = r.LLM.Call(ctx, prompt, options...)
+			return
+		})
+		return
+	}
+
+	g := &streamGuard{cb: opts.CallBackFn}
+	options = append(append([]CallOption{}, options...), WithSreamCallBack(g.callback))
+
+	err = r.do(ctx, func() (err error) {
+		g.failed = nil
+		ret, err = r.LLM.Call(ctx, prompt, options...)
+		return g.check(err)
+	})
+	return ret, g.finish(err)
+}
+
+// Chat implements LLM, the StreamCallback is retried only if no chunk has been delivered.
+func (r *retryLLM) Chat(ctx context.Context, req *schema.ChatRequest) (resp *schema.ChatResponse, err error) {
+
+	if req.StreamCallback == nil {
+		err = r.do(ctx, func() (err error) {
+			resp, err = r.LLM.Chat(ctx, req)
+			return
+		})
+		return
+	}
+
+	g := &streamGuard{cb: req.StreamCallback}
+	wrapped := *req
+	wrapped.StreamCallback = g.callback
+
+	err = r.do(ctx, func() (err error) {
+		g.failed = nil
+		resp, err = r.LLM.Chat(ctx, &wrapped)
+		return g.check(err)
+	})
+	return resp, g.finish(err)
+}
+
+// streamGuard wrap the stream callback of retried calls: the chunks are passed through, the error
+// ending the stream before any chunk is held until we know it's not retried.
+type streamGuard struct {
+	cb        schema.SreamCallBack
+	delivered bool
+	failed    error
+}
+
+func (g *streamGuard) callback(res *schema.ChatResponse, done bool, e error) {
+	switch {
+	case !done:
+		g.delivered = true
+		g.cb(res, done, e)
+	case e != nil && !g.delivered:
+		g.failed = e
+	default:
+		g.cb(res, done, e)
+	}
+}
+
+// check mark err not retryable if chunks have been delivered.
+func (g *streamGuard) check(err error) error {
+	if err != nil && g.delivered {
+		return &streamDelivered{err}
+	}
+	return err
+}
+
+// finish pass the held error to callback once retries end, return the error of call.
+func (g *streamGuard) finish(err error) error {
+	if d, ok := err.(*streamDelivered); ok {
+		err = d.err
+	}
+	if g.failed != nil {
+		g.cb(nil, true, g.failed)
+	}
+	return err
+}
+
+// streamDelivered mark err as not retryable as chunks have been delivered, it does not unwrap on purpose.
+type streamDelivered struct {
+	err error
+}
+
+func (s *streamDelivered) Error() string {
+	return s.err.Error()
+}
+
+// ChatStream implements Streamer, both opening the stream and receiving the first chunk are retried.
+func (r *retryLLM) ChatStream(ctx context.Context, req *schema.ChatRequest) (*ChatStream, error) {
+
+	var stream *ChatStream
+	var first *schema.ChatResponse
+	var firstErr error
+
+	err := r.do(ctx, func() (err error) {
+		if stream, err = OpenStream(ctx, r.LLM, req); err != nil {
+			return
+		}
+		first, firstErr = stream.Recv()
+		if firstErr != nil && firstErr != io.EOF {
+			return firstErr
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	pending := true
+
+	return NewChatStream(func() (*schema.ChatResponse, error) {
+		if pending {
+			pending = false
+			if firstErr != nil {
+				return nil, firstErr
+			}
+			return first, nil
+		}
+		return stream.Recv()
+	}, stream.Close), nil
+}
+
+// Completion implements LLM.
+func (r *retryLLM) Completion(ctx context.Context, req *schema.CompletionRequest) (resp *schema.CompletionResponse, err error) {
+	err = r.do(ctx, func() (err error) {
+		resp, err = r.LLM.Completion(ctx, req)
+		return
+	})
+	return
+}
+
+// Embeddings implements LLM.
+func (r *retryLLM) Embeddings(ctx context.Context, req *schema.EmbeddingsRequest) (resp *schema.EmbeddingsResponse, err error) {
+	err = r.do(ctx, func() (err error) {
+		resp, err = r.LLM.Embeddings(ctx, req)
+		return
+	})
+	return
+}
@@ -0,0 +1,215 @@
+package llms_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/nexptr/llmchain/llms"
+	"github.com/nexptr/llmchain/schema"
+)
+
+// flakyLLM fail the first fails requests with err, stream chunks delivered before failing if partial.
+type flakyLLM struct {
+	thirdParty
+	fails   int
+	err     error
+	partial bool
+	calls   int
+}
+
+func (f *flakyLLM) Chat(ctx context.Context, req *schema.ChatRequest) (*schema.ChatResponse, error) {
+
+	f.calls++
+	msg := schema.BuildAIMessage(`ok`)
+
+	if f.calls <= f.fails {
+		if req.StreamCallback != nil {
+			if f.partial {
+				req.StreamCallback(&schema.ChatResponse{Choices: []schema.Choice{{Delta: &msg}}}, false, nil)
+			}
+			req.StreamCallback(nil, true, f.err)
+		}
+		return nil, f.err
+	}
+
+	if req.StreamCallback != nil {
+		req.StreamCallback(&schema.ChatResponse{Choices: []schema.Choice{{Delta: &msg}}}, false, nil)
+		req.StreamCallback(nil, true, nil)
+	}
+	return &schema.ChatResponse{Choices: []schema.Choice{{Message: &msg}}}, nil
+}
+
+func (f *flakyLLM) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+
+	opts := llms.InitCallOptions(options...)
+	resp, err := f.Chat(ctx, &schema.ChatRequest{StreamCallback: opts.CallBackFn})
+	if err != nil {
+		return ``, err
+	}
+	return resp.Choices[0].Message.Content, nil
+}
+
+func retryPolicy() llms.RetryPolicy {
+	return llms.RetryPolicy{MaxRetries: 3, InitialBackoff: time.Millisecond, Multiplier: 2}
+}
+
+func unavailable(retryAfter time.Duration) error {
+	return &llms.Error{Provider: `fake`, Kind: llms.ErrUnavailable, Retryable: true, RetryAfter: retryAfter}
+}
+
+func TestWithRetry(t *testing.T) {
+
+	f := &flakyLLM{fails: 2, err: unavailable(0)}
+
+	if _, err := llms.WithRetry(f, retryPolicy()).Chat(context.Background(), &schema.ChatRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	if f.calls != 3 {
+		t.Fatalf(`expect 3 calls, got %d`, f.calls)
+	}
+}
+
+func TestWithRetry_Exhausted(t *testing.T) {
+
+	f := &flakyLLM{fails: 10, err: unavailable(0)}
+
+	_, err := llms.WithRetry(f, retryPolicy()).Chat(context.Background(), &schema.ChatRequest{})
+	if !errors.Is(err, llms.ErrUnavailable) || f.calls != 4 {
+		t.Fatalf(`unexpected %v after %d calls`, err, f.calls)
+	}
+}
+
+func TestWithRetry_NotRetryable(t *testing.T) {
+
+	f := &flakyLLM{fails: 1, err: &llms.Error{Kind: llms.ErrContextLengthExceeded}}
+
+	_, err := llms.WithRetry(f, retryPolicy()).Chat(context.Background(), &schema.ChatRequest{})
+	if !errors.Is(err, llms.ErrContextLengthExceeded) || f.calls != 1 {
+		t.Fatalf(`unexpected %v after %d calls`, err, f.calls)
+	}
+}
+
+func TestWithRetry_RetryAfter(t *testing.T) {
+
+	f := &flakyLLM{fails: 1, err: unavailable(50 * time.Millisecond)}
+
+	start := time.Now()
+	if _, err := llms.WithRetry(f, retryPolicy()).Chat(context.Background(), &schema.ChatRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(start) < 50*time.Millisecond {
+		t.Fatalf(`Retry-After not honoured, retried after %v`, time.Since(start))
+	}
+}
+
+func TestWithRetry_Deadline(t *testing.T) {
+
+	f := &flakyLLM{fails: 1, err: unavailable(time.Minute)}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := llms.WithRetry(f, retryPolicy()).Chat(ctx, &schema.ChatRequest{})
+	if !errors.Is(err, llms.ErrUnavailable) || time.Since(start) > 50*time.Millisecond {
+		t.Fatalf(`unexpected %v after %v`, err, time.Since(start))
+	}
+}
+
+func TestWithRetry_StreamCallback(t *testing.T) {
+
+	f := &flakyLLM{fails: 1, err: unavailable(0)}
+
+	chunks, errs := 0, 0
+	req := &schema.ChatRequest{StreamCallback: func(res *schema.ChatResponse, done bool, err error) {
+		if err != nil {
+			errs++
+		}
+		if !done {
+			chunks++
+		}
+	}}
+
+	if _, err := llms.WithRetry(f, retryPolicy()).Chat(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+	if f.calls != 2 || chunks != 1 || errs != 0 {
+		t.Fatalf(`unexpected calls %d chunks %d errors %d`, f.calls, chunks, errs)
+	}
+}
+
+func TestWithRetry_StreamDelivered(t *testing.T) {
+
+	f := &flakyLLM{fails: 1, err: unavailable(0), partial: true}
+
+	errs := 0
+	req := &schema.ChatRequest{StreamCallback: func(res *schema.ChatResponse, done bool, err error) {
+		if err != nil {
+			errs++
+		}
+	}}
+
+	_, err := llms.WithRetry(f, retryPolicy()).Chat(context.Background(), req)
+	if !errors.Is(err, llms.ErrUnavailable) || f.calls != 1 || errs != 1 {
+		t.Fatalf(`unexpected %v calls %d errors %d`, err, f.calls, errs)
+	}
+}
+
+func TestWithRetry_CallStreamDelivered(t *testing.T) {
+
+	f := &flakyLLM{fails: 1, err: unavailable(0), partial: true}
+
+	chunks, errs := 0, 0
+	cb := func(res *schema.ChatResponse, done bool, err error) {
+		if err != nil {
+			errs++
+		}
+		if !done {
+			chunks++
+		}
+	}
+
+	_, err := llms.WithRetry(f, retryPolicy()).Call(context.Background(), `hi`, llms.WithSreamCallBack(cb))
+	if !errors.Is(err, llms.ErrUnavailable) || f.calls != 1 || chunks != 1 || errs != 1 {
+		t.Fatalf(`unexpected %v calls %d chunks %d errors %d`, err, f.calls, chunks, errs)
+	}
+
+	// retried if no chunk delivered.
+	f = &flakyLLM{fails: 1, err: unavailable(0)}
+	chunks, errs = 0, 0
+
+	out, err := llms.WithRetry(f, retryPolicy()).Call(context.Background(), `hi`, llms.WithSreamCallBack(cb))
+	if err != nil || out != `ok` || f.calls != 2 || chunks != 1 || errs != 0 {
+		t.Fatalf(`unexpected %q %v calls %d chunks %d errors %d`, out, err, f.calls, chunks, errs)
+	}
+}
+
+func TestWithRetry_ChatStream(t *testing.T) {
+
+	f := &flakyLLM{fails: 2, err: unavailable(0)}
+
+	stream, err := llms.WithRetry(f, retryPolicy()).(llms.Streamer).ChatStream(context.Background(), &schema.ChatRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+
+	text := ``
+	for {
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		text += chunk.Choices[0].Delta.Content
+	}
+
+	if text != `ok` || f.calls != 3 {
+		t.Fatalf(`unexpected text %q after %d calls`, text, f.calls)
+	}
+}
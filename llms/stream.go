@@ -0,0 +1,208 @@
+package llms
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/nexptr/llmchain/schema"
+)
+
+// Streamer is implemented by LLMs which support streaming chat completions.
+type Streamer interface {
+	// ChatStream send chat request and return the stream of chunks,
+	// cancel ctx or Close the stream to stop the upstream.
+	ChatStream(ctx context.Context, req *schema.ChatRequest) (*ChatStream, error)
+}
+
+// ChatStream reader of streaming chat chunks, every chunk carries the new text in Choices[].Delta.
+// It's not safe to call Recv concurrently.
+type ChatStream struct {
+	recv  func() (*schema.ChatResponse, error)
+	close func() error
+
+	// err sticky error of Recv, io.EOF when finished.
+	err error
+
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// NewChatStream return ChatStream for providers, recv returns io.EOF when the stream finished,
+// close release the http body or gRPC stream.
+func NewChatStream(recv func() (*schema.ChatResponse, error), close func() error) *ChatStream {
+	return &ChatStream{recv: recv, close: close}
+}
+
+// Recv return the next chunk, io.EOF is returned when the stream finished normally.
+// The stream is closed automatically once Recv returns an error.
+func (s *ChatStream) Recv() (*schema.ChatResponse, error) {
+
+	if s.err != nil {
+		return nil, s.err
+	}
+
+	resp, err := s.recv()
+	if err != nil {
+		s.err = err
+		s.Close()
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// Close stop the stream and release upstream resources, it's safe to call Close more than once.
+func (s *ChatStream) Close() error {
+	s.closeOnce.Do(func() {
+		if s.close != nil {
+			s.closeErr = s.close()
+		}
+	})
+	return s.closeErr
+}
+
+// OpenStream open chat stream of llm, LLMs not implement Streamer are adapted by the StreamCallback api.
+func OpenStream(ctx context.Context, llm LLM, req *schema.ChatRequest) (*ChatStream, error) {
+
+	if s, ok := llm.(Streamer); ok {
+		return s.ChatStream(ctx, req)
+	}
+
+	return callbackStream(ctx, llm, req), nil
+}
+
+type streamEvent struct {
+	resp *schema.ChatResponse
+	done bool
+	err  error
+}
+
+// callbackStream adapt the StreamCallback of LLM.Chat to ChatStream.
+func callbackStream(ctx context.Context, llm LLM, rawReq *schema.ChatRequest) *ChatStream {
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	events := make(chan streamEvent)
+
+	// finished is set once the callback fired with done.
+	var finished atomic.Bool
+
+	req := *rawReq
+	req.Stream = true
+	req.StreamCallback = func(res *schema.ChatResponse, done bool, err error) {
+		if done {
+			finished.Store(true)
+		}
+		select {
+		case events <- streamEvent{resp: res, done: done, err: err}:
+		case <-ctx.Done():
+		}
+	}
+
+	go func() {
+		resp, err := llm.Chat(ctx, &req)
+		if err != nil {
+			req.StreamCallback(nil, true, err)
+			return
+		}
+
+		// LLMs ignoring StreamCallback return the complete response, stream it as single chunk.
+		if resp != nil && !finished.Load() {
+			req.StreamCallback(deltaChunk(resp), false, nil)
+			req.StreamCallback(nil, true, nil)
+		}
+	}()
+
+	recv := func() (*schema.ChatResponse, error) {
+		for {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case ev := <-events:
+				switch {
+				case ev.err != nil:
+					return nil, ev.err
+				case ev.done:
+					return nil, io.EOF
+				case ev.resp != nil:
+					return ev.resp, nil
+				}
+			}
+		}
+	}
+
+	return NewChatStream(recv, func() error {
+		cancel()
+		return nil
+	})
+}
+
+// deltaChunk return copy of the complete resp as chunk, the messages are moved to Delta.
+func deltaChunk(resp *schema.ChatResponse) *schema.ChatResponse {
+
+	chunk := *resp
+	chunk.Choices = make([]schema.Choice, len(resp.Choices))
+	for i, c := range resp.Choices {
+		if c.Delta == nil {
+			c.Delta, c.Message = c.Message, nil
+		}
+		chunk.Choices[i] = c
+	}
+	return &chunk
+}
+
+// ConsumeStream read all chunks of stream to cb until finished, and return the aggregated response.
+// The StreamCallback api of providers is built on it, so cb is called in the caller goroutine
+// and ConsumeStream blocks until the stream finished.
+func ConsumeStream(stream *ChatStream, cb schema.SreamCallBack) (*schema.ChatResponse, error) {
+
+	defer stream.Close()
+
+	ret := &schema.ChatResponse{Object: `chat.completion`}
+	content := strings.Builder{}
+	finishReason := ``
+
+	for {
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if cb != nil {
+				cb(nil, true, err)
+			}
+			return nil, err
+		}
+
+		if ret.ID == `` {
+			ret.ID, ret.Created, ret.Model = chunk.ID, chunk.Created, chunk.Model
+		}
+		if chunk.Usage.TotalTokens > 0 {
+			ret.Usage = chunk.Usage
+		}
+		for _, c := range chunk.Choices {
+			if c.Delta != nil {
+				content.WriteString(c.Delta.Content)
+			}
+			if c.FinishReason != `` {
+				finishReason = c.FinishReason
+			}
+		}
+
+		if cb != nil {
+			cb(chunk, false, nil)
+		}
+	}
+
+	msg := schema.BuildAIMessage(content.String())
+	ret.Choices = []schema.Choice{{Message: &msg, FinishReason: finishReason}}
+
+	if cb != nil {
+		cb(nil, true, nil)
+	}
+
+	return ret, nil
+}
@@ -0,0 +1,44 @@
+package llms_test
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/nexptr/llmchain/llms"
+	"github.com/nexptr/llmchain/schema"
+)
+
+// plainLLM ignore StreamCallback and return the complete response.
+type plainLLM struct {
+	thirdParty
+}
+
+func (p *plainLLM) Chat(ctx context.Context, req *schema.ChatRequest) (*schema.ChatResponse, error) {
+	msg := schema.BuildAIMessage(`complete answer`)
+	return &schema.ChatResponse{ID: `plain`, Choices: []schema.Choice{{Message: &msg, FinishReason: `stop`}}}, nil
+}
+
+func TestOpenStream_NonStreamingLLM(t *testing.T) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := llms.OpenStream(ctx, &plainLLM{thirdParty{`plain`}}, &schema.ChatRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chunk, err := stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chunk.ID != `plain` || chunk.Choices[0].Delta == nil || chunk.Choices[0].Delta.Content != `complete answer` || chunk.Choices[0].FinishReason != `stop` {
+		t.Fatalf(`unexpected chunk %+v`, chunk)
+	}
+
+	if _, err := stream.Recv(); err != io.EOF {
+		t.Fatalf(`expect io.EOF, got %v`, err)
+	}
+}
@@ -0,0 +1,126 @@
+package memory
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/nexptr/llmchain/schema"
+)
+
+// Buffer keep the conversation in memory, the last Window turns only if Window > 0.
+type Buffer struct {
+	cfg Config
+
+	mu       sync.RWMutex
+	messages []schema.Message
+}
+
+var _ schema.Memory = &Buffer{}
+
+// NewBuffer return buffer memory, the empty keys and prefixes of cfg are defaulted.
+func NewBuffer(cfg Config) *Buffer {
+
+	cfg.Type = TypeBuffer
+	if cfg.MemoryKey == `` {
+		cfg.MemoryKey = `history`
+	}
+	if cfg.InputKey == `` {
+		cfg.InputKey = `input`
+	}
+	if cfg.OutputKey == `` {
+		cfg.OutputKey = `output`
+	}
+	if cfg.HumanPrefix == `` {
+		cfg.HumanPrefix = `Human`
+	}
+	if cfg.AIPrefix == `` {
+		cfg.AIPrefix = `AI`
+	}
+
+	return &Buffer{cfg: cfg}
+}
+
+// Config implements Configurable.
+func (b *Buffer) Config() Config {
+	return b.cfg
+}
+
+// Messages return copy of the history.
+func (b *Buffer) Messages() []schema.Message {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return append([]schema.Message{}, b.messages...)
+}
+
+// MemoryVariables implements schema.Memory.
+func (b *Buffer) MemoryVariables() []string {
+	return []string{b.cfg.MemoryKey}
+}
+
+// LoadMemoryVariables implements schema.Memory.
+func (b *Buffer) LoadMemoryVariables(inputs map[string]any) (map[string]any, error) {
+
+	messages := b.Messages()
+
+	if b.cfg.ReturnMessages {
+		return map[string]any{b.cfg.MemoryKey: messages}, nil
+	}
+
+	lines := make([]string, len(messages))
+	for i, m := range messages {
+		prefix := b.cfg.HumanPrefix
+		if m.Role == `assistant` {
+			prefix = b.cfg.AIPrefix
+		}
+		lines[i] = prefix + `: ` + m.Content
+	}
+
+	return map[string]any{b.cfg.MemoryKey: strings.Join(lines, "\n")}, nil
+}
+
+// SaveContext implements schema.Memory, the input of InputKey and output of OutputKey are saved as a turn.
+func (b *Buffer) SaveContext(inputs map[string]any, outputs map[string]any) error {
+
+	input, ok := inputs[b.cfg.InputKey]
+	if !ok {
+		return fmt.Errorf(`memory: input '%s' not found`, b.cfg.InputKey)
+	}
+	output, ok := outputs[b.cfg.OutputKey]
+	if !ok {
+		return fmt.Errorf(`memory: output '%s' not found`, b.cfg.OutputKey)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.messages = append(b.messages, schema.BuildUserMessage(text(input)), schema.BuildAIMessage(text(output)))
+
+	if w := b.cfg.Window; w > 0 && len(b.messages) > 2*w {
+		b.messages = append([]schema.Message{}, b.messages[len(b.messages)-2*w:]...)
+	}
+
+	return nil
+}
+
+// Clear implements schema.Memory.
+func (b *Buffer) Clear() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.messages = nil
+	return nil
+}
+
+func text(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case schema.Message:
+		return v.Content
+	case *schema.Message:
+		return v.Content
+	case fmt.Stringer:
+		return v.String()
+	}
+	return fmt.Sprint(v)
+}
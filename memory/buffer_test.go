@@ -0,0 +1,49 @@
+package memory_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/nexptr/llmchain/memory"
+	"github.com/nexptr/llmchain/schema"
+)
+
+func TestBuffer(t *testing.T) {
+
+	m, err := memory.New(memory.Config{Window: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, turn := range [][2]string{{`q1`, `a1`}, {`q2`, `a2`}} {
+		if err := m.SaveContext(map[string]any{`input`: turn[0]}, map[string]any{`output`: turn[1]}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	vars, err := m.LoadMemoryVariables(nil)
+	if err != nil || vars[`history`] != "Human: q2\nAI: a2" {
+		t.Fatalf(`unexpected history %q: %v`, vars[`history`], err)
+	}
+
+	if err := m.SaveContext(map[string]any{`question`: `q3`}, map[string]any{`output`: `a3`}); err == nil {
+		t.Fatal(`expect error of missing input`)
+	}
+
+	b := memory.NewBuffer(memory.Config{ReturnMessages: true, MemoryKey: `chat_history`})
+	b.SaveContext(map[string]any{`input`: `hi`}, map[string]any{`output`: schema.BuildAIMessage(`hello`)})
+
+	vars, _ = b.LoadMemoryVariables(nil)
+	if want := []schema.Message{schema.BuildUserMessage(`hi`), schema.BuildAIMessage(`hello`)}; !reflect.DeepEqual(vars[`chat_history`], want) {
+		t.Fatalf(`unexpected history %v`, vars)
+	}
+
+	b.Clear()
+	if len(b.Messages()) != 0 {
+		t.Fatal(`history not cleared`)
+	}
+
+	if _, err := memory.New(memory.Config{Type: `redis`}); err == nil {
+		t.Fatal(`expect unknown type`)
+	}
+}
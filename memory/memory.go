@@ -0,0 +1,62 @@
+// Package memory the memories of chains, which load the conversation history as variables of prompt
+// and save the inputs and outputs of every run.
+package memory
+
+import (
+	"fmt"
+
+	"github.com/nexptr/llmchain/schema"
+)
+
+// TypeBuffer the type of Buffer.
+const TypeBuffer = `buffer`
+
+// Config the serializable configure of memory.
+//
+//	type: buffer
+//	window: 5
+//	return_messages: true
+type Config struct {
+	// Type buffer (default)
+	Type string `yaml:"type,omitempty" json:"type,omitempty"`
+	// MemoryKey the variable of history, default history
+	MemoryKey string `yaml:"memory_key,omitempty" json:"memory_key,omitempty"`
+	// InputKey the input saved, default input
+	InputKey string `yaml:"input_key,omitempty" json:"input_key,omitempty"`
+	// OutputKey the output saved, default output
+	OutputKey string `yaml:"output_key,omitempty" json:"output_key,omitempty"`
+	// ReturnMessages load history as []schema.Message, otherwise the text of `Human: xxx\nAI: xxx` lines.
+	ReturnMessages bool `yaml:"return_messages,omitempty" json:"return_messages,omitempty"`
+	// Window keep the last turns only, all turns if 0.
+	Window int `yaml:"window,omitempty" json:"window,omitempty"`
+	// HumanPrefix and AIPrefix of the history text, default Human and AI.
+	HumanPrefix string `yaml:"human_prefix,omitempty" json:"human_prefix,omitempty"`
+	AIPrefix    string `yaml:"ai_prefix,omitempty" json:"ai_prefix,omitempty"`
+}
+
+// Configurable the memory which can be serialized by its Config.
+type Configurable interface {
+	Config() Config
+}
+
+// New return memory of cfg.
+func New(cfg Config) (schema.Memory, error) {
+
+	switch cfg.Type {
+	case ``, TypeBuffer:
+		if cfg.Window < 0 {
+			return nil, fmt.Errorf(`memory: window must be >= 0`)
+		}
+		return NewBuffer(cfg), nil
+	}
+
+	return nil, fmt.Errorf(`memory: unknown type '%s'`, cfg.Type)
+}
+
+// ConfigOf return the Config of memory, false if memory is not Configurable.
+func ConfigOf(memory schema.Memory) (Config, bool) {
+	if c, ok := memory.(Configurable); ok {
+		return c.Config(), true
+	}
+	return Config{}, false
+}
@@ -0,0 +1,134 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Docs return the API docs of operations for the request prompt of APIChain, all operations if no
+// ids (operationId or `METHOD /path`) given.
+func (s *Spec) Docs(ids ...string) string {
+
+	b := &strings.Builder{}
+
+	fmt.Fprintf(b, "API: %s", s.Info.Title)
+	if s.Info.Version != `` {
+		fmt.Fprintf(b, " %s", s.Info.Version)
+	}
+	if s.Info.Description != `` {
+		fmt.Fprintf(b, "\n%s", strings.TrimSpace(s.Info.Description))
+	}
+	fmt.Fprintf(b, "\nBASE URL: %s\n", s.BaseURL())
+
+	for _, op := range s.operations {
+		if len(ids) > 0 && !op.is(ids) {
+			continue
+		}
+		b.WriteString("\n")
+		b.WriteString(op.Docs())
+	}
+
+	return b.String()
+}
+
+func (op *Operation) is(ids []string) bool {
+	for _, id := range ids {
+		if id == op.OperationID || id == op.Method+` `+op.Path {
+			return true
+		}
+	}
+	return false
+}
+
+// Docs return the concise docs of operation.
+//
+//	GET /weather
+//	Get the weather of city.
+//	Parameters:
+//	- city (query, string, required): the city name
+func (op *Operation) Docs() string {
+
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "%s %s\n", op.Method, op.Path)
+
+	desc := strings.TrimSpace(op.Summary)
+	if d := strings.TrimSpace(op.Description); d != `` && d != desc {
+		if desc != `` {
+			desc += "\n"
+		}
+		desc += d
+	}
+	if desc != `` {
+		b.WriteString(desc + "\n")
+	}
+
+	if len(op.Parameters) > 0 {
+		b.WriteString("Parameters:\n")
+		for _, p := range op.Parameters {
+			attrs := []string{p.In}
+			if t := p.Schema.typeName(); t != `` {
+				attrs = append(attrs, t)
+			}
+			if p.Required {
+				attrs = append(attrs, `required`)
+			}
+			if p.Schema != nil && len(p.Schema.Enum) > 0 {
+				attrs = append(attrs, `one of: `+joinValues(p.Schema.Enum))
+			}
+
+			fmt.Fprintf(b, "- %s (%s)", p.Name, strings.Join(attrs, `, `))
+			if d := p.description(); d != `` {
+				fmt.Fprintf(b, ": %s", d)
+			}
+			b.WriteString("\n")
+		}
+	}
+
+	if op.RequestBody != nil {
+		b.WriteString("Request body")
+		if op.RequestBody.Required {
+			b.WriteString(" (required)")
+		}
+		if d := strings.TrimSpace(op.RequestBody.Description); d != `` {
+			fmt.Fprintf(b, ": %s", d)
+		}
+		b.WriteString("\n")
+		if schema := op.jsonBody(); schema != nil {
+			data, _ := json.Marshal(schema)
+			b.Write(data)
+			b.WriteString("\n")
+		}
+	}
+
+	return b.String()
+}
+
+func (p *Parameter) description() string {
+	if d := strings.TrimSpace(p.Description); d != `` {
+		return d
+	}
+	if p.Schema != nil {
+		return strings.TrimSpace(p.Schema.Description)
+	}
+	return ``
+}
+
+// typeName return type of schema, example: string, array of integer.
+func (s *Schema) typeName() string {
+	if s == nil {
+		return ``
+	}
+	if s.Type == `array` && s.Items != nil && s.Items.Type != `` {
+		return `array of ` + s.Items.Type
+	}
+	return s.Type
+}
+
+func joinValues(values []any) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = fmt.Sprint(v)
+	}
+	return strings.Join(parts, `, `)
+}
@@ -0,0 +1,286 @@
+package openapi_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/nexptr/llmchain/chains"
+	"github.com/nexptr/llmchain/openapi"
+)
+
+const petstore = `openapi: 3.0.0
+info:
+  title: Petstore
+  version: "1.0"
+servers:
+  - url: {{URL}}/v1
+paths:
+  /pets:
+    get:
+      operationId: listPets
+      summary: List pets.
+      parameters:
+        - $ref: '#/components/parameters/limit'
+        - name: kind
+          in: query
+          schema:
+            type: string
+            enum: [cat, dog]
+    post:
+      summary: Create a pet.
+      requestBody:
+        required: true
+        content:
+          application/json:
+            schema:
+              $ref: '#/components/schemas/Pet'
+  /pets/{id}:
+    parameters:
+      - name: id
+        in: path
+        required: true
+        schema:
+          type: integer
+    get:
+      operationId: getPet
+      summary: Get a pet by id.
+components:
+  parameters:
+    limit:
+      name: limit
+      in: query
+      description: max number of pets
+      schema:
+        type: integer
+  schemas:
+    Pet:
+      type: object
+      required: [name]
+      properties:
+        name:
+          type: string
+        tags:
+          type: array
+          items:
+            type: string
+`
+
+func loadSpec(t *testing.T, serverURL string) *openapi.Spec {
+
+	file := filepath.Join(t.TempDir(), `petstore.yaml`)
+	if err := os.WriteFile(file, []byte(strings.ReplaceAll(petstore, `{{URL}}`, serverURL)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	spec, err := openapi.Load(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return spec
+}
+
+func TestSpec_Docs(t *testing.T) {
+
+	spec := loadSpec(t, `https://petstore.example.com`)
+
+	ops := []string{}
+	for _, op := range spec.Operations() {
+		ops = append(ops, op.Method+` `+op.Path)
+	}
+	if want := []string{`GET /pets`, `POST /pets`, `GET /pets/{id}`}; !reflect.DeepEqual(ops, want) {
+		t.Fatalf(`unexpected operations %v`, ops)
+	}
+
+	docs := spec.Docs(`listPets`, `POST /pets`)
+	for _, s := range []string{
+		`BASE URL: https://petstore.example.com/v1`,
+		"GET /pets\nList pets.\nParameters:\n- limit (query, integer): max number of pets\n- kind (query, string, one of: cat, dog)\n",
+		"POST /pets\nCreate a pet.\nRequest body (required)\n{\"type\":\"object\"",
+	} {
+		if !strings.Contains(docs, s) {
+			t.Fatalf("docs without %q:\n%s", s, docs)
+		}
+	}
+	if strings.Contains(docs, `/pets/{id}`) {
+		t.Fatalf("unexpected operation in docs:\n%s", docs)
+	}
+}
+
+func TestSpec_Validate(t *testing.T) {
+
+	spec := loadSpec(t, `https://petstore.example.com`)
+	base := `https://petstore.example.com/v1`
+
+	tests := []struct {
+		req *chains.APIRequest
+		err string
+	}{
+		{&chains.APIRequest{Method: `GET`, URL: base + `/pets?limit=10&kind=cat`}, ``},
+		{&chains.APIRequest{Method: `GET`, URL: base + `/pets/12`}, ``},
+		{&chains.APIRequest{Method: `POST`, URL: base + `/pets`, Body: `{"name":"kitty","tags":["a"]}`}, ``},
+		{&chains.APIRequest{Method: `GET`, URL: `https://evil.example.com/v1/pets`}, `is not under base url`},
+		{&chains.APIRequest{Method: `GET`, URL: base + `/owners`}, `unknown path '/owners'`},
+		{&chains.APIRequest{Method: `DELETE`, URL: base + `/pets/1`}, `method DELETE not allowed for path '/pets/1'`},
+		{&chains.APIRequest{Method: `GET`, URL: base + `/pets/abc`}, `path parameter 'id': 'abc' is not integer`},
+		{&chains.APIRequest{Method: `GET`, URL: base + `/pets?kind=bird`}, `query parameter 'kind': 'bird' is not one of: cat, dog`},
+		{&chains.APIRequest{Method: `GET`, URL: base + `/pets?color=red`}, `unknown query parameter 'color'`},
+		{&chains.APIRequest{Method: `POST`, URL: base + `/pets`}, `request body is required`},
+		{&chains.APIRequest{Method: `POST`, URL: base + `/pets`, Body: `{"tags":["a"]}`}, `request body: body.name is required`},
+		{&chains.APIRequest{Method: `POST`, URL: base + `/pets`, Body: `{"name":"kitty","tags":[1]}`}, `request body: body.tags[0]: expect string, got number`},
+	}
+
+	for _, tt := range tests {
+		_, err := spec.Validate(tt.req)
+		if tt.err == `` && err != nil || tt.err != `` && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+			t.Errorf(`%s: expect error %q, got %v`, tt.req, tt.err, err)
+		}
+	}
+}
+
+func TestTools(t *testing.T) {
+
+	var got string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		got = r.Method + ` ` + r.URL.String() + ` ` + string(data)
+		io.WriteString(w, `ok`)
+	}))
+	defer ts.Close()
+
+	spec := loadSpec(t, ts.URL)
+
+	executor, err := openapi.NewAPIChain(`petstore`, spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tools := map[string]*openapi.Tool{}
+	for _, tool := range spec.Tools(executor) {
+		tools[tool.Name] = tool
+	}
+
+	create, ok := tools[`post_pets`]
+	if !ok {
+		t.Fatalf(`unexpected tools %v`, tools)
+	}
+	schema, _ := json.Marshal(create.Parameters)
+	if want := `{"type":"object","properties":{"body":{"type":"object","properties":{"name":{"type":"string"},"tags":{"type":"array","items":{"type":"string"}}},"required":["name"]}},"required":["body"]}`; string(schema) != want {
+		t.Fatalf(`unexpected schema %s`, schema)
+	}
+
+	if _, err := tools[`getPet`].Call(context.Background(), `{"id":7}`); err != nil {
+		t.Fatal(err)
+	}
+	if got != `GET /v1/pets/7 ` {
+		t.Fatalf(`unexpected request %s`, got)
+	}
+
+	if _, err := tools[`listPets`].Call(context.Background(), `{"limit":5,"kind":"dog"}`); err != nil {
+		t.Fatal(err)
+	}
+	if got != `GET /v1/pets?kind=dog&limit=5 ` {
+		t.Fatalf(`unexpected request %s`, got)
+	}
+
+	if _, err := create.Call(context.Background(), `{"body":{"name":"kitty"}}`); err != nil {
+		t.Fatal(err)
+	}
+	if got != `POST /v1/pets {"name":"kitty"}` {
+		t.Fatalf(`unexpected request %s`, got)
+	}
+
+	if _, err := tools[`getPet`].Call(context.Background(), `{"id":"seven"}`); err == nil || err.Error() != `tool 'getPet': arguments.id: expect integer, got string` {
+		t.Fatalf(`unexpected error %v`, err)
+	}
+}
+
+func TestTools_BodyParameter(t *testing.T) {
+
+	spec, err := openapi.Parse([]byte(`openapi: 3.0.0
+info:
+  title: Notes
+  version: "1.0"
+servers:
+  - url: https://notes.example.com
+paths:
+  /notes:
+    post:
+      operationId: addNote
+      parameters:
+        - name: body
+          in: query
+          schema:
+            type: string
+      requestBody:
+        required: true
+        content:
+          text/plain:
+            schema:
+              type: string
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tool := spec.Tools(nil)[0]
+	if _, ok := tool.Parameters.Properties[`request_body`]; !ok || !reflect.DeepEqual(tool.Parameters.Required, []string{`request_body`}) {
+		t.Fatalf(`unexpected parameters %+v`, tool.Parameters)
+	}
+
+	req, err := tool.Request(`{"body":"markdown","request_body":"hello"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.URL != `https://notes.example.com/notes?body=markdown` || req.Body != `hello` {
+		t.Fatalf(`unexpected request %+v`, req)
+	}
+}
+
+func TestTools_EscapedPathParameter(t *testing.T) {
+
+	spec, err := openapi.Parse([]byte(`openapi: 3.0.0
+info:
+  title: Files
+  version: "1.0"
+servers:
+  - url: https://files.example.com/api
+paths:
+  /files/{name}:
+    get:
+      operationId: getFile
+      parameters:
+        - name: name
+          in: path
+          required: true
+          schema:
+            type: string
+            enum: [docs/readme.md]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := spec.Tools(nil)[0].Request(`{"name":"docs/readme.md"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.URL != `https://files.example.com/api/files/docs%2Freadme.md` {
+		t.Fatalf(`unexpected request %+v`, req)
+	}
+
+	// the escaped '/' is validated as part of the parameter.
+	if _, err := spec.Validate(req); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := spec.Validate(&chains.APIRequest{Method: `GET`, URL: `https://files.example.com/api/files/docs/readme.md`}); err == nil || !strings.Contains(err.Error(), `unknown path '/files/docs/readme.md'`) {
+		t.Fatalf(`unexpected error %v`, err)
+	}
+}
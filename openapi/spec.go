@@ -0,0 +1,355 @@
+// Package openapi load OpenAPI 3 spec to generate the docs and request validator of APIChain, and
+// the tools calling the operations.
+package openapi
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/nexptr/llmchain/utils"
+	"gopkg.in/yaml.v3"
+)
+
+// Spec the subset of OpenAPI 3 used to call the API.
+type Spec struct {
+	OpenAPI    string               `json:"openapi" yaml:"openapi"`
+	Info       Info                 `json:"info" yaml:"info"`
+	Servers    []Server             `json:"servers,omitempty" yaml:"servers,omitempty"`
+	Paths      map[string]*PathItem `json:"paths" yaml:"paths"`
+	Components Components           `json:"components,omitempty" yaml:"components,omitempty"`
+
+	operations []*Operation
+}
+
+type Info struct {
+	Title       string `json:"title" yaml:"title"`
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+	Version     string `json:"version" yaml:"version"`
+}
+
+type Server struct {
+	URL         string `json:"url" yaml:"url"`
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+}
+
+// Components the reusable objects referenced by $ref.
+type Components struct {
+	Schemas       map[string]*Schema      `json:"schemas,omitempty" yaml:"schemas,omitempty"`
+	Parameters    map[string]*Parameter   `json:"parameters,omitempty" yaml:"parameters,omitempty"`
+	RequestBodies map[string]*RequestBody `json:"requestBodies,omitempty" yaml:"requestBodies,omitempty"`
+}
+
+// PathItem the operations of a path, Parameters are shared by the operations.
+type PathItem struct {
+	Parameters []*Parameter `json:"parameters,omitempty" yaml:"parameters,omitempty"`
+	Get        *Operation   `json:"get,omitempty" yaml:"get,omitempty"`
+	Put        *Operation   `json:"put,omitempty" yaml:"put,omitempty"`
+	Post       *Operation   `json:"post,omitempty" yaml:"post,omitempty"`
+	Delete     *Operation   `json:"delete,omitempty" yaml:"delete,omitempty"`
+	Patch      *Operation   `json:"patch,omitempty" yaml:"patch,omitempty"`
+	Head       *Operation   `json:"head,omitempty" yaml:"head,omitempty"`
+}
+
+// Operation an API operation, Method and Path are set on load.
+type Operation struct {
+	Method string `json:"-" yaml:"-"`
+	Path   string `json:"-" yaml:"-"`
+
+	OperationID string       `json:"operationId,omitempty" yaml:"operationId,omitempty"`
+	Summary     string       `json:"summary,omitempty" yaml:"summary,omitempty"`
+	Description string       `json:"description,omitempty" yaml:"description,omitempty"`
+	Parameters  []*Parameter `json:"parameters,omitempty" yaml:"parameters,omitempty"`
+	RequestBody *RequestBody `json:"requestBody,omitempty" yaml:"requestBody,omitempty"`
+
+	pattern *regexp.Regexp
+	// pathNames the names of path parameters in order.
+	pathNames []string
+}
+
+// Parameter of path, query or header, the cookie parameters are ignored.
+type Parameter struct {
+	Ref         string  `json:"$ref,omitempty" yaml:"$ref,omitempty"`
+	Name        string  `json:"name,omitempty" yaml:"name,omitempty"`
+	In          string  `json:"in,omitempty" yaml:"in,omitempty"`
+	Description string  `json:"description,omitempty" yaml:"description,omitempty"`
+	Required    bool    `json:"required,omitempty" yaml:"required,omitempty"`
+	Schema      *Schema `json:"schema,omitempty" yaml:"schema,omitempty"`
+}
+
+type RequestBody struct {
+	Ref         string               `json:"$ref,omitempty" yaml:"$ref,omitempty"`
+	Description string               `json:"description,omitempty" yaml:"description,omitempty"`
+	Required    bool                 `json:"required,omitempty" yaml:"required,omitempty"`
+	Content     map[string]MediaType `json:"content,omitempty" yaml:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema,omitempty" yaml:"schema,omitempty"`
+}
+
+// Schema the subset of JSON schema, marshaled as the JSON schema of tool arguments.
+type Schema struct {
+	Ref         string             `json:"$ref,omitempty" yaml:"$ref,omitempty"`
+	Type        string             `json:"type,omitempty" yaml:"type,omitempty"`
+	Format      string             `json:"format,omitempty" yaml:"format,omitempty"`
+	Description string             `json:"description,omitempty" yaml:"description,omitempty"`
+	Enum        []any              `json:"enum,omitempty" yaml:"enum,omitempty"`
+	Items       *Schema            `json:"items,omitempty" yaml:"items,omitempty"`
+	Properties  map[string]*Schema `json:"properties,omitempty" yaml:"properties,omitempty"`
+	Required    []string           `json:"required,omitempty" yaml:"required,omitempty"`
+}
+
+// Load read spec from JSON (.json) or YAML (others) file.
+func Load(file string) (*Spec, error) {
+
+	s := &Spec{}
+	if err := utils.ReadFile(file, s); err != nil {
+		return nil, err
+	}
+
+	if err := s.init(); err != nil {
+		return nil, fmt.Errorf(`%s: %v`, file, err)
+	}
+	return s, nil
+}
+
+// Parse spec of JSON or YAML data.
+func Parse(data []byte) (*Spec, error) {
+
+	s := &Spec{}
+	if err := yaml.Unmarshal(data, s); err != nil {
+		return nil, err
+	}
+
+	if err := s.init(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Operations return the operations sorted by path and method.
+func (s *Spec) Operations() []*Operation {
+	return s.operations
+}
+
+// Operation return the operation of operationId or `METHOD /path`, nil if not found.
+func (s *Spec) Operation(id string) *Operation {
+	for _, op := range s.operations {
+		if op.OperationID == id || op.Method+` `+op.Path == id {
+			return op
+		}
+	}
+	return nil
+}
+
+// BaseURL return the url of first server, without trailing slash.
+func (s *Spec) BaseURL() string {
+	if len(s.Servers) == 0 {
+		return ``
+	}
+	return strings.TrimRight(s.Servers[0].URL, `/`)
+}
+
+var (
+	pathParam   = regexp.MustCompile(`\{(\w+)\}`)
+	quotedParam = regexp.MustCompile(`\\\{(\w+)\\\}`)
+)
+
+// init check the version, resolve the references and collect the operations.
+func (s *Spec) init() error {
+
+	if !strings.HasPrefix(s.OpenAPI, `3.`) {
+		return fmt.Errorf(`unsupported openapi version '%s', expect 3.x`, s.OpenAPI)
+	}
+	if len(s.Paths) == 0 {
+		return fmt.Errorf(`no paths`)
+	}
+	if base := s.BaseURL(); base != `` {
+		if u, err := url.Parse(base); err != nil || u.Host == `` {
+			return fmt.Errorf(`server url '%s' is not absolute`, base)
+		}
+	}
+
+	paths := make([]string, 0, len(s.Paths))
+	for p := range s.Paths {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	for _, p := range paths {
+		item := s.Paths[p]
+		if item == nil {
+			continue
+		}
+
+		pattern, err := regexp.Compile(`^` + quotedParam.ReplaceAllString(regexp.QuoteMeta(p), `([^/]+)`) + `$`)
+		if err != nil {
+			return fmt.Errorf(`path '%s': %v`, p, err)
+		}
+
+		shared, err := s.resolveParameters(item.Parameters)
+		if err != nil {
+			return fmt.Errorf(`path '%s': %v`, p, err)
+		}
+
+		for _, m := range []struct {
+			method string
+			op     *Operation
+		}{{`GET`, item.Get}, {`PUT`, item.Put}, {`POST`, item.Post}, {`DELETE`, item.Delete}, {`PATCH`, item.Patch}, {`HEAD`, item.Head}} {
+
+			if m.op == nil {
+				continue
+			}
+			op := m.op
+			op.Method, op.Path, op.pattern = m.method, p, pattern
+			for _, name := range pathParam.FindAllStringSubmatch(p, -1) {
+				op.pathNames = append(op.pathNames, name[1])
+			}
+
+			if err := s.resolveOperation(op, shared); err != nil {
+				return fmt.Errorf(`%s %s: %v`, op.Method, p, err)
+			}
+			s.operations = append(s.operations, op)
+		}
+	}
+
+	return nil
+}
+
+// resolveOperation resolve the references of op, the shared parameters are overridden by the ones
+// of op with the same name and location.
+func (s *Spec) resolveOperation(op *Operation, shared []*Parameter) error {
+
+	params, err := s.resolveParameters(op.Parameters)
+	if err != nil {
+		return err
+	}
+
+	merged := []*Parameter{}
+	for _, p := range shared {
+		overridden := false
+		for _, o := range params {
+			if o.Name == p.Name && o.In == p.In {
+				overridden = true
+				break
+			}
+		}
+		if !overridden {
+			merged = append(merged, p)
+		}
+	}
+	op.Parameters = append(merged, params...)
+
+	for _, p := range op.Parameters {
+		if p.In == `path` && !strings.Contains(op.Path, `{`+p.Name+`}`) {
+			return fmt.Errorf(`path parameter '%s' not in path`, p.Name)
+		}
+	}
+
+	if op.RequestBody != nil && op.RequestBody.Ref != `` {
+		name := strings.TrimPrefix(op.RequestBody.Ref, `#/components/requestBodies/`)
+		body, ok := s.Components.RequestBodies[name]
+		if !ok {
+			return fmt.Errorf(`unresolved reference '%s'`, op.RequestBody.Ref)
+		}
+		op.RequestBody = body
+	}
+
+	if op.RequestBody != nil {
+		for k, mt := range op.RequestBody.Content {
+			if mt.Schema, err = s.resolveSchema(mt.Schema, map[string]bool{}); err != nil {
+				return fmt.Errorf(`request body: %v`, err)
+			}
+			op.RequestBody.Content[k] = mt
+		}
+	}
+
+	return nil
+}
+
+func (s *Spec) resolveParameters(params []*Parameter) ([]*Parameter, error) {
+
+	ret := make([]*Parameter, 0, len(params))
+	for _, p := range params {
+		if p.Ref != `` {
+			name := strings.TrimPrefix(p.Ref, `#/components/parameters/`)
+			ref, ok := s.Components.Parameters[name]
+			if !ok {
+				return nil, fmt.Errorf(`unresolved reference '%s'`, p.Ref)
+			}
+			p = ref
+		}
+
+		if p.In == `cookie` {
+			continue
+		}
+
+		schema, err := s.resolveSchema(p.Schema, map[string]bool{})
+		if err != nil {
+			return nil, fmt.Errorf(`parameter '%s': %v`, p.Name, err)
+		}
+
+		c := *p
+		c.Schema = schema
+		ret = append(ret, &c)
+	}
+	return ret, nil
+}
+
+// resolveSchema return copy of schema with references resolved, the recursive references are kept.
+func (s *Spec) resolveSchema(schema *Schema, resolving map[string]bool) (*Schema, error) {
+
+	if schema == nil {
+		return nil, nil
+	}
+
+	if schema.Ref != `` {
+		name := strings.TrimPrefix(schema.Ref, `#/components/schemas/`)
+		if resolving[name] {
+			return schema, nil
+		}
+		ref, ok := s.Components.Schemas[name]
+		if !ok {
+			return nil, fmt.Errorf(`unresolved reference '%s'`, schema.Ref)
+		}
+
+		resolving[name] = true
+		defer delete(resolving, name)
+		return s.resolveSchema(ref, resolving)
+	}
+
+	c := *schema
+	var err error
+	if c.Items, err = s.resolveSchema(schema.Items, resolving); err != nil {
+		return nil, err
+	}
+	if len(schema.Properties) > 0 {
+		c.Properties = make(map[string]*Schema, len(schema.Properties))
+		for k, v := range schema.Properties {
+			if c.Properties[k], err = s.resolveSchema(v, resolving); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return &c, nil
+}
+
+// jsonBody return the JSON schema of request body, nil if the body is not JSON.
+func (op *Operation) jsonBody() *Schema {
+
+	if op.RequestBody == nil {
+		return nil
+	}
+	for k, mt := range op.RequestBody.Content {
+		if strings.Contains(k, `json`) {
+			if mt.Schema == nil {
+				return &Schema{}
+			}
+			return mt.Schema
+		}
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+package openapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/nexptr/llmchain/chains"
+)
+
+// BodyArg the argument of request body of tool, prefixed by request_ while an operation parameter
+// has the same name, example: request_body.
+const BodyArg = `body`
+
+// NewAPIChain return APIChain of spec: the docs are generated from the operations, and the request
+// generated by llm is validated by the spec before sending. The allowed domain is the host of the
+// base url.
+func NewAPIChain(name string, spec *Spec) (*chains.APIChain, error) {
+
+	base, err := url.Parse(spec.BaseURL())
+	if err != nil || base.Host == `` {
+		return nil, fmt.Errorf(`spec '%s': no server url`, spec.Info.Title)
+	}
+
+	c := chains.NewAPIChain(name, spec.Docs())
+	c.AllowedDomains = []string{base.Host}
+	c.Validator = func(req *chains.APIRequest) error {
+		_, err := spec.Validate(req)
+		return err
+	}
+	return c, nil
+}
+
+// Tool the operation callable with JSON arguments, the parameters by name and the request body
+// by BodyArg.
+type Tool struct {
+	Name        string
+	Description string
+	// Parameters the JSON schema of arguments.
+	Parameters *Schema
+	Operation  *Operation
+
+	spec     *Spec
+	executor *chains.APIChain
+}
+
+// Tools return tools of the operations, the requests are validated and sent by executor, which is
+// usually returned by NewAPIChain, so the allowlist, headers and timeout apply.
+func (s *Spec) Tools(executor *chains.APIChain) []*Tool {
+
+	ret := make([]*Tool, 0, len(s.operations))
+	for _, op := range s.operations {
+		ret = append(ret, &Tool{
+			Name:        op.toolName(),
+			Description: strings.TrimSpace(op.Summary + "\n" + op.Description),
+			Parameters:  op.arguments(),
+			Operation:   op,
+			spec:        s,
+			executor:    executor,
+		})
+	}
+	return ret
+}
+
+var nonIdent = regexp.MustCompile(`[^a-zA-Z0-9]+`)
+
+// toolName return operationId, or method and path as identifier, example: get_pets_id.
+func (op *Operation) toolName() string {
+	if op.OperationID != `` {
+		return op.OperationID
+	}
+	return strings.Trim(nonIdent.ReplaceAllString(strings.ToLower(op.Method+`_`+op.Path), `_`), `_`)
+}
+
+// bodyArg return the argument of request body not used by the parameters.
+func (op *Operation) bodyArg() string {
+
+	name := BodyArg
+	for {
+		used := false
+		for _, p := range op.Parameters {
+			used = used || p.Name == name
+		}
+		if !used {
+			return name
+		}
+		name = `request_` + name
+	}
+}
+
+// arguments return JSON schema of the tool arguments.
+func (op *Operation) arguments() *Schema {
+
+	args := &Schema{Type: `object`, Properties: map[string]*Schema{}}
+
+	for _, p := range op.Parameters {
+		prop := &Schema{}
+		if p.Schema != nil {
+			c := *p.Schema
+			prop = &c
+		}
+		if d := strings.TrimSpace(p.Description); d != `` {
+			prop.Description = d
+		}
+		args.Properties[p.Name] = prop
+		if p.Required {
+			args.Required = append(args.Required, p.Name)
+		}
+	}
+
+	if op.RequestBody != nil {
+		body := op.jsonBody()
+		if body == nil {
+			body = &Schema{Type: `string`}
+		}
+		c := *body
+		if d := strings.TrimSpace(op.RequestBody.Description); d != `` {
+			c.Description = d
+		}
+		name := op.bodyArg()
+		args.Properties[name] = &c
+		if op.RequestBody.Required {
+			args.Required = append(args.Required, name)
+		}
+	}
+
+	return args
+}
+
+// Request return the request of JSON arguments.
+func (t *Tool) Request(args string) (*chains.APIRequest, error) {
+
+	vals := map[string]any{}
+	if strings.TrimSpace(args) != `` {
+		if err := json.Unmarshal([]byte(args), &vals); err != nil {
+			return nil, fmt.Errorf(`tool '%s': arguments: %v`, t.Name, err)
+		}
+	}
+
+	if err := validateValue(t.Parameters, vals, `arguments`); err != nil {
+		return nil, fmt.Errorf(`tool '%s': %v`, t.Name, err)
+	}
+
+	op := t.Operation
+	path := op.Path
+	query := url.Values{}
+	req := &chains.APIRequest{Method: op.Method}
+
+	for _, p := range op.Parameters {
+		v, ok := vals[p.Name]
+		if !ok {
+			continue
+		}
+
+		switch p.In {
+		case `path`:
+			path = strings.ReplaceAll(path, `{`+p.Name+`}`, url.PathEscape(paramValue(v)))
+		case `query`:
+			query.Set(p.Name, paramValue(v))
+		case `header`:
+			if req.Headers == nil {
+				req.Headers = map[string]string{}
+			}
+			req.Headers[p.Name] = paramValue(v)
+		}
+	}
+
+	req.URL = t.spec.BaseURL() + path
+	if len(query) > 0 {
+		req.URL += `?` + query.Encode()
+	}
+
+	if body, ok := vals[op.bodyArg()]; ok && op.RequestBody != nil {
+		if s, ok := body.(string); ok && op.jsonBody() == nil {
+			req.Body = s
+		} else {
+			data, err := json.Marshal(body)
+			if err != nil {
+				return nil, fmt.Errorf(`tool '%s': body: %v`, t.Name, err)
+			}
+			req.Body = string(data)
+			if req.Headers == nil {
+				req.Headers = map[string]string{}
+			}
+			req.Headers[`Content-Type`] = `application/json`
+		}
+	}
+
+	return req, nil
+}
+
+// Call the operation with JSON arguments, return the response.
+func (t *Tool) Call(ctx context.Context, args string) (string, error) {
+
+	if t.executor == nil {
+		return ``, fmt.Errorf(`tool '%s': no executor`, t.Name)
+	}
+
+	req, err := t.Request(args)
+	if err != nil {
+		return ``, err
+	}
+
+	return t.executor.Send(ctx, req)
+}
+
+// paramValue format the argument as parameter value, the array is comma separated.
+func paramValue(v any) string {
+	if arr, ok := v.([]any); ok {
+		parts := make([]string, len(arr))
+		for i, item := range arr {
+			parts[i] = formatValue(item)
+		}
+		return strings.Join(parts, `,`)
+	}
+	return formatValue(v)
+}
@@ -0,0 +1,288 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/nexptr/llmchain/chains"
+)
+
+// Validate check req against the spec: the url is under the base url, the method and path match
+// an operation, and the parameters and JSON body match the schemas. The matched operation is
+// returned.
+func (s *Spec) Validate(req *chains.APIRequest) (*Operation, error) {
+
+	u, err := url.Parse(req.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	base, err := url.Parse(s.BaseURL())
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.EqualFold(u.Scheme, base.Scheme) || !strings.EqualFold(u.Host, base.Host) {
+		return nil, fmt.Errorf(`url '%s' is not under base url '%s'`, req.URL, s.BaseURL())
+	}
+
+	// match the escaped path, an escaped '/' in path parameter doesn't split the segment.
+	basePath := strings.TrimRight(base.EscapedPath(), `/`)
+	if !strings.HasPrefix(u.EscapedPath(), basePath+`/`) {
+		return nil, fmt.Errorf(`url '%s' is not under base url '%s'`, req.URL, s.BaseURL())
+	}
+	path := strings.TrimPrefix(u.EscapedPath(), basePath)
+
+	var (
+		op          *Operation
+		values      []string
+		pathMatched bool
+	)
+	for _, o := range s.operations {
+		m := o.pattern.FindStringSubmatch(path)
+		if m == nil {
+			continue
+		}
+		pathMatched = true
+		if o.Method == strings.ToUpper(req.Method) {
+			op, values = o, m[1:]
+			break
+		}
+	}
+
+	if op == nil {
+		if pathMatched {
+			return nil, fmt.Errorf(`method %s not allowed for path '%s'`, req.Method, path)
+		}
+		return nil, fmt.Errorf(`unknown path '%s'`, path)
+	}
+
+	pathValues := map[string]string{}
+	for i, name := range op.pathNames {
+		v, err := url.PathUnescape(values[i])
+		if err != nil {
+			return op, fmt.Errorf(`path parameter '%s': %v`, name, err)
+		}
+		pathValues[name] = v
+	}
+
+	query := u.Query()
+	known := map[string]bool{}
+
+	for _, p := range op.Parameters {
+
+		var (
+			vals []string
+			ok   bool
+		)
+		switch p.In {
+		case `path`:
+			var v string
+			v, ok = pathValues[p.Name]
+			vals = []string{v}
+		case `query`:
+			known[p.Name] = true
+			vals, ok = query[p.Name]
+		case `header`:
+			for k, v := range req.Headers {
+				if strings.EqualFold(k, p.Name) {
+					vals, ok = []string{v}, true
+				}
+			}
+		default:
+			continue
+		}
+
+		if !ok {
+			if p.Required {
+				return op, fmt.Errorf(`%s parameter '%s' is required`, p.In, p.Name)
+			}
+			continue
+		}
+
+		for _, v := range vals {
+			if err := validateParam(p.Schema, v); err != nil {
+				return op, fmt.Errorf(`%s parameter '%s': %v`, p.In, p.Name, err)
+			}
+		}
+	}
+
+	for k := range query {
+		if !known[k] {
+			return op, fmt.Errorf(`unknown query parameter '%s'`, k)
+		}
+	}
+
+	if err := op.validateBody(req.Body); err != nil {
+		return op, err
+	}
+
+	return op, nil
+}
+
+func (op *Operation) validateBody(body string) error {
+
+	if strings.TrimSpace(body) == `` {
+		if op.RequestBody != nil && op.RequestBody.Required {
+			return fmt.Errorf(`request body is required`)
+		}
+		return nil
+	}
+
+	if op.RequestBody == nil {
+		return fmt.Errorf(`unexpected request body`)
+	}
+
+	schema := op.jsonBody()
+	if schema == nil {
+		return nil
+	}
+
+	var v any
+	if err := json.Unmarshal([]byte(body), &v); err != nil {
+		return fmt.Errorf(`request body: %v`, err)
+	}
+	if err := validateValue(schema, v, `body`); err != nil {
+		return fmt.Errorf(`request body: %v`, err)
+	}
+	return nil
+}
+
+// validateParam check the raw value of parameter, the array is comma separated.
+func validateParam(schema *Schema, raw string) error {
+
+	if schema == nil {
+		return nil
+	}
+
+	if schema.Type == `array` {
+		for _, item := range strings.Split(raw, `,`) {
+			if err := validateParam(schema.Items, item); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var err error
+	switch schema.Type {
+	case `integer`:
+		_, err = strconv.ParseInt(raw, 10, 64)
+	case `number`:
+		_, err = strconv.ParseFloat(raw, 64)
+	case `boolean`:
+		_, err = strconv.ParseBool(raw)
+	}
+	if err != nil {
+		return fmt.Errorf(`'%s' is not %s`, raw, schema.Type)
+	}
+
+	return checkEnum(schema, raw)
+}
+
+// validateValue check the JSON value v at path.
+func validateValue(schema *Schema, v any, path string) error {
+
+	if schema == nil || schema.Ref != `` {
+		return nil
+	}
+
+	switch schema.Type {
+	case `object`:
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return fmt.Errorf(`%s: expect object, got %s`, path, jsonType(v))
+		}
+		for _, k := range schema.Required {
+			if _, ok := obj[k]; !ok {
+				return fmt.Errorf(`%s.%s is required`, path, k)
+			}
+		}
+		for k, val := range obj {
+			if err := validateValue(schema.Properties[k], val, path+`.`+k); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case `array`:
+		arr, ok := v.([]any)
+		if !ok {
+			return fmt.Errorf(`%s: expect array, got %s`, path, jsonType(v))
+		}
+		for i, item := range arr {
+			if err := validateValue(schema.Items, item, fmt.Sprintf(`%s[%d]`, path, i)); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case `integer`:
+		if f, ok := v.(float64); !ok || f != math.Trunc(f) {
+			return fmt.Errorf(`%s: expect integer, got %s`, path, jsonType(v))
+		}
+	case `number`:
+		if _, ok := v.(float64); !ok {
+			return fmt.Errorf(`%s: expect number, got %s`, path, jsonType(v))
+		}
+	case `string`:
+		if _, ok := v.(string); !ok {
+			return fmt.Errorf(`%s: expect string, got %s`, path, jsonType(v))
+		}
+	case `boolean`:
+		if _, ok := v.(bool); !ok {
+			return fmt.Errorf(`%s: expect boolean, got %s`, path, jsonType(v))
+		}
+	}
+
+	if err := checkEnum(schema, formatValue(v)); err != nil {
+		return fmt.Errorf(`%s: %v`, path, err)
+	}
+	return nil
+}
+
+func checkEnum(schema *Schema, raw string) error {
+
+	if len(schema.Enum) == 0 {
+		return nil
+	}
+	for _, e := range schema.Enum {
+		if formatValue(e) == raw {
+			return nil
+		}
+	}
+	return fmt.Errorf(`'%s' is not one of: %s`, raw, joinValues(schema.Enum))
+}
+
+// formatValue format the scalar as parameter value.
+func formatValue(v any) string {
+	switch t := v.(type) {
+	case string:
+		return t
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+func jsonType(v any) string {
+	switch v.(type) {
+	case nil:
+		return `null`
+	case map[string]any:
+		return `object`
+	case []any:
+		return `array`
+	case float64:
+		return `number`
+	case string:
+		return `string`
+	case bool:
+		return `boolean`
+	}
+	return fmt.Sprintf(`%T`, v)
+}
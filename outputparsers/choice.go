@@ -0,0 +1,86 @@
+package outputparsers
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Boolean parse the answer of True or False word, default YES and NO, case insensitive.
+type Boolean struct {
+	True  string
+	False string
+}
+
+var _ OutputParser[bool] = Boolean{}
+
+func (p Boolean) words() (string, string) {
+	t, f := p.True, p.False
+	if t == `` {
+		t = `YES`
+	}
+	if f == `` {
+		f = `NO`
+	}
+	return t, f
+}
+
+// Parse implements OutputParser, the words are looked up in output, it's an error if both or
+// neither found.
+func (p Boolean) Parse(output string) (bool, error) {
+
+	t, f := p.words()
+
+	hasT, hasF := containsWord(output, t), containsWord(output, f)
+
+	switch {
+	case hasT && !hasF:
+		return true, nil
+	case hasF && !hasT:
+		return false, nil
+	case hasT && hasF:
+		return false, parseError(output, `ambiguous answer, both %s and %s found`, t, f)
+	}
+	return false, parseError(output, `expect %s or %s`, t, f)
+}
+
+// FormatInstructions implements OutputParser.
+func (p Boolean) FormatInstructions() string {
+	t, f := p.words()
+	return fmt.Sprintf(`Answer with %s or %s only.`, t, f)
+}
+
+func containsWord(s, word string) bool {
+	re := regexp.MustCompile(`(?i)(^|[^\pL\pN_])` + regexp.QuoteMeta(word) + `($|[^\pL\pN_])`)
+	return re.MatchString(s)
+}
+
+// Enum parse output of one of Values, case insensitive, the value of Values is returned.
+type Enum struct {
+	Values []string
+}
+
+var _ OutputParser[string] = Enum{}
+
+// NewEnum return parser of values.
+func NewEnum(values ...string) Enum {
+	return Enum{Values: values}
+}
+
+// Parse implements OutputParser.
+func (p Enum) Parse(output string) (string, error) {
+
+	answer := cleanWord(output)
+	for _, v := range p.Values {
+		if strings.EqualFold(answer, v) {
+			return v, nil
+		}
+	}
+
+	return ``, parseError(output, `'%s' is not one of %s`, answer, strings.Join(p.Values, `, `))
+}
+
+// FormatInstructions implements OutputParser.
+func (p Enum) FormatInstructions() string {
+	return fmt.Sprintf(`Select one of the following options: %s`, strings.Join(p.Values, `, `))
+}
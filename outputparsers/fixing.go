@@ -0,0 +1,114 @@
+package outputparsers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/nexptr/llmchain/llms"
+	"github.com/nexptr/llmchain/prompts"
+)
+
+// FixPrompt asks llm to fix the malformed output, variables: instructions, output and error.
+var FixPrompt = prompts.PromptTemplate(`Instructions:
+--------------
+{{.instructions}}
+--------------
+Completion:
+--------------
+{{.output}}
+--------------
+
+Above, the Completion did not satisfy the constraints given in the Instructions.
+Error:
+--------------
+{{.error}}
+--------------
+
+Please try again. Please only respond with an answer that satisfies the constraints laid out in the Instructions:`,
+	`instructions`, `output`, `error`)
+
+// Fixing re-ask LLM with the parse error to fix the malformed output, at most MaxRetries times.
+type Fixing[T any] struct {
+	Parser OutputParser[T]
+	LLM    llms.LLM
+	// MaxRetries times to ask LLM, default 1.
+	MaxRetries int
+	// Prompt the prompt of fix, FixPrompt if nil.
+	Prompt *prompts.Template
+}
+
+var (
+	_ OutputParser[struct{}]  = &Fixing[struct{}]{}
+	_ ContextParser[struct{}] = &Fixing[struct{}]{}
+)
+
+// NewFixing return parser fixing the output of parser by llm.
+func NewFixing[T any](parser OutputParser[T], llm llms.LLM) *Fixing[T] {
+	return &Fixing[T]{Parser: parser, LLM: llm, MaxRetries: 1}
+}
+
+// Parse implements OutputParser.
+func (p *Fixing[T]) Parse(output string) (T, error) {
+	return p.ParseContext(context.Background(), output)
+}
+
+// ParseContext parse output, the malformed output is fixed by LLM with ctx. Only *ParseError is
+// fixed, the other errors are returned.
+func (p *Fixing[T]) ParseContext(ctx context.Context, output string) (T, error) {
+
+	v, err := p.Parser.Parse(output)
+
+	tmpl := p.Prompt
+	if tmpl == nil {
+		tmpl = FixPrompt
+	}
+
+	retries := p.MaxRetries
+	if retries <= 0 {
+		retries = 1
+	}
+
+	for i := 0; i < retries; i++ {
+
+		var perr *ParseError
+		if !errors.As(err, &perr) {
+			return v, err
+		}
+
+		prompt, rerr := renderFix(tmpl, prompts.H{
+			`instructions`: p.Parser.FormatInstructions(),
+			`output`:       output,
+			`error`:        perr.Err.Error(),
+		})
+		if rerr != nil {
+			return v, fmt.Errorf(`fix prompt: %v`, rerr)
+		}
+
+		output, rerr = p.LLM.Call(ctx, prompt)
+		if rerr != nil {
+			return v, fmt.Errorf(`fix output: %v`, rerr)
+		}
+
+		v, err = p.Parser.Parse(output)
+	}
+
+	return v, err
+}
+
+// renderFix render tmpl with the variables it declares, custom prompts may omit some of vars.
+func renderFix(tmpl *prompts.Template, vars prompts.H) (string, error) {
+
+	data := prompts.H{}
+	for _, k := range tmpl.Variables() {
+		if v, ok := vars[k]; ok {
+			data[k] = v
+		}
+	}
+	return tmpl.Render(data)
+}
+
+// FormatInstructions implements OutputParser.
+func (p *Fixing[T]) FormatInstructions() string {
+	return p.Parser.FormatInstructions()
+}
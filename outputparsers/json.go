@@ -0,0 +1,148 @@
+package outputparsers
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// JSON parse the JSON output into T, the JSON may be wrapped in a markdown code block.
+// The fields of struct are described by the `desc` tag in FormatInstructions:
+//
+//	type Answer struct {
+//		Answer string   `json:"answer" desc:"answer of the question"`
+//		Source []string `json:"source" desc:"urls of the sources"`
+//	}
+type JSON[T any] struct {
+	// Strict the unknown fields are errors.
+	Strict bool
+}
+
+var _ OutputParser[struct{}] = JSON[struct{}]{}
+
+// NewJSON return parser of T.
+func NewJSON[T any]() JSON[T] {
+	return JSON[T]{}
+}
+
+// Parse implements OutputParser.
+func (p JSON[T]) Parse(output string) (T, error) {
+
+	var v T
+
+	text := extractJSON(output)
+
+	dec := json.NewDecoder(strings.NewReader(text))
+	if p.Strict {
+		dec.DisallowUnknownFields()
+	}
+
+	if err := dec.Decode(&v); err != nil {
+		return v, &ParseError{Output: output, Err: fmt.Errorf(`invalid json: %v`, err)}
+	}
+
+	return v, nil
+}
+
+// FormatInstructions implements OutputParser.
+func (p JSON[T]) FormatInstructions() string {
+
+	var v T
+	shape := jsonShape(reflect.TypeOf(&v).Elem(), ``, map[reflect.Type]bool{})
+
+	return "The output should be formatted as JSON in a markdown code block like the following, " +
+		"including the leading \"```json\" and trailing \"```\":\n\n```json\n" + shape + "\n```"
+}
+
+// jsonFence ```json ... ```
+var jsonFence = regexp.MustCompile("(?s)```(?:json|JSON)?[ \t]*\n?(.*?)```")
+
+// extractJSON return the content of code block, or from the first { or [ to the last matched } or ].
+func extractJSON(output string) string {
+
+	if m := jsonFence.FindStringSubmatch(output); m != nil {
+		return strings.TrimSpace(m[1])
+	}
+
+	start := strings.IndexAny(output, `{[`)
+	if start < 0 {
+		return strings.TrimSpace(output)
+	}
+
+	closer := byte('}')
+	if output[start] == '[' {
+		closer = ']'
+	}
+
+	if end := strings.LastIndexByte(output, closer); end > start {
+		return output[start : end+1]
+	}
+	return output[start:]
+}
+
+// jsonShape describe type t like JSON, example: {"name": string, "tags": [string]}
+func jsonShape(t reflect.Type, indent string, seen map[reflect.Type]bool) string {
+
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return `string`
+	case reflect.Bool:
+		return `boolean`
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return `integer`
+	case reflect.Float32, reflect.Float64:
+		return `number`
+	case reflect.Slice, reflect.Array:
+		return `[` + jsonShape(t.Elem(), indent, seen) + `]`
+	case reflect.Map:
+		return `{string: ` + jsonShape(t.Elem(), indent, seen) + `}`
+	case reflect.Struct:
+	default:
+		return `any`
+	}
+
+	if seen[t] {
+		return `object`
+	}
+	seen[t] = true
+	defer delete(seen, t)
+
+	lines := []string{}
+	inner := indent + `  `
+
+	for i := 0; i < t.NumField(); i++ {
+
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+
+		name := f.Name
+		if tag := f.Tag.Get(`json`); tag != `` {
+			if tag == `-` {
+				continue
+			}
+			if n, _, _ := strings.Cut(tag, `,`); n != `` {
+				name = n
+			}
+		}
+
+		line := fmt.Sprintf(`%s"%s": %s`, inner, name, jsonShape(f.Type, inner, seen))
+		if desc := f.Tag.Get(`desc`); desc != `` {
+			line += ` // ` + desc
+		}
+		lines = append(lines, line)
+	}
+
+	if len(lines) == 0 {
+		return `{}`
+	}
+	return "{\n" + strings.Join(lines, ",\n") + "\n" + indent + "}"
+}
@@ -0,0 +1,60 @@
+package outputparsers
+
+import (
+	"regexp"
+	"strings"
+)
+
+// CommaSeparatedList parse output like `foo, bar, baz`
+type CommaSeparatedList struct{}
+
+var _ OutputParser[[]string] = CommaSeparatedList{}
+
+// Parse implements OutputParser, the empty items are dropped.
+func (CommaSeparatedList) Parse(output string) ([]string, error) {
+
+	ret := []string{}
+	for _, item := range strings.FieldsFunc(output, func(r rune) bool { return r == ',' || r == '，' || r == '\n' }) {
+		if item = strings.TrimSpace(item); item != `` {
+			ret = append(ret, item)
+		}
+	}
+
+	if len(ret) == 0 {
+		return nil, parseError(output, `empty list`)
+	}
+	return ret, nil
+}
+
+// FormatInstructions implements OutputParser.
+func (CommaSeparatedList) FormatInstructions() string {
+	return "Your response should be a list of comma separated values, eg: `foo, bar, baz`"
+}
+
+// NumberedList parse the items of lines like `1. foo` or `2) bar`, the other lines are ignored.
+type NumberedList struct{}
+
+var _ OutputParser[[]string] = NumberedList{}
+
+var numberedItem = regexp.MustCompile(`^\s*\d+[.)、]\s*(.+?)\s*$`)
+
+// Parse implements OutputParser.
+func (NumberedList) Parse(output string) ([]string, error) {
+
+	ret := []string{}
+	for _, line := range strings.Split(output, "\n") {
+		if m := numberedItem.FindStringSubmatch(line); m != nil {
+			ret = append(ret, m[1])
+		}
+	}
+
+	if len(ret) == 0 {
+		return nil, parseError(output, `no numbered items found`)
+	}
+	return ret, nil
+}
+
+// FormatInstructions implements OutputParser.
+func (NumberedList) FormatInstructions() string {
+	return "Your response should be a numbered list with each item on a new line, eg:\n\n1. foo\n2. bar\n3. baz"
+}
@@ -0,0 +1,76 @@
+// Package outputparsers parse the text output of llms into data, every parser describes the expected
+// format by FormatInstructions which should be injected into the prompt.
+//
+//	parser := outputparsers.NewJSON[Answer]()
+//	prompt := question + "\n\n" + parser.FormatInstructions()
+//	out, _ := llm.Call(ctx, prompt)
+//	answer, err := outputparsers.NewFixing[Answer](parser, llm).Parse(out)
+package outputparsers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// OutputParser parse the output of llm to T.
+type OutputParser[T any] interface {
+	// Parse return the value of output, the error is *ParseError if output is malformed.
+	Parse(output string) (T, error)
+	// FormatInstructions describe the format of output expected by Parse.
+	FormatInstructions() string
+}
+
+// ParseError the output is malformed.
+type ParseError struct {
+	Output string
+	Err    error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf(`parse output: %v`, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+func parseError(output string, format string, args ...any) *ParseError {
+	return &ParseError{Output: output, Err: fmt.Errorf(format, args...)}
+}
+
+// cleanWord trim the spaces, quotes and trailing punctuation of a single word answer.
+func cleanWord(s string) string {
+	return strings.Trim(strings.TrimSpace(s), "\"'`.。!！ \n")
+}
+
+// ContextParser the parser which may call llm, example: Fixing.
+type ContextParser[T any] interface {
+	ParseContext(ctx context.Context, output string) (T, error)
+}
+
+// anyParser erase the value type of OutputParser.
+type anyParser[T any] struct {
+	parser OutputParser[T]
+}
+
+// Any return parser of any value, used by the chains accepting all kinds of parsers.
+func Any[T any](parser OutputParser[T]) OutputParser[any] {
+	return anyParser[T]{parser}
+}
+
+func (p anyParser[T]) Parse(output string) (any, error) {
+	return p.parser.Parse(output)
+}
+
+// ParseContext implements ContextParser if the parser is.
+func (p anyParser[T]) ParseContext(ctx context.Context, output string) (any, error) {
+	if c, ok := p.parser.(ContextParser[T]); ok {
+		return c.ParseContext(ctx, output)
+	}
+	return p.parser.Parse(output)
+}
+
+func (p anyParser[T]) FormatInstructions() string {
+	return p.parser.FormatInstructions()
+}
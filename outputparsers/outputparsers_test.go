@@ -0,0 +1,180 @@
+package outputparsers_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/nexptr/llmchain/llms"
+	"github.com/nexptr/llmchain/outputparsers"
+	"github.com/nexptr/llmchain/prompts"
+	"github.com/nexptr/llmchain/schema"
+)
+
+type answer struct {
+	Answer  string   `json:"answer" desc:"answer of the question"`
+	Sources []string `json:"sources"`
+	Score   float64  `json:"score,omitempty"`
+}
+
+func TestJSON(t *testing.T) {
+
+	p := outputparsers.NewJSON[answer]()
+
+	cases := []string{
+		"```json\n{\"answer\": \"42\", \"sources\": [\"a\"]}\n```",
+		"Sure! Here it is: {\"answer\": \"42\", \"sources\": [\"a\"]} Hope it helps.",
+		`{"answer": "42", "sources": ["a"]}`,
+	}
+
+	for _, c := range cases {
+		v, err := p.Parse(c)
+		if err != nil {
+			t.Fatalf(`parse %q: %v`, c, err)
+		}
+		if !reflect.DeepEqual(v, answer{Answer: `42`, Sources: []string{`a`}}) {
+			t.Fatalf(`unexpected value %+v`, v)
+		}
+	}
+
+	var perr *outputparsers.ParseError
+	if _, err := p.Parse(`I don't know`); !errors.As(err, &perr) {
+		t.Fatalf(`expect ParseError, got %v`, err)
+	}
+
+	instructions := p.FormatInstructions()
+	for _, want := range []string{`"answer": string // answer of the question`, `"sources": [string]`, `"score": number`} {
+		if !strings.Contains(instructions, want) {
+			t.Fatalf("instructions missing %s:\n%s", want, instructions)
+		}
+	}
+}
+
+func TestLists(t *testing.T) {
+
+	items, err := outputparsers.CommaSeparatedList{}.Parse(` red, green ,blue,`)
+	if err != nil || !reflect.DeepEqual(items, []string{`red`, `green`, `blue`}) {
+		t.Fatalf(`unexpected items %v: %v`, items, err)
+	}
+
+	items, err = outputparsers.NumberedList{}.Parse("Here you are:\n1. red\n2) green\n 3. blue")
+	if err != nil || !reflect.DeepEqual(items, []string{`red`, `green`, `blue`}) {
+		t.Fatalf(`unexpected items %v: %v`, items, err)
+	}
+
+	if _, err := (outputparsers.NumberedList{}).Parse(`red green`); err == nil {
+		t.Fatal(`expect error of no items`)
+	}
+}
+
+func TestRegex(t *testing.T) {
+
+	if _, err := outputparsers.NewRegex(`Action: (.+)`, ``); err == nil {
+		t.Fatal(`expect error of no named groups`)
+	}
+
+	p, err := outputparsers.NewRegex(`Action: (?P<action>.+)\nInput: (?P<input>.+)`, ``)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := p.Parse("Thought: search it\nAction: search\nInput: golang")
+	if err != nil || v[`action`] != `search` || v[`input`] != `golang` {
+		t.Fatalf(`unexpected value %v: %v`, v, err)
+	}
+}
+
+func TestChoices(t *testing.T) {
+
+	b := outputparsers.Boolean{}
+	for output, want := range map[string]bool{`YES`: true, `no.`: false, `Yes, it is.`: true} {
+		if v, err := b.Parse(output); err != nil || v != want {
+			t.Fatalf(`parse %q: %v %v`, output, v, err)
+		}
+	}
+	if _, err := b.Parse(`yes and no`); err == nil {
+		t.Fatal(`expect ambiguous error`)
+	}
+	if _, err := b.Parse(`nothing`); err == nil {
+		t.Fatal(`expect error`)
+	}
+
+	e := outputparsers.NewEnum(`Positive`, `Negative`, `Neutral`)
+	if v, err := e.Parse(` "negative". `); err != nil || v != `Negative` {
+		t.Fatalf(`unexpected value %v: %v`, v, err)
+	}
+	if _, err := e.Parse(`angry`); err == nil {
+		t.Fatal(`expect error`)
+	}
+}
+
+// fixLLM answer the fix prompts in order.
+type fixLLM struct {
+	answers []string
+	prompts []string
+}
+
+func (f *fixLLM) Name() string { return `fix` }
+
+func (f *fixLLM) Free() {}
+
+func (f *fixLLM) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	f.prompts = append(f.prompts, prompt)
+	a := f.answers[0]
+	f.answers = f.answers[1:]
+	return a, nil
+}
+
+func (f *fixLLM) Chat(ctx context.Context, req *schema.ChatRequest) (*schema.ChatResponse, error) {
+	return nil, errors.New(`not implemented`)
+}
+
+func (f *fixLLM) Completion(ctx context.Context, req *schema.CompletionRequest) (*schema.CompletionResponse, error) {
+	return nil, errors.New(`not implemented`)
+}
+
+func (f *fixLLM) Embeddings(ctx context.Context, req *schema.EmbeddingsRequest) (*schema.EmbeddingsResponse, error) {
+	return nil, errors.New(`not implemented`)
+}
+
+func TestFixing(t *testing.T) {
+
+	llm := &fixLLM{answers: []string{`maybe`, `Neutral`}}
+
+	p := outputparsers.NewFixing[string](outputparsers.NewEnum(`Positive`, `Negative`, `Neutral`), llm)
+	p.MaxRetries = 2
+
+	v, err := p.Parse(`I feel so-so`)
+	if err != nil || v != `Neutral` {
+		t.Fatalf(`unexpected value %v: %v`, v, err)
+	}
+
+	if len(llm.prompts) != 2 || !strings.Contains(llm.prompts[0], `I feel so-so`) ||
+		!strings.Contains(llm.prompts[0], `Select one of the following options: Positive, Negative, Neutral`) ||
+		!strings.Contains(llm.prompts[1], `'maybe' is not one of`) {
+		t.Fatalf(`unexpected fix prompts %q`, llm.prompts)
+	}
+
+	// the valid output is not fixed.
+	if v, err := p.Parse(`positive`); err != nil || v != `Positive` || len(llm.prompts) != 2 {
+		t.Fatalf(`unexpected value %v: %v`, v, err)
+	}
+}
+
+func TestFixing_CustomPrompt(t *testing.T) {
+
+	llm := &fixLLM{answers: []string{`Negative`}}
+
+	p := outputparsers.NewFixing[string](outputparsers.NewEnum(`Positive`, `Negative`, `Neutral`), llm)
+	p.Prompt = prompts.PromptTemplate(`Fix: {{.output}}`, `output`).WithMode(prompts.Strict)
+
+	v, err := p.Parse(`bad`)
+	if err != nil || v != `Negative` {
+		t.Fatalf(`unexpected value %v: %v`, v, err)
+	}
+	if len(llm.prompts) != 1 || llm.prompts[0] != `Fix: bad` {
+		t.Fatalf(`unexpected fix prompts %q`, llm.prompts)
+	}
+}
@@ -0,0 +1,63 @@
+package outputparsers
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Regex parse the named groups of pattern, keyed by group name.
+//
+//	p, _ := outputparsers.NewRegex(`Action: (?P<action>.+)\nInput: (?P<input>.+)`, "")
+type Regex struct {
+	Pattern *regexp.Regexp
+	// Instructions the format instructions, pattern is described by default.
+	Instructions string
+}
+
+var _ OutputParser[map[string]string] = &Regex{}
+
+// NewRegex return parser of pattern which must have named groups.
+func NewRegex(pattern, instructions string) (*Regex, error) {
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	named := false
+	for _, name := range re.SubexpNames() {
+		if name != `` {
+			named = true
+		}
+	}
+	if !named {
+		return nil, fmt.Errorf(`regex '%s' has no named groups`, pattern)
+	}
+
+	return &Regex{Pattern: re, Instructions: instructions}, nil
+}
+
+// Parse implements OutputParser.
+func (p *Regex) Parse(output string) (map[string]string, error) {
+
+	m := p.Pattern.FindStringSubmatch(output)
+	if m == nil {
+		return nil, parseError(output, `output does not match '%s'`, p.Pattern)
+	}
+
+	ret := map[string]string{}
+	for i, name := range p.Pattern.SubexpNames() {
+		if name != `` {
+			ret[name] = m[i]
+		}
+	}
+	return ret, nil
+}
+
+// FormatInstructions implements OutputParser.
+func (p *Regex) FormatInstructions() string {
+	if p.Instructions != `` {
+		return p.Instructions
+	}
+	return fmt.Sprintf("Your response should match the regular expression: %s", p.Pattern)
+}
@@ -0,0 +1,344 @@
+package prompts
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/nexptr/llmchain/prompts/jinja"
+	"github.com/nexptr/llmchain/schema"
+	"gopkg.in/yaml.v3"
+)
+
+// ChatTemplate render chat messages to the prompt of a model family. Formats support the
+// placeholders {system}, {content}, {bos}, {eos} and {round} (start from 1).
+//
+//	name: vicuna
+//	models: [vicuna-*]
+//	system: A chat between a curious user and an artificial intelligence assistant.
+//	system_format: "{system} "
+//	user_format: "USER: {content} "
+//	assistant_format: "ASSISTANT: {content}</s>"
+//	generation: "ASSISTANT:"
+//	stop: ["</s>"]
+//
+// Jinja templates like the chat_template of Hugging Face are supported by the jinja field, the
+// formats are ignored then.
+type ChatTemplate struct {
+	Name string `json:"name" yaml:"name"`
+	// Models name patterns of models using the template, '*' matches any sequence, example: llama-2-*
+	Models []string `json:"models" yaml:"models"`
+
+	BOS string `json:"bos" yaml:"bos"`
+	EOS string `json:"eos" yaml:"eos"`
+
+	// System default system message, used if the request has none.
+	System       string `json:"system" yaml:"system"`
+	SystemFormat string `json:"system_format" yaml:"system_format"`
+	// SystemInFirstUser render the system message inside the first user message, example: Llama-2
+	SystemInFirstUser bool `json:"system_in_first_user" yaml:"system_in_first_user"`
+
+	UserFormat      string `json:"user_format" yaml:"user_format"`
+	AssistantFormat string `json:"assistant_format" yaml:"assistant_format"`
+	// Generation appended to prompt for the reply of assistant, example: "ASSISTANT:"
+	Generation string `json:"generation" yaml:"generation"`
+
+	// Stop words of generation.
+	Stop []string `json:"stop" yaml:"stop"`
+
+	// Jinja chat template rendered with messages, bos_token, eos_token and add_generation_prompt.
+	Jinja string `json:"jinja" yaml:"jinja"`
+
+	jinjaOnce sync.Once
+	jinja     *jinja.Template
+	jinjaErr  error
+}
+
+// Validate check the name and the Jinja template.
+func (t *ChatTemplate) Validate() error {
+
+	if t.Name == `` {
+		return fmt.Errorf(`name is required`)
+	}
+
+	_, err := t.compile()
+	return err
+}
+
+// compile return the parsed Jinja template, nil if Jinja is empty.
+func (t *ChatTemplate) compile() (*jinja.Template, error) {
+
+	t.jinjaOnce.Do(func() {
+		if t.Jinja != `` {
+			t.jinja, t.jinjaErr = jinja.Parse(t.Jinja)
+		}
+	})
+	return t.jinja, t.jinjaErr
+}
+
+// Render return prompt of messages. The system messages of request replace the default system
+// message, and the prompt ends with Generation for the reply.
+func (t *ChatTemplate) Render(messages []schema.Message) (string, error) {
+
+	if t.Jinja != `` {
+		return t.renderJinja(messages)
+	}
+
+	systems := []string{}
+	for _, msg := range messages {
+		if msg.Role == `system` && msg.Content != `` {
+			systems = append(systems, msg.Content)
+		}
+	}
+	system := strings.Join(systems, "\n")
+	if len(systems) == 0 {
+		system = t.System
+	}
+
+	systemPrompt := ``
+	if system != `` {
+		systemPrompt = t.format(t.SystemFormat, system, ``, 0)
+	}
+
+	sb := strings.Builder{}
+	if !t.SystemInFirstUser {
+		sb.WriteString(systemPrompt)
+	}
+
+	round := 0
+	for _, msg := range messages {
+		switch msg.Role {
+		case `user`:
+			round++
+			content := msg.Content
+			if t.SystemInFirstUser && round == 1 {
+				content = systemPrompt + content
+			}
+			sb.WriteString(t.format(t.UserFormat, system, content, round))
+		case `assistant`:
+			sb.WriteString(t.format(t.AssistantFormat, system, msg.Content, round))
+		}
+	}
+
+	sb.WriteString(t.format(t.Generation, system, ``, round))
+
+	return sb.String(), nil
+}
+
+func (t *ChatTemplate) renderJinja(messages []schema.Message) (string, error) {
+
+	tmpl, err := t.compile()
+	if err != nil {
+		return ``, err
+	}
+
+	msgs := make([]any, 0, len(messages)+1)
+	if t.System != `` && (len(messages) == 0 || messages[0].Role != `system`) {
+		msgs = append(msgs, map[string]any{`role`: `system`, `content`: t.System})
+	}
+	for _, msg := range messages {
+		msgs = append(msgs, map[string]any{`role`: msg.Role, `content`: msg.Content})
+	}
+
+	return tmpl.Render(map[string]any{
+		`messages`:              msgs,
+		`bos_token`:             t.BOS,
+		`eos_token`:             t.EOS,
+		`add_generation_prompt`: true,
+	})
+}
+
+func (t *ChatTemplate) format(format, system, content string, round int) string {
+	if format == `` {
+		format = `{content}`
+	}
+	return strings.NewReplacer(
+		`{system}`, system,
+		`{content}`, content,
+		`{bos}`, t.BOS,
+		`{eos}`, t.EOS,
+		`{round}`, strconv.Itoa(round),
+	).Replace(format)
+}
+
+// Match report whether model uses the template.
+func (t *ChatTemplate) Match(model string) bool {
+	if model == t.Name {
+		return true
+	}
+	for _, pattern := range t.Models {
+		if ok, _ := path.Match(pattern, model); ok {
+			return true
+		}
+	}
+	return false
+}
+
+var chatTemplates = struct {
+	sync.RWMutex
+	// templates in registration order, the later registered ones take precedence.
+	list []*ChatTemplate
+}{}
+
+// DefaultChatTemplate used by models without matched template.
+const DefaultChatTemplate = `vicuna`
+
+// RegisterChatTemplate register or replace template by name.
+func RegisterChatTemplate(t *ChatTemplate) {
+
+	chatTemplates.Lock()
+	defer chatTemplates.Unlock()
+
+	for i, v := range chatTemplates.list {
+		if v.Name == t.Name {
+			chatTemplates.list = append(chatTemplates.list[:i], chatTemplates.list[i+1:]...)
+			break
+		}
+	}
+	chatTemplates.list = append(chatTemplates.list, t)
+}
+
+// GetChatTemplate return template by name.
+func GetChatTemplate(name string) (*ChatTemplate, bool) {
+
+	chatTemplates.RLock()
+	defer chatTemplates.RUnlock()
+
+	for _, v := range chatTemplates.list {
+		if v.Name == name {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// ChatTemplateOf return template of model by Models patterns, the later registered templates
+// take precedence. DefaultChatTemplate is returned if no template matches.
+func ChatTemplateOf(model string) *ChatTemplate {
+
+	chatTemplates.RLock()
+	for i := len(chatTemplates.list) - 1; i >= 0; i-- {
+		if t := chatTemplates.list[i]; t.Match(model) {
+			chatTemplates.RUnlock()
+			return t
+		}
+	}
+	chatTemplates.RUnlock()
+
+	t, _ := GetChatTemplate(DefaultChatTemplate)
+	return t
+}
+
+// ChatTemplates return the names of registered templates.
+func ChatTemplates() []string {
+
+	chatTemplates.RLock()
+	defer chatTemplates.RUnlock()
+
+	names := make([]string, 0, len(chatTemplates.list))
+	for _, v := range chatTemplates.list {
+		names = append(names, v.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LoadChatTemplates register the templates in YAML file, which is a list of ChatTemplate.
+func LoadChatTemplates(file string) error {
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	templates := []*ChatTemplate{}
+	if err := yaml.Unmarshal(data, &templates); err != nil {
+		return fmt.Errorf(`%s: %v`, file, err)
+	}
+
+	for i, t := range templates {
+		if err := t.Validate(); err != nil {
+			return fmt.Errorf(`%s: templates[%d]: %v`, file, i, err)
+		}
+	}
+	for _, t := range templates {
+		RegisterChatTemplate(t)
+	}
+
+	return nil
+}
+
+func init() {
+
+	for _, t := range []*ChatTemplate{
+		{
+			// https://github.com/lm-sys/FastChat/blob/main/docs/vicuna_weights_version.md
+			Name:            `vicuna`,
+			Models:          []string{`vicuna-*`, `*-vicuna-*`, `longchat-*`},
+			System:          `A chat between a curious user and an artificial intelligence assistant. The assistant gives helpful, detailed, and polite answers to the user's questions.`,
+			SystemFormat:    `{system} `,
+			UserFormat:      `USER: {content} `,
+			AssistantFormat: `ASSISTANT: {content}{eos}`,
+			Generation:      `ASSISTANT:`,
+			EOS:             `</s>`,
+			Stop:            []string{`</s>`},
+		},
+		{
+			// https://huggingface.co/blog/llama2#how-to-prompt-llama-2
+			Name:              `llama-2`,
+			Models:            []string{`llama-2-*`, `Llama-2-*`, `codellama-*`},
+			BOS:               `<s>`,
+			EOS:               `</s>`,
+			SystemFormat:      "<<SYS>>\n{system}\n<</SYS>>\n\n",
+			SystemInFirstUser: true,
+			UserFormat:        `{bos}[INST] {content} [/INST]`,
+			AssistantFormat:   ` {content} {eos}`,
+			Stop:              []string{`</s>`},
+		},
+		{
+			Name:            `chatml`,
+			Models:          []string{`qwen-*`, `Qwen-*`, `*-chatml`},
+			System:          `You are a helpful assistant.`,
+			SystemFormat:    "<|im_start|>system\n{system}<|im_end|>\n",
+			UserFormat:      "<|im_start|>user\n{content}<|im_end|>\n",
+			AssistantFormat: "<|im_start|>assistant\n{content}<|im_end|>\n",
+			Generation:      "<|im_start|>assistant\n",
+			Stop:            []string{`<|im_end|>`, `<|endoftext|>`},
+		},
+		{
+			Name:            `chatglm2`,
+			Models:          []string{`chatglm2-*`},
+			SystemFormat:    "{system}\n\n",
+			UserFormat:      "[Round {round}]\n\n问：{content}\n\n",
+			AssistantFormat: "答：{content}\n\n",
+			Generation:      `答：`,
+		},
+		{
+			Name:            `alpaca`,
+			Models:          []string{`alpaca-*`, `*-alpaca-*`},
+			System:          `Below is an instruction that describes a task. Write a response that appropriately completes the request.`,
+			SystemFormat:    "{system}\n\n",
+			UserFormat:      "### Instruction:\n{content}\n\n",
+			AssistantFormat: "### Response:\n{content}{eos}",
+			Generation:      "### Response:\n",
+			EOS:             `</s>`,
+			Stop:            []string{`</s>`, `### Instruction:`},
+		},
+		{
+			Name:            `dolly`,
+			Models:          []string{`dolly-v2-*`},
+			System:          `Below is an instruction that describes a task. Write a response that appropriately completes the request.`,
+			SystemFormat:    "{system}\n\n",
+			UserFormat:      "### Instruction:\n{content}\n\n",
+			AssistantFormat: "### Response:\n{content}\n\n### End\n\n",
+			Generation:      "### Response:\n",
+			Stop:            []string{`### End`},
+		},
+	} {
+		RegisterChatTemplate(t)
+	}
+}
@@ -0,0 +1,236 @@
+package prompts
+
+import (
+	"fmt"
+
+	"github.com/nexptr/llmchain/schema"
+)
+
+// MessageFormatter render messages of a chat prompt.
+type MessageFormatter interface {
+	// FormatMessages return the messages rendered with vars.
+	FormatMessages(vars H) ([]schema.Message, error)
+	// Variables return the variables used.
+	Variables() []string
+}
+
+// RoleMessageTemplate render a message of role by template.
+type RoleMessageTemplate struct {
+	Role     string
+	Template *Template
+}
+
+var _ MessageFormatter = &RoleMessageTemplate{}
+
+// NewMessageTemplate return template of a message of role: system, user or assistant.
+func NewMessageTemplate(role, prompt string) (*RoleMessageTemplate, error) {
+
+	t, err := New(prompt)
+	if err != nil {
+		return nil, fmt.Errorf(`%s message: %v`, role, err)
+	}
+
+	return &RoleMessageTemplate{Role: role, Template: t}, nil
+}
+
+// SystemMessage return system message template, the parse error is returned by NewChatPromptTemplate.
+func SystemMessage(prompt string) MessageFormatter {
+	return messageTemplate(`system`, prompt)
+}
+
+// UserMessage return user message template, the parse error is returned by NewChatPromptTemplate.
+func UserMessage(prompt string) MessageFormatter {
+	return messageTemplate(`user`, prompt)
+}
+
+// AssistantMessage return assistant message template, the parse error is returned by NewChatPromptTemplate.
+func AssistantMessage(prompt string) MessageFormatter {
+	return messageTemplate(`assistant`, prompt)
+}
+
+func messageTemplate(role, prompt string) MessageFormatter {
+	t, err := NewMessageTemplate(role, prompt)
+	if err != nil {
+		return invalidFormatter{err}
+	}
+	return t
+}
+
+// invalidFormatter hold the parse error of template.
+type invalidFormatter struct {
+	err error
+}
+
+func (f invalidFormatter) FormatMessages(vars H) ([]schema.Message, error) {
+	return nil, f.err
+}
+
+func (invalidFormatter) Variables() []string {
+	return nil
+}
+
+// FormatMessages implements MessageFormatter, only the variables of template are passed.
+func (m *RoleMessageTemplate) FormatMessages(vars H) ([]schema.Message, error) {
+
+	content, err := renderUsed(m.Template, vars)
+	if err != nil {
+		return nil, fmt.Errorf(`%s message: %v`, m.Role, err)
+	}
+
+	return []schema.Message{{Role: m.Role, Content: content}}, nil
+}
+
+// Variables implements MessageFormatter.
+func (m *RoleMessageTemplate) Variables() []string {
+	return m.Template.Variables()
+}
+
+// MessagesPlaceholder splice the messages of variable Name, example: the history loaded from memory.
+// The value may be []schema.Message or schema.Message.
+type MessagesPlaceholder struct {
+	Name string
+	// Optional render nothing if the variable is not set.
+	Optional bool
+}
+
+var _ MessageFormatter = MessagesPlaceholder{}
+
+// FormatMessages implements MessageFormatter.
+func (p MessagesPlaceholder) FormatMessages(vars H) ([]schema.Message, error) {
+
+	v, ok := vars[p.Name]
+	if !ok || v == nil {
+		if p.Optional {
+			return nil, nil
+		}
+		return nil, fmt.Errorf(`messages placeholder: field: '%s' not set`, p.Name)
+	}
+
+	switch msgs := v.(type) {
+	case []schema.Message:
+		return msgs, nil
+	case schema.Message:
+		return []schema.Message{msgs}, nil
+	case string:
+		// memory returning the history as text
+		if msgs == `` {
+			return nil, nil
+		}
+		return nil, fmt.Errorf(`messages placeholder: field '%s' is a string, configure the memory to return messages`, p.Name)
+	}
+
+	return nil, fmt.Errorf(`messages placeholder: field '%s' is %T, expect []schema.Message`, p.Name, v)
+}
+
+// Variables implements MessageFormatter.
+func (p MessagesPlaceholder) Variables() []string {
+	return []string{p.Name}
+}
+
+// ChatPromptTemplate render the messages of chat request from role message templates and placeholders.
+//
+//	t, err := prompts.NewChatPromptTemplate(
+//		prompts.SystemMessage(`You are a helpful assistant of {{.product}}.`),
+//		prompts.MessagesPlaceholder{Name: `history`, Optional: true},
+//		prompts.UserMessage(`{{.input}}`),
+//	)
+//	messages, err := t.WithMemory(memory).FormatMessages(prompts.H{`product`: `llmchain`, `input`: `hi`})
+type ChatPromptTemplate struct {
+	Messages []MessageFormatter
+
+	memory   schema.Memory
+	partials H
+}
+
+// NewChatPromptTemplate return template of messages, the parse errors of messages are returned.
+func NewChatPromptTemplate(messages ...MessageFormatter) (*ChatPromptTemplate, error) {
+
+	for _, m := range messages {
+		if f, ok := m.(invalidFormatter); ok {
+			return nil, f.err
+		}
+	}
+
+	return &ChatPromptTemplate{Messages: messages, partials: H{}}, nil
+}
+
+// WithMemory return copy of template, the variables of memory are loaded on format.
+func (t *ChatPromptTemplate) WithMemory(memory schema.Memory) *ChatPromptTemplate {
+	c := *t
+	c.memory = memory
+	return &c
+}
+
+// Partial return copy of template with vars filled, vars of FormatMessages take precedence.
+func (t *ChatPromptTemplate) Partial(vars H) *ChatPromptTemplate {
+
+	c := *t
+	c.partials = make(H, len(t.partials)+len(vars))
+	for k, v := range t.partials {
+		c.partials[k] = v
+	}
+	for k, v := range vars {
+		c.partials[k] = v
+	}
+	return &c
+}
+
+// Variables return the variables to set, not filled by Partial or memory.
+func (t *ChatPromptTemplate) Variables() []string {
+
+	filled := map[string]bool{}
+	for k := range t.partials {
+		filled[k] = true
+	}
+	if t.memory != nil {
+		for _, k := range t.memory.MemoryVariables() {
+			filled[k] = true
+		}
+	}
+
+	ret := []string{}
+	for _, m := range t.Messages {
+		for _, v := range m.Variables() {
+			if !filled[v] {
+				filled[v] = true
+				ret = append(ret, v)
+			}
+		}
+	}
+	return ret
+}
+
+// FormatMessages return messages rendered with vars, the partial vars and the memory variables loaded
+// with vars. The messages can be used as ChatRequest.Messages directly.
+func (t *ChatPromptTemplate) FormatMessages(vars H) ([]schema.Message, error) {
+
+	data := make(H, len(t.partials)+len(vars))
+	for k, v := range t.partials {
+		data[k] = v
+	}
+
+	if t.memory != nil {
+		mem, err := t.memory.LoadMemoryVariables(vars)
+		if err != nil {
+			return nil, fmt.Errorf(`load memory: %v`, err)
+		}
+		for k, v := range mem {
+			data[k] = v
+		}
+	}
+
+	for k, v := range vars {
+		data[k] = v
+	}
+
+	ret := []schema.Message{}
+	for _, m := range t.Messages {
+		msgs, err := m.FormatMessages(data)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, msgs...)
+	}
+
+	return ret, nil
+}
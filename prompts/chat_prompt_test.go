@@ -0,0 +1,94 @@
+package prompts_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/nexptr/llmchain/prompts"
+	"github.com/nexptr/llmchain/schema"
+)
+
+// historyMemory return the history messages as variable history.
+type historyMemory struct {
+	history []schema.Message
+	inputs  map[string]any
+}
+
+func (m *historyMemory) MemoryVariables() []string {
+	return []string{`history`}
+}
+
+func (m *historyMemory) LoadMemoryVariables(inputs map[string]any) (map[string]any, error) {
+	m.inputs = inputs
+	return map[string]any{`history`: m.history}, nil
+}
+
+func (m *historyMemory) SaveContext(inputs map[string]any, outputs map[string]any) error {
+	return nil
+}
+
+func (m *historyMemory) Clear() error {
+	m.history = nil
+	return nil
+}
+
+func TestChatPromptTemplate(t *testing.T) {
+
+	tmpl, err := prompts.NewChatPromptTemplate(
+		prompts.SystemMessage(`You are an assistant of {{.product}}.`),
+		prompts.MessagesPlaceholder{Name: `history`, Optional: true},
+		prompts.UserMessage(`{{.input}}`),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if vars := tmpl.Variables(); !reflect.DeepEqual(vars, []string{`product`, `history`, `input`}) {
+		t.Fatalf(`unexpected variables %v`, vars)
+	}
+
+	// without memory, the optional history is empty.
+	msgs, err := tmpl.FormatMessages(prompts.H{`product`: `llmchain`, `input`: `hi`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []schema.Message{{Role: `system`, Content: `You are an assistant of llmchain.`}, schema.BuildUserMessage(`hi`)}
+	if !reflect.DeepEqual(msgs, want) {
+		t.Fatalf(`unexpected messages %v`, msgs)
+	}
+
+	memory := &historyMemory{history: []schema.Message{schema.BuildUserMessage(`q1`), schema.BuildAIMessage(`a1`)}}
+	withMemory := tmpl.Partial(prompts.H{`product`: `llmchain`}).WithMemory(memory)
+
+	if vars := withMemory.Variables(); !reflect.DeepEqual(vars, []string{`input`}) {
+		t.Fatalf(`unexpected variables %v`, vars)
+	}
+
+	msgs, err = withMemory.FormatMessages(prompts.H{`input`: `q2`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []schema.Message{want[0], schema.BuildUserMessage(`q1`), schema.BuildAIMessage(`a1`), schema.BuildUserMessage(`q2`)}
+	if !reflect.DeepEqual(msgs, want) {
+		t.Fatalf(`unexpected messages %v`, msgs)
+	}
+	if memory.inputs[`input`] != `q2` {
+		t.Fatalf(`memory is not loaded with inputs: %v`, memory.inputs)
+	}
+}
+
+func TestChatPromptTemplate_Errors(t *testing.T) {
+
+	if _, err := prompts.NewChatPromptTemplate(prompts.UserMessage(`{{.input`)); err == nil {
+		t.Fatal(`expect parse error`)
+	}
+
+	tmpl, _ := prompts.NewChatPromptTemplate(prompts.MessagesPlaceholder{Name: `history`}, prompts.UserMessage(`{{.input}}`))
+
+	if _, err := tmpl.FormatMessages(prompts.H{`input`: `hi`}); err == nil || err.Error() != `messages placeholder: field: 'history' not set` {
+		t.Fatalf(`unexpected error %v`, err)
+	}
+	if _, err := tmpl.FormatMessages(prompts.H{`history`: []schema.Message{}}); err == nil || err.Error() != `user message: field: 'input' not set` {
+		t.Fatalf(`unexpected error %v`, err)
+	}
+}
@@ -0,0 +1,121 @@
+package prompts_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nexptr/llmchain/prompts"
+	"github.com/nexptr/llmchain/schema"
+)
+
+func TestChatTemplate_Render(t *testing.T) {
+
+	history := []schema.Message{
+		{Role: `system`, Content: `S`},
+		schema.BuildUserMessage(`u1`),
+		schema.BuildAIMessage(`a1`),
+		schema.BuildUserMessage(`u2`),
+	}
+
+	cases := []struct {
+		template string
+		messages []schema.Message
+		want     string
+	}{
+		{`llama-2`, history, "<s>[INST] <<SYS>>\nS\n<</SYS>>\n\nu1 [/INST] a1 </s><s>[INST] u2 [/INST]"},
+		{`llama-2`, history[1:2], `<s>[INST] u1 [/INST]`},
+		{`chatml`, history, "<|im_start|>system\nS<|im_end|>\n<|im_start|>user\nu1<|im_end|>\n<|im_start|>assistant\na1<|im_end|>\n<|im_start|>user\nu2<|im_end|>\n<|im_start|>assistant\n"},
+		{`vicuna`, history, `S USER: u1 ASSISTANT: a1</s>USER: u2 ASSISTANT:`},
+		{`chatglm2`, history, "S\n\n[Round 1]\n\n问：u1\n\n答：a1\n\n[Round 2]\n\n问：u2\n\n答："},
+		{`alpaca`, history[1:2], "Below is an instruction that describes a task. Write a response that appropriately completes the request.\n\n### Instruction:\nu1\n\n### Response:\n"},
+	}
+
+	for _, c := range cases {
+		tmpl, ok := prompts.GetChatTemplate(c.template)
+		if !ok {
+			t.Fatalf(`template %s not found`, c.template)
+		}
+		if got, err := tmpl.Render(c.messages); err != nil || got != c.want {
+			t.Errorf("%s:\n got: %q\nwant: %q", c.template, got, c.want)
+		}
+	}
+}
+
+func TestChatTemplateOf(t *testing.T) {
+
+	cases := map[string]string{
+		`llama-2-13b-chat`: `llama-2`,
+		`vicuna-13b-v1.5`:  `vicuna`,
+		`chatglm2-6b`:      `chatglm2`,
+		`dolly-v2-12b`:     `dolly`,
+		`unknown`:          prompts.DefaultChatTemplate,
+	}
+
+	for model, want := range cases {
+		if got := prompts.ChatTemplateOf(model).Name; got != want {
+			t.Errorf(`%s: got template %s, want %s`, model, got, want)
+		}
+	}
+}
+
+func TestLoadChatTemplates(t *testing.T) {
+
+	file := filepath.Join(t.TempDir(), `templates.yaml`)
+	os.WriteFile(file, []byte(`
+- name: test-raw
+  models: [test-raw-*]
+  user_format: "Q: {content}\n"
+  assistant_format: "A: {content}\n"
+  generation: "A:"
+  stop: ["Q:"]
+`), 0644)
+
+	if err := prompts.LoadChatTemplates(file); err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := prompts.ChatTemplateOf(`test-raw-7b`)
+	if tmpl.Name != `test-raw` || len(tmpl.Stop) != 1 {
+		t.Fatalf(`unexpected template %+v`, tmpl)
+	}
+	if got, _ := tmpl.Render([]schema.Message{schema.BuildUserMessage(`hi`)}); got != "Q: hi\nA:" {
+		t.Fatalf(`unexpected prompt %q`, got)
+	}
+}
+
+func TestResolveChatTemplate_HF(t *testing.T) {
+
+	dir := t.TempDir()
+	os.Mkdir(filepath.Join(dir, `my-model`), 0755)
+	os.WriteFile(filepath.Join(dir, `my-model`, `tokenizer_config.json`), []byte(`{
+		"bos_token": {"content": "<s>", "lstrip": false},
+		"eos_token": "</s>",
+		"chat_template": "{{ bos_token }}{% for m in messages %}{{ m['role'] }}: {{ m['content'] }}{{ eos_token }}{% endfor %}{% if add_generation_prompt %}assistant:{% endif %}"
+	}`), 0644)
+
+	defer func(dir string) { prompts.HFDir = dir }(prompts.HFDir)
+	prompts.HFDir = dir
+
+	tmpl, err := prompts.ResolveChatTemplate(`my-model`, ``, ``)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tmpl.Stop) != 1 || tmpl.Stop[0] != `</s>` {
+		t.Fatalf(`unexpected stop %v`, tmpl.Stop)
+	}
+
+	got, err := tmpl.Render([]schema.Message{{Role: `system`, Content: `S`}, schema.BuildUserMessage(`hi`)})
+	if err != nil || got != `<s>system: S</s>user: hi</s>assistant:` {
+		t.Fatalf(`unexpected prompt %q, %v`, got, err)
+	}
+
+	// without tokenizer config, the template of model name is used.
+	if tmpl, _ := prompts.ResolveChatTemplate(`vicuna-7b`, ``, ``); tmpl.Name != `vicuna` {
+		t.Fatalf(`unexpected template %s`, tmpl.Name)
+	}
+
+	if _, err := prompts.ResolveChatTemplate(`my-model`, `unknown`, ``); err == nil {
+		t.Fatal(`expect error of unknown template`)
+	}
+}
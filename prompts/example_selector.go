@@ -0,0 +1,170 @@
+package prompts
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/nexptr/llmchain/schema"
+	"github.com/nexptr/llmchain/tokenizer"
+	"github.com/nexptr/llmchain/vstore"
+)
+
+// ExampleSelector select the examples of few-shot prompt for the input.
+type ExampleSelector interface {
+	// SelectExamples return examples for vars, the input of prompt.
+	SelectExamples(ctx context.Context, vars H) ([]H, error)
+	// AddExample add example to the candidates.
+	AddExample(ctx context.Context, example H) error
+}
+
+// Examples the static examples, all of them are selected.
+type Examples []H
+
+var _ ExampleSelector = &Examples{}
+
+// SelectExamples implements ExampleSelector.
+func (e *Examples) SelectExamples(ctx context.Context, vars H) ([]H, error) {
+	return *e, nil
+}
+
+// AddExample implements ExampleSelector.
+func (e *Examples) AddExample(ctx context.Context, example H) error {
+	*e = append(*e, example)
+	return nil
+}
+
+// LengthBasedSelector select the examples in order as long as they fit MaxTokens, the tokens of input
+// are taken from the budget.
+type LengthBasedSelector struct {
+	// Template renders the example to measure.
+	Template *Template
+	// Tokenizer counts tokens, the estimator if nil.
+	Tokenizer tokenizer.Tokenizer
+	// MaxTokens budget of the input and examples.
+	MaxTokens int
+
+	mu       sync.RWMutex
+	examples []H
+}
+
+var _ ExampleSelector = &LengthBasedSelector{}
+
+// NewLengthBasedSelector return selector of examples rendered by template within maxTokens.
+func NewLengthBasedSelector(template *Template, maxTokens int, examples ...H) *LengthBasedSelector {
+	return &LengthBasedSelector{Template: template, MaxTokens: maxTokens, examples: examples}
+}
+
+// AddExample implements ExampleSelector.
+func (s *LengthBasedSelector) AddExample(ctx context.Context, example H) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.examples = append(s.examples, example)
+	return nil
+}
+
+// SelectExamples implements ExampleSelector.
+func (s *LengthBasedSelector) SelectExamples(ctx context.Context, vars H) ([]H, error) {
+
+	tk := s.Tokenizer
+	if tk == nil {
+		tk = tokenizer.Estimator{}
+	}
+
+	remaining := s.MaxTokens - tk.Count(exampleText(vars, nil))
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ret := []H{}
+	for _, example := range s.examples {
+		text, err := s.Template.WithMode(Lenient).Render(example)
+		if err != nil {
+			return nil, err
+		}
+		remaining -= tk.Count(text)
+		if remaining < 0 {
+			break
+		}
+		ret = append(ret, example)
+	}
+
+	return ret, nil
+}
+
+// SemanticSelector select the K examples most similar to the input, examples are stored in Store as
+// documents with the example as metadata.
+type SemanticSelector struct {
+	Store vstore.VectorStore
+	// K number of examples selected.
+	K int
+	// InputKeys the keys of example and input used for similarity, all keys if empty.
+	InputKeys []string
+	// Options of the vector store, example: vstore.WithNameSpace
+	Options []vstore.Option
+}
+
+var _ ExampleSelector = &SemanticSelector{}
+
+// NewSemanticSelector return selector of k examples from store, the examples are added to store with
+// the options, example: vstore.WithNameSpace.
+func NewSemanticSelector(ctx context.Context, store vstore.VectorStore, k int, inputKeys []string, examples []H, options ...vstore.Option) (*SemanticSelector, error) {
+
+	s := &SemanticSelector{Store: store, K: k, InputKeys: inputKeys, Options: options}
+
+	docs := make([]schema.Document, len(examples))
+	for i, example := range examples {
+		docs[i] = s.document(example)
+	}
+
+	if err := store.AddDocuments(ctx, docs, s.Options...); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *SemanticSelector) document(example H) schema.Document {
+	return schema.Document{PageContent: exampleText(example, s.InputKeys), Metadata: example}
+}
+
+// AddExample implements ExampleSelector.
+func (s *SemanticSelector) AddExample(ctx context.Context, example H) error {
+	return s.Store.AddDocuments(ctx, []schema.Document{s.document(example)}, s.Options...)
+}
+
+// SelectExamples implements ExampleSelector, the most similar example comes last, so it's closest
+// to the input in prompt.
+func (s *SemanticSelector) SelectExamples(ctx context.Context, vars H) ([]H, error) {
+
+	docs, err := s.Store.SimilaritySearch(ctx, exampleText(vars, s.InputKeys), s.K, s.Options...)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]H, 0, len(docs))
+	for i := len(docs) - 1; i >= 0; i-- {
+		ret = append(ret, docs[i].Metadata)
+	}
+	return ret, nil
+}
+
+// exampleText join the values of keys, all keys sorted if keys is empty.
+func exampleText(vars H, keys []string) string {
+
+	if len(keys) == 0 {
+		for k := range vars {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+	}
+
+	parts := []string{}
+	for _, k := range keys {
+		if v, ok := vars[k]; ok {
+			parts = append(parts, toText(v))
+		}
+	}
+	return strings.Join(parts, "\n")
+}
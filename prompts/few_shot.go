@@ -0,0 +1,137 @@
+package prompts
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// FewShotTemplate render prompt of prefix, the examples selected for input and suffix, separated by
+// Separator.
+//
+//	t, err := prompts.NewFewShotTemplate(
+//		`Give the antonym of every input.`,
+//		"Input: {{.input}}\nOutput: {{.output}}",
+//		"Input: {{.input}}\nOutput:",
+//		&prompts.Examples{{`input`: `happy`, `output`: `sad`}, {`input`: `tall`, `output`: `short`}},
+//	)
+//	prompt, err := t.Render(ctx, prompts.H{`input`: `big`})
+type FewShotTemplate struct {
+	// Prefix optional, rendered with the input.
+	Prefix *Template
+	// Example renders every selected example.
+	Example *Template
+	// Suffix rendered with the input, usually the question.
+	Suffix *Template
+
+	Selector ExampleSelector
+
+	// Separator joins the prefix, examples and suffix, default is "\n\n".
+	Separator string
+}
+
+// NewFewShotTemplate parse the templates, prefix may be empty.
+func NewFewShotTemplate(prefix, example, suffix string, selector ExampleSelector) (*FewShotTemplate, error) {
+
+	t := &FewShotTemplate{Selector: selector, Separator: "\n\n"}
+
+	var err error
+	if prefix != `` {
+		if t.Prefix, err = New(prefix); err != nil {
+			return nil, fmt.Errorf(`prefix: %v`, err)
+		}
+	}
+	if t.Example, err = New(example); err != nil {
+		return nil, fmt.Errorf(`example: %v`, err)
+	}
+	if t.Suffix, err = New(suffix); err != nil {
+		return nil, fmt.Errorf(`suffix: %v`, err)
+	}
+
+	return t, nil
+}
+
+// Variables return the variables of prefix and suffix.
+func (t *FewShotTemplate) Variables() []string {
+
+	seen := map[string]bool{}
+	ret := []string{}
+	for _, tmpl := range []*Template{t.Prefix, t.Suffix} {
+		if tmpl == nil {
+			continue
+		}
+		for _, v := range tmpl.Variables() {
+			if !seen[v] {
+				seen[v] = true
+				ret = append(ret, v)
+			}
+		}
+	}
+	return ret
+}
+
+// Render return prompt of vars, the examples are selected by Selector for vars.
+func (t *FewShotTemplate) Render(ctx context.Context, vars H) (string, error) {
+
+	parts := []string{}
+
+	if t.Prefix != nil {
+		s, err := renderUsed(t.Prefix, vars)
+		if err != nil {
+			return ``, fmt.Errorf(`prefix: %v`, err)
+		}
+		parts = append(parts, s)
+	}
+
+	if t.Selector != nil {
+		examples, err := t.Selector.SelectExamples(ctx, vars)
+		if err != nil {
+			return ``, fmt.Errorf(`select examples: %v`, err)
+		}
+		for i, example := range examples {
+			s, err := renderUsed(t.Example, example)
+			if err != nil {
+				return ``, fmt.Errorf(`examples[%d]: %v`, i, err)
+			}
+			parts = append(parts, s)
+		}
+	}
+
+	s, err := renderUsed(t.Suffix, vars)
+	if err != nil {
+		return ``, fmt.Errorf(`suffix: %v`, err)
+	}
+	parts = append(parts, s)
+
+	sep := t.Separator
+	if sep == `` {
+		sep = "\n\n"
+	}
+
+	ret := []string{}
+	for _, p := range parts {
+		if p != `` {
+			ret = append(ret, p)
+		}
+	}
+	return strings.Join(ret, sep), nil
+}
+
+// renderUsed render tmpl with the vars it uses, other vars are ignored.
+func renderUsed(tmpl *Template, vars H) (string, error) {
+
+	used := H{}
+	for _, v := range tmpl.Variables() {
+		if val, ok := vars[v]; ok {
+			used[v] = val
+		}
+	}
+	return tmpl.Render(used)
+}
+
+func toText(v any) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return fmt.Sprint(v)
+}
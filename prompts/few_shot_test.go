@@ -0,0 +1,115 @@
+package prompts_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/nexptr/llmchain/llms"
+	"github.com/nexptr/llmchain/prompts"
+	"github.com/nexptr/llmchain/schema"
+	"github.com/nexptr/llmchain/vstore"
+)
+
+// embedLLM embeds text to the counts of words of vocabulary.
+type embedLLM struct {
+	vocabulary []string
+}
+
+func (l *embedLLM) Name() string { return `embed` }
+func (l *embedLLM) Free()        {}
+func (l *embedLLM) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return ``, nil
+}
+func (l *embedLLM) Chat(ctx context.Context, req *schema.ChatRequest) (*schema.ChatResponse, error) {
+	return &schema.ChatResponse{}, nil
+}
+func (l *embedLLM) Completion(ctx context.Context, req *schema.CompletionRequest) (*schema.CompletionResponse, error) {
+	return &schema.CompletionResponse{}, nil
+}
+func (l *embedLLM) Embeddings(ctx context.Context, req *schema.EmbeddingsRequest) (*schema.EmbeddingsResponse, error) {
+	resp := &schema.EmbeddingsResponse{}
+	for i, text := range req.Input.([]string) {
+		v := make([]float32, len(l.vocabulary))
+		for j, w := range l.vocabulary {
+			v[j] = float32(strings.Count(text, w))
+		}
+		resp.Data = append(resp.Data, schema.EmbeddingData{Embedding: v, Index: i})
+	}
+	return resp, nil
+}
+
+var antonyms = []prompts.H{
+	{`input`: `happy`, `output`: `sad`},
+	{`input`: `tall`, `output`: `short`},
+	{`input`: `sunny`, `output`: `gloomy`},
+	{`input`: `windy`, `output`: `calm`},
+}
+
+func TestFewShotTemplate(t *testing.T) {
+
+	examples := prompts.Examples(antonyms[:2])
+	tmpl, err := prompts.NewFewShotTemplate(`Give the antonym of every {{.kind}}.`, "Input: {{.input}}\nOutput: {{.output}}", "Input: {{.input}}\nOutput:", &examples)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if vars := tmpl.Variables(); strings.Join(vars, `,`) != `kind,input` {
+		t.Fatalf(`unexpected variables %v`, vars)
+	}
+
+	got, err := tmpl.Render(context.Background(), prompts.H{`kind`: `word`, `input`: `big`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Give the antonym of every word.\n\nInput: happy\nOutput: sad\n\nInput: tall\nOutput: short\n\nInput: big\nOutput:"
+	if got != want {
+		t.Fatalf("unexpected prompt:\n%s", got)
+	}
+}
+
+func TestLengthBasedSelector(t *testing.T) {
+
+	example := prompts.PromptTemplate("Input: {{.input}}\nOutput: {{.output}}")
+	// every example costs 6 tokens by the estimator, the input 1 token.
+	selector := prompts.NewLengthBasedSelector(example, 14, antonyms...)
+
+	got, err := selector.SelectExamples(context.Background(), prompts.H{`input`: `big`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[1][`input`] != `tall` {
+		t.Fatalf(`unexpected examples %v`, got)
+	}
+
+	// long input leaves no room for examples.
+	got, _ = selector.SelectExamples(context.Background(), prompts.H{`input`: strings.Repeat(`big `, 20)})
+	if len(got) != 0 {
+		t.Fatalf(`unexpected examples %v`, got)
+	}
+}
+
+func TestSemanticSelector(t *testing.T) {
+
+	ctx := context.Background()
+	store := vstore.NewMemoryStore(&embedLLM{vocabulary: []string{`happy`, `tall`, `sunny`, `windy`, `weather`, `y`}})
+
+	selector, err := prompts.NewSemanticSelector(ctx, store, 2, []string{`input`}, antonyms, vstore.WithNameSpace(`antonyms`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the examples are stored in the name space of the selector.
+	if docs, _ := store.SimilaritySearch(ctx, `windy`, 2); len(docs) != 0 {
+		t.Fatalf(`unexpected documents in the default name space %v`, docs)
+	}
+
+	got, err := selector.SelectExamples(ctx, prompts.H{`input`: `windy weather`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the most similar example comes last.
+	if len(got) != 2 || got[1][`input`] != `windy` {
+		t.Fatalf(`unexpected examples %v`, got)
+	}
+}
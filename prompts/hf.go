@@ -0,0 +1,170 @@
+package prompts
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// HFDir where the Hugging Face model directories ({model}/tokenizer_config.json) are looked up,
+// default is $LLMCHAIN_MODELS_DIR or models
+var HFDir = defaultHFDir()
+
+func defaultHFDir() string {
+	if dir := os.Getenv(`LLMCHAIN_MODELS_DIR`); dir != `` {
+		return dir
+	}
+	return `models`
+}
+
+// hfTokenizerConfig the fields of tokenizer_config.json used by chat template.
+type hfTokenizerConfig struct {
+	// ChatTemplate string, or list of {name, template}
+	ChatTemplate json.RawMessage `json:"chat_template"`
+	// BOSToken string, or AddedToken {content}
+	BOSToken json.RawMessage `json:"bos_token"`
+	EOSToken json.RawMessage `json:"eos_token"`
+}
+
+// hfToken decode token of string or {"content": "..."}
+func hfToken(raw json.RawMessage) string {
+
+	s := ``
+	if json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+
+	added := struct {
+		Content string `json:"content"`
+	}{}
+	json.Unmarshal(raw, &added)
+	return added.Content
+}
+
+// hfChatTemplate decode chat_template of string, or the one named default of list.
+func hfChatTemplate(raw json.RawMessage) (string, error) {
+
+	if len(raw) == 0 {
+		return ``, nil
+	}
+
+	s := ``
+	if json.Unmarshal(raw, &s) == nil {
+		return s, nil
+	}
+
+	named := []struct {
+		Name     string `json:"name"`
+		Template string `json:"template"`
+	}{}
+	if err := json.Unmarshal(raw, &named); err != nil {
+		return ``, fmt.Errorf(`chat_template: %v`, err)
+	}
+	for _, t := range named {
+		if t.Name == `default` {
+			return t.Template, nil
+		}
+	}
+	return ``, fmt.Errorf(`chat_template: no template named default`)
+}
+
+// LoadHFChatTemplate load template name from the Hugging Face tokenizer_config.json, path may be the
+// model directory, chat_template.jinja in it takes precedence over the chat_template of config.
+// The eos_token is used as stop word.
+func LoadHFChatTemplate(name, path string) (*ChatTemplate, error) {
+
+	file, jinjaFile := path, ``
+	if fi, err := os.Stat(path); err != nil {
+		return nil, err
+	} else if fi.IsDir() {
+		file = filepath.Join(path, `tokenizer_config.json`)
+		jinjaFile = filepath.Join(path, `chat_template.jinja`)
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	conf := hfTokenizerConfig{}
+	if err := json.Unmarshal(data, &conf); err != nil {
+		return nil, fmt.Errorf(`%s: %v`, file, err)
+	}
+
+	src, err := hfChatTemplate(conf.ChatTemplate)
+	if err != nil {
+		return nil, fmt.Errorf(`%s: %v`, file, err)
+	}
+
+	if jinjaFile != `` {
+		if data, err := os.ReadFile(jinjaFile); err == nil {
+			src, file = string(data), jinjaFile
+		}
+	}
+
+	if src == `` {
+		return nil, fmt.Errorf(`%s: no chat_template`, file)
+	}
+
+	t := &ChatTemplate{
+		Name:  name,
+		BOS:   hfToken(conf.BOSToken),
+		EOS:   hfToken(conf.EOSToken),
+		Jinja: src,
+	}
+	if t.EOS != `` {
+		t.Stop = []string{t.EOS}
+	}
+
+	if err := t.Validate(); err != nil {
+		return nil, fmt.Errorf(`%s: %v`, file, err)
+	}
+
+	return t, nil
+}
+
+var hfTemplates = struct {
+	sync.Mutex
+	loaded map[string]*ChatTemplate
+}{loaded: map[string]*ChatTemplate{}}
+
+// ResolveChatTemplate return template of model by order:
+//  1. the registered template named name
+//  2. the chat_template of the Hugging Face tokenizer config, file or directory
+//  3. the chat_template of HFDir/{model}, if exists
+//  4. ChatTemplateOf(model)
+func ResolveChatTemplate(model, name, config string) (*ChatTemplate, error) {
+
+	if name != `` {
+		t, ok := GetChatTemplate(name)
+		if !ok {
+			return nil, fmt.Errorf(`unknown chat template '%s', registered: %v`, name, ChatTemplates())
+		}
+		return t, nil
+	}
+
+	if config == `` {
+		dir := filepath.Join(HFDir, model)
+		if _, err := os.Stat(filepath.Join(dir, `tokenizer_config.json`)); err != nil {
+			return ChatTemplateOf(model), nil
+		}
+		config = dir
+	}
+
+	hfTemplates.Lock()
+	defer hfTemplates.Unlock()
+
+	if t, ok := hfTemplates.loaded[config]; ok {
+		return t, nil
+	}
+
+	t, err := LoadHFChatTemplate(model, config)
+	if err != nil {
+		return nil, err
+	}
+	hfTemplates.loaded[config] = t
+
+	return t, nil
+}
@@ -0,0 +1,822 @@
+package jinja
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+type (
+	filterFunc func(v any, args []any, kwargs map[string]any) (any, error)
+	testFunc   func(v any, args []any) (bool, error)
+)
+
+// arg return the i-th positional argument, or the keyword argument, or def.
+func arg(args []any, kwargs map[string]any, i int, name string, def any) any {
+	if i < len(args) {
+		return args[i]
+	}
+	if v, ok := kwargs[name]; ok {
+		return v
+	}
+	return def
+}
+
+var filters map[string]filterFunc
+
+var tests map[string]testFunc
+
+var globals map[string]Func
+
+func init() {
+
+	filters = map[string]filterFunc{
+		`trim`: func(v any, args []any, kwargs map[string]any) (any, error) {
+			if chars, ok := arg(args, kwargs, 0, `chars`, nil).(string); ok {
+				return strings.Trim(toString(v), chars), nil
+			}
+			return strings.TrimSpace(toString(v)), nil
+		},
+		`upper`: func(v any, args []any, kwargs map[string]any) (any, error) {
+			return strings.ToUpper(toString(v)), nil
+		},
+		`lower`: func(v any, args []any, kwargs map[string]any) (any, error) {
+			return strings.ToLower(toString(v)), nil
+		},
+		`capitalize`: func(v any, args []any, kwargs map[string]any) (any, error) {
+			return capitalize(toString(v)), nil
+		},
+		`title`: func(v any, args []any, kwargs map[string]any) (any, error) {
+			return title(toString(v)), nil
+		},
+		`length`: func(v any, args []any, kwargs map[string]any) (any, error) {
+			return length(v)
+		},
+		`string`: func(v any, args []any, kwargs map[string]any) (any, error) {
+			return toString(v), nil
+		},
+		`int`: func(v any, args []any, kwargs map[string]any) (any, error) {
+			if s, ok := v.(string); ok {
+				if n, err := strconv.Atoi(strings.TrimSpace(s)); err == nil {
+					return n, nil
+				}
+				if f, err := strconv.ParseFloat(strings.TrimSpace(s), 64); err == nil {
+					return int(f), nil
+				}
+				return arg(args, kwargs, 0, `default`, 0), nil
+			}
+			if n, ok := toInt(v); ok {
+				return n, nil
+			}
+			return arg(args, kwargs, 0, `default`, 0), nil
+		},
+		`float`: func(v any, args []any, kwargs map[string]any) (any, error) {
+			if s, ok := v.(string); ok {
+				if f, err := strconv.ParseFloat(strings.TrimSpace(s), 64); err == nil {
+					return f, nil
+				}
+				return arg(args, kwargs, 0, `default`, 0.0), nil
+			}
+			if n, ok := toNumber(v); ok {
+				return toFloat(n), nil
+			}
+			return arg(args, kwargs, 0, `default`, 0.0), nil
+		},
+		`abs`: func(v any, args []any, kwargs map[string]any) (any, error) {
+			switch n := normalize(v).(type) {
+			case int:
+				if n < 0 {
+					return -n, nil
+				}
+				return n, nil
+			case float64:
+				return math.Abs(n), nil
+			}
+			return nil, fmt.Errorf(`bad operand type for abs(): %s`, typeName(v))
+		},
+		`default`: func(v any, args []any, kwargs map[string]any) (any, error) {
+			def := arg(args, kwargs, 0, `default_value`, ``)
+			if truthy(arg(args, kwargs, 1, `boolean`, false)) {
+				if !truthy(v) {
+					return def, nil
+				}
+				return v, nil
+			}
+			if isUndefined(v) {
+				return def, nil
+			}
+			return v, nil
+		},
+		`first`: func(v any, args []any, kwargs map[string]any) (any, error) {
+			items, err := iterate(v)
+			if err != nil || len(items) == 0 {
+				return undefined{}, err
+			}
+			return items[0], nil
+		},
+		`last`: func(v any, args []any, kwargs map[string]any) (any, error) {
+			items, err := iterate(v)
+			if err != nil || len(items) == 0 {
+				return undefined{}, err
+			}
+			return items[len(items)-1], nil
+		},
+		`list`: func(v any, args []any, kwargs map[string]any) (any, error) {
+			items, err := iterate(v)
+			return append([]any{}, items...), err
+		},
+		`reverse`: func(v any, args []any, kwargs map[string]any) (any, error) {
+			if s, ok := v.(string); ok {
+				return slice(s, nil, nil, -1)
+			}
+			items, err := iterate(v)
+			if err != nil {
+				return nil, err
+			}
+			return slice(items, nil, nil, -1)
+		},
+		`join`: func(v any, args []any, kwargs map[string]any) (any, error) {
+			items, err := iterate(v)
+			if err != nil {
+				return nil, err
+			}
+			attr, _ := arg(args, kwargs, 1, `attribute`, nil).(string)
+			parts := make([]string, len(items))
+			for i, item := range items {
+				if attr != `` {
+					item = getAttr(item, attr)
+				}
+				parts[i] = toString(item)
+			}
+			return strings.Join(parts, toString(arg(args, kwargs, 0, `d`, ``))), nil
+		},
+		`replace`: func(v any, args []any, kwargs map[string]any) (any, error) {
+			if len(args) < 2 {
+				return nil, fmt.Errorf(`replace requires old and new`)
+			}
+			n := -1
+			if c, ok := toInt(arg(args, kwargs, 2, `count`, -1)); ok {
+				n = c
+			}
+			return strings.Replace(toString(v), toString(args[0]), toString(args[1]), n), nil
+		},
+		`items`: func(v any, args []any, kwargs map[string]any) (any, error) {
+			return items(v)
+		},
+		`dictsort`: func(v any, args []any, kwargs map[string]any) (any, error) {
+			return items(v)
+		},
+		`tojson`: func(v any, args []any, kwargs map[string]any) (any, error) {
+			indent, _ := toInt(arg(args, kwargs, 0, `indent`, nil))
+			return toJSON(v, indent, ``), nil
+		},
+		`indent`: func(v any, args []any, kwargs map[string]any) (any, error) {
+			width := `    `
+			switch w := arg(args, kwargs, 0, `width`, 4).(type) {
+			case string:
+				width = w
+			case int:
+				width = strings.Repeat(` `, w)
+			}
+			first := truthy(arg(args, kwargs, 1, `first`, false))
+			lines := strings.Split(toString(v), "\n")
+			for i := range lines {
+				if (i > 0 || first) && lines[i] != `` {
+					lines[i] = width + lines[i]
+				}
+			}
+			return strings.Join(lines, "\n"), nil
+		},
+		`safe`: func(v any, args []any, kwargs map[string]any) (any, error) {
+			return v, nil
+		},
+		`map`: func(v any, args []any, kwargs map[string]any) (any, error) {
+			items, err := iterate(v)
+			if err != nil {
+				return nil, err
+			}
+			ret := make([]any, len(items))
+			if attr, ok := kwargs[`attribute`].(string); ok {
+				for i, item := range items {
+					ret[i] = getAttr(item, attr)
+					if isUndefined(ret[i]) && kwargs[`default`] != nil {
+						ret[i] = kwargs[`default`]
+					}
+				}
+				return ret, nil
+			}
+			if len(args) == 0 {
+				return nil, fmt.Errorf(`map requires a filter name or attribute`)
+			}
+			f, ok := filters[toString(args[0])]
+			if !ok {
+				return nil, fmt.Errorf(`no filter named '%s'`, toString(args[0]))
+			}
+			for i, item := range items {
+				if ret[i], err = f(item, args[1:], nil); err != nil {
+					return nil, err
+				}
+			}
+			return ret, nil
+		},
+		`selectattr`: selectFilter(true, true),
+		`rejectattr`: selectFilter(false, true),
+		`select`:     selectFilter(true, false),
+		`reject`:     selectFilter(false, false),
+		`unique`: func(v any, args []any, kwargs map[string]any) (any, error) {
+			items, err := iterate(v)
+			if err != nil {
+				return nil, err
+			}
+			ret := []any{}
+			for _, item := range items {
+				if ok, _ := contains(ret, item); !ok {
+					ret = append(ret, item)
+				}
+			}
+			return ret, nil
+		},
+		`sort`: func(v any, args []any, kwargs map[string]any) (any, error) {
+			items, err := iterate(v)
+			if err != nil {
+				return nil, err
+			}
+			ret := append([]any{}, items...)
+			reverse := truthy(arg(args, kwargs, 0, `reverse`, false))
+			attr, _ := arg(args, kwargs, 2, `attribute`, nil).(string)
+			sort.SliceStable(ret, func(i, j int) bool {
+				a, b := ret[i], ret[j]
+				if attr != `` {
+					a, b = getAttr(a, attr), getAttr(b, attr)
+				}
+				c, _ := compare(a, b)
+				if reverse {
+					return c > 0
+				}
+				return c < 0
+			})
+			return ret, nil
+		},
+		`wordcount`: func(v any, args []any, kwargs map[string]any) (any, error) {
+			return len(strings.Fields(toString(v))), nil
+		},
+	}
+	filters[`count`] = filters[`length`]
+	filters[`d`] = filters[`default`]
+	filters[`e`] = filters[`safe`]
+	filters[`escape`] = filters[`safe`]
+
+	tests = map[string]testFunc{
+		`defined`: func(v any, args []any) (bool, error) {
+			return !isUndefined(v), nil
+		},
+		`undefined`: func(v any, args []any) (bool, error) {
+			return isUndefined(v), nil
+		},
+		`none`: func(v any, args []any) (bool, error) {
+			return v == nil, nil
+		},
+		`boolean`: func(v any, args []any) (bool, error) {
+			_, ok := v.(bool)
+			return ok, nil
+		},
+		`true`: func(v any, args []any) (bool, error) {
+			return v == true, nil
+		},
+		`false`: func(v any, args []any) (bool, error) {
+			return v == false, nil
+		},
+		`string`: func(v any, args []any) (bool, error) {
+			_, ok := normalize(v).(string)
+			return ok, nil
+		},
+		`number`: func(v any, args []any) (bool, error) {
+			switch normalize(v).(type) {
+			case int, float64:
+				return true, nil
+			}
+			return false, nil
+		},
+		`integer`: func(v any, args []any) (bool, error) {
+			_, ok := normalize(v).(int)
+			return ok, nil
+		},
+		`float`: func(v any, args []any) (bool, error) {
+			_, ok := normalize(v).(float64)
+			return ok, nil
+		},
+		`mapping`: func(v any, args []any) (bool, error) {
+			switch normalize(v).(type) {
+			case map[string]any, *namespace:
+				return true, nil
+			}
+			return false, nil
+		},
+		`sequence`: func(v any, args []any) (bool, error) {
+			switch normalize(v).(type) {
+			case []any, string, map[string]any:
+				return true, nil
+			}
+			return false, nil
+		},
+		`iterable`: func(v any, args []any) (bool, error) {
+			switch normalize(v).(type) {
+			case []any, string, map[string]any:
+				return true, nil
+			}
+			return false, nil
+		},
+		`callable`: func(v any, args []any) (bool, error) {
+			_, ok := v.(Func)
+			return ok, nil
+		},
+		`even`: func(v any, args []any) (bool, error) {
+			n, ok := toInt(v)
+			return ok && n%2 == 0, nil
+		},
+		`odd`: func(v any, args []any) (bool, error) {
+			n, ok := toInt(v)
+			return ok && n%2 != 0, nil
+		},
+		`divisibleby`: func(v any, args []any) (bool, error) {
+			n, ok1 := toInt(v)
+			d, ok2 := toInt(arg(args, nil, 0, ``, nil))
+			return ok1 && ok2 && d != 0 && n%d == 0, nil
+		},
+		`equalto`: func(v any, args []any) (bool, error) {
+			return len(args) > 0 && equal(v, args[0]), nil
+		},
+		`ne`: func(v any, args []any) (bool, error) {
+			return len(args) > 0 && !equal(v, args[0]), nil
+		},
+		`in`: func(v any, args []any) (bool, error) {
+			if len(args) == 0 {
+				return false, nil
+			}
+			return contains(args[0], v)
+		},
+		`lower`: func(v any, args []any) (bool, error) {
+			s, ok := v.(string)
+			return ok && strings.ToLower(s) == s, nil
+		},
+		`upper`: func(v any, args []any) (bool, error) {
+			s, ok := v.(string)
+			return ok && strings.ToUpper(s) == s, nil
+		},
+	}
+	tests[`eq`] = tests[`equalto`]
+	tests[`==`] = tests[`equalto`]
+	for name, op := range map[string]string{`lt`: `<`, `le`: `<=`, `gt`: `>`, `ge`: `>=`} {
+		tests[name] = compareTest(op)
+		tests[op] = tests[name]
+	}
+
+	globals = map[string]Func{
+		`raise_exception`: func(args []any, kwargs map[string]any) (any, error) {
+			return nil, &Exception{Message: toString(arg(args, kwargs, 0, `message`, `error raised by template`))}
+		},
+		`namespace`: func(args []any, kwargs map[string]any) (any, error) {
+			ns := &namespace{attrs: map[string]any{}}
+			if len(args) > 0 {
+				if m, ok := normalize(args[0]).(map[string]any); ok {
+					for k, v := range m {
+						ns.attrs[k] = v
+					}
+				}
+			}
+			for k, v := range kwargs {
+				ns.attrs[k] = v
+			}
+			return ns, nil
+		},
+		`range`: func(args []any, kwargs map[string]any) (any, error) {
+			ints := make([]int, len(args))
+			for i, a := range args {
+				n, ok := toInt(a)
+				if !ok {
+					return nil, fmt.Errorf(`range: %s object cannot be interpreted as an integer`, typeName(a))
+				}
+				ints[i] = n
+			}
+			start, stop, step := 0, 0, 1
+			switch len(ints) {
+			case 1:
+				stop = ints[0]
+			case 2:
+				start, stop = ints[0], ints[1]
+			case 3:
+				start, stop, step = ints[0], ints[1], ints[2]
+			default:
+				return nil, fmt.Errorf(`range expected 1 to 3 arguments, got %d`, len(ints))
+			}
+			if step == 0 {
+				return nil, fmt.Errorf(`range step must not be zero`)
+			}
+			ret := []any{}
+			for i := start; (step > 0 && i < stop) || (step < 0 && i > stop); i += step {
+				ret = append(ret, i)
+			}
+			return ret, nil
+		},
+		`dict`: func(args []any, kwargs map[string]any) (any, error) {
+			ret := map[string]any{}
+			for k, v := range kwargs {
+				ret[k] = v
+			}
+			return ret, nil
+		},
+		`strftime_now`: func(args []any, kwargs map[string]any) (any, error) {
+			return strftime(Now(), toString(arg(args, kwargs, 0, `format`, ``))), nil
+		},
+	}
+}
+
+// Now return the time of strftime_now(), replaceable by tests.
+var Now = time.Now
+
+func compareTest(op string) testFunc {
+	return func(v any, args []any) (bool, error) {
+		if len(args) == 0 {
+			return false, fmt.Errorf(`test '%s' requires an argument`, op)
+		}
+		c, err := compare(v, args[0])
+		if err != nil {
+			return false, err
+		}
+		switch op {
+		case `<`:
+			return c < 0, nil
+		case `<=`:
+			return c <= 0, nil
+		case `>`:
+			return c > 0, nil
+		}
+		return c >= 0, nil
+	}
+}
+
+// selectFilter return select, reject, selectattr and rejectattr.
+func selectFilter(keep, byAttr bool) filterFunc {
+
+	return func(v any, args []any, kwargs map[string]any) (any, error) {
+
+		items, err := iterate(v)
+		if err != nil {
+			return nil, err
+		}
+
+		attr := ``
+		if byAttr {
+			if len(args) == 0 {
+				return nil, fmt.Errorf(`missing attribute name`)
+			}
+			attr, args = toString(args[0]), args[1:]
+		}
+
+		var test testFunc
+		if len(args) > 0 {
+			t, ok := tests[toString(args[0])]
+			if !ok {
+				return nil, fmt.Errorf(`no test named '%s'`, toString(args[0]))
+			}
+			test, args = t, args[1:]
+		}
+
+		ret := []any{}
+		for _, item := range items {
+			x := item
+			if byAttr {
+				x = getAttr(item, attr)
+			}
+			ok := truthy(x)
+			if test != nil {
+				if ok, err = test(x, args); err != nil {
+					return nil, err
+				}
+			}
+			if ok == keep {
+				ret = append(ret, item)
+			}
+		}
+		return ret, nil
+	}
+}
+
+// items return the [key, value] pairs of dict sorted by key.
+func items(v any) ([]any, error) {
+
+	if isUndefined(v) {
+		return []any{}, nil
+	}
+
+	m, ok := normalize(v).(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf(`%s has no items`, typeName(v))
+	}
+
+	ret := make([]any, 0, len(m))
+	for _, k := range sortedKeys(m) {
+		ret = append(ret, []any{k, normalize(m[k])})
+	}
+	return ret, nil
+}
+
+func capitalize(s string) string {
+	r, size := utf8.DecodeRuneInString(s)
+	if size == 0 {
+		return s
+	}
+	return string(unicode.ToUpper(r)) + strings.ToLower(s[size:])
+}
+
+func title(s string) string {
+	prev := ' '
+	return strings.Map(func(r rune) rune {
+		defer func() { prev = r }()
+		if unicode.IsLetter(prev) || unicode.IsDigit(prev) || prev == '\'' {
+			return unicode.ToLower(r)
+		}
+		return unicode.ToUpper(r)
+	}, s)
+}
+
+// method return the bound method of str and dict, nil if none.
+func method(obj any, name string) Func {
+
+	switch x := normalize(obj).(type) {
+	case string:
+		return strMethod(x, name)
+	case map[string]any:
+		switch name {
+		case `items`:
+			return func(args []any, kwargs map[string]any) (any, error) {
+				return items(x)
+			}
+		case `keys`:
+			return func(args []any, kwargs map[string]any) (any, error) {
+				return iterate(x)
+			}
+		case `values`:
+			return func(args []any, kwargs map[string]any) (any, error) {
+				ret := []any{}
+				for _, k := range sortedKeys(x) {
+					ret = append(ret, x[k])
+				}
+				return ret, nil
+			}
+		case `get`:
+			return func(args []any, kwargs map[string]any) (any, error) {
+				if v, ok := x[toString(arg(args, kwargs, 0, `key`, ``))]; ok {
+					return normalize(v), nil
+				}
+				return arg(args, kwargs, 1, `default`, nil), nil
+			}
+		}
+	}
+
+	return nil
+}
+
+func strMethod(s, name string) Func {
+
+	chars := func(args []any) (string, bool) {
+		if len(args) > 0 && args[0] != nil {
+			return toString(args[0]), true
+		}
+		return ``, false
+	}
+
+	switch name {
+	case `strip`:
+		return func(args []any, kwargs map[string]any) (any, error) {
+			if c, ok := chars(args); ok {
+				return strings.Trim(s, c), nil
+			}
+			return strings.TrimSpace(s), nil
+		}
+	case `lstrip`:
+		return func(args []any, kwargs map[string]any) (any, error) {
+			if c, ok := chars(args); ok {
+				return strings.TrimLeft(s, c), nil
+			}
+			return strings.TrimLeftFunc(s, unicode.IsSpace), nil
+		}
+	case `rstrip`:
+		return func(args []any, kwargs map[string]any) (any, error) {
+			if c, ok := chars(args); ok {
+				return strings.TrimRight(s, c), nil
+			}
+			return strings.TrimRightFunc(s, unicode.IsSpace), nil
+		}
+	case `upper`:
+		return func(args []any, kwargs map[string]any) (any, error) {
+			return strings.ToUpper(s), nil
+		}
+	case `lower`:
+		return func(args []any, kwargs map[string]any) (any, error) {
+			return strings.ToLower(s), nil
+		}
+	case `title`:
+		return func(args []any, kwargs map[string]any) (any, error) {
+			return title(s), nil
+		}
+	case `capitalize`:
+		return func(args []any, kwargs map[string]any) (any, error) {
+			return capitalize(s), nil
+		}
+	case `startswith`, `endswith`:
+		return func(args []any, kwargs map[string]any) (any, error) {
+			prefixes := []any{arg(args, kwargs, 0, `prefix`, ``)}
+			if list, ok := normalize(prefixes[0]).([]any); ok {
+				prefixes = list
+			}
+			for _, p := range prefixes {
+				if name == `startswith` && strings.HasPrefix(s, toString(p)) || name == `endswith` && strings.HasSuffix(s, toString(p)) {
+					return true, nil
+				}
+			}
+			return false, nil
+		}
+	case `split`:
+		return func(args []any, kwargs map[string]any) (any, error) {
+			var parts []string
+			sep := arg(args, kwargs, 0, `sep`, nil)
+			n, ok := toInt(arg(args, kwargs, 1, `maxsplit`, -1))
+			if !ok || n < 0 {
+				n = -1
+			} else {
+				n++
+			}
+			if sep == nil {
+				parts = strings.Fields(s)
+				if n > 0 && len(parts) > n {
+					parts = append(parts[:n-1], strings.Join(parts[n-1:], ` `))
+				}
+			} else {
+				parts = strings.SplitN(s, toString(sep), n)
+			}
+			ret := make([]any, len(parts))
+			for i, p := range parts {
+				ret[i] = p
+			}
+			return ret, nil
+		}
+	case `replace`:
+		return func(args []any, kwargs map[string]any) (any, error) {
+			if len(args) < 2 {
+				return nil, fmt.Errorf(`replace requires old and new`)
+			}
+			return strings.ReplaceAll(s, toString(args[0]), toString(args[1])), nil
+		}
+	case `join`:
+		return func(args []any, kwargs map[string]any) (any, error) {
+			items, err := iterate(arg(args, kwargs, 0, `iterable`, nil))
+			if err != nil {
+				return nil, err
+			}
+			parts := make([]string, len(items))
+			for i, item := range items {
+				parts[i] = toString(item)
+			}
+			return strings.Join(parts, s), nil
+		}
+	case `find`:
+		return func(args []any, kwargs map[string]any) (any, error) {
+			i := strings.Index(s, toString(arg(args, kwargs, 0, `sub`, ``)))
+			if i < 0 {
+				return -1, nil
+			}
+			return utf8.RuneCountInString(s[:i]), nil
+		}
+	case `count`:
+		return func(args []any, kwargs map[string]any) (any, error) {
+			return strings.Count(s, toString(arg(args, kwargs, 0, `sub`, ``))), nil
+		}
+	}
+
+	return nil
+}
+
+// toJSON encode v like Python json.dumps(v, ensure_ascii=False), keys are sorted.
+func toJSON(v any, indent int, prefix string) string {
+
+	nl, sep, inner := ``, `, `, prefix
+	if indent > 0 {
+		inner = prefix + strings.Repeat(` `, indent)
+		nl, sep = "\n"+inner, ","+"\n"+inner
+	}
+	end := ``
+	if indent > 0 {
+		end = "\n" + prefix
+	}
+
+	switch x := normalize(v).(type) {
+	case nil, undefined:
+		return `null`
+	case bool:
+		if x {
+			return `true`
+		}
+		return `false`
+	case int, float64:
+		if f, ok := x.(float64); ok && (math.IsInf(f, 0) || math.IsNaN(f)) {
+			return `null`
+		}
+		return repr(x)
+	case string:
+		return jsonString(x)
+	case []any:
+		if len(x) == 0 {
+			return `[]`
+		}
+		parts := make([]string, len(x))
+		for i, item := range x {
+			parts[i] = toJSON(item, indent, inner)
+		}
+		return `[` + nl + strings.Join(parts, sep) + end + `]`
+	case map[string]any:
+		if len(x) == 0 {
+			return `{}`
+		}
+		parts := make([]string, 0, len(x))
+		for _, k := range sortedKeys(x) {
+			parts = append(parts, jsonString(k)+`: `+toJSON(x[k], indent, inner))
+		}
+		return `{` + nl + strings.Join(parts, sep) + end + `}`
+	case *namespace:
+		return toJSON(x.attrs, indent, prefix)
+	}
+
+	return jsonString(toString(v))
+}
+
+func jsonString(s string) string {
+
+	sb := strings.Builder{}
+	sb.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			sb.WriteString(`\"`)
+		case '\\':
+			sb.WriteString(`\\`)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\r':
+			sb.WriteString(`\r`)
+		case '\t':
+			sb.WriteString(`\t`)
+		default:
+			if r < 0x20 {
+				fmt.Fprintf(&sb, `\u%04x`, r)
+			} else {
+				sb.WriteRune(r)
+			}
+		}
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
+
+// strftime format t with the common directives of Python strftime.
+func strftime(t time.Time, format string) string {
+
+	directives := map[byte]string{
+		'Y': `2006`, 'y': `06`, 'm': `01`, 'd': `02`, 'B': `January`, 'b': `Jan`,
+		'A': `Monday`, 'a': `Mon`, 'H': `15`, 'I': `03`, 'M': `04`, 'S': `05`, 'p': `PM`, 'Z': `MST`, 'z': `-0700`,
+	}
+
+	sb := strings.Builder{}
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i+1 == len(format) {
+			sb.WriteByte(format[i])
+			continue
+		}
+		i++
+		switch c := format[i]; c {
+		case '%':
+			sb.WriteByte('%')
+		case '-':
+			// %-d day without padding
+			if i+1 < len(format) && format[i+1] == 'd' {
+				i++
+				sb.WriteString(strconv.Itoa(t.Day()))
+			}
+		case 'j':
+			fmt.Fprintf(&sb, `%03d`, t.YearDay())
+		default:
+			if layout, ok := directives[c]; ok {
+				sb.WriteString(t.Format(layout))
+			} else {
+				sb.WriteByte('%')
+				sb.WriteByte(c)
+			}
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,612 @@
+package jinja
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// control flow of loopcontrols.
+var (
+	errBreak    = errors.New(`break outside loop`)
+	errContinue = errors.New(`continue outside loop`)
+)
+
+// Exception the error raised by raise_exception() in template.
+type Exception struct {
+	Message string
+}
+
+func (e *Exception) Error() string {
+	return e.Message
+}
+
+// scope the variables of template, loops and macros push new scopes.
+type scope struct {
+	vars   map[string]any
+	parent *scope
+}
+
+func (s *scope) lookup(name string) (any, bool) {
+	for ; s != nil; s = s.parent {
+		if v, ok := s.vars[name]; ok {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+func (s *scope) child() *scope {
+	return &scope{vars: map[string]any{}, parent: s}
+}
+
+type state struct {
+	sb *strings.Builder
+}
+
+func (st *state) render(nodes []node, sc *scope) error {
+
+	for _, n := range nodes {
+
+		switch n := n.(type) {
+		case *textNode:
+			st.sb.WriteString(n.text)
+
+		case *outputNode:
+			v, err := eval(n.expr, sc)
+			if err != nil {
+				return lineError(n.line, err)
+			}
+			st.sb.WriteString(toString(v))
+
+		case *ifNode:
+			matched := false
+			for i, cond := range n.conds {
+				v, err := eval(cond, sc)
+				if err != nil {
+					return err
+				}
+				if truthy(v) {
+					if err := st.render(n.bodies[i], sc); err != nil {
+						return err
+					}
+					matched = true
+					break
+				}
+			}
+			if !matched && n.els != nil {
+				if err := st.render(n.els, sc); err != nil {
+					return err
+				}
+			}
+
+		case *forNode:
+			if err := st.renderFor(n, sc); err != nil {
+				return err
+			}
+
+		case *setNode:
+			if err := st.renderSet(n, sc); err != nil {
+				return err
+			}
+
+		case *macroNode:
+			sc.vars[n.name] = st.macro(n, sc)
+
+		case *breakNode:
+			return errBreak
+
+		case *continueNode:
+			return errContinue
+		}
+	}
+
+	return nil
+}
+
+func (st *state) renderFor(n *forNode, sc *scope) error {
+
+	v, err := eval(n.iter, sc)
+	if err != nil {
+		return lineError(n.line, err)
+	}
+	all, err := iterate(v)
+	if err != nil {
+		return lineError(n.line, err)
+	}
+
+	// filter items first, so loop.length and loop.last count the filtered items.
+	items := make([]any, 0, len(all))
+	for _, item := range all {
+		if n.cond != nil {
+			inner := sc.child()
+			if err := assign(inner, n.vars, item); err != nil {
+				return lineError(n.line, err)
+			}
+			ok, err := eval(n.cond, inner)
+			if err != nil {
+				return lineError(n.line, err)
+			}
+			if !truthy(ok) {
+				continue
+			}
+		}
+		items = append(items, item)
+	}
+
+	if len(items) == 0 {
+		return st.render(n.els, sc)
+	}
+
+	for i, item := range items {
+
+		inner := sc.child()
+		if err := assign(inner, n.vars, item); err != nil {
+			return lineError(n.line, err)
+		}
+
+		loop := map[string]any{
+			`index`:     i + 1,
+			`index0`:    i,
+			`revindex`:  len(items) - i,
+			`revindex0`: len(items) - i - 1,
+			`first`:     i == 0,
+			`last`:      i == len(items)-1,
+			`length`:    len(items),
+			`previtem`:  undefined{},
+			`nextitem`:  undefined{},
+		}
+		if i > 0 {
+			loop[`previtem`] = items[i-1]
+		}
+		if i+1 < len(items) {
+			loop[`nextitem`] = items[i+1]
+		}
+		loop[`cycle`] = Func(func(args []any, kwargs map[string]any) (any, error) {
+			if len(args) == 0 {
+				return nil, fmt.Errorf(`no items for cycling given`)
+			}
+			return args[i%len(args)], nil
+		})
+		inner.vars[`loop`] = loop
+
+		err := st.render(n.body, inner)
+		if err == errBreak {
+			break
+		}
+		if err != nil && err != errContinue {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// assign item to the loop variables, item is unpacked if there are multiple variables.
+func assign(sc *scope, vars []string, item any) error {
+
+	if len(vars) == 1 {
+		sc.vars[vars[0]] = normalize(item)
+		return nil
+	}
+
+	values, ok := normalize(item).([]any)
+	if !ok || len(values) != len(vars) {
+		return fmt.Errorf(`cannot unpack %s to %d variables`, typeName(item), len(vars))
+	}
+	for i, name := range vars {
+		sc.vars[name] = normalize(values[i])
+	}
+	return nil
+}
+
+func (st *state) renderSet(n *setNode, sc *scope) error {
+
+	var v any
+	if n.body != nil {
+		inner := &state{sb: &strings.Builder{}}
+		if err := inner.render(n.body, sc); err != nil {
+			return err
+		}
+		v = inner.sb.String()
+	} else {
+		var err error
+		if v, err = eval(n.value, sc); err != nil {
+			return lineError(n.line, err)
+		}
+	}
+
+	if n.attr == `` {
+		sc.vars[n.name] = v
+		return nil
+	}
+
+	target, _ := sc.lookup(n.name)
+	ns, ok := target.(*namespace)
+	if !ok {
+		return lineError(n.line, fmt.Errorf(`cannot assign attribute on non-namespace object '%s'`, n.name))
+	}
+	ns.attrs[n.attr] = v
+	return nil
+}
+
+// macro return the Func of macro, the body is rendered in a scope of the defining scope.
+func (st *state) macro(n *macroNode, sc *scope) Func {
+
+	return func(args []any, kwargs map[string]any) (any, error) {
+
+		inner := sc.child()
+		for i, param := range n.params {
+			switch {
+			case i < len(args):
+				inner.vars[param] = args[i]
+			case kwargs[param] != nil:
+				inner.vars[param] = kwargs[param]
+			case n.defaults[param] != nil:
+				v, err := eval(n.defaults[param], sc)
+				if err != nil {
+					return nil, err
+				}
+				inner.vars[param] = v
+			default:
+				inner.vars[param] = undefined{}
+			}
+		}
+
+		out := &state{sb: &strings.Builder{}}
+		if err := out.render(n.body, inner); err != nil {
+			return nil, err
+		}
+		return out.sb.String(), nil
+	}
+}
+
+func lineError(line int, err error) error {
+	var e *Exception
+	if errors.As(err, &e) || strings.HasPrefix(err.Error(), `line `) {
+		return err
+	}
+	return fmt.Errorf(`line %d: %w`, line, err)
+}
+
+func eval(e expr, sc *scope) (any, error) {
+
+	switch e := e.(type) {
+	case *literal:
+		return e.v, nil
+
+	case *nameExpr:
+		if v, ok := sc.lookup(e.name); ok {
+			return normalize(v), nil
+		}
+		if f, ok := globals[e.name]; ok {
+			return f, nil
+		}
+		return undefined{}, nil
+
+	case *attrExpr:
+		obj, err := eval(e.obj, sc)
+		if err != nil {
+			return nil, err
+		}
+		return getAttr(obj, e.name), nil
+
+	case *indexExpr:
+		obj, err := eval(e.obj, sc)
+		if err != nil {
+			return nil, err
+		}
+		key, err := eval(e.index, sc)
+		if err != nil {
+			return nil, err
+		}
+		return getItem(obj, key), nil
+
+	case *sliceExpr:
+		obj, err := eval(e.obj, sc)
+		if err != nil {
+			return nil, err
+		}
+		bounds := make([]any, 3)
+		for i, b := range []expr{e.lo, e.hi, e.step} {
+			if b == nil {
+				continue
+			}
+			if bounds[i], err = eval(b, sc); err != nil {
+				return nil, err
+			}
+			if bounds[i] == nil {
+				continue
+			}
+			if _, ok := toInt(bounds[i]); !ok {
+				return nil, fmt.Errorf(`slice indices must be integers, got %s`, typeName(bounds[i]))
+			}
+		}
+		return slice(obj, bounds[0], bounds[1], bounds[2])
+
+	case *callExpr:
+		fn, err := eval(e.fn, sc)
+		if err != nil {
+			return nil, err
+		}
+		f, ok := fn.(Func)
+		if !ok {
+			return nil, fmt.Errorf(`%s is not callable`, describe(e.fn))
+		}
+		args, kwargs, err := evalArgs(e.args, e.kwargs, sc)
+		if err != nil {
+			return nil, err
+		}
+		return f(args, kwargs)
+
+	case *filterExpr:
+		obj, err := eval(e.obj, sc)
+		if err != nil {
+			return nil, err
+		}
+		f, ok := filters[e.name]
+		if !ok {
+			return nil, fmt.Errorf(`no filter named '%s'`, e.name)
+		}
+		args, kwargs, err := evalArgs(e.args, e.kwargs, sc)
+		if err != nil {
+			return nil, err
+		}
+		return f(obj, args, kwargs)
+
+	case *testExpr:
+		obj, err := eval(e.obj, sc)
+		if err != nil {
+			return nil, err
+		}
+		t, ok := tests[e.name]
+		if !ok {
+			return nil, fmt.Errorf(`no test named '%s'`, e.name)
+		}
+		args, _, err := evalArgs(e.args, nil, sc)
+		if err != nil {
+			return nil, err
+		}
+		ret, err := t(obj, args)
+		if err != nil {
+			return nil, err
+		}
+		return ret != e.not, nil
+
+	case *unaryExpr:
+		x, err := eval(e.x, sc)
+		if err != nil {
+			return nil, err
+		}
+		if e.op == `not` {
+			return !truthy(x), nil
+		}
+		switch n := normalize(x).(type) {
+		case int:
+			return -n, nil
+		case float64:
+			return -n, nil
+		}
+		return nil, fmt.Errorf(`bad operand type for unary -: %s`, typeName(x))
+
+	case *binaryExpr:
+		return evalBinary(e, sc)
+
+	case *condExpr:
+		cond, err := eval(e.cond, sc)
+		if err != nil {
+			return nil, err
+		}
+		if truthy(cond) {
+			return eval(e.a, sc)
+		}
+		return eval(e.b, sc)
+
+	case *listExpr:
+		ret := make([]any, len(e.items))
+		for i, item := range e.items {
+			v, err := eval(item, sc)
+			if err != nil {
+				return nil, err
+			}
+			ret[i] = v
+		}
+		return ret, nil
+
+	case *dictExpr:
+		ret := make(map[string]any, len(e.keys))
+		for i := range e.keys {
+			k, err := eval(e.keys[i], sc)
+			if err != nil {
+				return nil, err
+			}
+			v, err := eval(e.values[i], sc)
+			if err != nil {
+				return nil, err
+			}
+			ret[toString(k)] = v
+		}
+		return ret, nil
+	}
+
+	return nil, fmt.Errorf(`unknown expression %T`, e)
+}
+
+func evalArgs(exprs []expr, kwexprs map[string]expr, sc *scope) ([]any, map[string]any, error) {
+
+	args := make([]any, len(exprs))
+	for i, a := range exprs {
+		v, err := eval(a, sc)
+		if err != nil {
+			return nil, nil, err
+		}
+		args[i] = v
+	}
+
+	kwargs := make(map[string]any, len(kwexprs))
+	for k, a := range kwexprs {
+		v, err := eval(a, sc)
+		if err != nil {
+			return nil, nil, err
+		}
+		kwargs[k] = v
+	}
+
+	return args, kwargs, nil
+}
+
+// describe return the name of callee for errors.
+func describe(e expr) string {
+	switch e := e.(type) {
+	case *nameExpr:
+		return `'` + e.name + `'`
+	case *attrExpr:
+		return `'` + e.name + `'`
+	}
+	return `object`
+}
+
+func evalBinary(e *binaryExpr, sc *scope) (any, error) {
+
+	l, err := eval(e.l, sc)
+	if err != nil {
+		return nil, err
+	}
+
+	// short circuit, the operand is returned like Python.
+	switch e.op {
+	case `and`:
+		if !truthy(l) {
+			return l, nil
+		}
+		return eval(e.r, sc)
+	case `or`:
+		if truthy(l) {
+			return l, nil
+		}
+		return eval(e.r, sc)
+	}
+
+	r, err := eval(e.r, sc)
+	if err != nil {
+		return nil, err
+	}
+
+	switch e.op {
+	case `==`:
+		return equal(l, r), nil
+	case `!=`:
+		return !equal(l, r), nil
+	case `<`, `>`, `<=`, `>=`:
+		c, err := compare(l, r)
+		if err != nil {
+			return nil, err
+		}
+		switch e.op {
+		case `<`:
+			return c < 0, nil
+		case `>`:
+			return c > 0, nil
+		case `<=`:
+			return c <= 0, nil
+		}
+		return c >= 0, nil
+	case `in`:
+		return contains(r, l)
+	case `not in`:
+		ok, err := contains(r, l)
+		return !ok, err
+	case `~`:
+		return toString(l) + toString(r), nil
+	}
+
+	return arith(e.op, l, r)
+}
+
+// arith the arithmetic operators, + also concatenates strings and lists.
+func arith(op string, l, r any) (any, error) {
+
+	l, r = normalize(l), normalize(r)
+
+	switch op {
+	case `+`:
+		if x, ok := l.(string); ok {
+			if y, ok := r.(string); ok {
+				return x + y, nil
+			}
+		}
+		if x, ok := l.([]any); ok {
+			if y, ok := r.([]any); ok {
+				return append(append([]any{}, x...), y...), nil
+			}
+		}
+	case `*`:
+		if x, ok := l.(string); ok {
+			if n, ok := r.(int); ok && n > 0 {
+				return strings.Repeat(x, n), nil
+			}
+			if _, ok := r.(int); ok {
+				return ``, nil
+			}
+		}
+	}
+
+	x, ok1 := toNumber(l)
+	y, ok2 := toNumber(r)
+	if !ok1 || !ok2 {
+		return nil, fmt.Errorf(`unsupported operand types for %s: %s and %s`, op, typeName(l), typeName(r))
+	}
+
+	xi, xInt := x.(int)
+	yi, yInt := y.(int)
+	ints := xInt && yInt
+	xf, yf := toFloat(x), toFloat(y)
+
+	switch op {
+	case `+`:
+		if ints {
+			return xi + yi, nil
+		}
+		return xf + yf, nil
+	case `-`:
+		if ints {
+			return xi - yi, nil
+		}
+		return xf - yf, nil
+	case `*`:
+		if ints {
+			return xi * yi, nil
+		}
+		return xf * yf, nil
+	case `/`:
+		if yf == 0 {
+			return nil, fmt.Errorf(`division by zero`)
+		}
+		return xf / yf, nil
+	case `//`:
+		if yf == 0 {
+			return nil, fmt.Errorf(`division by zero`)
+		}
+		if ints {
+			return int(math.Floor(xf / yf)), nil
+		}
+		return math.Floor(xf / yf), nil
+	case `%`:
+		if yf == 0 {
+			return nil, fmt.Errorf(`modulo by zero`)
+		}
+		if ints {
+			// the sign of Python modulo follows the divisor
+			return ((xi % yi) + yi) % yi, nil
+		}
+		return xf - math.Floor(xf/yf)*yf, nil
+	case `**`:
+		if ints && yi >= 0 {
+			return int(math.Pow(xf, yf)), nil
+		}
+		return math.Pow(xf, yf), nil
+	}
+
+	return nil, fmt.Errorf(`unknown operator '%s'`, op)
+}
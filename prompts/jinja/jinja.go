@@ -0,0 +1,66 @@
+// Package jinja a Jinja2 subset interpreter for the chat_template of Hugging Face tokenizers.
+//
+// Supported: {{ }}, {% if/elif/else %}, {% for %} with loop and else, {% set %} including namespace
+// attributes and block set, {% macro %}, break/continue, whitespace control, the common filters and
+// tests, and the globals raise_exception(), namespace(), range() and strftime_now(). The template
+// is rendered with trim_blocks and lstrip_blocks like transformers does.
+package jinja
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Template a parsed Jinja template.
+type Template struct {
+	nodes []node
+}
+
+// Parse parse Jinja template source.
+func Parse(src string) (*Template, error) {
+
+	segs, err := split(src)
+	if err != nil {
+		return nil, fmt.Errorf(`jinja: %v`, err)
+	}
+
+	p := &parser{segs: segs}
+	nodes, _, _, err := p.parseBody()
+	if err != nil {
+		return nil, fmt.Errorf(`jinja: %v`, err)
+	}
+
+	return &Template{nodes: nodes}, nil
+}
+
+// Must panic if err is not nil.
+func Must(t *Template, err error) *Template {
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// Render render template with vars. Values may be any Go value, structs are accessed by the json
+// names of fields. The error raised by raise_exception() is *Exception.
+func (t *Template) Render(vars map[string]any) (string, error) {
+
+	sc := &scope{vars: map[string]any{}}
+	for k, v := range vars {
+		sc.vars[k] = v
+	}
+
+	st := &state{sb: &strings.Builder{}}
+	err := st.render(t.nodes, sc)
+	switch err {
+	case nil:
+		return st.sb.String(), nil
+	case errBreak, errContinue:
+		return ``, fmt.Errorf(`jinja: %v`, err)
+	}
+
+	if _, ok := err.(*Exception); ok {
+		return ``, err
+	}
+	return ``, fmt.Errorf(`jinja: %w`, err)
+}
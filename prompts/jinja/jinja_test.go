@@ -0,0 +1,144 @@
+package jinja_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/nexptr/llmchain/prompts/jinja"
+)
+
+// https://huggingface.co/meta-llama/Llama-2-7b-chat-hf/blob/main/tokenizer_config.json
+const llama2 = `{% if messages[0]['role'] == 'system' %}{% set loop_messages = messages[1:] %}{% set system_message = messages[0]['content'] %}{% else %}{% set loop_messages = messages %}{% set system_message = false %}{% endif %}{% for message in loop_messages %}{% if (message['role'] == 'user') != (loop.index0 % 2 == 0) %}{{ raise_exception('Conversation roles must alternate user/assistant/user/assistant/...') }}{% endif %}{% if loop.index0 == 0 and system_message != false %}{% set content = '<<SYS>>\n' + system_message + '\n<</SYS>>\n\n' + message['content'] %}{% else %}{% set content = message['content'] %}{% endif %}{% if message['role'] == 'user' %}{{ bos_token + '[INST] ' + content.strip() + ' [/INST]' }}{% elif message['role'] == 'assistant' %}{{ ' '  + content.strip() + ' ' + eos_token }}{% endif %}{% endfor %}`
+
+// https://huggingface.co/HuggingFaceH4/zephyr-7b-beta/blob/main/tokenizer_config.json
+const zephyr = `{% for message in messages %}
+{% if message['role'] == 'user' %}
+{{ '<|user|>\n' + message['content'] + eos_token }}
+{% elif message['role'] == 'system' %}
+{{ '<|system|>\n' + message['content'] + eos_token }}
+{% elif message['role'] == 'assistant' %}
+{{ '<|assistant|>\n'  + message['content'] + eos_token }}
+{% endif %}
+{% if loop.last and add_generation_prompt %}
+{{ '<|assistant|>' }}
+{% endif %}
+{% endfor %}`
+
+func messages(kv ...string) []any {
+	ret := []any{}
+	for i := 0; i+1 < len(kv); i += 2 {
+		ret = append(ret, map[string]any{`role`: kv[i], `content`: kv[i+1]})
+	}
+	return ret
+}
+
+func TestRender_ChatTemplates(t *testing.T) {
+
+	cases := []struct {
+		name, src string
+		vars      map[string]any
+		want      string
+	}{
+		{`llama-2`, llama2, map[string]any{
+			`messages`:  messages(`system`, `S`, `user`, `u1 `, `assistant`, `a1`, `user`, `u2`),
+			`bos_token`: `<s>`, `eos_token`: `</s>`,
+		}, "<s>[INST] <<SYS>>\nS\n<</SYS>>\n\nu1 [/INST] a1 </s><s>[INST] u2 [/INST]"},
+		{`zephyr`, zephyr, map[string]any{
+			`messages`:  messages(`system`, `S`, `user`, `hi`),
+			`eos_token`: `</s>`, `add_generation_prompt`: true,
+		}, "<|system|>\nS</s>\n<|user|>\nhi</s>\n<|assistant|>\n"},
+	}
+
+	for _, c := range cases {
+		tmpl, err := jinja.Parse(c.src)
+		if err != nil {
+			t.Fatalf(`%s: %v`, c.name, err)
+		}
+		got, err := tmpl.Render(c.vars)
+		if err != nil {
+			t.Fatalf(`%s: %v`, c.name, err)
+		}
+		if got != c.want {
+			t.Errorf("%s:\n got: %q\nwant: %q", c.name, got, c.want)
+		}
+	}
+}
+
+func TestRender_RaiseException(t *testing.T) {
+
+	tmpl := jinja.Must(jinja.Parse(llama2))
+	_, err := tmpl.Render(map[string]any{`messages`: messages(`assistant`, `a`)})
+
+	var e *jinja.Exception
+	if !errors.As(err, &e) || e.Message != `Conversation roles must alternate user/assistant/user/assistant/...` {
+		t.Fatalf(`unexpected error %v`, err)
+	}
+}
+
+func TestRender_Syntax(t *testing.T) {
+
+	cases := []struct {
+		src  string
+		want string
+	}{
+		{`{{ 1 + 2 * 3 }} {{ 7 // 2 }} {{ -7 % 3 }} {{ 2 ** 3 }} {{ 1 / 2 }}`, `7 3 2 8 0.5`},
+		{`{{ 'a' ~ 1 ~ none }} {{ 'ab' * 2 }} {{ [1] + [2] }}`, `a1None abab [1, 2]`},
+		{`{{ x if x is defined else 'undef' }} {{ y.z }}|{{ 'n' if not y }}`, `undef |n`},
+		{`{{ 'abc'[::-1] }} {{ [1, 2, 3][1:] }} {{ [1, 2, 3][-1] }}`, `cba [2, 3] 3`},
+		{`{{ '  Hi  '|trim|upper }} {{ [3, 1]|sort|join(',') }} {{ 'x'|length }}`, `HI 1,3 1`},
+		{`{{ {'b': 1, 'a': [true, none, 'é']}|tojson }}`, `{"a": [true, null, "é"], "b": 1}`},
+		{`{% for k, v in {'b': 2, 'a': 1}.items() %}{{ k }}={{ v }}{{ ',' if not loop.last }}{% endfor %}`, `a=1,b=2`},
+		{`{% for i in range(5) if i is odd %}{{ loop.index }}:{{ i }} {% else %}empty{% endfor %}`, `1:1 2:3 `},
+		{`{% for i in [] %}x{% else %}empty{% endfor %}`, `empty`},
+		{`{% for i in range(10) %}{% if i == 3 %}{% break %}{% endif %}{% if i is even %}{% continue %}{% endif %}{{ i }}{% endfor %}`, `1`},
+		{`{% set ns = namespace(n=0) %}{% for i in range(3) %}{% set ns.n = ns.n + i %}{% endfor %}{{ ns.n }}`, `3`},
+		{`{% set x = 1 %}{% for i in range(3) %}{% set x = i %}{% endfor %}{{ x }}`, `1`},
+		{`{% macro tag(name, v='1') %}<{{ name }}={{ v }}>{% endmacro %}{{ tag('a') }}{{ tag('b', v=2) }}`, `<a=1><b=2>`},
+		{`{% set block %}in{{ 1 }}{% endset %}[{{ block }}]`, `[in1]`},
+		{"  {%- if true -%}  \n x \n {%- endif %}", `x`},
+		{"<ul>\n  {% for i in [1, 2] %}\n  <li>{{ i }}</li>\n  {% endfor %}\n</ul>", "<ul>\n  <li>1</li>\n  <li>2</li>\n</ul>"},
+		{`{# comment #}{{ 'a.b.c'.split('.')|last }} {{ 'ab'.startswith('a') }} {{ d.get('k', 'def') }}`, `c True def`},
+		{`{{ msgs|selectattr('role', 'equalto', 'user')|map(attribute='content')|join(' ') }}`, `u1 u2`},
+	}
+
+	vars := map[string]any{
+		`d`: map[string]any{},
+		`msgs`: []struct {
+			Role    string `json:"role"`
+			Content string `json:"content"`
+		}{{`user`, `u1`}, {`assistant`, `a1`}, {`user`, `u2`}},
+	}
+
+	for _, c := range cases {
+		tmpl, err := jinja.Parse(c.src)
+		if err != nil {
+			t.Errorf(`%s: %v`, c.src, err)
+			continue
+		}
+		got, err := tmpl.Render(vars)
+		if err != nil {
+			t.Errorf(`%s: %v`, c.src, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("%s:\n got: %q\nwant: %q", c.src, got, c.want)
+		}
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+
+	cases := map[string]string{
+		`{% if true %}`:               `jinja: unexpected end of template, expect 'elif' or 'else' or 'endif'`,
+		"\n{{ 1 + }}":                 `jinja: line 2: unexpected end of expression`,
+		`{% include 'x' %}`:           `jinja: line 1: unsupported statement 'include'`,
+		`{{ 'unclosed }}`:             `jinja: line 1: unclosed tag '{{'`,
+		`{% for x in y %}{% endif %}`: `jinja: line 1: unsupported statement 'endif'`,
+	}
+
+	for src, want := range cases {
+		if _, err := jinja.Parse(src); err == nil || err.Error() != want {
+			t.Errorf("%q:\n got: %v\nwant: %s", src, err, want)
+		}
+	}
+}
@@ -0,0 +1,285 @@
+package jinja
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// kinds of template segments.
+const (
+	segText = iota
+	segExpr
+	segStmt
+)
+
+// segment a piece of template source, the text, or the content of {{ }} or {% %}.
+type segment struct {
+	kind int
+	src  string
+	line int
+}
+
+// split template source to segments, applying the whitespace control `-` and trim_blocks,
+// lstrip_blocks like Hugging Face does.
+func split(src string) ([]segment, error) {
+
+	segs := []segment{}
+	line := 1
+	// trimNext strip the leading whitespaces of the next text.
+	trimNext := false
+	// trimNewline strip the first newline of the next text (trim_blocks).
+	trimNewline := false
+	// lineStart whether the next text starts a line.
+	lineStart := true
+
+	for len(src) > 0 {
+
+		i := indexTag(src)
+		text := src
+		if i >= 0 {
+			text = src[:i]
+		}
+
+		if trimNext {
+			text = strings.TrimLeftFunc(text, unicode.IsSpace)
+		} else if trimNewline {
+			trimmed := strings.TrimPrefix(strings.TrimPrefix(text, "\r"), "\n")
+			lineStart = lineStart || trimmed != text
+			text = trimmed
+		}
+		trimNext, trimNewline = false, false
+
+		if i < 0 {
+			segs = append(segs, segment{segText, text, line})
+			break
+		}
+
+		open := src[i : i+2]
+		rest := src[i+2:]
+
+		// whitespace control of the start of tag
+		if strings.HasPrefix(rest, `-`) {
+			text = strings.TrimRightFunc(text, unicode.IsSpace)
+			rest = rest[1:]
+		} else if strings.HasPrefix(rest, `+`) {
+			rest = rest[1:]
+		} else if open != `{{` {
+			text = lstripBlock(text, lineStart)
+		}
+		lineStart = false
+
+		if text != `` {
+			segs = append(segs, segment{segText, text, line})
+		}
+		line += strings.Count(src[:i+2], "\n")
+
+		end, closeLen, err := indexClose(rest, open)
+		if err != nil {
+			return nil, fmt.Errorf(`line %d: %v`, line, err)
+		}
+
+		content := rest[:end]
+		if strings.HasSuffix(content, `-`) {
+			content = content[:len(content)-1]
+			trimNext = true
+		} else if strings.HasSuffix(content, `+`) {
+			content = content[:len(content)-1]
+		} else if open != `{{` {
+			trimNewline = true
+		}
+
+		switch open {
+		case `{{`:
+			segs = append(segs, segment{segExpr, content, line})
+		case `{%`:
+			segs = append(segs, segment{segStmt, content, line})
+		}
+
+		line += strings.Count(rest[:end+closeLen], "\n")
+		src = rest[end+closeLen:]
+	}
+
+	return segs, nil
+}
+
+// indexTag return index of the first {{, {% or {#.
+func indexTag(src string) int {
+	for i := 0; i+1 < len(src); i++ {
+		if src[i] == '{' && (src[i+1] == '{' || src[i+1] == '%' || src[i+1] == '#') {
+			return i
+		}
+	}
+	return -1
+}
+
+// indexClose return index and length of the close of tag, strings in tag are skipped.
+func indexClose(src, open string) (int, int, error) {
+
+	if open == `{#` {
+		if i := strings.Index(src, `#}`); i >= 0 {
+			return i, 2, nil
+		}
+		return 0, 0, fmt.Errorf(`unclosed comment`)
+	}
+
+	close := `}}`
+	if open == `{%` {
+		close = `%}`
+	}
+
+	var quote byte
+	for i := 0; i < len(src); i++ {
+		c := src[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case strings.HasPrefix(src[i:], close):
+			return i, 2, nil
+		}
+	}
+
+	return 0, 0, fmt.Errorf(`unclosed tag '%s'`, open)
+}
+
+// lstripBlock strip the spaces and tabs before a block tag if they start the line (lstrip_blocks),
+// lineStart report whether text starts a line.
+func lstripBlock(text string, lineStart bool) string {
+	i := strings.LastIndexByte(text, '\n')
+	if i < 0 && !lineStart {
+		return text
+	}
+	if strings.Trim(text[i+1:], " \t") == `` {
+		return text[:i+1]
+	}
+	return text
+}
+
+// kinds of expression tokens.
+const (
+	tokEOF = iota
+	tokName
+	tokString
+	tokInt
+	tokFloat
+	tokOp
+)
+
+type token struct {
+	kind int
+	val  string
+}
+
+// operators sorted by length, so the longest matches first.
+var operators = []string{
+	`**`, `//`, `==`, `!=`, `<=`, `>=`,
+	`+`, `-`, `*`, `/`, `%`, `~`, `<`, `>`, `=`, `(`, `)`, `[`, `]`, `{`, `}`, `,`, `:`, `.`, `|`,
+}
+
+// tokenize the content of a tag.
+func tokenize(src string) ([]token, error) {
+
+	tokens := []token{}
+
+	for i := 0; i < len(src); {
+
+		c := src[i]
+
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+
+		case c == '_' || isLetter(c):
+			j := i + 1
+			for j < len(src) && (src[j] == '_' || isLetter(src[j]) || isDigit(src[j])) {
+				j++
+			}
+			tokens = append(tokens, token{tokName, src[i:j]})
+			i = j
+
+		case isDigit(c):
+			j, kind := i, tokInt
+			for j < len(src) && (isDigit(src[j]) || src[j] == '_') {
+				j++
+			}
+			if j+1 < len(src) && src[j] == '.' && isDigit(src[j+1]) {
+				kind = tokFloat
+				j++
+				for j < len(src) && isDigit(src[j]) {
+					j++
+				}
+			}
+			tokens = append(tokens, token{kind, strings.ReplaceAll(src[i:j], `_`, ``)})
+			i = j
+
+		case c == '\'' || c == '"':
+			s, n, err := unquote(src[i:])
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{tokString, s})
+			i += n
+
+		default:
+			matched := false
+			for _, op := range operators {
+				if strings.HasPrefix(src[i:], op) {
+					tokens = append(tokens, token{tokOp, op})
+					i += len(op)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf(`unexpected char %q`, c)
+			}
+		}
+	}
+
+	return append(tokens, token{kind: tokEOF}), nil
+}
+
+// unquote the string literal at the start of src, return the string and the length of literal.
+func unquote(src string) (string, int, error) {
+
+	quote := src[0]
+	sb := strings.Builder{}
+
+	for i := 1; i < len(src); i++ {
+		c := src[i]
+		switch {
+		case c == quote:
+			return sb.String(), i + 1, nil
+		case c == '\\' && i+1 < len(src):
+			i++
+			switch src[i] {
+			case 'n':
+				sb.WriteByte('\n')
+			case 't':
+				sb.WriteByte('\t')
+			case 'r':
+				sb.WriteByte('\r')
+			default:
+				sb.WriteByte(src[i])
+			}
+		default:
+			sb.WriteByte(c)
+		}
+	}
+
+	return ``, 0, fmt.Errorf(`unclosed string`)
+}
+
+func isLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
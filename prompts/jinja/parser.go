@@ -0,0 +1,831 @@
+package jinja
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// statements
+type (
+	node interface{}
+
+	textNode struct {
+		text string
+	}
+
+	outputNode struct {
+		line int
+		expr expr
+	}
+
+	ifNode struct {
+		conds  []expr
+		bodies [][]node
+		// els body of else, nil if none.
+		els []node
+	}
+
+	forNode struct {
+		line int
+		vars []string
+		iter expr
+		// cond filter of items, example: {% for m in messages if m.role != 'system' %}
+		cond expr
+		body []node
+		els  []node
+	}
+
+	setNode struct {
+		line int
+		// target name or namespace attribute.
+		name, attr string
+		value      expr
+		// body of block set, {% set x %}...{% endset %}
+		body []node
+	}
+
+	macroNode struct {
+		name     string
+		params   []string
+		defaults map[string]expr
+		body     []node
+	}
+
+	// breakNode and continueNode of loopcontrols.
+	breakNode    struct{}
+	continueNode struct{}
+)
+
+// expressions
+type (
+	expr interface{}
+
+	literal struct {
+		v any
+	}
+
+	nameExpr struct {
+		name string
+	}
+
+	attrExpr struct {
+		obj  expr
+		name string
+	}
+
+	indexExpr struct {
+		obj, index expr
+	}
+
+	sliceExpr struct {
+		obj, lo, hi, step expr
+	}
+
+	callExpr struct {
+		fn     expr
+		args   []expr
+		kwargs map[string]expr
+	}
+
+	filterExpr struct {
+		obj    expr
+		name   string
+		args   []expr
+		kwargs map[string]expr
+	}
+
+	testExpr struct {
+		obj  expr
+		name string
+		args []expr
+		not  bool
+	}
+
+	unaryExpr struct {
+		op string
+		x  expr
+	}
+
+	binaryExpr struct {
+		op   string
+		l, r expr
+	}
+
+	condExpr struct {
+		cond, a, b expr
+	}
+
+	listExpr struct {
+		items []expr
+	}
+
+	dictExpr struct {
+		keys, values []expr
+	}
+)
+
+// parser parse the segments of template to nodes.
+type parser struct {
+	segs []segment
+	pos  int
+}
+
+// parseBody parse nodes until one of the end statements, return nodes and the end statement keyword.
+func (p *parser) parseBody(ends ...string) ([]node, string, *tagParser, error) {
+
+	nodes := []node{}
+
+	for p.pos < len(p.segs) {
+
+		seg := p.segs[p.pos]
+		p.pos++
+
+		switch seg.kind {
+		case segText:
+			nodes = append(nodes, &textNode{seg.src})
+
+		case segExpr:
+			tp, err := newTagParser(seg)
+			if err != nil {
+				return nil, ``, nil, err
+			}
+			e, err := tp.parseExpr()
+			if err != nil {
+				return nil, ``, nil, err
+			}
+			if err := tp.end(); err != nil {
+				return nil, ``, nil, err
+			}
+			nodes = append(nodes, &outputNode{seg.line, e})
+
+		case segStmt:
+			tp, err := newTagParser(seg)
+			if err != nil {
+				return nil, ``, nil, err
+			}
+			keyword := tp.next().val
+			for _, end := range ends {
+				if keyword == end {
+					return nodes, keyword, tp, nil
+				}
+			}
+			n, err := p.parseStmt(keyword, tp)
+			if err != nil {
+				return nil, ``, nil, err
+			}
+			if n != nil {
+				nodes = append(nodes, n)
+			}
+		}
+	}
+
+	if len(ends) > 0 {
+		return nil, ``, nil, fmt.Errorf(`unexpected end of template, expect '%s'`, strings.Join(ends, `' or '`))
+	}
+
+	return nodes, ``, nil, nil
+}
+
+func (p *parser) parseStmt(keyword string, tp *tagParser) (node, error) {
+
+	switch keyword {
+	case `if`:
+		n := &ifNode{}
+		for {
+			cond, err := tp.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			if err := tp.end(); err != nil {
+				return nil, err
+			}
+			body, end, next, err := p.parseBody(`elif`, `else`, `endif`)
+			if err != nil {
+				return nil, err
+			}
+			n.conds = append(n.conds, cond)
+			n.bodies = append(n.bodies, body)
+
+			switch end {
+			case `elif`:
+				tp = next
+				continue
+			case `else`:
+				if err := next.end(); err != nil {
+					return nil, err
+				}
+				n.els, _, next, err = p.parseBody(`endif`)
+				if err != nil {
+					return nil, err
+				}
+			}
+			return n, next.end()
+		}
+
+	case `for`:
+		n := &forNode{line: tp.line}
+		for {
+			name, err := tp.expectName()
+			if err != nil {
+				return nil, err
+			}
+			n.vars = append(n.vars, name)
+			if !tp.skipOp(`,`) {
+				break
+			}
+		}
+		if !tp.skipName(`in`) {
+			return nil, tp.errorf(`expect 'in'`)
+		}
+		iter, err := tp.parseCondFree()
+		if err != nil {
+			return nil, err
+		}
+		n.iter = iter
+		if tp.skipName(`if`) {
+			if n.cond, err = tp.parseCondFree(); err != nil {
+				return nil, err
+			}
+		}
+		if err := tp.end(); err != nil {
+			return nil, err
+		}
+		body, end, next, err := p.parseBody(`else`, `endfor`)
+		if err != nil {
+			return nil, err
+		}
+		n.body = body
+		if end == `else` {
+			if err := next.end(); err != nil {
+				return nil, err
+			}
+			if n.els, _, next, err = p.parseBody(`endfor`); err != nil {
+				return nil, err
+			}
+		}
+		return n, next.end()
+
+	case `set`:
+		n := &setNode{line: tp.line}
+		name, err := tp.expectName()
+		if err != nil {
+			return nil, err
+		}
+		n.name = name
+		if tp.skipOp(`.`) {
+			if n.attr, err = tp.expectName(); err != nil {
+				return nil, err
+			}
+		}
+		if !tp.skipOp(`=`) {
+			// block set
+			if err := tp.end(); err != nil {
+				return nil, err
+			}
+			body, _, next, err := p.parseBody(`endset`)
+			if err != nil {
+				return nil, err
+			}
+			n.body = body
+			return n, next.end()
+		}
+		if n.value, err = tp.parseExpr(); err != nil {
+			return nil, err
+		}
+		return n, tp.end()
+
+	case `macro`:
+		n := &macroNode{defaults: map[string]expr{}}
+		name, err := tp.expectName()
+		if err != nil {
+			return nil, err
+		}
+		n.name = name
+		if !tp.skipOp(`(`) {
+			return nil, tp.errorf(`expect '('`)
+		}
+		for !tp.skipOp(`)`) {
+			param, err := tp.expectName()
+			if err != nil {
+				return nil, err
+			}
+			n.params = append(n.params, param)
+			if tp.skipOp(`=`) {
+				if n.defaults[param], err = tp.parseExpr(); err != nil {
+					return nil, err
+				}
+			}
+			if !tp.skipOp(`,`) && tp.peek().val != `)` {
+				return nil, tp.errorf(`expect ',' or ')'`)
+			}
+		}
+		if err := tp.end(); err != nil {
+			return nil, err
+		}
+		body, _, next, err := p.parseBody(`endmacro`)
+		if err != nil {
+			return nil, err
+		}
+		n.body = body
+		return n, next.end()
+
+	case `break`:
+		return &breakNode{}, tp.end()
+
+	case `continue`:
+		return &continueNode{}, tp.end()
+
+	case `generation`, `endgeneration`:
+		// the assistant mask of Hugging Face, no effect on the prompt.
+		return nil, tp.end()
+
+	default:
+		return nil, tp.errorf(`unsupported statement '%s'`, keyword)
+	}
+}
+
+// tagParser parse the expression tokens of a tag.
+type tagParser struct {
+	tokens []token
+	pos    int
+	line   int
+}
+
+func newTagParser(seg segment) (*tagParser, error) {
+	tokens, err := tokenize(seg.src)
+	if err != nil {
+		return nil, fmt.Errorf(`line %d: %v`, seg.line, err)
+	}
+	return &tagParser{tokens: tokens, line: seg.line}, nil
+}
+
+func (tp *tagParser) errorf(format string, args ...any) error {
+	return fmt.Errorf(`line %d: %s`, tp.line, fmt.Sprintf(format, args...))
+}
+
+func (tp *tagParser) peek() token {
+	return tp.tokens[tp.pos]
+}
+
+func (tp *tagParser) next() token {
+	t := tp.tokens[tp.pos]
+	if t.kind != tokEOF {
+		tp.pos++
+	}
+	return t
+}
+
+func (tp *tagParser) skipOp(op string) bool {
+	if t := tp.peek(); t.kind == tokOp && t.val == op {
+		tp.pos++
+		return true
+	}
+	return false
+}
+
+func (tp *tagParser) skipName(name string) bool {
+	if t := tp.peek(); t.kind == tokName && t.val == name {
+		tp.pos++
+		return true
+	}
+	return false
+}
+
+// isName report whether the tokens from pos are the names.
+func (tp *tagParser) isName(names ...string) bool {
+	for i, name := range names {
+		if tp.pos+i >= len(tp.tokens) {
+			return false
+		}
+		if t := tp.tokens[tp.pos+i]; t.kind != tokName || t.val != name {
+			return false
+		}
+	}
+	return true
+}
+
+func (tp *tagParser) expectName() (string, error) {
+	t := tp.next()
+	if t.kind != tokName {
+		return ``, tp.errorf(`expect name, got '%s'`, t.val)
+	}
+	return t.val, nil
+}
+
+func (tp *tagParser) expectOp(op string) error {
+	if !tp.skipOp(op) {
+		return tp.errorf(`expect '%s', got '%s'`, op, tp.peek().val)
+	}
+	return nil
+}
+
+// end check all tokens are consumed.
+func (tp *tagParser) end() error {
+	if t := tp.peek(); t.kind != tokEOF {
+		return tp.errorf(`unexpected '%s'`, t.val)
+	}
+	return nil
+}
+
+// parseExpr parse the conditional expression: a if cond else b
+func (tp *tagParser) parseExpr() (expr, error) {
+
+	e, err := tp.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	for tp.skipName(`if`) {
+		cond, err := tp.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		var b expr = &literal{undefined{}}
+		if tp.skipName(`else`) {
+			if b, err = tp.parseOr(); err != nil {
+				return nil, err
+			}
+		}
+		e = &condExpr{cond, e, b}
+	}
+
+	return e, nil
+}
+
+// parseCondFree parse expression without the conditional, used by for, where `if` filters items.
+func (tp *tagParser) parseCondFree() (expr, error) {
+	return tp.parseOr()
+}
+
+func (tp *tagParser) parseOr() (expr, error) {
+	l, err := tp.parseAnd()
+	for err == nil && tp.skipName(`or`) {
+		var r expr
+		if r, err = tp.parseAnd(); err == nil {
+			l = &binaryExpr{`or`, l, r}
+		}
+	}
+	return l, err
+}
+
+func (tp *tagParser) parseAnd() (expr, error) {
+	l, err := tp.parseNot()
+	for err == nil && tp.skipName(`and`) {
+		var r expr
+		if r, err = tp.parseNot(); err == nil {
+			l = &binaryExpr{`and`, l, r}
+		}
+	}
+	return l, err
+}
+
+func (tp *tagParser) parseNot() (expr, error) {
+	if tp.skipName(`not`) {
+		x, err := tp.parseNot()
+		return &unaryExpr{`not`, x}, err
+	}
+	return tp.parseCompare()
+}
+
+func (tp *tagParser) parseCompare() (expr, error) {
+
+	l, err := tp.parseMath1()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		op := ``
+		t := tp.peek()
+		switch {
+		case t.kind == tokOp && (t.val == `==` || t.val == `!=` || t.val == `<` || t.val == `>` || t.val == `<=` || t.val == `>=`):
+			op = t.val
+			tp.pos++
+		case tp.isName(`in`):
+			op = `in`
+			tp.pos++
+		case tp.isName(`not`, `in`):
+			op = `not in`
+			tp.pos += 2
+		default:
+			return l, nil
+		}
+
+		r, err := tp.parseMath1()
+		if err != nil {
+			return nil, err
+		}
+		l = &binaryExpr{op, l, r}
+	}
+}
+
+func (tp *tagParser) parseBinary(ops []string, next func() (expr, error)) (expr, error) {
+
+	l, err := next()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		t := tp.peek()
+		matched := false
+		for _, op := range ops {
+			if t.kind == tokOp && t.val == op {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return l, nil
+		}
+		tp.pos++
+		r, err := next()
+		if err != nil {
+			return nil, err
+		}
+		l = &binaryExpr{t.val, l, r}
+	}
+}
+
+func (tp *tagParser) parseMath1() (expr, error) {
+	return tp.parseBinary([]string{`+`, `-`}, tp.parseConcat)
+}
+
+func (tp *tagParser) parseConcat() (expr, error) {
+	return tp.parseBinary([]string{`~`}, tp.parseMath2)
+}
+
+func (tp *tagParser) parseMath2() (expr, error) {
+	return tp.parseBinary([]string{`*`, `/`, `//`, `%`}, tp.parsePow)
+}
+
+func (tp *tagParser) parsePow() (expr, error) {
+	return tp.parseBinary([]string{`**`}, tp.parseUnary)
+}
+
+func (tp *tagParser) parseUnary() (expr, error) {
+
+	if tp.skipOp(`-`) {
+		x, err := tp.parseUnary()
+		return &unaryExpr{`-`, x}, err
+	}
+	if tp.skipOp(`+`) {
+		return tp.parseUnary()
+	}
+
+	e, err := tp.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	if e, err = tp.parsePostfix(e); err != nil {
+		return nil, err
+	}
+	return tp.parseFilters(e)
+}
+
+func (tp *tagParser) parsePrimary() (expr, error) {
+
+	t := tp.next()
+
+	switch t.kind {
+	case tokString:
+		s := t.val
+		// adjacent strings are concatenated
+		for tp.peek().kind == tokString {
+			s += tp.next().val
+		}
+		return &literal{s}, nil
+
+	case tokInt:
+		v, err := strconv.Atoi(t.val)
+		if err != nil {
+			return nil, tp.errorf(`%v`, err)
+		}
+		return &literal{v}, nil
+
+	case tokFloat:
+		v, err := strconv.ParseFloat(t.val, 64)
+		if err != nil {
+			return nil, tp.errorf(`%v`, err)
+		}
+		return &literal{v}, nil
+
+	case tokName:
+		switch t.val {
+		case `true`, `True`:
+			return &literal{true}, nil
+		case `false`, `False`:
+			return &literal{false}, nil
+		case `none`, `None`:
+			return &literal{nil}, nil
+		}
+		return &nameExpr{t.val}, nil
+
+	case tokOp:
+		switch t.val {
+		case `(`:
+			e, err := tp.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			if tp.skipOp(`,`) {
+				// tuple, treated as list
+				items := []expr{e}
+				for !tp.skipOp(`)`) {
+					item, err := tp.parseExpr()
+					if err != nil {
+						return nil, err
+					}
+					items = append(items, item)
+					if !tp.skipOp(`,`) && tp.peek().val != `)` {
+						return nil, tp.errorf(`expect ',' or ')'`)
+					}
+				}
+				return &listExpr{items}, nil
+			}
+			return e, tp.expectOp(`)`)
+
+		case `[`:
+			items := []expr{}
+			for !tp.skipOp(`]`) {
+				item, err := tp.parseExpr()
+				if err != nil {
+					return nil, err
+				}
+				items = append(items, item)
+				if !tp.skipOp(`,`) && tp.peek().val != `]` {
+					return nil, tp.errorf(`expect ',' or ']'`)
+				}
+			}
+			return &listExpr{items}, nil
+
+		case `{`:
+			d := &dictExpr{}
+			for !tp.skipOp(`}`) {
+				k, err := tp.parseExpr()
+				if err != nil {
+					return nil, err
+				}
+				if err := tp.expectOp(`:`); err != nil {
+					return nil, err
+				}
+				v, err := tp.parseExpr()
+				if err != nil {
+					return nil, err
+				}
+				d.keys, d.values = append(d.keys, k), append(d.values, v)
+				if !tp.skipOp(`,`) && tp.peek().val != `}` {
+					return nil, tp.errorf(`expect ',' or '}'`)
+				}
+			}
+			return d, nil
+		}
+	}
+
+	if t.kind == tokEOF {
+		return nil, tp.errorf(`unexpected end of expression`)
+	}
+	return nil, tp.errorf(`unexpected '%s'`, t.val)
+}
+
+func (tp *tagParser) parsePostfix(e expr) (expr, error) {
+
+	for {
+		switch {
+		case tp.skipOp(`.`):
+			t := tp.next()
+			if t.kind != tokName && t.kind != tokInt {
+				return nil, tp.errorf(`expect attribute name, got '%s'`, t.val)
+			}
+			e = &attrExpr{e, t.val}
+
+		case tp.skipOp(`[`):
+			var err error
+			if e, err = tp.parseSubscript(e); err != nil {
+				return nil, err
+			}
+
+		case tp.skipOp(`(`):
+			args, kwargs, err := tp.parseArgs()
+			if err != nil {
+				return nil, err
+			}
+			e = &callExpr{e, args, kwargs}
+
+		default:
+			return e, nil
+		}
+	}
+}
+
+// parseSubscript parse the index or slice after '['.
+func (tp *tagParser) parseSubscript(obj expr) (expr, error) {
+
+	parts := []expr{nil}
+	colons := 0
+
+	for !tp.skipOp(`]`) {
+		if tp.skipOp(`:`) {
+			colons++
+			if colons > 2 {
+				return nil, tp.errorf(`invalid slice`)
+			}
+			parts = append(parts, nil)
+			continue
+		}
+		e, err := tp.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		parts[len(parts)-1] = e
+	}
+
+	if colons == 0 {
+		if parts[0] == nil {
+			return nil, tp.errorf(`empty subscript`)
+		}
+		return &indexExpr{obj, parts[0]}, nil
+	}
+
+	for len(parts) < 3 {
+		parts = append(parts, nil)
+	}
+	return &sliceExpr{obj, parts[0], parts[1], parts[2]}, nil
+}
+
+// parseArgs parse the call arguments after '('.
+func (tp *tagParser) parseArgs() ([]expr, map[string]expr, error) {
+
+	args := []expr{}
+	kwargs := map[string]expr{}
+
+	for !tp.skipOp(`)`) {
+
+		if t := tp.peek(); t.kind == tokName && tp.pos+1 < len(tp.tokens) && tp.tokens[tp.pos+1].val == `=` && tp.tokens[tp.pos+1].kind == tokOp {
+			tp.pos += 2
+			v, err := tp.parseExpr()
+			if err != nil {
+				return nil, nil, err
+			}
+			kwargs[t.val] = v
+		} else {
+			v, err := tp.parseExpr()
+			if err != nil {
+				return nil, nil, err
+			}
+			args = append(args, v)
+		}
+
+		if !tp.skipOp(`,`) && tp.peek().val != `)` {
+			return nil, nil, tp.errorf(`expect ',' or ')'`)
+		}
+	}
+
+	return args, kwargs, nil
+}
+
+// parseFilters parse the filters `x | f(args)` and tests `x is [not] t(args)`.
+func (tp *tagParser) parseFilters(e expr) (expr, error) {
+
+	for {
+		switch {
+		case tp.skipOp(`|`):
+			name, err := tp.expectName()
+			if err != nil {
+				return nil, err
+			}
+			f := &filterExpr{obj: e, name: name}
+			if tp.skipOp(`(`) {
+				if f.args, f.kwargs, err = tp.parseArgs(); err != nil {
+					return nil, err
+				}
+			}
+			e = f
+
+		case tp.skipName(`is`):
+			t := &testExpr{obj: e, not: tp.skipName(`not`)}
+			name, err := tp.expectName()
+			if err != nil {
+				return nil, err
+			}
+			t.name = name
+			if tp.skipOp(`(`) {
+				if t.args, _, err = tp.parseArgs(); err != nil {
+					return nil, err
+				}
+			} else if p := tp.peek(); p.kind == tokString || p.kind == tokInt || p.kind == tokFloat {
+				// test with one argument without parentheses, example: x is divisibleby 3
+				arg, err := tp.parsePrimary()
+				if err != nil {
+					return nil, err
+				}
+				t.args = []expr{arg}
+			}
+			e = t
+
+		default:
+			return e, nil
+		}
+	}
+}
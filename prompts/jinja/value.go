@@ -0,0 +1,530 @@
+package jinja
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// undefined the value of missing variables and attributes, rendered as empty string.
+type undefined struct{}
+
+// namespace the mutable object of namespace(), attributes can be set in loops.
+type namespace struct {
+	attrs map[string]any
+}
+
+// Func a callable value, example: the globals and macros.
+type Func func(args []any, kwargs map[string]any) (any, error)
+
+func isUndefined(v any) bool {
+	_, ok := v.(undefined)
+	return ok
+}
+
+// normalize convert Go values to the value types of interpreter: nil, bool, int, float64, string,
+// []any, map[string]any, Func.
+func normalize(v any) any {
+
+	switch x := v.(type) {
+	case nil, undefined, bool, int, float64, string, []any, map[string]any, Func, *namespace:
+		return v
+	case func(args []any, kwargs map[string]any) (any, error):
+		return Func(x)
+	case int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return int(reflect.ValueOf(v).Convert(reflect.TypeOf(0)).Int())
+	case float32:
+		return float64(x)
+	case []string:
+		ret := make([]any, len(x))
+		for i, s := range x {
+			ret[i] = s
+		}
+		return ret
+	case map[string]string:
+		ret := make(map[string]any, len(x))
+		for k, s := range x {
+			ret[k] = s
+		}
+		return ret
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Pointer:
+		if rv.IsNil() {
+			return nil
+		}
+		return normalize(rv.Elem().Interface())
+	case reflect.Slice, reflect.Array:
+		ret := make([]any, rv.Len())
+		for i := range ret {
+			ret[i] = rv.Index(i).Interface()
+		}
+		return ret
+	case reflect.Map:
+		ret := make(map[string]any, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			ret[fmt.Sprint(iter.Key().Interface())] = iter.Value().Interface()
+		}
+		return ret
+	case reflect.Struct:
+		return structToMap(rv)
+	case reflect.String:
+		return rv.String()
+	case reflect.Bool:
+		return rv.Bool()
+	}
+
+	return v
+}
+
+// structToMap convert struct to map keyed by the json tag names or field names.
+func structToMap(rv reflect.Value) map[string]any {
+
+	ret := map[string]any{}
+	rt := rv.Type()
+
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name := f.Name
+		if tag, _, _ := strings.Cut(f.Tag.Get(`json`), `,`); tag == `-` {
+			continue
+		} else if tag != `` {
+			name = tag
+		}
+		ret[name] = rv.Field(i).Interface()
+	}
+
+	return ret
+}
+
+func truthy(v any) bool {
+
+	switch x := normalize(v).(type) {
+	case nil, undefined:
+		return false
+	case bool:
+		return x
+	case int:
+		return x != 0
+	case float64:
+		return x != 0
+	case string:
+		return x != ``
+	case []any:
+		return len(x) > 0
+	case map[string]any:
+		return len(x) > 0
+	}
+	return true
+}
+
+// toString render value like Python str().
+func toString(v any) string {
+
+	switch x := normalize(v).(type) {
+	case undefined:
+		return ``
+	case string:
+		return x
+	}
+	return repr(v)
+}
+
+// repr return Python repr of value.
+func repr(v any) string {
+
+	switch x := normalize(v).(type) {
+	case nil:
+		return `None`
+	case undefined:
+		return ``
+	case bool:
+		if x {
+			return `True`
+		}
+		return `False`
+	case int:
+		return strconv.Itoa(x)
+	case float64:
+		if math.IsInf(x, 0) || math.IsNaN(x) {
+			return strings.ToLower(strconv.FormatFloat(x, 'g', -1, 64))
+		}
+		s := strconv.FormatFloat(x, 'g', -1, 64)
+		if !strings.ContainsAny(s, `.e`) {
+			s += `.0`
+		}
+		return s
+	case string:
+		return `'` + strings.NewReplacer(`\`, `\\`, `'`, `\'`, "\n", `\n`).Replace(x) + `'`
+	case []any:
+		items := make([]string, len(x))
+		for i, item := range x {
+			items[i] = repr(item)
+		}
+		return `[` + strings.Join(items, `, `) + `]`
+	case map[string]any:
+		items := make([]string, 0, len(x))
+		for _, k := range sortedKeys(x) {
+			items = append(items, repr(k)+`: `+repr(x[k]))
+		}
+		return `{` + strings.Join(items, `, `) + `}`
+	case *namespace:
+		return `<Namespace ` + repr(x.attrs) + `>`
+	case Func:
+		return `<function>`
+	}
+	return fmt.Sprint(v)
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// toNumber return the int or float64 of v.
+func toNumber(v any) (any, bool) {
+	switch x := normalize(v).(type) {
+	case int, float64:
+		return x, true
+	case bool:
+		if x {
+			return 1, true
+		}
+		return 0, true
+	}
+	return nil, false
+}
+
+func toFloat(v any) float64 {
+	switch x := v.(type) {
+	case int:
+		return float64(x)
+	case float64:
+		return x
+	}
+	return 0
+}
+
+func toInt(v any) (int, bool) {
+	n, ok := toNumber(v)
+	if !ok {
+		return 0, false
+	}
+	if f, ok := n.(float64); ok {
+		return int(f), true
+	}
+	return n.(int), true
+}
+
+func equal(a, b any) bool {
+
+	a, b = normalize(a), normalize(b)
+
+	if x, ok := toNumber(a); ok {
+		if _, isBool := a.(bool); !isBool {
+			if y, ok := toNumber(b); ok {
+				if _, isBool := b.(bool); !isBool {
+					return toFloat(x) == toFloat(y)
+				}
+			}
+		}
+	}
+
+	switch x := a.(type) {
+	case []any:
+		y, ok := b.([]any)
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !equal(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]any:
+		y, ok := b.(map[string]any)
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for k, v := range x {
+			if w, ok := y[k]; !ok || !equal(v, w) {
+				return false
+			}
+		}
+		return true
+	case Func, *namespace:
+		return false
+	}
+
+	return a == b
+}
+
+// compare return -1, 0, 1 of a and b, numbers and strings are comparable.
+func compare(a, b any) (int, error) {
+
+	a, b = normalize(a), normalize(b)
+
+	if x, ok := toNumber(a); ok {
+		if y, ok := toNumber(b); ok {
+			fx, fy := toFloat(x), toFloat(y)
+			switch {
+			case fx < fy:
+				return -1, nil
+			case fx > fy:
+				return 1, nil
+			}
+			return 0, nil
+		}
+	}
+
+	if x, ok := a.(string); ok {
+		if y, ok := b.(string); ok {
+			return strings.Compare(x, y), nil
+		}
+	}
+
+	return 0, fmt.Errorf(`'<' not supported between %s and %s`, typeName(a), typeName(b))
+}
+
+func typeName(v any) string {
+	switch normalize(v).(type) {
+	case nil:
+		return `none`
+	case undefined:
+		return `undefined`
+	case bool:
+		return `bool`
+	case int:
+		return `int`
+	case float64:
+		return `float`
+	case string:
+		return `str`
+	case []any:
+		return `list`
+	case map[string]any:
+		return `dict`
+	case *namespace:
+		return `namespace`
+	case Func:
+		return `function`
+	}
+	return fmt.Sprintf(`%T`, v)
+}
+
+// length of string (in runes), list and dict.
+func length(v any) (int, error) {
+	switch x := normalize(v).(type) {
+	case string:
+		return utf8.RuneCountInString(x), nil
+	case []any:
+		return len(x), nil
+	case map[string]any:
+		return len(x), nil
+	case undefined:
+		return 0, nil
+	}
+	return 0, fmt.Errorf(`object of type %s has no length`, typeName(v))
+}
+
+// iterate return the items of list, the runes of string, or the sorted keys of dict.
+func iterate(v any) ([]any, error) {
+	switch x := normalize(v).(type) {
+	case []any:
+		return x, nil
+	case string:
+		ret := []any{}
+		for _, r := range x {
+			ret = append(ret, string(r))
+		}
+		return ret, nil
+	case map[string]any:
+		ret := []any{}
+		for _, k := range sortedKeys(x) {
+			ret = append(ret, k)
+		}
+		return ret, nil
+	case nil, undefined:
+		return nil, nil
+	}
+	return nil, fmt.Errorf(`%s is not iterable`, typeName(v))
+}
+
+func contains(container, item any) (bool, error) {
+
+	switch x := normalize(container).(type) {
+	case string:
+		s, ok := normalize(item).(string)
+		if !ok {
+			return false, fmt.Errorf(`'in <string>' requires string as left operand, not %s`, typeName(item))
+		}
+		return strings.Contains(x, s), nil
+	case []any:
+		for _, v := range x {
+			if equal(v, item) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case map[string]any:
+		k, ok := normalize(item).(string)
+		if !ok {
+			return false, nil
+		}
+		_, ok = x[k]
+		return ok, nil
+	case undefined:
+		return false, nil
+	}
+
+	return false, fmt.Errorf(`argument of type %s is not iterable`, typeName(container))
+}
+
+// getAttr return attribute or item of obj, undefined if missing.
+func getAttr(obj any, name string) any {
+
+	switch x := normalize(obj).(type) {
+	case map[string]any:
+		if v, ok := x[name]; ok {
+			return normalize(v)
+		}
+	case *namespace:
+		if v, ok := x.attrs[name]; ok {
+			return v
+		}
+	case []any:
+		if i, err := strconv.Atoi(name); err == nil {
+			return getItem(x, i)
+		}
+	}
+
+	if m := method(obj, name); m != nil {
+		return m
+	}
+
+	return undefined{}
+}
+
+// getItem return obj[key], undefined if missing.
+func getItem(obj, key any) any {
+
+	switch x := normalize(obj).(type) {
+	case []any:
+		i, ok := toInt(key)
+		if !ok {
+			return undefined{}
+		}
+		if i < 0 {
+			i += len(x)
+		}
+		if i < 0 || i >= len(x) {
+			return undefined{}
+		}
+		return normalize(x[i])
+	case string:
+		i, ok := toInt(key)
+		if !ok {
+			return undefined{}
+		}
+		runes := []rune(x)
+		if i < 0 {
+			i += len(runes)
+		}
+		if i < 0 || i >= len(runes) {
+			return undefined{}
+		}
+		return string(runes[i])
+	case map[string]any, *namespace:
+		if k, ok := normalize(key).(string); ok {
+			return getAttr(x, k)
+		}
+	}
+
+	return undefined{}
+}
+
+// slice return obj[lo:hi:step] of list or string like Python.
+func slice(obj any, lo, hi, step any) (any, error) {
+
+	var items []any
+	s, isString := normalize(obj).(string)
+	if isString {
+		for _, r := range s {
+			items = append(items, string(r))
+		}
+	} else {
+		x, ok := normalize(obj).([]any)
+		if !ok {
+			return nil, fmt.Errorf(`%s is not sliceable`, typeName(obj))
+		}
+		items = x
+	}
+
+	n := len(items)
+	st := 1
+	if step != nil {
+		st, _ = toInt(step)
+		if st == 0 {
+			return nil, fmt.Errorf(`slice step cannot be zero`)
+		}
+	}
+
+	bound := func(v any, def int) int {
+		if v == nil {
+			return def
+		}
+		i, _ := toInt(v)
+		if i < 0 {
+			i += n
+		}
+		if st > 0 {
+			return clamp(i, 0, n)
+		}
+		return clamp(i, -1, n-1)
+	}
+
+	ret := []any{}
+	if st > 0 {
+		for i := bound(lo, 0); i < bound(hi, n); i += st {
+			ret = append(ret, items[i])
+		}
+	} else {
+		for i := bound(lo, n-1); i > bound(hi, -1); i += st {
+			ret = append(ret, items[i])
+		}
+	}
+
+	if isString {
+		sb := strings.Builder{}
+		for _, r := range ret {
+			sb.WriteString(r.(string))
+		}
+		return sb.String(), nil
+	}
+	return ret, nil
+}
+
+func clamp(i, lo, hi int) int {
+	if i < lo {
+		return lo
+	}
+	if i > hi {
+		return hi
+	}
+	return i
+}
@@ -0,0 +1,473 @@
+package prompts
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/nexptr/llmchain/schema"
+)
+
+// TemplateConfig the templates of model, the values are references of Library, example: llama/chat
+type TemplateConfig struct {
+	Completion string `json:"completion" yaml:"completion"`
+	Chat       string `json:"chat" yaml:"chat"`
+	Edit       string `json:"edit" yaml:"edit"`
+}
+
+// PromptData the data of templates bound by TemplateConfig.
+type PromptData struct {
+	// Model name of the request.
+	Model string
+	// Input the prompt of completion, or the contents of chat messages joined by new line.
+	Input string
+	// Messages of chat request.
+	Messages []schema.Message
+	// Instruction of edit request.
+	Instruction string
+}
+
+// ChatPromptData return data of chat template, Input is the joined contents of messages.
+func ChatPromptData(model string, messages []schema.Message) PromptData {
+
+	contents := make([]string, len(messages))
+	for i, m := range messages {
+		contents[i] = m.Content
+	}
+
+	return PromptData{Model: model, Input: strings.Join(contents, "\n"), Messages: messages}
+}
+
+// TemplateVersion a loaded version of template file.
+type TemplateVersion struct {
+	Version int
+	Source  string
+	ModTime time.Time
+}
+
+// Library versioned prompt templates of text/template loaded from fs.FS, example: embed.FS or
+// os.DirFS(dir). Files of Ext are referenced by namespace (the directory) and name without Ext:
+//
+//	qa/stuff.tmpl   -> qa/stuff
+//	summary.tmpl    -> summary
+//
+// A reference may pin the version: qa/stuff@2. The files of the same namespace can include each other
+// by file name: {{template "header.tmpl" .}}
+//
+// Reload keeps the last good version of a file that fails to parse, so a bad edit never breaks the
+// running server.
+type Library struct {
+	fsys fs.FS
+
+	ext         string
+	funcMap     template.FuncMap
+	maxVersions int
+	onReload    func(error)
+
+	// reload serialize Reload
+	reload sync.Mutex
+	// fingerprint of files of last Reload, used by Watch
+	fingerprint string
+
+	mu        sync.RWMutex
+	templates map[string][]TemplateVersion
+	// sets the latest versions parsed together, keyed by namespace
+	sets     map[string]*template.Template
+	bindings []binding
+}
+
+type binding struct {
+	pattern string
+	config  TemplateConfig
+}
+
+// LibraryOption configures Library.
+type LibraryOption func(*Library)
+
+// WithExt set extension of template files, default .tmpl
+func WithExt(ext string) LibraryOption {
+	return func(l *Library) {
+		l.ext = ext
+	}
+}
+
+// WithFuncs add functions to templates.
+func WithFuncs(funcMap template.FuncMap) LibraryOption {
+	return func(l *Library) {
+		for k, v := range funcMap {
+			l.funcMap[k] = v
+		}
+	}
+}
+
+// WithMaxVersions set versions kept of every template, default 10.
+func WithMaxVersions(n int) LibraryOption {
+	return func(l *Library) {
+		l.maxVersions = n
+	}
+}
+
+// WithReloadHandler set handler of Reload done by Watch, err is nil if all files reloaded.
+func WithReloadHandler(fn func(err error)) LibraryOption {
+	return func(l *Library) {
+		l.onReload = fn
+	}
+}
+
+// NewLibrary load templates of fsys, the parse errors of files are returned with the library of
+// other files.
+func NewLibrary(fsys fs.FS, opts ...LibraryOption) (*Library, error) {
+
+	l := &Library{
+		fsys:        fsys,
+		ext:         `.tmpl`,
+		funcMap:     template.FuncMap{},
+		maxVersions: 10,
+		templates:   map[string][]TemplateVersion{},
+		sets:        map[string]*template.Template{},
+	}
+
+	for _, fn := range opts {
+		fn(l)
+	}
+
+	return l, l.Reload()
+}
+
+// LoadLibrary load templates of directory dir, the library can be watched by Watch.
+func LoadLibrary(dir string, opts ...LibraryOption) (*Library, error) {
+
+	if _, err := os.Stat(dir); err != nil {
+		return nil, err
+	}
+	return NewLibrary(os.DirFS(dir), opts...)
+}
+
+type libraryFile struct {
+	path    string
+	source  string
+	modTime time.Time
+}
+
+// scan return the template files of fsys sorted by path.
+func (l *Library) scan() ([]libraryFile, string, error) {
+
+	files := []libraryFile{}
+	fingerprint := strings.Builder{}
+
+	err := fs.WalkDir(l.fsys, `.`, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(p, l.ext) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&fingerprint, "%s:%d:%d\n", p, info.Size(), info.ModTime().UnixNano())
+
+		data, err := fs.ReadFile(l.fsys, p)
+		if err != nil {
+			return err
+		}
+
+		files = append(files, libraryFile{path: p, source: string(data), modTime: info.ModTime()})
+		return nil
+	})
+
+	return files, fingerprint.String(), err
+}
+
+// Reload load the changed files as new versions, the removed files are dropped. A file failed to
+// parse keeps the last good version, all parse errors are returned.
+func (l *Library) Reload() error {
+
+	l.reload.Lock()
+	defer l.reload.Unlock()
+
+	files, fingerprint, err := l.scan()
+	if err != nil {
+		return err
+	}
+
+	l.mu.RLock()
+	current := l.templates
+	l.mu.RUnlock()
+
+	templates := make(map[string][]TemplateVersion, len(files))
+	errs := []error{}
+
+	for _, f := range files {
+
+		ref := strings.TrimSuffix(f.path, l.ext)
+		versions := current[ref]
+
+		if n := len(versions); n > 0 && versions[n-1].Source == f.source {
+			templates[ref] = versions
+			continue
+		}
+
+		if _, err := template.New(path.Base(f.path)).Funcs(l.funcMap).Parse(f.source); err != nil {
+			errs = append(errs, fmt.Errorf(`%s: %v`, f.path, err))
+			if len(versions) > 0 {
+				templates[ref] = versions
+			}
+			continue
+		}
+
+		next := 1
+		if n := len(versions); n > 0 {
+			next = versions[n-1].Version + 1
+		}
+
+		// copy, the versions may be read by Versions
+		versions = append(append([]TemplateVersion{}, versions...), TemplateVersion{Version: next, Source: f.source, ModTime: f.modTime})
+		if l.maxVersions > 0 && len(versions) > l.maxVersions {
+			versions = versions[len(versions)-l.maxVersions:]
+		}
+		templates[ref] = versions
+	}
+
+	sets, err := l.parseSets(templates)
+	if err != nil {
+		// keep all the last versions, the files conflict with each other. The fingerprint is kept,
+		// so Watch retries.
+		return errors.Join(append(errs, err)...)
+	}
+
+	l.mu.Lock()
+	l.templates = templates
+	l.sets = sets
+	l.mu.Unlock()
+
+	l.fingerprint = fingerprint
+
+	return errors.Join(errs...)
+}
+
+// parseSets parse the latest versions of every namespace together, so they can include each other.
+func (l *Library) parseSets(templates map[string][]TemplateVersion) (map[string]*template.Template, error) {
+
+	refs := make([]string, 0, len(templates))
+	for ref := range templates {
+		refs = append(refs, ref)
+	}
+	sort.Strings(refs)
+
+	sets := map[string]*template.Template{}
+
+	for _, ref := range refs {
+
+		ns := namespaceOf(ref)
+		set, ok := sets[ns]
+		if !ok {
+			set = template.New(``).Funcs(l.funcMap)
+			sets[ns] = set
+		}
+
+		versions := templates[ref]
+		if _, err := set.New(path.Base(ref) + l.ext).Parse(versions[len(versions)-1].Source); err != nil {
+			return nil, fmt.Errorf(`%s%s: %v`, ref, l.ext, err)
+		}
+	}
+
+	return sets, nil
+}
+
+func namespaceOf(ref string) string {
+	if ns := path.Dir(ref); ns != `.` {
+		return ns
+	}
+	return ``
+}
+
+// Watch poll the files every interval, the library is reloaded once files changed until ctx done.
+// Errors of Reload are passed to the handler set by WithReloadHandler.
+//
+//	go lib.Watch(ctx, 5*time.Second)
+func (l *Library) Watch(ctx context.Context, interval time.Duration) error {
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		if !l.changed() {
+			continue
+		}
+
+		err := l.Reload()
+		if l.onReload != nil {
+			l.onReload(err)
+		}
+	}
+}
+
+// changed report whether files changed since last Reload by size and modification time.
+func (l *Library) changed() bool {
+
+	_, fingerprint, err := l.scan()
+	if err != nil {
+		return true
+	}
+
+	l.reload.Lock()
+	defer l.reload.Unlock()
+	return fingerprint != l.fingerprint
+}
+
+// Names return the sorted references of all templates.
+func (l *Library) Names() []string {
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	ret := make([]string, 0, len(l.templates))
+	for ref := range l.templates {
+		ret = append(ret, ref)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// Has report whether template of ref exists.
+func (l *Library) Has(ref string) bool {
+	_, _, err := l.lookup(ref)
+	return err == nil
+}
+
+// Versions return the kept versions of template name, the oldest first.
+func (l *Library) Versions(name string) []TemplateVersion {
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return append([]TemplateVersion{}, l.templates[strings.TrimSuffix(name, l.ext)]...)
+}
+
+// lookup return the template set to execute and the name of template in it.
+func (l *Library) lookup(ref string) (*template.Template, string, error) {
+
+	name, version := ref, 0
+	if i := strings.LastIndex(ref, `@`); i >= 0 {
+		v, err := strconv.Atoi(ref[i+1:])
+		if err != nil {
+			return nil, ``, fmt.Errorf(`template '%s': invalid version`, ref)
+		}
+		name, version = ref[:i], v
+	}
+	name = strings.TrimSuffix(name, l.ext)
+
+	l.mu.RLock()
+	versions := l.templates[name]
+	set := l.sets[namespaceOf(name)]
+	l.mu.RUnlock()
+
+	if len(versions) == 0 {
+		return nil, ``, fmt.Errorf(`template '%s' not found`, name)
+	}
+
+	base := path.Base(name) + l.ext
+
+	if version == 0 || version == versions[len(versions)-1].Version {
+		return set, base, nil
+	}
+
+	for _, v := range versions {
+		if v.Version != version {
+			continue
+		}
+		// the old version with the latest ones of namespace.
+		c, err := set.Clone()
+		if err != nil {
+			return nil, ``, err
+		}
+		if _, err := c.New(base).Parse(v.Source); err != nil {
+			return nil, ``, fmt.Errorf(`template '%s': %v`, ref, err)
+		}
+		return c, base, nil
+	}
+
+	return nil, ``, fmt.Errorf(`template '%s': version %d not found`, name, version)
+}
+
+// Execute write template of ref applied to data to wr.
+func (l *Library) Execute(wr io.Writer, ref string, data any) error {
+
+	set, name, err := l.lookup(ref)
+	if err != nil {
+		return err
+	}
+	return set.ExecuteTemplate(wr, name, data)
+}
+
+// Render return template of ref applied to data.
+func (l *Library) Render(ref string, data any) (string, error) {
+
+	var buf bytes.Buffer
+
+	err := l.Execute(&buf, ref, data)
+	return buf.String(), err
+}
+
+// Bind set the templates of model name or models matching pattern (path.Match), the exact name and
+// then the later bound pattern take precedence. The referenced templates must exist.
+func (l *Library) Bind(pattern string, config TemplateConfig) error {
+
+	if _, err := path.Match(pattern, ``); err != nil {
+		return fmt.Errorf(`bind '%s': %v`, pattern, err)
+	}
+
+	for _, ref := range []string{config.Completion, config.Chat, config.Edit} {
+		if ref == `` {
+			continue
+		}
+		if _, _, err := l.lookup(ref); err != nil {
+			return fmt.Errorf(`bind '%s': %v`, pattern, err)
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.bindings = append(l.bindings, binding{pattern, config})
+	return nil
+}
+
+// TemplateConfigOf return the templates bound to model.
+func (l *Library) TemplateConfigOf(model string) (TemplateConfig, bool) {
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	// the exact name first
+	for i := len(l.bindings) - 1; i >= 0; i-- {
+		if l.bindings[i].pattern == model {
+			return l.bindings[i].config, true
+		}
+	}
+	for i := len(l.bindings) - 1; i >= 0; i-- {
+		if ok, _ := path.Match(l.bindings[i].pattern, model); ok {
+			return l.bindings[i].config, true
+		}
+	}
+	return TemplateConfig{}, false
+}
@@ -0,0 +1,195 @@
+package prompts_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/nexptr/llmchain/prompts"
+	"github.com/nexptr/llmchain/schema"
+)
+
+func TestLibrary(t *testing.T) {
+
+	fsys := fstest.MapFS{
+		`summary.tmpl`:       {Data: []byte(`Summarize: {{.Input}}`)},
+		`llama/header.tmpl`:  {Data: []byte(`[INST] `)},
+		`llama/chat.tmpl`:    {Data: []byte(`{{template "header.tmpl"}}{{range .Messages}}{{.Content}} {{end}}[/INST]`)},
+		`llama/readme.md`:    {Data: []byte(`not a template`)},
+		`broken/broken.tmpl`: {Data: []byte(`{{.Input`)},
+	}
+
+	lib, err := prompts.NewLibrary(fsys)
+	if err == nil || !strings.Contains(err.Error(), `broken/broken.tmpl`) {
+		t.Fatalf(`expect parse error of broken template, got %v`, err)
+	}
+
+	if names := strings.Join(lib.Names(), `,`); names != `llama/chat,llama/header,summary` {
+		t.Fatalf(`unexpected names %s`, names)
+	}
+
+	data := prompts.ChatPromptData(`llama-2`, []schema.Message{schema.BuildUserMessage(`hi`)})
+	out, err := lib.Render(`llama/chat`, data)
+	if err != nil || out != `[INST] hi [/INST]` {
+		t.Fatalf(`unexpected render %q: %v`, out, err)
+	}
+
+	// edit the template, a new version is loaded.
+	fsys[`summary.tmpl`] = &fstest.MapFile{Data: []byte(`TL;DR: {{.Input}}`)}
+	if err := lib.Reload(); err == nil {
+		t.Fatal(`expect parse error of broken template`)
+	}
+
+	if out, _ := lib.Render(`summary`, prompts.PromptData{Input: `x`}); out != `TL;DR: x` {
+		t.Fatalf(`unexpected latest version %q`, out)
+	}
+	if out, _ := lib.Render(`summary@1`, prompts.PromptData{Input: `x`}); out != `Summarize: x` {
+		t.Fatalf(`unexpected version 1 %q`, out)
+	}
+
+	// a bad edit keeps the last good version.
+	fsys[`summary.tmpl`] = &fstest.MapFile{Data: []byte(`{{.Input`)}
+	lib.Reload()
+	if versions := lib.Versions(`summary`); len(versions) != 2 || versions[1].Version != 2 {
+		t.Fatalf(`unexpected versions %+v`, versions)
+	}
+	if _, err := lib.Render(`summary@3`, nil); err == nil {
+		t.Fatal(`expect version not found`)
+	}
+}
+
+func TestLibrary_Bind(t *testing.T) {
+
+	lib, err := prompts.NewLibrary(fstest.MapFS{
+		`llama/chat.tmpl`: {Data: []byte(`{{.Input}}`)},
+		`alpaca.tmpl`:     {Data: []byte(`### Instruction: {{.Input}}`)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lib.Bind(`llama-*`, prompts.TemplateConfig{Chat: `llama/chat`}); err != nil {
+		t.Fatal(err)
+	}
+	if err := lib.Bind(`llama-2-alpaca`, prompts.TemplateConfig{Completion: `alpaca`}); err != nil {
+		t.Fatal(err)
+	}
+	if err := lib.Bind(`vicuna`, prompts.TemplateConfig{Chat: `missing`}); err == nil {
+		t.Fatal(`expect template not found`)
+	}
+
+	if cfg, ok := lib.TemplateConfigOf(`llama-2-7b`); !ok || cfg.Chat != `llama/chat` {
+		t.Fatalf(`unexpected config %+v`, cfg)
+	}
+	if cfg, ok := lib.TemplateConfigOf(`llama-2-alpaca`); !ok || cfg.Completion != `alpaca` || cfg.Chat != `` {
+		t.Fatalf(`unexpected config %+v`, cfg)
+	}
+	if _, ok := lib.TemplateConfigOf(`vicuna`); ok {
+		t.Fatal(`unexpected config of vicuna`)
+	}
+}
+
+func TestLibrary_Watch(t *testing.T) {
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, `qa.tmpl`)
+	if err := os.WriteFile(file, []byte(`Q: {{.Input}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded := make(chan error, 1)
+	lib, err := prompts.LoadLibrary(dir, prompts.WithReloadHandler(func(err error) { reloaded <- err }))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go lib.Watch(ctx, 10*time.Millisecond)
+
+	if err := os.WriteFile(file, []byte(`Question: {{.Input}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-reloaded:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal(`library is not reloaded`)
+	}
+
+	if out, _ := lib.Render(`qa`, prompts.PromptData{Input: `why`}); out != `Question: why` {
+		t.Fatalf(`unexpected render %q`, out)
+	}
+}
+
+func TestLibrary_WatchFixed(t *testing.T) {
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, `qa.tmpl`)
+	if err := os.WriteFile(file, []byte(`Q: {{.Input}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded := make(chan error, 10)
+	lib, err := prompts.LoadLibrary(dir, prompts.WithReloadHandler(func(err error) { reloaded <- err }))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go lib.Watch(ctx, 10*time.Millisecond)
+
+	wait := func() error {
+		select {
+		case err := <-reloaded:
+			return err
+		case <-time.After(5 * time.Second):
+			t.Fatal(`library is not reloaded`)
+		}
+		return nil
+	}
+
+	// the broken file keeps the last good version.
+	if err := os.WriteFile(file, []byte(`Question: {{.Input`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := wait(); err == nil {
+		t.Fatal(`expect parse error`)
+	}
+	if out, _ := lib.Render(`qa`, prompts.PromptData{Input: `why`}); out != `Q: why` {
+		t.Fatalf(`unexpected render %q`, out)
+	}
+
+	if err := os.WriteFile(file, []byte(`Question: {{.Input}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := wait(); err != nil {
+		t.Fatal(err)
+	}
+	if out, _ := lib.Render(`qa`, prompts.PromptData{Input: `why`}); out != `Question: why` {
+		t.Fatalf(`unexpected render %q`, out)
+	}
+}
+
+func TestNewRender(t *testing.T) {
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, `hello.tmpl`), []byte(`Hello {{.}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	r := prompts.NewRender(filepath.Join(dir, `*.tmpl`))
+	for _, name := range []string{`hello`, `hello.tmpl`} {
+		if got, err := r.Render(name, `world`); err != nil || got != `Hello world` {
+			t.Fatalf(`unexpected %q, %v`, got, err)
+		}
+	}
+}
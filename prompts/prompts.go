@@ -9,3 +9,25 @@ Question: {{.question}}
 Helpful Answer:`,
 	"context", "question",
 )
+
+// SummaryPrompt summarize the text of context, used to map and combine documents.
+var SummaryPrompt = PromptTemplate(
+	`Write a concise summary of the following:
+
+"{{.context}}"
+
+CONCISE SUMMARY:`,
+	"context",
+)
+
+// RefinePrompt refine the existing_answer with the new context.
+var RefinePrompt = PromptTemplate(
+	`Your job is to produce a final summary.
+We have provided an existing summary up to a certain point: {{.existing_answer}}
+We have the opportunity to refine the existing summary (only if needed) with some more context below.
+------------
+{{.context}}
+------------
+Given the new context, refine the original summary. If the context isn't useful, return the original summary.`,
+	"existing_answer", "context",
+)
@@ -1,56 +1,34 @@
 package prompts
 
 import (
-	"bytes"
-	"io"
-	"strings"
-	"text/template"
+	"path/filepath"
 )
 
-type TemplateConfig struct {
-	Completion string `json:"completion" yaml:"completion"`
-	Chat       string `json:"chat" yaml:"chat"`
-	Edit       string `json:"edit" yaml:"edit"`
-}
-
+// Render renders the templates of a directory.
+//
+// Deprecated: use Library, Render delegates to it.
 type Render struct {
-	tmpl    *template.Template
-	funcMap template.FuncMap
+	*Library
 }
 
-// NewRender 创建初始化渲染类，输入参数为当前模版库路径
+// NewRender load templates matching path, default is prompts/*.tmpl, it panics if the templates
+// fail to load. The templates are loaded recursively from the directory of path.
+//
+// Deprecated: use LoadLibrary.
 func NewRender(path string) *Render {
 
-	p := &Render{funcMap: template.FuncMap{
-		// "CustomPortContent": CustomPortContent,
-	}}
-
 	if path == `` {
-		path = "prompts/*.tmpl"
+		path = `prompts/*.tmpl`
 	}
 
-	p.tmpl = template.Must(template.New("").Funcs(p.funcMap).ParseGlob(path))
-
-	return p
-}
-
-func (p *Render) Execute(wr io.Writer, name string, data any) error {
-
-	// if !strings.HasSuffix(name, `.tmpl`) {
-	// 	name = name + `.tmpl`
-	// }
-
-	return p.tmpl.ExecuteTemplate(wr, name, data)
-}
-
-func (p *Render) Render(name string, data any) (string, error) {
-
-	if !strings.HasSuffix(name, `.tmpl`) {
-		name = name + `.tmpl`
+	opts := []LibraryOption{}
+	if ext := filepath.Ext(path); ext != `` {
+		opts = append(opts, WithExt(ext))
 	}
 
-	var buf bytes.Buffer
-
-	err := p.tmpl.ExecuteTemplate(&buf, name, data)
-	return buf.String(), err
+	l, err := LoadLibrary(filepath.Dir(path), opts...)
+	if err != nil {
+		panic(err)
+	}
+	return &Render{Library: l}
 }
@@ -0,0 +1,218 @@
+package prompts
+
+import (
+	"fmt"
+
+	"github.com/nexptr/llmchain/utils"
+)
+
+// types of PromptDef
+const (
+	PromptTypeTemplate = `prompt`
+	PromptTypeChat     = `chat`
+	PromptTypeFewShot  = `few_shot`
+)
+
+// PromptDef the serialized form of *Template, *ChatPromptTemplate and *FewShotTemplate.
+//
+//	type: few_shot
+//	prefix: Give the antonym of every input.
+//	example: "Input: {{.input}}\nOutput: {{.output}}"
+//	suffix: "Input: {{.input}}\nOutput:"
+//	examples:
+//	  - {input: happy, output: sad}
+type PromptDef struct {
+	// Type prompt (default), chat or few_shot
+	Type string `yaml:"type,omitempty" json:"type,omitempty"`
+
+	// Template of prompt
+	Template       string   `yaml:"template,omitempty" json:"template,omitempty"`
+	InputVariables []string `yaml:"input_variables,omitempty" json:"input_variables,omitempty"`
+	// Mode strict or lenient, empty is the default mode
+	Mode string `yaml:"mode,omitempty" json:"mode,omitempty"`
+	// Partials the filled variables of prompt and chat.
+	Partials H `yaml:"partials,omitempty" json:"partials,omitempty"`
+
+	// Messages of chat.
+	Messages []MessageDef `yaml:"messages,omitempty" json:"messages,omitempty"`
+
+	// Prefix, Example and Suffix of few_shot.
+	Prefix    string `yaml:"prefix,omitempty" json:"prefix,omitempty"`
+	Example   string `yaml:"example,omitempty" json:"example,omitempty"`
+	Suffix    string `yaml:"suffix,omitempty" json:"suffix,omitempty"`
+	Separator string `yaml:"separator,omitempty" json:"separator,omitempty"`
+	Examples  []H    `yaml:"examples,omitempty" json:"examples,omitempty"`
+	// MaxTokens the examples are selected by LengthBasedSelector if > 0
+	MaxTokens int `yaml:"max_tokens,omitempty" json:"max_tokens,omitempty"`
+}
+
+// MessageDef message of chat, either a role message template or a placeholder.
+type MessageDef struct {
+	Role     string `yaml:"role,omitempty" json:"role,omitempty"`
+	Template string `yaml:"template,omitempty" json:"template,omitempty"`
+	// Placeholder name of MessagesPlaceholder
+	Placeholder string `yaml:"placeholder,omitempty" json:"placeholder,omitempty"`
+	Optional    bool   `yaml:"optional,omitempty" json:"optional,omitempty"`
+}
+
+// DefOf return serialized form of tmpl: *Template, *ChatPromptTemplate or *FewShotTemplate.
+// The memory of chat and the semantic selector of few-shot are not serialized.
+func DefOf(tmpl any) (*PromptDef, error) {
+
+	switch t := tmpl.(type) {
+	case *Template:
+		d := &PromptDef{Template: t.source, InputVariables: t.variables, Mode: modeName(t.mode)}
+		if len(t.partials) > 0 {
+			d.Partials = t.partials
+		}
+		return d, nil
+
+	case *ChatPromptTemplate:
+		d := &PromptDef{Type: PromptTypeChat}
+		if len(t.partials) > 0 {
+			d.Partials = t.partials
+		}
+		for i, m := range t.Messages {
+			switch m := m.(type) {
+			case *RoleMessageTemplate:
+				d.Messages = append(d.Messages, MessageDef{Role: m.Role, Template: m.Template.source})
+			case MessagesPlaceholder:
+				d.Messages = append(d.Messages, MessageDef{Placeholder: m.Name, Optional: m.Optional})
+			default:
+				return nil, fmt.Errorf(`messages[%d]: unsupported message %T`, i, m)
+			}
+		}
+		return d, nil
+
+	case *FewShotTemplate:
+		d := &PromptDef{Type: PromptTypeFewShot, Example: t.Example.source, Suffix: t.Suffix.source}
+		if t.Separator != "\n\n" {
+			d.Separator = t.Separator
+		}
+		if t.Prefix != nil {
+			d.Prefix = t.Prefix.source
+		}
+		switch s := t.Selector.(type) {
+		case nil:
+		case *Examples:
+			d.Examples = *s
+		case *LengthBasedSelector:
+			s.mu.RLock()
+			d.Examples = append([]H{}, s.examples...)
+			s.mu.RUnlock()
+			d.MaxTokens = s.MaxTokens
+		default:
+			return nil, fmt.Errorf(`unsupported example selector %T`, s)
+		}
+		return d, nil
+	}
+
+	return nil, fmt.Errorf(`unsupported template %T`, tmpl)
+}
+
+// Build return the template of d: *Template, *ChatPromptTemplate or *FewShotTemplate.
+func (d *PromptDef) Build() (any, error) {
+
+	switch d.Type {
+	case ``, PromptTypeTemplate:
+		t, err := New(d.Template, d.InputVariables...)
+		if err != nil {
+			return nil, err
+		}
+		mode, err := parseMode(d.Mode)
+		if err != nil {
+			return nil, err
+		}
+		if len(d.Partials) > 0 {
+			t = t.Partial(d.Partials)
+		}
+		return t.WithMode(mode), nil
+
+	case PromptTypeChat:
+		messages := make([]MessageFormatter, len(d.Messages))
+		for i, m := range d.Messages {
+			if m.Placeholder != `` {
+				messages[i] = MessagesPlaceholder{Name: m.Placeholder, Optional: m.Optional}
+				continue
+			}
+			if m.Role == `` {
+				return nil, fmt.Errorf(`messages[%d]: role or placeholder is required`, i)
+			}
+			messages[i] = messageTemplate(m.Role, m.Template)
+		}
+		t, err := NewChatPromptTemplate(messages...)
+		if err != nil {
+			return nil, err
+		}
+		if len(d.Partials) > 0 {
+			t = t.Partial(d.Partials)
+		}
+		return t, nil
+
+	case PromptTypeFewShot:
+		t, err := NewFewShotTemplate(d.Prefix, d.Example, d.Suffix, nil)
+		if err != nil {
+			return nil, err
+		}
+		if d.Separator != `` {
+			t.Separator = d.Separator
+		}
+		if d.MaxTokens > 0 {
+			t.Selector = NewLengthBasedSelector(t.Example, d.MaxTokens, d.Examples...)
+		} else {
+			examples := Examples(d.Examples)
+			t.Selector = &examples
+		}
+		return t, nil
+	}
+
+	return nil, fmt.Errorf(`unknown prompt type '%s'`, d.Type)
+}
+
+func modeName(mode Mode) string {
+	switch mode {
+	case Strict:
+		return `strict`
+	case Lenient:
+		return `lenient`
+	}
+	return ``
+}
+
+func parseMode(name string) (Mode, error) {
+	switch name {
+	case ``:
+		return Default, nil
+	case `strict`:
+		return Strict, nil
+	case `lenient`:
+		return Lenient, nil
+	}
+	return Default, fmt.Errorf(`unknown mode '%s'`, name)
+}
+
+// Save write tmpl to file as JSON (.json) or YAML, see DefOf.
+func Save(file string, tmpl any) error {
+
+	d, err := DefOf(tmpl)
+	if err != nil {
+		return err
+	}
+	return utils.WriteFile(file, d)
+}
+
+// Load read template from file of JSON (.json) or YAML, the template is *Template, *ChatPromptTemplate
+// or *FewShotTemplate by the type of file.
+func Load(file string) (any, error) {
+
+	d := &PromptDef{}
+	if err := utils.ReadFile(file, d); err != nil {
+		return nil, err
+	}
+
+	t, err := d.Build()
+	if err != nil {
+		return nil, fmt.Errorf(`%s: %v`, file, err)
+	}
+	return t, nil
+}
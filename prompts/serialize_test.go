@@ -0,0 +1,74 @@
+package prompts_test
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/nexptr/llmchain/prompts"
+	"github.com/nexptr/llmchain/schema"
+)
+
+func TestSaveLoad(t *testing.T) {
+
+	dir := t.TempDir()
+
+	tmpl, _ := prompts.New(`{{.context}} Q: {{.question}}`, `lang`)
+	tmpl = tmpl.Partial(prompts.H{`lang`: `en`}).WithMode(prompts.Lenient)
+
+	chat, _ := prompts.NewChatPromptTemplate(
+		prompts.SystemMessage(`You are an assistant of {{.product}}.`),
+		prompts.MessagesPlaceholder{Name: `history`, Optional: true},
+		prompts.UserMessage(`{{.input}}`),
+	)
+
+	fewShot, _ := prompts.NewFewShotTemplate(`Antonyms.`, `{{.input}}: {{.output}}`, `{{.input}}:`,
+		prompts.NewLengthBasedSelector(nil, 100, prompts.H{`input`: `happy`, `output`: `sad`}))
+
+	for _, file := range []string{`prompt.yaml`, `prompt.json`} {
+
+		file = filepath.Join(dir, file)
+
+		if err := prompts.Save(file, tmpl); err != nil {
+			t.Fatal(err)
+		}
+		v, err := prompts.Load(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		loaded := v.(*prompts.Template)
+		if !reflect.DeepEqual(loaded.Variables(), []string{`context`, `question`}) || loaded.Source() != tmpl.Source() {
+			t.Fatalf(`unexpected template %v %s`, loaded.Variables(), loaded.Source())
+		}
+		if out, err := loaded.Render(prompts.H{`question`: `why`}); err != nil || out != ` Q: why` {
+			t.Fatalf(`unexpected render %q: %v`, out, err)
+		}
+	}
+
+	file := filepath.Join(dir, `chat.json`)
+	if err := prompts.Save(file, chat); err != nil {
+		t.Fatal(err)
+	}
+	v, err := prompts.Load(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs, err := v.(*prompts.ChatPromptTemplate).FormatMessages(prompts.H{`product`: `llmchain`, `input`: `hi`})
+	if err != nil || len(msgs) != 2 || msgs[1] != schema.BuildUserMessage(`hi`) {
+		t.Fatalf(`unexpected messages %v: %v`, msgs, err)
+	}
+
+	file = filepath.Join(dir, `few_shot.yaml`)
+	if err := prompts.Save(file, fewShot); err != nil {
+		t.Fatal(err)
+	}
+	v, err = prompts.Load(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := v.(*prompts.FewShotTemplate).Render(context.Background(), prompts.H{`input`: `big`})
+	if err != nil || out != "Antonyms.\n\nhappy: sad\n\nbig:" {
+		t.Fatalf(`unexpected render %q: %v`, out, err)
+	}
+}
@@ -3,14 +3,34 @@ package prompts
 import (
 	"bytes"
 	"fmt"
+	"sort"
+	"strings"
 	"text/template"
+	"text/template/parse"
 )
 
-type H = map[string]string
+// H values of template variables, values may be strings, lists, maps or structs.
+type H = map[string]any
 
+// Mode how Render validates the variables.
+type Mode int
+
+const (
+	// Default missing variables are errors, unknown keys are ignored, so callers may pass extra keys.
+	Default Mode = iota
+	// Strict missing variables and unknown keys are errors, opt-in to catch typos of keys.
+	Strict
+	// Lenient missing variables are rendered empty, unknown keys are ignored.
+	Lenient
+)
+
+// Template prompt template of text/template, variables are discovered from the template.
 type Template struct {
+	source    string
 	tmpl      *template.Template
 	variables []string
+	partials  H
+	mode      Mode
 }
 
 func PromptTemplate(prompt string, variables ...string) *Template {
@@ -21,6 +41,8 @@ func PromptTemplate(prompt string, variables ...string) *Template {
 	return t
 }
 
+// New parse prompt, the variables used by prompt are discovered, variables declares the extra ones
+// required.
 func New(prompt string, variables ...string) (*Template, error) {
 
 	tmpl, err := template.New(``).Parse(prompt)
@@ -30,30 +52,193 @@ func New(prompt string, variables ...string) (*Template, error) {
 	}
 
 	t := &Template{
+		source:    prompt,
 		tmpl:      tmpl,
-		variables: variables,
+		variables: discover(tmpl),
+		partials:  H{},
 	}
 
-	if len(t.variables) == 0 {
-		t.variables = []string{`input`}
+	for _, v := range variables {
+		if !t.hasVariable(v) {
+			t.variables = append(t.variables, v)
+		}
 	}
 
 	return t, nil
 }
 
+// Source return the text of template.
+func (t *Template) Source() string {
+	return t.source
+}
+
+// Variables return the variables not filled by Partial.
+func (t *Template) Variables() []string {
+
+	ret := []string{}
+	for _, v := range t.variables {
+		if _, ok := t.partials[v]; !ok {
+			ret = append(ret, v)
+		}
+	}
+	return ret
+}
+
+func (t *Template) hasVariable(name string) bool {
+	for _, v := range t.variables {
+		if v == name {
+			return true
+		}
+	}
+	return false
+}
+
+// WithMode return copy of template with the validation mode.
+func (t *Template) WithMode(mode Mode) *Template {
+	c := *t
+	c.mode = mode
+	return &c
+}
+
+// Partial return copy of template with vars filled, vars of Render take precedence.
+func (t *Template) Partial(vars H) *Template {
+
+	c := *t
+	c.partials = make(H, len(t.partials)+len(vars))
+	for k, v := range t.partials {
+		c.partials[k] = v
+	}
+	for k, v := range vars {
+		c.partials[k] = v
+	}
+	return &c
+}
+
+// Render execute template with vars and the partial vars.
 func (t *Template) Render(vars H) (string, error) {
 
-	//todo verify vars
+	data := make(H, len(t.partials)+len(vars))
+	for k, v := range t.partials {
+		data[k] = v
+	}
+	for k, v := range vars {
+		data[k] = v
+	}
+
+	missing := []string{}
 	for _, v := range t.variables {
-		if _, ok := vars[v]; !ok {
-			return "", fmt.Errorf(`field: '%s' not set`, v)
+		if _, ok := data[v]; !ok {
+			missing = append(missing, v)
+		}
+	}
+
+	if t.mode == Lenient {
+		for _, v := range missing {
+			data[v] = ``
+		}
+	} else if len(missing) > 0 {
+		return ``, fmt.Errorf(`field: '%s' not set`, strings.Join(missing, `', '`))
+	}
+
+	if t.mode == Strict {
+		for k := range vars {
+			if !t.hasVariable(k) {
+				return ``, fmt.Errorf(`field: '%s' not used by template, expect one of %v`, k, t.variables)
+			}
 		}
 	}
 
 	var buf bytes.Buffer
 
-	err := t.tmpl.Execute(&buf, vars)
+	err := t.tmpl.Execute(&buf, data)
 
 	return buf.String(), err
 
 }
+
+// discover return the top level fields used by template in order of appearance, example: .question
+// and $.context. Fields inside range and with refer to the element, they are not variables.
+func discover(tmpl *template.Template) []string {
+
+	seen := map[string]bool{}
+	ret := []string{}
+
+	add := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			ret = append(ret, name)
+		}
+	}
+
+	var walk func(n parse.Node, root bool)
+	walk = func(n parse.Node, root bool) {
+
+		switch n := n.(type) {
+		case *parse.ListNode:
+			if n == nil {
+				return
+			}
+			for _, c := range n.Nodes {
+				walk(c, root)
+			}
+		case *parse.ActionNode:
+			walk(n.Pipe, root)
+		case *parse.PipeNode:
+			if n == nil {
+				return
+			}
+			for _, cmd := range n.Cmds {
+				walk(cmd, root)
+			}
+		case *parse.CommandNode:
+			for _, arg := range n.Args {
+				walk(arg, root)
+			}
+		case *parse.FieldNode:
+			if root {
+				add(n.Ident[0])
+			}
+		case *parse.ChainNode:
+			walk(n.Node, root)
+		case *parse.VariableNode:
+			// $.x refers to the root always
+			if n.Ident[0] == `$` && len(n.Ident) > 1 {
+				add(n.Ident[1])
+			}
+		case *parse.IfNode:
+			walk(n.Pipe, root)
+			walk(n.List, root)
+			walk(n.ElseList, root)
+		case *parse.RangeNode:
+			walk(n.Pipe, root)
+			walk(n.List, false)
+			walk(n.ElseList, root)
+		case *parse.WithNode:
+			walk(n.Pipe, root)
+			walk(n.List, false)
+			walk(n.ElseList, root)
+		case *parse.TemplateNode:
+			walk(n.Pipe, root)
+		}
+	}
+
+	// the main template first, then the associated templates by name.
+	templates := tmpl.Templates()
+	sort.Slice(templates, func(i, j int) bool {
+		if templates[i].Name() == tmpl.Name() {
+			return true
+		}
+		if templates[j].Name() == tmpl.Name() {
+			return false
+		}
+		return templates[i].Name() < templates[j].Name()
+	})
+
+	for _, t := range templates {
+		if t.Tree != nil {
+			walk(t.Tree.Root, true)
+		}
+	}
+
+	return ret
+}
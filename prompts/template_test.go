@@ -1,6 +1,7 @@
 package prompts
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -15,3 +16,62 @@ func TestTemplate_Render(t *testing.T) {
 	println(msg)
 
 }
+
+func TestTemplate_Variables(t *testing.T) {
+
+	tmpl, err := New(`{{.question}} {{if .context}}{{.context}}{{end}} {{range .docs}}{{.Title}} {{$.question}}{{end}} {{with .user}}{{.Name}}{{end}}`, `extra`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{`question`, `context`, `docs`, `user`, `extra`}
+	if got := tmpl.Variables(); strings.Join(got, `,`) != strings.Join(want, `,`) {
+		t.Fatalf(`unexpected variables %v`, got)
+	}
+}
+
+func TestTemplate_Modes(t *testing.T) {
+
+	tmpl := PromptTemplate(`Q: {{.question}}{{range .docs}} [{{.}}]{{end}}`)
+
+	got, err := tmpl.Render(H{`question`: `hi`, `docs`: []string{`a`, `b`}})
+	if err != nil || got != `Q: hi [a] [b]` {
+		t.Fatalf(`unexpected %q, %v`, got, err)
+	}
+
+	if _, err := tmpl.Render(H{`question`: `hi`}); err == nil || err.Error() != `field: 'docs' not set` {
+		t.Fatalf(`unexpected error %v`, err)
+	}
+
+	// the extra keys are ignored by default.
+	got, err = tmpl.Render(H{`question`: `hi`, `docs`: nil, `extra`: `ignored`})
+	if err != nil || got != `Q: hi` {
+		t.Fatalf(`unexpected %q, %v`, got, err)
+	}
+
+	if _, err := tmpl.WithMode(Strict).Render(H{`question`: `hi`, `docs`: nil, `questoin`: `typo`}); err == nil || !strings.Contains(err.Error(), `'questoin' not used`) {
+		t.Fatalf(`unexpected error %v`, err)
+	}
+
+	got, err = tmpl.WithMode(Lenient).Render(H{`docs`: []string{`a`}, `questoin`: `typo`})
+	if err != nil || got != `Q:  [a]` {
+		t.Fatalf(`unexpected %q, %v`, got, err)
+	}
+}
+
+func TestTemplate_Partial(t *testing.T) {
+
+	partial := QAPrompt.Partial(H{`context`: `ctx`})
+
+	if vars := partial.Variables(); len(vars) != 1 || vars[0] != `question` {
+		t.Fatalf(`unexpected variables %v`, vars)
+	}
+	if vars := QAPrompt.Variables(); len(vars) != 2 {
+		t.Fatalf(`the original template is changed: %v`, vars)
+	}
+
+	msg, err := partial.Render(H{`question`: `why`})
+	if err != nil || !strings.Contains(msg, "ctx\n\nQuestion: why") {
+		t.Fatalf(`unexpected %q, %v`, msg, err)
+	}
+}
@@ -2,6 +2,6 @@ package schema
 
 // Document is the interface for interacting with a document.
 type Document struct {
-	PageContent string
-	Metadata    map[string]any
+	PageContent string         `json:"page_content" yaml:"page_content"`
+	Metadata    map[string]any `json:"metadata,omitempty" yaml:"metadata,omitempty"`
 }
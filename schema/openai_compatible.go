@@ -246,16 +246,27 @@ type CompletionResponse struct {
 	Model   string     `json:"model,omitempty"`
 	Choices []Choice   `json:"choices,omitempty"`
 	Usage   Usage      `json:"usage"`
+
+	// Custom fields - not present in the OpenAI API
+
+	// SourceDocuments the documents the answer based on, returned by retrieval chains.
+	SourceDocuments []Document `json:"source_documents,omitempty"`
 }
 
 type ChatResponse struct {
 	ID      string   `json:"id,omitempty"`
 	Object  string   `json:"object,omitempty"`
 	Created int64    `json:"created,omitempty"`
+	Model   string   `json:"model,omitempty"`
 	Choices []Choice `json:"choices,omitempty"`
 	Data    []Item   `json:"data,omitempty"`
 
 	Usage Usage `json:"usage"`
+
+	// Custom fields - not present in the OpenAI API
+
+	// SourceDocuments the documents the answer based on, returned by retrieval chains.
+	SourceDocuments []Document `json:"source_documents,omitempty"`
 }
 
 func (r *ChatResponse) String() string {
@@ -318,3 +329,35 @@ type EmbeddingData struct {
 	Embedding []float32 `json:"embedding"`
 	Index     int       `json:"index"`
 }
+
+// Model describes an OpenAI compatible model entry of the /v1/models response.
+type Model struct {
+	ID      string     `json:"id"`
+	Object  ObjectType `json:"object"`
+	Created int64      `json:"created,omitempty"`
+	OwnedBy string     `json:"owned_by,omitempty"`
+}
+
+// ModelList is the response of /v1/models.
+type ModelList struct {
+	Object ObjectType `json:"object"`
+	Data   []Model    `json:"data"`
+}
+
+// APIError is the OpenAI compatible error body.
+// See https://platform.openai.com/docs/guides/error-codes/api-errors
+type APIError struct {
+	Message string  `json:"message"`
+	Type    string  `json:"type"`
+	Param   *string `json:"param"`
+	Code    any     `json:"code"`
+}
+
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+// ErrorResponse wraps APIError as the OpenAI API does: {"error": {...}}
+type ErrorResponse struct {
+	Error *APIError `json:"error"`
+}
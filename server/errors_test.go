@@ -0,0 +1,57 @@
+package server_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nexptr/llmchain/llms"
+	"github.com/nexptr/llmchain/schema"
+	"github.com/nexptr/llmchain/server"
+)
+
+// errLLM fail every request with err
+type errLLM struct {
+	fakeLLM
+	err error
+}
+
+func (f *errLLM) Chat(ctx context.Context, req *schema.ChatRequest) (*schema.ChatResponse, error) {
+	return nil, f.err
+}
+
+func TestServer_ChatCompletionsError(t *testing.T) {
+
+	gin.SetMode(gin.TestMode)
+
+	cases := []struct {
+		err    error
+		status int
+		typ    string
+	}{
+		{llms.NewHTTPError(`openai`, http.StatusTooManyRequests, `requests`, `rate_limit_exceeded`, `slow down`, nil), http.StatusTooManyRequests, `rate_limit_error`},
+		{llms.NewHTTPError(`openai`, http.StatusBadRequest, ``, `context_length_exceeded`, `too long`, nil), http.StatusBadRequest, `invalid_request_error`},
+		{llms.NewHTTPError(`openai`, http.StatusUnauthorized, ``, `invalid_api_key`, `bad key`, nil), http.StatusBadGateway, `server_error`},
+		{&llms.Error{Provider: `local`, Kind: llms.ErrOutOfMemory, Retryable: true}, http.StatusServiceUnavailable, `server_error`},
+	}
+
+	for _, c := range cases {
+		ts := httptest.NewServer(server.New(server.WithModels(&errLLM{fakeLLM: fakeLLM{name: `fake`}, err: c.err})))
+
+		out := schema.ErrorResponse{}
+		status := post(t, ts.URL+`/v1/chat/completions`, schema.ChatRequest{
+			Model:    `fake`,
+			Messages: []schema.Message{schema.BuildUserMessage(`hi`)},
+		}, &out)
+		ts.Close()
+
+		if status != c.status {
+			t.Errorf(`%v: expect status %d, got %d`, c.err, c.status, status)
+		}
+		if out.Error == nil || out.Error.Type != c.typ {
+			t.Errorf(`%v: unexpected error body %+v`, c.err, out.Error)
+		}
+	}
+}
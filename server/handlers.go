@@ -0,0 +1,481 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nexptr/llmchain/chains"
+	"github.com/nexptr/llmchain/llms"
+	"github.com/nexptr/llmchain/prompts"
+	"github.com/nexptr/llmchain/schema"
+)
+
+func (s *Server) listModels(c *gin.Context) {
+
+	ret := schema.ModelList{Object: schema.OTList, Data: []schema.Model{}}
+
+	for _, name := range s.ModelNames() {
+		ret.Data = append(ret.Data, schema.Model{ID: name, Object: schema.OTModel})
+	}
+
+	c.JSON(http.StatusOK, ret)
+}
+
+func (s *Server) retrieveModel(c *gin.Context) {
+
+	name := c.Param(`model`)
+
+	if _, ok := s.Model(name); !ok {
+		abortWithModelNotFound(c, name)
+		return
+	}
+
+	c.JSON(http.StatusOK, schema.Model{ID: name, Object: schema.OTModel})
+}
+
+func (s *Server) chatCompletions(c *gin.Context) {
+
+	req := &schema.ChatRequest{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		abortWithInvalidRequest(c, err)
+		return
+	}
+
+	llm, ok := s.Model(req.Model)
+	if !ok {
+		abortWithModelNotFound(c, req.Model)
+		return
+	}
+
+	if req.Langchain != `` {
+		s.chatWithChain(c, llm, req)
+		return
+	}
+
+	if tmpl := s.templateConfig(llm).Chat; tmpl != `` {
+		if req.Stream {
+			abortWithInvalidRequest(c, fmt.Errorf(`stream is not supported by the chat template of model '%s'`, req.Model))
+			return
+		}
+		s.chatWithTemplate(c, llm, req, tmpl)
+		return
+	}
+
+	if req.Stream {
+		s.chatStream(c, llm, req)
+		return
+	}
+
+	resp, err := llm.Chat(c.Request.Context(), req)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	if resp == nil {
+		abortWithError(c, fmt.Errorf(`model '%s' returned empty response`, req.Model))
+		return
+	}
+
+	fillChatResponse(resp, req.Model)
+	c.JSON(http.StatusOK, resp)
+}
+
+func (s *Server) chatWithChain(c *gin.Context, llm llms.LLM, req *schema.ChatRequest) {
+
+	chain, ok := chains.GetChain(req.Langchain)
+	if !ok {
+		abortWithInvalidRequest(c, fmt.Errorf(`langchain '%s' not found`, req.Langchain))
+		return
+	}
+
+	inputs := map[string]any{
+		chains.InputKey:    lastUserContent(req.Messages),
+		chains.MessagesKey: req.Messages,
+	}
+
+	if req.Stream {
+		// request context is canceled when client disconnected, which stops the chain.
+		ctx, cancel := context.WithCancel(c.Request.Context())
+		defer cancel()
+
+		stream := chainStream(ctx, chain, inputs, chains.WithModel(llm), chains.WithStopWords(req.Stop))
+		writeStream(ctx, c, stream, chatChunk(req.Model))
+		return
+	}
+
+	out, err := chains.Call(c.Request.Context(), chain, inputs, chains.WithModel(llm), chains.WithStopWords(req.Stop))
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	var resp *schema.ChatResponse
+
+	if v, ok := out[chains.OutputKey].(*schema.ChatResponse); ok {
+		resp = v
+	} else {
+		text, err := chainOutputText(req.Langchain, out)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		msg := schema.BuildAIMessage(text)
+		resp = &schema.ChatResponse{Choices: []schema.Choice{{Message: &msg, FinishReason: `stop`}}}
+	}
+
+	if docs, ok := out[chains.SourceDocumentsKey].([]schema.Document); ok {
+		resp.SourceDocuments = docs
+	}
+
+	fillChatResponse(resp, req.Model)
+	c.JSON(http.StatusOK, resp)
+}
+
+// chainOutputText return the text of chain output.
+func chainOutputText(name string, out map[string]any) (string, error) {
+
+	switch v := out[chains.OutputKey].(type) {
+	case string:
+		return v, nil
+	case schema.Message:
+		return v.Content, nil
+	case *schema.ChatResponse:
+		if len(v.Choices) > 0 && v.Choices[0].Message != nil {
+			return v.Choices[0].Message.Content, nil
+		}
+	}
+	return ``, fmt.Errorf(`langchain '%s' returned unsupported output %T`, name, out[chains.OutputKey])
+}
+
+// chatWithTemplate render the messages to prompt by template of library, the prompt is completed by llm.
+func (s *Server) chatWithTemplate(c *gin.Context, llm llms.LLM, req *schema.ChatRequest, tmpl string) {
+
+	prompt, err := s.prompts.Render(tmpl, prompts.ChatPromptData(req.Model, req.Messages))
+	if err != nil {
+		abortWithError(c, fmt.Errorf(`render chat template '%s': %v`, tmpl, err))
+		return
+	}
+
+	resp, err := llm.Completion(c.Request.Context(), &schema.CompletionRequest{
+		Model:            req.Model,
+		Prompt:           prompt,
+		MaxTokens:        req.MaxTokens,
+		Temperature:      req.Temperature,
+		TopP:             req.TopP,
+		N:                req.N,
+		Stop:             req.Stop,
+		PresencePenalty:  req.PresencePenalty,
+		FrequencyPenalty: req.FrequencyPenalty,
+		LogitBias:        req.LogitBias,
+		User:             req.User,
+	})
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	if resp == nil {
+		abortWithError(c, fmt.Errorf(`model '%s' returned empty response`, req.Model))
+		return
+	}
+
+	ret := &schema.ChatResponse{ID: resp.ID, Created: resp.Created, Usage: resp.Usage}
+	for _, choice := range resp.Choices {
+		msg := schema.BuildAIMessage(choice.Text)
+		ret.Choices = append(ret.Choices, schema.Choice{Index: choice.Index, Message: &msg, FinishReason: choice.FinishReason})
+	}
+
+	fillChatResponse(ret, req.Model)
+	c.JSON(http.StatusOK, ret)
+}
+
+// completions serve /v1/completions, stream is supported with langchain only, as providers have no
+// streaming api of completion.
+func (s *Server) completions(c *gin.Context) {
+
+	req := &schema.CompletionRequest{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		abortWithInvalidRequest(c, err)
+		return
+	}
+
+	llm, ok := s.Model(req.Model)
+	if !ok {
+		abortWithModelNotFound(c, req.Model)
+		return
+	}
+
+	if req.Langchain != `` && req.Stream {
+		chain, ok := chains.GetChain(req.Langchain)
+		if !ok {
+			abortWithInvalidRequest(c, fmt.Errorf(`langchain '%s' not found`, req.Langchain))
+			return
+		}
+
+		// request context is canceled when client disconnected, which stops the chain.
+		ctx, cancel := context.WithCancel(c.Request.Context())
+		defer cancel()
+
+		stream := chainStream(ctx, chain, map[string]any{chains.InputKey: req.Prompt}, chains.WithModel(llm), chains.WithStopWords(req.Stop))
+		writeStream(ctx, c, stream, completionChunk(req.Model))
+		return
+	}
+
+	if req.Stream {
+		abortWithInvalidRequest(c, fmt.Errorf(`stream is not supported by completions of model '%s', use chat completions or langchain`, req.Model))
+		return
+	}
+
+	var (
+		resp *schema.CompletionResponse
+		err  error
+	)
+
+	if req.Langchain != `` {
+		resp, err = completionWithChain(c, llm, req)
+	} else if tmpl := s.templateConfig(llm).Completion; tmpl != `` {
+		resp, err = s.completionWithTemplate(c, llm, req, tmpl)
+	} else {
+		resp, err = llm.Completion(c.Request.Context(), req)
+	}
+
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	if resp == nil {
+		abortWithError(c, fmt.Errorf(`model '%s' returned empty response`, req.Model))
+		return
+	}
+
+	if resp.ID == `` {
+		resp.ID = newID(`cmpl-`)
+	}
+	if resp.Object == `` {
+		resp.Object = schema.OTTextCompletion
+	}
+	if resp.Created == 0 {
+		resp.Created = time.Now().Unix()
+	}
+	if resp.Model == `` {
+		resp.Model = req.Model
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+func completionWithChain(c *gin.Context, llm llms.LLM, req *schema.CompletionRequest) (*schema.CompletionResponse, error) {
+
+	chain, ok := chains.GetChain(req.Langchain)
+	if !ok {
+		return nil, invalidRequestError{fmt.Errorf(`langchain '%s' not found`, req.Langchain)}
+	}
+
+	out, err := chains.Call(c.Request.Context(), chain, map[string]any{chains.InputKey: req.Prompt}, chains.WithModel(llm), chains.WithStopWords(req.Stop))
+	if err != nil {
+		return nil, err
+	}
+
+	text, err := chainOutputText(req.Langchain, out)
+	if err != nil {
+		return nil, err
+	}
+
+	docs, _ := out[chains.SourceDocumentsKey].([]schema.Document)
+
+	return &schema.CompletionResponse{
+		Choices:         []schema.Choice{{Text: text, FinishReason: `stop`}},
+		SourceDocuments: docs,
+	}, nil
+}
+
+// completionWithTemplate render the prompt by template of library before completion.
+func (s *Server) completionWithTemplate(c *gin.Context, llm llms.LLM, req *schema.CompletionRequest, tmpl string) (*schema.CompletionResponse, error) {
+
+	prompt, err := s.prompts.Render(tmpl, prompts.PromptData{Model: req.Model, Input: req.Prompt})
+	if err != nil {
+		return nil, fmt.Errorf(`render completion template '%s': %v`, tmpl, err)
+	}
+
+	r := *req
+	r.Prompt = prompt
+	return llm.Completion(c.Request.Context(), &r)
+}
+
+func (s *Server) embeddings(c *gin.Context) {
+
+	req := &schema.EmbeddingsRequest{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		abortWithInvalidRequest(c, err)
+		return
+	}
+
+	// json decode []string as []interface{}
+	if v, ok := req.Input.([]any); ok {
+		input := make([]string, 0, len(v))
+		for _, i := range v {
+			str, ok := i.(string)
+			if !ok {
+				break
+			}
+			input = append(input, str)
+		}
+		if len(input) == len(v) {
+			req.Input = input
+		}
+	}
+
+	if err := req.Verify(); err != nil {
+		abortWithInvalidRequest(c, err)
+		return
+	}
+
+	llm, ok := s.Model(req.Model)
+	if !ok {
+		abortWithModelNotFound(c, req.Model)
+		return
+	}
+
+	resp, err := llm.Embeddings(c.Request.Context(), req)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	if resp == nil {
+		abortWithError(c, fmt.Errorf(`model '%s' returned empty response`, req.Model))
+		return
+	}
+
+	if resp.Object == `` {
+		resp.Object = string(schema.OTList)
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// fillChatResponse set the OpenAI required fields which not returned by providers.
+func fillChatResponse(resp *schema.ChatResponse, model string) {
+	if resp.ID == `` || resp.ID == `TODO` {
+		resp.ID = newID(`chatcmpl-`)
+	}
+	if resp.Object == `` {
+		resp.Object = `chat.completion`
+	}
+	if resp.Created == 0 {
+		resp.Created = time.Now().Unix()
+	}
+	if resp.Model == `` {
+		resp.Model = model
+	}
+}
+
+func lastUserContent(messages []schema.Message) string {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == `user` {
+			return messages[i].Content
+		}
+	}
+	return ``
+}
+
+func newID(prefix string) string {
+	b := make([]byte, 12)
+	_, _ = rand.Read(b)
+	return prefix + hex.EncodeToString(b)
+}
+
+type invalidRequestError struct {
+	error
+}
+
+func abortWithInvalidRequest(c *gin.Context, err error) {
+	c.AbortWithStatusJSON(http.StatusBadRequest, schema.ErrorResponse{Error: &schema.APIError{
+		Message: err.Error(),
+		Type:    `invalid_request_error`,
+	}})
+}
+
+func abortWithModelNotFound(c *gin.Context, model string) {
+	c.AbortWithStatusJSON(http.StatusNotFound, schema.ErrorResponse{Error: &schema.APIError{
+		Message: fmt.Sprintf(`The model '%s' does not exist`, model),
+		Type:    `invalid_request_error`,
+		Code:    `model_not_found`,
+	}})
+}
+
+func abortWithError(c *gin.Context, err error) {
+
+	var invalid invalidRequestError
+	if errors.As(err, &invalid) {
+		abortWithInvalidRequest(c, invalid.error)
+		return
+	}
+
+	var e *llms.Error
+	if errors.As(err, &e) && e.RetryAfter > 0 {
+		c.Header(`Retry-After`, strconv.Itoa(int(math.Ceil(e.RetryAfter.Seconds()))))
+	}
+
+	c.AbortWithStatusJSON(errorStatus(err), errorResponse(err))
+}
+
+// errorStatus return http status of the llms errors.
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, llms.ErrRateLimited), errors.Is(err, llms.ErrQuotaExceeded):
+		return http.StatusTooManyRequests
+	case errors.Is(err, llms.ErrContextLengthExceeded), errors.Is(err, llms.ErrInvalidRequest):
+		return http.StatusBadRequest
+	case errors.Is(err, llms.ErrModelNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, llms.ErrUnauthorized):
+		// the credential of upstream is configured by server, client can do nothing about it.
+		return http.StatusBadGateway
+	case errors.Is(err, llms.ErrOutOfMemory), errors.Is(err, llms.ErrUnavailable):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, llms.ErrTimeout), errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// errorResponse convert err to OpenAI compatible error body.
+func errorResponse(err error) schema.ErrorResponse {
+
+	apiErr := &schema.APIError{
+		Message: err.Error(),
+		Type:    `server_error`,
+	}
+
+	var e *llms.Error
+	if errors.As(err, &e) {
+		apiErr.Message = e.Message
+		if apiErr.Message == `` {
+			apiErr.Message = e.Error()
+		}
+		if e.Code != `` {
+			apiErr.Code = e.Code
+		}
+	}
+
+	switch {
+	case errors.Is(err, llms.ErrContextLengthExceeded):
+		apiErr.Type, apiErr.Code = `invalid_request_error`, `context_length_exceeded`
+	case errors.Is(err, llms.ErrInvalidRequest):
+		apiErr.Type = `invalid_request_error`
+	case errors.Is(err, llms.ErrRateLimited):
+		apiErr.Type = `rate_limit_error`
+	case errors.Is(err, llms.ErrQuotaExceeded):
+		apiErr.Type = `insufficient_quota`
+	}
+
+	return schema.ErrorResponse{Error: apiErr}
+}
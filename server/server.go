@@ -0,0 +1,134 @@
+package server
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nexptr/llmchain/llms"
+	"github.com/nexptr/llmchain/prompts"
+)
+
+// Server OpenAI compatible http server, serve all registered models and chains.
+//
+// stream:true is served as server-sent events by chat completions and langchain requests, the
+// client disconnect cancels the upstream. Completions and chats rendered by the chat template of
+// WithPromptLibrary reply 400 to stream, as providers have no streaming api of completion.
+type Server struct {
+	engine *gin.Engine
+
+	mu     sync.RWMutex
+	models map[string]llms.LLM
+
+	// prompts the templates bound to models, may be nil
+	prompts *prompts.Library
+}
+
+// Option is a function that configures a Server.
+type Option func(*Server)
+
+// WithModels register models to server, models are keyed by llms.LLM.Name()
+func WithModels(models ...llms.LLM) Option {
+	return func(s *Server) {
+		for _, m := range models {
+			s.models[m.Name()] = m
+		}
+	}
+}
+
+// WithPromptLibrary render the prompt of models bound by lib.Bind: the completion template renders
+// the prompt of completions, and the chat template renders the messages of chat to a prompt of completion.
+func WithPromptLibrary(lib *prompts.Library) Option {
+	return func(s *Server) {
+		s.prompts = lib
+	}
+}
+
+// New return server with the OpenAI compatible routes registered.
+func New(opts ...Option) *Server {
+
+	s := &Server{
+		engine: gin.New(),
+		models: make(map[string]llms.LLM),
+	}
+
+	for _, fn := range opts {
+		fn(s)
+	}
+
+	s.engine.Use(gin.Recovery())
+	s.routes()
+
+	return s
+}
+
+func (s *Server) routes() {
+
+	v1 := s.engine.Group(`/v1`)
+
+	v1.GET(`/models`, s.listModels)
+	v1.GET(`/models/:model`, s.retrieveModel)
+	v1.POST(`/chat/completions`, s.chatCompletions)
+	v1.POST(`/completions`, s.completions)
+	v1.POST(`/embeddings`, s.embeddings)
+}
+
+// AddModel register or replace model by name.
+func (s *Server) AddModel(llm llms.LLM) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.models[llm.Name()] = llm
+}
+
+// Model return registered model by name or alias registered by llms.RegisterAlias.
+func (s *Server) Model(name string) (llms.LLM, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	m, ok := s.models[name]
+	if !ok {
+		m, ok = s.models[llms.ResolveAlias(name)]
+	}
+	return m, ok
+}
+
+// templateConfig return the templates bound to llm.
+func (s *Server) templateConfig(llm llms.LLM) prompts.TemplateConfig {
+	if s.prompts == nil {
+		return prompts.TemplateConfig{}
+	}
+	cfg, _ := s.prompts.TemplateConfigOf(llm.Name())
+	return cfg
+}
+
+// ModelNames return the sorted names of all registered models.
+func (s *Server) ModelNames() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	names := make([]string, 0, len(s.models))
+	for name := range s.models {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.engine.ServeHTTP(w, r)
+}
+
+// Run listen and serve on addr, example: ":8080"
+func (s *Server) Run(addr string) error {
+	return http.ListenAndServe(addr, s)
+}
+
+// Free free all registered models.
+func (s *Server) Free() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, m := range s.models {
+		m.Free()
+	}
+}
@@ -0,0 +1,342 @@
+package server_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nexptr/llmchain/chains"
+	"github.com/nexptr/llmchain/llms"
+	"github.com/nexptr/llmchain/llms/local"
+	"github.com/nexptr/llmchain/prompts"
+	"github.com/nexptr/llmchain/schema"
+	"github.com/nexptr/llmchain/server"
+	"google.golang.org/grpc"
+)
+
+// fakeLLM echo the last message back
+type fakeLLM struct {
+	name string
+}
+
+func (f *fakeLLM) Name() string { return f.name }
+
+func (f *fakeLLM) Free() {}
+
+func (f *fakeLLM) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return `echo: ` + prompt, nil
+}
+
+func (f *fakeLLM) Chat(ctx context.Context, req *schema.ChatRequest) (*schema.ChatResponse, error) {
+	msg := schema.BuildAIMessage(`echo: ` + req.Messages[len(req.Messages)-1].Content)
+	return &schema.ChatResponse{Choices: []schema.Choice{{Message: &msg, FinishReason: `stop`}}}, nil
+}
+
+func (f *fakeLLM) Completion(ctx context.Context, req *schema.CompletionRequest) (*schema.CompletionResponse, error) {
+	return &schema.CompletionResponse{Choices: []schema.Choice{{Text: `echo: ` + req.Prompt}}}, nil
+}
+
+func (f *fakeLLM) Embeddings(ctx context.Context, req *schema.EmbeddingsRequest) (*schema.EmbeddingsResponse, error) {
+	resp := &schema.EmbeddingsResponse{}
+	for i := range req.Input.([]string) {
+		resp.Data = append(resp.Data, schema.EmbeddingData{Object: `embedding`, Embedding: []float32{float32(i)}, Index: i})
+	}
+	return resp, nil
+}
+
+// upperChain calls the model from the call options and returns the answer upper cased
+type upperChain struct{}
+
+func (upperChain) GetName() string { return `upper` }
+
+func (upperChain) GetMemory() schema.Memory { return nil }
+
+func (upperChain) GetInputKeys() []string { return []string{chains.InputKey} }
+
+func (upperChain) GetOutputKeys() []string { return []string{chains.OutputKey} }
+
+func (upperChain) Chat(ctx context.Context, inputs map[string]any, options ...chains.ChainCallOption) (map[string]any, error) {
+	return map[string]any{chains.OutputKey: strings.ToUpper(inputs[chains.InputKey].(string))}, nil
+}
+
+func newTestServer(t *testing.T) *httptest.Server {
+	gin.SetMode(gin.TestMode)
+	chains.RegChain(upperChain{})
+	t.Cleanup(func() { chains.UnregChain(upperChain{}.GetName()) })
+
+	ts := httptest.NewServer(server.New(server.WithModels(&fakeLLM{name: `fake-a`}, &fakeLLM{name: `fake-b`})))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func post(t *testing.T, url string, body any, out any) int {
+	b, _ := json.Marshal(body)
+	resp, err := http.Post(url, `application/json`, bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode
+}
+
+func TestServer_Models(t *testing.T) {
+
+	ts := newTestServer(t)
+
+	resp, err := http.Get(ts.URL + `/v1/models`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	list := schema.ModelList{}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		t.Fatal(err)
+	}
+
+	if list.Object != schema.OTList || len(list.Data) != 2 || list.Data[0].ID != `fake-a` || list.Data[1].ID != `fake-b` {
+		t.Fatalf(`unexpected models: %+v`, list)
+	}
+}
+
+func TestServer_ChatCompletions(t *testing.T) {
+
+	ts := newTestServer(t)
+
+	resp := schema.ChatResponse{}
+	code := post(t, ts.URL+`/v1/chat/completions`, schema.ChatRequest{
+		Model:    `fake-b`,
+		Messages: []schema.Message{schema.BuildUserMessage(`hello`)},
+	}, &resp)
+
+	if code != http.StatusOK {
+		t.Fatalf(`status %d`, code)
+	}
+	if resp.Model != `fake-b` || resp.ID == `` || resp.Choices[0].Message.Content != `echo: hello` {
+		t.Fatalf(`unexpected response: %s`, resp.String())
+	}
+
+	errResp := schema.ErrorResponse{}
+	code = post(t, ts.URL+`/v1/chat/completions`, schema.ChatRequest{Model: `missing`}, &errResp)
+	if code != http.StatusNotFound || errResp.Error.Code != `model_not_found` {
+		t.Fatalf(`unexpected error response %d: %+v`, code, errResp.Error)
+	}
+}
+
+func TestServer_ChatCompletionsWithChain(t *testing.T) {
+
+	ts := newTestServer(t)
+
+	resp := schema.ChatResponse{}
+	code := post(t, ts.URL+`/v1/chat/completions`, schema.ChatRequest{
+		Model:     `fake-a`,
+		Messages:  []schema.Message{schema.BuildUserMessage(`hello`)},
+		Langchain: `upper`,
+	}, &resp)
+
+	if code != http.StatusOK || resp.Choices[0].Message.Content != `HELLO` {
+		t.Fatalf(`unexpected response %d: %s`, code, resp.String())
+	}
+
+	errResp := schema.ErrorResponse{}
+	code = post(t, ts.URL+`/v1/chat/completions`, schema.ChatRequest{Model: `fake-a`, Langchain: `missing`}, &errResp)
+	if code != http.StatusBadRequest {
+		t.Fatalf(`unexpected status %d`, code)
+	}
+}
+
+// staticRetriever return the documents for any query.
+type staticRetriever []schema.Document
+
+func (r staticRetriever) GetRelevantDocuments(ctx context.Context, query string) ([]schema.Document, error) {
+	return r, nil
+}
+
+func TestServer_RetrievalQA(t *testing.T) {
+
+	ts := newTestServer(t)
+
+	docs := staticRetriever{{PageContent: `go is a language`, Metadata: map[string]any{`source`: `go.md`}}}
+	chains.RegChain(chains.NewRetrievalQA(docs, nil).WithName(`test-retrieval-qa`))
+	t.Cleanup(func() { chains.UnregChain(`test-retrieval-qa`) })
+
+	resp := schema.ChatResponse{}
+	code := post(t, ts.URL+`/v1/chat/completions`, schema.ChatRequest{
+		Model:     `fake-a`,
+		Messages:  []schema.Message{schema.BuildUserMessage(`what is go?`)},
+		Langchain: `test-retrieval-qa`,
+	}, &resp)
+
+	if code != http.StatusOK || !strings.Contains(resp.Choices[0].Message.Content, "go is a language\n\nQuestion: what is go?") {
+		t.Fatalf(`unexpected response %d: %s`, code, resp.String())
+	}
+	want := []schema.Document{{PageContent: `go is a language`, Metadata: map[string]any{`source`: `go.md`}}}
+	if !reflect.DeepEqual(resp.SourceDocuments, want) {
+		t.Fatalf(`unexpected source documents %+v`, resp.SourceDocuments)
+	}
+
+	cresp := schema.CompletionResponse{}
+	code = post(t, ts.URL+`/v1/completions`, schema.CompletionRequest{Model: `fake-a`, Prompt: `what is go?`, Langchain: `test-retrieval-qa`}, &cresp)
+	if code != http.StatusOK || !strings.HasPrefix(cresp.Choices[0].Text, `echo: `) || !reflect.DeepEqual(cresp.SourceDocuments, want) {
+		t.Fatalf(`unexpected completion response %d: %+v`, code, cresp)
+	}
+}
+
+func TestServer_Completions(t *testing.T) {
+
+	ts := newTestServer(t)
+
+	resp := schema.CompletionResponse{}
+	code := post(t, ts.URL+`/v1/completions`, schema.CompletionRequest{Model: `fake-a`, Prompt: `hi`}, &resp)
+
+	if code != http.StatusOK || resp.Object != schema.OTTextCompletion || resp.Choices[0].Text != `echo: hi` {
+		t.Fatalf(`unexpected response %d: %s`, code, resp.ID)
+	}
+
+	code = post(t, ts.URL+`/v1/completions`, schema.CompletionRequest{Model: `fake-a`, Prompt: `hi`, Langchain: `upper`}, &resp)
+	if code != http.StatusOK || resp.Choices[0].Text != `HI` {
+		t.Fatalf(`unexpected chain response %d: %+v`, code, resp.Choices)
+	}
+}
+
+// completionWorker the gRPC worker of local models answering completions.
+type completionWorker struct {
+	local.UnimplementedChatServiceServer
+}
+
+func (completionWorker) Completion(ctx context.Context, in *local.GenerationRequest) (*local.GenerationReply, error) {
+	return &local.GenerationReply{Text: in.Prompt + ` world`, FinishReason: `stop`}, nil
+}
+
+func TestServer_LocalCompletions(t *testing.T) {
+
+	gin.SetMode(gin.TestMode)
+
+	lis, err := net.Listen(`tcp`, `127.0.0.1:0`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gs := grpc.NewServer()
+	local.RegisterChatServiceServer(gs, completionWorker{})
+	go gs.Serve(lis)
+	t.Cleanup(gs.Stop)
+
+	llm := local.New(local.WithHosts([]string{lis.Addr().String()}), local.WithModel(`llama-x`))
+	t.Cleanup(llm.Free)
+
+	ts := httptest.NewServer(server.New(server.WithModels(llm)))
+	t.Cleanup(ts.Close)
+
+	resp := schema.CompletionResponse{}
+	code := post(t, ts.URL+`/v1/completions`, schema.CompletionRequest{Model: `llama-x`, Prompt: `hello`}, &resp)
+
+	if code != http.StatusOK || len(resp.Choices) != 1 || resp.Choices[0].Text != `hello world` || resp.Choices[0].FinishReason != `stop` {
+		t.Fatalf(`unexpected response %d: %+v`, code, resp)
+	}
+}
+
+func TestServer_PromptLibrary(t *testing.T) {
+
+	gin.SetMode(gin.TestMode)
+
+	lib, err := prompts.NewLibrary(fstest.MapFS{
+		`llama/chat.tmpl`:       {Data: []byte("{{range .Messages}}[{{.Role}}] {{.Content}}\n{{end}}[assistant]")},
+		`llama/completion.tmpl`: {Data: []byte(`[INST] {{.Input}} [/INST]`)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := lib.Bind(`llama-*`, prompts.TemplateConfig{Completion: `llama/completion`, Chat: `llama/chat`}); err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewServer(server.New(
+		server.WithModels(&fakeLLM{name: `llama-2`}, &fakeLLM{name: `fake-a`}),
+		server.WithPromptLibrary(lib),
+	))
+	defer ts.Close()
+
+	// the chat template renders messages to the prompt of completion.
+	resp := schema.ChatResponse{}
+	code := post(t, ts.URL+`/v1/chat/completions`, schema.ChatRequest{
+		Model:    `llama-2`,
+		Messages: []schema.Message{{Role: `system`, Content: `be brief`}, schema.BuildUserMessage(`hello`)},
+	}, &resp)
+	if code != http.StatusOK || resp.Object != `chat.completion` || resp.Choices[0].Message.Content != "echo: [system] be brief\n[user] hello\n[assistant]" {
+		t.Fatalf(`unexpected response %d: %s`, code, resp.String())
+	}
+
+	// the chat template is completed by the model, which can't stream.
+	errResp := schema.ErrorResponse{}
+	code = post(t, ts.URL+`/v1/chat/completions`, schema.ChatRequest{
+		Model:    `llama-2`,
+		Messages: []schema.Message{schema.BuildUserMessage(`hello`)},
+		Stream:   true,
+	}, &errResp)
+	if code != http.StatusBadRequest || errResp.Error == nil || !strings.Contains(errResp.Error.Message, `stream is not supported`) {
+		t.Fatalf(`unexpected response %d: %+v`, code, errResp.Error)
+	}
+
+	cresp := schema.CompletionResponse{}
+	code = post(t, ts.URL+`/v1/completions`, schema.CompletionRequest{Model: `llama-2`, Prompt: `hi`}, &cresp)
+	if code != http.StatusOK || cresp.Choices[0].Text != `echo: [INST] hi [/INST]` {
+		t.Fatalf(`unexpected response %d: %+v`, code, cresp.Choices)
+	}
+
+	// models without templates are not changed.
+	code = post(t, ts.URL+`/v1/completions`, schema.CompletionRequest{Model: `fake-a`, Prompt: `hi`}, &cresp)
+	if code != http.StatusOK || cresp.Choices[0].Text != `echo: hi` {
+		t.Fatalf(`unexpected response %d: %+v`, code, cresp.Choices)
+	}
+}
+
+func TestServer_Embeddings(t *testing.T) {
+
+	ts := newTestServer(t)
+
+	resp := schema.EmbeddingsResponse{}
+	code := post(t, ts.URL+`/v1/embeddings`, map[string]any{`model`: `fake-a`, `input`: []string{`a`, `b`}}, &resp)
+
+	if code != http.StatusOK || len(resp.Data) != 2 || resp.Data[1].Embedding[0] != 1 {
+		t.Fatalf(`unexpected response %d: %s`, code, resp.String())
+	}
+
+	errResp := schema.ErrorResponse{}
+	code = post(t, ts.URL+`/v1/embeddings`, map[string]any{`model`: `fake-a`, `input`: 1}, &errResp)
+	if code != http.StatusBadRequest {
+		t.Fatalf(`unexpected status %d`, code)
+	}
+}
+
+// emptyLLM return no response without error.
+type emptyLLM struct {
+	fakeLLM
+}
+
+func (emptyLLM) Embeddings(ctx context.Context, req *schema.EmbeddingsRequest) (*schema.EmbeddingsResponse, error) {
+	return nil, nil
+}
+
+func TestServer_EmbeddingsEmptyResponse(t *testing.T) {
+
+	gin.SetMode(gin.TestMode)
+	ts := httptest.NewServer(server.New(server.WithModels(&emptyLLM{fakeLLM{name: `empty`}})))
+	defer ts.Close()
+
+	errResp := schema.ErrorResponse{}
+	code := post(t, ts.URL+`/v1/embeddings`, map[string]any{`model`: `empty`, `input`: []string{`a`}}, &errResp)
+	if code != http.StatusInternalServerError || !strings.Contains(errResp.Error.Message, `empty response`) {
+		t.Fatalf(`unexpected response %d: %+v`, code, errResp.Error)
+	}
+}
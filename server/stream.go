@@ -0,0 +1,218 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nexptr/llmchain/chains"
+	"github.com/nexptr/llmchain/llms"
+	"github.com/nexptr/llmchain/schema"
+)
+
+var (
+	sseDataPrefix = []byte("data: ")
+	sseDataDone   = []byte("[DONE]")
+	sseEventEnd   = []byte("\n\n")
+)
+
+// chatStream write the chunks of llms.ChatStream as OpenAI compatible server-sent events.
+func (s *Server) chatStream(c *gin.Context, llm llms.LLM, req *schema.ChatRequest) {
+
+	// request context is canceled when client disconnected, which stops the upstream.
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	defer cancel()
+
+	stream, err := llms.OpenStream(ctx, llm, req)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	writeStream(ctx, c, stream, chatChunk(req.Model))
+}
+
+// chatChunk return formatter of chat.completion.chunk events.
+func chatChunk(model string) func(*schema.ChatResponse) any {
+
+	id, created := newID(`chatcmpl-`), time.Now().Unix()
+
+	return func(chunk *schema.ChatResponse) any {
+		chunk.ID, chunk.Object, chunk.Created, chunk.Model = id, `chat.completion.chunk`, created, model
+		for i := range chunk.Choices {
+			if chunk.Choices[i].Delta == nil {
+				chunk.Choices[i].Delta, chunk.Choices[i].Message = chunk.Choices[i].Message, nil
+			}
+		}
+		return chunk
+	}
+}
+
+// completionChunk return formatter of text_completion events, the delta is the text.
+func completionChunk(model string) func(*schema.ChatResponse) any {
+
+	id, created := newID(`cmpl-`), time.Now().Unix()
+
+	return func(chunk *schema.ChatResponse) any {
+		ret := &schema.CompletionResponse{
+			ID:              id,
+			Object:          schema.OTTextCompletion,
+			Created:         created,
+			Model:           model,
+			SourceDocuments: chunk.SourceDocuments,
+		}
+		for _, choice := range chunk.Choices {
+			text := ``
+			if choice.Delta != nil {
+				text = choice.Delta.Content
+			}
+			ret.Choices = append(ret.Choices, schema.Choice{Index: choice.Index, Text: text, FinishReason: choice.FinishReason})
+		}
+		return ret
+	}
+}
+
+// writeStream write the chunks of stream formatted by format as server-sent events, the error
+// before the first chunk is replied as normal json error. ctx is the context of stream.
+func writeStream(ctx context.Context, c *gin.Context, stream *llms.ChatStream, format func(*schema.ChatResponse) any) {
+
+	defer stream.Close()
+
+	started := false
+
+	for {
+		chunk, err := stream.Recv()
+
+		if err == io.EOF {
+			if !started {
+				startEventStream(c)
+			}
+			_ = writeData(c, sseDataDone)
+			return
+		}
+
+		if err != nil {
+			if !started {
+				// nothing send yet, reply as normal json error.
+				abortWithError(c, err)
+				return
+			}
+			if ctx.Err() == nil {
+				_ = writeEvent(c, errorResponse(err))
+			}
+			return
+		}
+
+		if !started {
+			startEventStream(c)
+			started = true
+		}
+
+		// write blocks until client received, the upstream is read no faster than client.
+		if err := writeEvent(c, format(chunk)); err != nil {
+			return
+		}
+	}
+}
+
+// chainStream run chain in background and stream the chunks of its model as deltas. The last chunk
+// finishes the choice with the source documents, and carries the output if the chain streamed
+// nothing. Close the stream to cancel the chain.
+func chainStream(ctx context.Context, chain chains.Chain, inputs map[string]any, options ...chains.ChainCallOption) *llms.ChatStream {
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	chunks := make(chan *schema.ChatResponse)
+	errc := make(chan error, 1)
+
+	send := func(chunk *schema.ChatResponse) {
+		select {
+		case chunks <- chunk:
+		case <-ctx.Done():
+		}
+	}
+
+	go func() {
+		defer close(chunks)
+
+		streamed := false
+		opts := append(append([]chains.ChainCallOption{}, options...), chains.WithStreamingFunc(func(chunk string) {
+			streamed = true
+			msg := schema.BuildAIMessage(chunk)
+			send(&schema.ChatResponse{Choices: []schema.Choice{{Delta: &msg}}})
+		}))
+
+		out, err := chains.Call(ctx, chain, inputs, opts...)
+		if err != nil {
+			errc <- err
+			return
+		}
+
+		text := ``
+		if !streamed {
+			if text, err = chainOutputText(chain.GetName(), out); err != nil {
+				errc <- err
+				return
+			}
+		}
+
+		msg := schema.BuildAIMessage(text)
+		last := &schema.ChatResponse{Choices: []schema.Choice{{Delta: &msg, FinishReason: `stop`}}}
+		last.SourceDocuments, _ = out[chains.SourceDocumentsKey].([]schema.Document)
+		send(last)
+	}()
+
+	recv := func() (*schema.ChatResponse, error) {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case chunk, ok := <-chunks:
+			if ok {
+				return chunk, nil
+			}
+			select {
+			case err := <-errc:
+				return nil, err
+			default:
+				return nil, io.EOF
+			}
+		}
+	}
+
+	return llms.NewChatStream(recv, func() error {
+		cancel()
+		return nil
+	})
+}
+
+func startEventStream(c *gin.Context) {
+	h := c.Writer.Header()
+	h.Set(`Content-Type`, `text/event-stream`)
+	h.Set(`Cache-Control`, `no-cache`)
+	h.Set(`Connection`, `keep-alive`)
+	h.Set(`X-Accel-Buffering`, `no`)
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+}
+
+func writeEvent(c *gin.Context, v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return writeData(c, b)
+}
+
+// writeData write `data: xxx\n\n` and flush it immediately.
+func writeData(c *gin.Context, data []byte) error {
+	for _, b := range [][]byte{sseDataPrefix, data, sseEventEnd} {
+		if _, err := c.Writer.Write(b); err != nil {
+			return err
+		}
+	}
+	c.Writer.Flush()
+	return nil
+}
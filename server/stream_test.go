@@ -0,0 +1,300 @@
+package server_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nexptr/llmchain/chains"
+	"github.com/nexptr/llmchain/llms"
+	"github.com/nexptr/llmchain/prompts"
+	"github.com/nexptr/llmchain/schema"
+	"github.com/nexptr/llmchain/server"
+)
+
+// streamLLM stream the words of last message back by StreamCallback, Call streams the words of
+// prompt by the stream callback.
+type streamLLM struct {
+	fakeLLM
+	cancelled chan struct{}
+}
+
+func (f *streamLLM) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+
+	opts := llms.InitCallOptions(options...)
+	if opts.CallBackFn == nil {
+		return f.fakeLLM.Call(ctx, prompt, options...)
+	}
+	if prompt == `refuse` {
+		return ``, errors.New(`upstream refused`)
+	}
+	return prompt, f.stream(ctx, prompt, opts.CallBackFn)
+}
+
+func (f *streamLLM) Chat(ctx context.Context, req *schema.ChatRequest) (*schema.ChatResponse, error) {
+
+	if req.StreamCallback == nil {
+		return f.fakeLLM.Chat(ctx, req)
+	}
+
+	content := req.Messages[len(req.Messages)-1].Content
+	if content == `refuse` {
+		return nil, errors.New(`upstream refused`)
+	}
+
+	go f.stream(ctx, content, req.StreamCallback)
+
+	return nil, nil
+}
+
+// stream the words of content to cb, `fail` fails after the first chunk and `hang` waits ctx done.
+func (f *streamLLM) stream(ctx context.Context, content string, cb schema.SreamCallBack) error {
+
+	chunk := func(text string) *schema.ChatResponse {
+		msg := schema.BuildAIMessage(text)
+		return &schema.ChatResponse{Choices: []schema.Choice{{Delta: &msg}}}
+	}
+
+	switch content {
+	case `fail`:
+		err := errors.New(`upstream failed`)
+		cb(chunk(`partial`), false, nil)
+		cb(nil, true, err)
+		return err
+	case `hang`:
+		cb(chunk(`partial`), false, nil)
+		<-ctx.Done()
+		close(f.cancelled)
+		cb(nil, true, ctx.Err())
+		return ctx.Err()
+	}
+
+	for _, w := range strings.Fields(content) {
+		cb(chunk(w), false, nil)
+	}
+	cb(nil, true, nil)
+	return nil
+}
+
+// streamChain the chain of streamLLM answering the input as is.
+const streamChain = `test-stream-chain`
+
+func newStreamServer(t *testing.T) (*httptest.Server, *streamLLM) {
+	gin.SetMode(gin.TestMode)
+
+	chains.RegChain(chains.NewLLMChain(nil, prompts.PromptTemplate(`{{.input}}`, `input`)).WithName(streamChain))
+	t.Cleanup(func() { chains.UnregChain(streamChain) })
+
+	llm := &streamLLM{fakeLLM: fakeLLM{name: `stream`}, cancelled: make(chan struct{})}
+	ts := httptest.NewServer(server.New(server.WithModels(llm)))
+	t.Cleanup(ts.Close)
+	return ts, llm
+}
+
+func streamRequest(ctx context.Context, t *testing.T, url, content string) *http.Response {
+	return postStream(ctx, t, url+`/v1/chat/completions`, schema.ChatRequest{
+		Model:    `stream`,
+		Messages: []schema.Message{schema.BuildUserMessage(content)},
+		Stream:   true,
+	})
+}
+
+func postStream(ctx context.Context, t *testing.T, url string, body any) *http.Response {
+	b, _ := json.Marshal(body)
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(b))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func readEvents(t *testing.T, resp *http.Response) []string {
+	defer resp.Body.Close()
+	events := []string{}
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		if line := scanner.Text(); strings.HasPrefix(line, `data: `) {
+			events = append(events, strings.TrimPrefix(line, `data: `))
+		}
+	}
+	return events
+}
+
+func TestServer_ChatStream(t *testing.T) {
+
+	ts, _ := newStreamServer(t)
+
+	resp := streamRequest(context.Background(), t, ts.URL, `hello stream world`)
+	if ct := resp.Header.Get(`Content-Type`); ct != `text/event-stream` {
+		t.Fatalf(`unexpected content type %s`, ct)
+	}
+
+	events := readEvents(t, resp)
+	if len(events) != 4 || events[3] != `[DONE]` {
+		t.Fatalf(`unexpected events: %v`, events)
+	}
+
+	words := []string{}
+	for _, e := range events[:3] {
+		chunk := schema.ChatResponse{}
+		if err := json.Unmarshal([]byte(e), &chunk); err != nil {
+			t.Fatal(err)
+		}
+		if chunk.Object != `chat.completion.chunk` || chunk.Model != `stream` {
+			t.Fatalf(`unexpected chunk: %s`, e)
+		}
+		words = append(words, chunk.Choices[0].Delta.Content)
+	}
+	if strings.Join(words, ` `) != `hello stream world` {
+		t.Fatalf(`unexpected words: %v`, words)
+	}
+}
+
+func TestServer_ChatStreamError(t *testing.T) {
+
+	ts, _ := newStreamServer(t)
+
+	events := readEvents(t, streamRequest(context.Background(), t, ts.URL, `fail`))
+	if len(events) != 2 {
+		t.Fatalf(`unexpected events: %v`, events)
+	}
+
+	errResp := schema.ErrorResponse{}
+	if err := json.Unmarshal([]byte(events[1]), &errResp); err != nil || errResp.Error == nil {
+		t.Fatalf(`expect error event, got: %s`, events[1])
+	}
+	if errResp.Error.Message != `upstream failed` {
+		t.Fatalf(`unexpected error: %+v`, errResp.Error)
+	}
+
+	// failed before any chunk, reply json error
+	resp := streamRequest(context.Background(), t, ts.URL, `refuse`)
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Fatalf(`unexpected status %d`, resp.StatusCode)
+	}
+}
+
+func TestServer_ChatStreamClientDisconnect(t *testing.T) {
+
+	ts, llm := newStreamServer(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	resp := streamRequest(ctx, t, ts.URL, `hang`)
+
+	// wait first chunk then go away
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	if err != nil || !strings.HasPrefix(line, `data: `) {
+		t.Fatalf(`unexpected first line %q: %v`, line, err)
+	}
+	cancel()
+	resp.Body.Close()
+
+	select {
+	case <-llm.cancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatal(`upstream context not cancelled after client disconnected`)
+	}
+}
+
+func TestServer_ChainStream(t *testing.T) {
+
+	ts, _ := newStreamServer(t)
+
+	resp := postStream(context.Background(), t, ts.URL+`/v1/chat/completions`, schema.ChatRequest{
+		Model:     `stream`,
+		Messages:  []schema.Message{schema.BuildUserMessage(`hello chain`)},
+		Stream:    true,
+		Langchain: streamChain,
+	})
+
+	events := readEvents(t, resp)
+	if len(events) != 4 || events[3] != `[DONE]` {
+		t.Fatalf(`unexpected events: %v`, events)
+	}
+
+	texts, finish := []string{}, ``
+	for _, e := range events[:3] {
+		chunk := schema.ChatResponse{}
+		if err := json.Unmarshal([]byte(e), &chunk); err != nil || chunk.Object != `chat.completion.chunk` {
+			t.Fatalf(`unexpected chunk %s: %v`, e, err)
+		}
+		texts = append(texts, chunk.Choices[0].Delta.Content)
+		finish = chunk.Choices[0].FinishReason
+	}
+	if strings.Join(texts, `|`) != `hello|chain|` || finish != `stop` {
+		t.Fatalf(`unexpected chunks %q, finish %q`, texts, finish)
+	}
+
+	// the chain fails mid-stream.
+	resp = postStream(context.Background(), t, ts.URL+`/v1/chat/completions`, schema.ChatRequest{
+		Model:     `stream`,
+		Messages:  []schema.Message{schema.BuildUserMessage(`fail`)},
+		Stream:    true,
+		Langchain: streamChain,
+	})
+	events = readEvents(t, resp)
+	if len(events) != 2 || !strings.Contains(events[1], `upstream failed`) {
+		t.Fatalf(`unexpected events: %v`, events)
+	}
+}
+
+func TestServer_ChainStreamClientDisconnect(t *testing.T) {
+
+	ts, llm := newStreamServer(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	resp := postStream(ctx, t, ts.URL+`/v1/completions`, schema.CompletionRequest{
+		Model:     `stream`,
+		Prompt:    `hang`,
+		Stream:    true,
+		Langchain: streamChain,
+	})
+
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	if err != nil || !strings.HasPrefix(line, `data: `) {
+		t.Fatalf(`unexpected first line %q: %v`, line, err)
+	}
+	cancel()
+	resp.Body.Close()
+
+	select {
+	case <-llm.cancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatal(`chain not cancelled after client disconnected`)
+	}
+}
+
+func TestServer_CompletionStream(t *testing.T) {
+
+	ts := newTestServer(t)
+
+	// the chain not streaming is sent as the last chunk.
+	resp := postStream(context.Background(), t, ts.URL+`/v1/completions`, schema.CompletionRequest{Model: `fake-a`, Prompt: `hi`, Stream: true, Langchain: `upper`})
+	events := readEvents(t, resp)
+	if len(events) != 2 || events[1] != `[DONE]` {
+		t.Fatalf(`unexpected events: %v`, events)
+	}
+
+	chunk := schema.CompletionResponse{}
+	if err := json.Unmarshal([]byte(events[0]), &chunk); err != nil || chunk.Object != schema.OTTextCompletion ||
+		chunk.Choices[0].Text != `HI` || chunk.Choices[0].FinishReason != `stop` {
+		t.Fatalf(`unexpected chunk %s: %v`, events[0], err)
+	}
+
+	// providers have no streaming api of completion.
+	errResp := schema.ErrorResponse{}
+	code := post(t, ts.URL+`/v1/completions`, schema.CompletionRequest{Model: `fake-a`, Prompt: `hi`, Stream: true}, &errResp)
+	if code != http.StatusBadRequest || errResp.Error == nil || !strings.Contains(errResp.Error.Message, `stream is not supported`) {
+		t.Fatalf(`unexpected response %d: %+v`, code, errResp.Error)
+	}
+}
@@ -0,0 +1,274 @@
+package tokenizer
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// the pre-tokenize patterns of tiktoken. RE2 has no lookahead, so `\s+(?!\S)|\s+` is replaced by
+// the last group `(\s+)` and the lookahead is done by BPE.split.
+const (
+	cl100kPattern = `(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|(\s+)`
+	p50kPattern   = `'s|'t|'re|'ve|'m|'ll|'d| ?\p{L}+| ?\p{N}+| ?[^\s\p{L}\p{N}]+|(\s+)`
+)
+
+// encoding names of tiktoken.
+const (
+	Cl100kBase = `cl100k_base`
+	P50kBase   = `p50k_base`
+)
+
+var encodings = map[string]struct {
+	pattern string
+	special map[string]int
+}{
+	Cl100kBase: {cl100kPattern, map[string]int{
+		`<|endoftext|>`:   100257,
+		`<|fim_prefix|>`:  100258,
+		`<|fim_middle|>`:  100259,
+		`<|fim_suffix|>`:  100260,
+		`<|endofprompt|>`: 100276,
+	}},
+	P50kBase: {p50kPattern, map[string]int{
+		`<|endoftext|>`: 50256,
+	}},
+}
+
+// BPE byte pair encoding tokenizer compatible with tiktoken.
+type BPE struct {
+	name    string
+	pattern *regexp.Regexp
+	ranks   map[string]int
+	decoder map[int]string
+
+	special        map[string]int
+	specialDecoder map[int]string
+	specialPattern *regexp.Regexp
+}
+
+var _ Tokenizer = &BPE{}
+
+// LoadFile load encoding name from the tiktoken rank file, example: cl100k_base.tiktoken
+// Unknown encoding names use the pattern of cl100k_base without special tokens.
+func LoadFile(name, file string) (*BPE, error) {
+
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	ranks, err := ParseRanks(f)
+	if err != nil {
+		return nil, fmt.Errorf(`%s: %v`, file, err)
+	}
+
+	return NewBPE(name, ranks)
+}
+
+// ParseRanks parse tiktoken rank file, every line is `base64(token) rank`.
+func ParseRanks(r io.Reader) (map[string]int, error) {
+
+	ranks := map[string]int{}
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+
+		text := strings.TrimSpace(scanner.Text())
+		if text == `` {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf(`line %d: expect 'token rank', got %q`, line, text)
+		}
+
+		token, err := base64.StdEncoding.DecodeString(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf(`line %d: %v`, line, err)
+		}
+		rank, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf(`line %d: %v`, line, err)
+		}
+
+		ranks[string(token)] = rank
+	}
+
+	return ranks, scanner.Err()
+}
+
+// NewBPE return BPE of encoding name with the ranks.
+func NewBPE(name string, ranks map[string]int) (*BPE, error) {
+
+	enc, ok := encodings[name]
+	if !ok {
+		enc.pattern = cl100kPattern
+	}
+
+	pattern, err := regexp.Compile(enc.pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &BPE{
+		name:           name,
+		pattern:        pattern,
+		ranks:          ranks,
+		decoder:        make(map[int]string, len(ranks)),
+		special:        enc.special,
+		specialDecoder: make(map[int]string, len(enc.special)),
+	}
+
+	for token, rank := range ranks {
+		b.decoder[rank] = token
+	}
+
+	if len(enc.special) > 0 {
+		quoted := make([]string, 0, len(enc.special))
+		for token, rank := range enc.special {
+			quoted = append(quoted, regexp.QuoteMeta(token))
+			b.specialDecoder[rank] = token
+		}
+		sort.Strings(quoted)
+		b.specialPattern = regexp.MustCompile(strings.Join(quoted, `|`))
+	}
+
+	return b, nil
+}
+
+// Name return the encoding name.
+func (b *BPE) Name() string {
+	return b.name
+}
+
+// Encode implements Tokenizer, special tokens in text are encoded as special tokens.
+func (b *BPE) Encode(text string) []int {
+
+	ret := []int{}
+
+	if b.specialPattern == nil {
+		return b.encodeOrdinary(text, ret)
+	}
+
+	start := 0
+	for _, loc := range b.specialPattern.FindAllStringIndex(text, -1) {
+		ret = b.encodeOrdinary(text[start:loc[0]], ret)
+		ret = append(ret, b.special[text[loc[0]:loc[1]]])
+		start = loc[1]
+	}
+
+	return b.encodeOrdinary(text[start:], ret)
+}
+
+func (b *BPE) encodeOrdinary(text string, ret []int) []int {
+	for _, piece := range b.split(text) {
+		if rank, ok := b.ranks[piece]; ok {
+			ret = append(ret, rank)
+			continue
+		}
+		ret = b.bytePairEncode(piece, ret)
+	}
+	return ret
+}
+
+// split pre-tokenize text by pattern. A whitespace run matched by the last group gives back its last
+// char to the next piece if followed by non-space, which is what `\s+(?!\S)` does.
+func (b *BPE) split(text string) []string {
+
+	pieces := []string{}
+
+	for pos := 0; pos < len(text); {
+
+		loc := b.pattern.FindStringSubmatchIndex(text[pos:])
+		if loc == nil {
+			break
+		}
+
+		start, end := pos+loc[0], pos+loc[1]
+
+		if loc[2] >= 0 && end < len(text) {
+			next, _ := utf8.DecodeRuneInString(text[end:])
+			_, last := utf8.DecodeLastRuneInString(text[start:end])
+			if !unicode.IsSpace(next) && end-last > start {
+				end -= last
+			}
+		}
+
+		if end == start {
+			// never happen with the builtin patterns, skip the char to avoid endless loop.
+			_, size := utf8.DecodeRuneInString(text[pos:])
+			pos += size
+			continue
+		}
+
+		pieces = append(pieces, text[start:end])
+		pos = end
+	}
+
+	return pieces
+}
+
+// bytePairEncode merge the adjacent parts of piece with the lowest rank until no merge is possible.
+func (b *BPE) bytePairEncode(piece string, ret []int) []int {
+
+	// boundaries of parts, part i is piece[parts[i]:parts[i+1]]
+	parts := make([]int, len(piece)+1)
+	for i := range parts {
+		parts[i] = i
+	}
+
+	for len(parts) > 2 {
+
+		minRank, minIndex := -1, -1
+		for i := 0; i+2 < len(parts); i++ {
+			rank, ok := b.ranks[piece[parts[i]:parts[i+2]]]
+			if ok && (minRank < 0 || rank < minRank) {
+				minRank, minIndex = rank, i
+			}
+		}
+
+		if minIndex < 0 {
+			break
+		}
+
+		parts = append(parts[:minIndex+1], parts[minIndex+2:]...)
+	}
+
+	for i := 0; i+1 < len(parts); i++ {
+		if rank, ok := b.ranks[piece[parts[i]:parts[i+1]]]; ok {
+			ret = append(ret, rank)
+		}
+	}
+
+	return ret
+}
+
+// Decode implements Tokenizer, unknown tokens are skipped.
+func (b *BPE) Decode(tokens []int) string {
+
+	sb := strings.Builder{}
+	for _, t := range tokens {
+		if v, ok := b.decoder[t]; ok {
+			sb.WriteString(v)
+		} else if v, ok := b.specialDecoder[t]; ok {
+			sb.WriteString(v)
+		}
+	}
+	return sb.String()
+}
+
+// Count implements Tokenizer.
+func (b *BPE) Count(text string) int {
+	return len(b.Encode(text))
+}
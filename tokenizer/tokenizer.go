@@ -0,0 +1,197 @@
+// Package tokenizer count tokens offline, BPE encodings are loaded from the tiktoken rank files on disk.
+package tokenizer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/nexptr/llmchain/schema"
+)
+
+// Tokenizer encode text to tokens of model.
+type Tokenizer interface {
+	// Name return the encoding name, example: cl100k_base
+	Name() string
+	// Encode return the tokens of text.
+	Encode(text string) []int
+	// Decode return the text of tokens.
+	Decode(tokens []int) string
+	// Count return the number of tokens of text.
+	Count(text string) int
+}
+
+// Dir where rank files ({encoding}.tiktoken) are loaded from, default is $LLMCHAIN_TOKENIZER_DIR or models/tokenizer
+var Dir = defaultDir()
+
+func defaultDir() string {
+	if dir := os.Getenv(`LLMCHAIN_TOKENIZER_DIR`); dir != `` {
+		return dir
+	}
+	return filepath.Join(`models`, `tokenizer`)
+}
+
+var cache = struct {
+	sync.Mutex
+	loaded map[string]Tokenizer
+	failed map[string]error
+}{loaded: map[string]Tokenizer{}, failed: map[string]error{}}
+
+// Get return the tokenizer of encoding name (cl100k_base, p50k_base) loaded from Dir, or of the rank
+// file if name is a path. Loaded tokenizers and load errors are cached, so the missing rank files
+// are not opened again.
+func Get(name string) (Tokenizer, error) {
+
+	cache.Lock()
+	defer cache.Unlock()
+
+	if t, ok := cache.loaded[name]; ok {
+		return t, nil
+	}
+	if err, ok := cache.failed[name]; ok {
+		return nil, err
+	}
+
+	file, encoding := name, strings.TrimSuffix(filepath.Base(name), `.tiktoken`)
+	if _, ok := encodings[name]; ok {
+		file = filepath.Join(Dir, name+`.tiktoken`)
+	}
+
+	t, err := LoadFile(encoding, file)
+	if err != nil {
+		cache.failed[name] = err
+		return nil, err
+	}
+
+	cache.loaded[name] = t
+	return t, nil
+}
+
+// EncodingForModel return the encoding name of OpenAI models.
+func EncodingForModel(model string) string {
+	switch {
+	case strings.HasPrefix(model, `gpt-4`), strings.HasPrefix(model, `gpt-3.5-turbo`), strings.HasPrefix(model, `text-embedding-ada-002`):
+		return Cl100kBase
+	case strings.HasPrefix(model, `text-davinci-002`), strings.HasPrefix(model, `text-davinci-003`), strings.HasPrefix(model, `code-`):
+		return P50kBase
+	default:
+		return Cl100kBase
+	}
+}
+
+// ForModel return tokenizer of model, the estimator is returned if the rank file is not available.
+func ForModel(model string) Tokenizer {
+	return GetOrEstimate(EncodingForModel(model))
+}
+
+// GetOrEstimate return Get(name), the estimator is returned if name is empty or failed to load.
+func GetOrEstimate(name string) Tokenizer {
+	if name == `` {
+		return Estimator{}
+	}
+	t, err := Get(name)
+	if err != nil {
+		return Estimator{}
+	}
+	return t
+}
+
+// CountMessages count the tokens of chat messages the way OpenAI does, every message costs 3 extra
+// tokens for the separators, and the reply is primed with 3 tokens.
+func CountMessages(t Tokenizer, messages []schema.Message) int {
+
+	n := 3
+	for _, msg := range messages {
+		n += 3 + t.Count(msg.Role) + t.Count(msg.Content)
+	}
+	return n
+}
+
+// Truncate return the longest prefix of text within max tokens, empty if max <= 0.
+func Truncate(t Tokenizer, text string, max int) string {
+
+	if max <= 0 {
+		return ``
+	}
+	if t.Count(text) <= max {
+		return text
+	}
+
+	end := search(text, func(i int) bool { return t.Count(text[:i]) > max }) - 1
+	for end > 0 && !utf8.RuneStart(text[end]) {
+		end--
+	}
+	return text[:end]
+}
+
+// TruncateLeft return the longest suffix of text within max tokens.
+func TruncateLeft(t Tokenizer, text string, max int) string {
+
+	start := search(text, func(i int) bool { return t.Count(text[i:]) <= max })
+	for start < len(text) && !utf8.RuneStart(text[start]) {
+		start++
+	}
+	return text[start:]
+}
+
+// search return the smallest byte offset i in [0, len(text)] that f(i) is true, f must be monotonic.
+func search(text string, f func(i int) bool) int {
+	lo, hi := 0, len(text)
+	for lo < hi {
+		mid := int(uint(lo+hi) >> 1)
+		if !f(mid) {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	return lo
+}
+
+// Estimator estimate the tokens without rank files, every CJK char is counted as one token and
+// every 4 bytes of other text as one token. It's used when the vocabulary of model is unknown.
+type Estimator struct{}
+
+var _ Tokenizer = Estimator{}
+
+// Name implements Tokenizer.
+func (Estimator) Name() string {
+	return `estimator`
+}
+
+// Encode implements Tokenizer, the tokens are the runes of text, so len(Encode(text)) is not Count(text),
+// use Truncate to cut text by tokens.
+func (Estimator) Encode(text string) []int {
+	ret := make([]int, 0, len(text))
+	for _, r := range text {
+		ret = append(ret, int(r))
+	}
+	return ret
+}
+
+// Decode implements Tokenizer.
+func (Estimator) Decode(tokens []int) string {
+	sb := strings.Builder{}
+	for _, t := range tokens {
+		sb.WriteRune(rune(t))
+	}
+	return sb.String()
+}
+
+// Count implements Tokenizer.
+func (Estimator) Count(text string) int {
+
+	n, other := 0, 0
+	for _, r := range text {
+		if unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) {
+			n++
+		} else {
+			other += len(string(r))
+		}
+	}
+
+	return n + (other+3)/4
+}
@@ -0,0 +1,114 @@
+package tokenizer_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/nexptr/llmchain/schema"
+	"github.com/nexptr/llmchain/tokenizer"
+)
+
+// testdata/tiny.tiktoken has the 256 bytes and merges: he ll hell hello " w" or " wor" ld " world" " b" 你
+func tiny(t *testing.T) *tokenizer.BPE {
+	b, err := tokenizer.LoadFile(tokenizer.Cl100kBase, `testdata/tiny.tiktoken`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestBPE_Encode(t *testing.T) {
+
+	b := tiny(t)
+
+	cases := []struct {
+		text   string
+		tokens []int
+	}{
+		{`hello world`, []int{259, 264}},
+		// `\s+(?!\S)` leave the last space to the next word.
+		{`a  b`, []int{'a', ' ', 265}},
+		{"hello \n", []int{259, ' ', '\n'}},
+		{`你好`, []int{267, 0xe5, 0xa5, 0xbd}},
+		{`hello<|endoftext|>`, []int{259, 100257}},
+	}
+
+	for _, c := range cases {
+		tokens := b.Encode(c.text)
+		if !reflect.DeepEqual(tokens, c.tokens) {
+			t.Errorf(`%q: expect %v, got %v`, c.text, c.tokens, tokens)
+		}
+		if text := b.Decode(tokens); text != c.text {
+			t.Errorf(`%q: decoded %q`, c.text, text)
+		}
+		if b.Count(c.text) != len(c.tokens) {
+			t.Errorf(`%q: unexpected count %d`, c.text, b.Count(c.text))
+		}
+	}
+}
+
+func TestGet(t *testing.T) {
+
+	b, err := tokenizer.Get(`testdata/tiny.tiktoken`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Name() != `tiny` || b.Count(`hello world`) != 2 {
+		t.Fatalf(`unexpected tokenizer %s`, b.Name())
+	}
+
+	tokenizer.Dir = t.TempDir()
+	if _, ok := tokenizer.ForModel(`gpt-4`).(tokenizer.Estimator); !ok {
+		t.Fatal(`expect estimator without rank files`)
+	}
+
+	// the load error is cached, the file created later is not loaded.
+	missing := filepath.Join(t.TempDir(), `late.tiktoken`)
+	if _, err := tokenizer.Get(missing); err == nil {
+		t.Fatal(`expect error of missing rank file`)
+	}
+	data, _ := os.ReadFile(`testdata/tiny.tiktoken`)
+	if err := os.WriteFile(missing, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tokenizer.Get(missing); err == nil {
+		t.Fatal(`expect cached error`)
+	}
+}
+
+func TestCountMessages(t *testing.T) {
+
+	messages := []schema.Message{
+		{Role: `system`, Content: `你是一个助手。`},
+		schema.BuildUserMessage(`hello world`),
+	}
+
+	// 3 + (3 + 2 + 7) + (3 + 1 + 3)
+	if n := tokenizer.CountMessages(tokenizer.Estimator{}, messages); n != 22 {
+		t.Fatalf(`unexpected count %d`, n)
+	}
+}
+
+func TestTruncate(t *testing.T) {
+
+	b := tiny(t)
+	text := `hello world hello world`
+
+	if got := tokenizer.Truncate(b, text, 2); got != `hello world` {
+		t.Fatalf(`unexpected prefix %q`, got)
+	}
+	for _, max := range []int{0, -1} {
+		if got := tokenizer.Truncate(b, text, max); got != `` {
+			t.Fatalf(`unexpected prefix %q of max %d`, got, max)
+		}
+	}
+	if got := tokenizer.TruncateLeft(b, text, 2); b.Count(got) > 2 || !strings.HasSuffix(text, got) {
+		t.Fatalf(`unexpected suffix %q`, got)
+	}
+	if got := tokenizer.TruncateLeft(tokenizer.Estimator{}, `你好世界`, 2); got != `世界` {
+		t.Fatalf(`unexpected suffix %q`, got)
+	}
+}
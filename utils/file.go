@@ -0,0 +1,55 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// isJSON report whether file is JSON by extension, otherwise YAML.
+func isJSON(file string) bool {
+	return strings.EqualFold(filepath.Ext(file), `.json`)
+}
+
+// WriteFile write v to file as JSON (.json) or YAML (others).
+func WriteFile(file string, v any) error {
+
+	var (
+		data []byte
+		err  error
+	)
+
+	if isJSON(file) {
+		data, err = json.MarshalIndent(v, ``, `  `)
+	} else {
+		data, err = yaml.Marshal(v)
+	}
+	if err != nil {
+		return fmt.Errorf(`%s: %v`, file, err)
+	}
+
+	return os.WriteFile(file, data, 0o644)
+}
+
+// ReadFile decode JSON (.json) or YAML (others) file to v.
+func ReadFile(file string, v any) error {
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	if isJSON(file) {
+		err = json.Unmarshal(data, v)
+	} else {
+		err = yaml.Unmarshal(data, v)
+	}
+	if err != nil {
+		return fmt.Errorf(`%s: %v`, file, err)
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package vstore
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/nexptr/llmchain/llms"
+	"github.com/nexptr/llmchain/schema"
+)
+
+// MemoryStore in-memory vector store, documents are embedded by the Embeddings of llm and searched
+// by cosine similarity. It's suited for small corpora like few-shot examples.
+type MemoryStore struct {
+	llm llms.LLM
+
+	mu sync.RWMutex
+	// docs keyed by name space
+	docs map[string][]embeddedDocument
+}
+
+type embeddedDocument struct {
+	doc    schema.Document
+	vector []float32
+}
+
+var _ VectorStore = &MemoryStore{}
+
+// NewMemoryStore return store embedding by llm.
+func NewMemoryStore(llm llms.LLM) *MemoryStore {
+	return &MemoryStore{llm: llm, docs: map[string][]embeddedDocument{}}
+}
+
+// AddDocuments implements VectorStore.
+func (s *MemoryStore) AddDocuments(ctx context.Context, docs []schema.Document, options ...Option) error {
+
+	if len(docs) == 0 {
+		return nil
+	}
+
+	opts := parseOptions(options)
+
+	texts := make([]string, len(docs))
+	for i, d := range docs {
+		texts[i] = d.PageContent
+	}
+
+	vectors, err := s.embed(ctx, texts)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, d := range docs {
+		s.docs[opts.NameSpace] = append(s.docs[opts.NameSpace], embeddedDocument{doc: d, vector: vectors[i]})
+	}
+
+	return nil
+}
+
+// SimilaritySearch implements VectorStore, the most similar documents come first.
+func (s *MemoryStore) SimilaritySearch(ctx context.Context, query string, numDocuments int, options ...Option) ([]schema.Document, error) {
+
+	opts := parseOptions(options)
+
+	vectors, err := s.embed(ctx, []string{query})
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	docs := s.docs[opts.NameSpace]
+	s.mu.RUnlock()
+
+	type scored struct {
+		doc   schema.Document
+		score float64
+	}
+
+	results := make([]scored, len(docs))
+	for i, d := range docs {
+		results[i] = scored{d.doc, cosine(vectors[0], d.vector)}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].score > results[j].score
+	})
+
+	if numDocuments > 0 && len(results) > numDocuments {
+		results = results[:numDocuments]
+	}
+
+	ret := make([]schema.Document, len(results))
+	for i, r := range results {
+		ret[i] = r.doc
+	}
+	return ret, nil
+}
+
+func (s *MemoryStore) embed(ctx context.Context, texts []string) ([][]float32, error) {
+
+	resp, err := s.llm.Embeddings(ctx, &schema.EmbeddingsRequest{Model: s.llm.Name(), Input: texts})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(resp.Data) != len(texts) {
+		return nil, fmt.Errorf(`embeddings: expect %d vectors, got %d`, len(texts), len(resp.Data))
+	}
+
+	ret := make([][]float32, len(texts))
+	for i, d := range resp.Data {
+		if d.Index >= 0 && d.Index < len(ret) {
+			ret[d.Index] = d.Embedding
+		} else {
+			ret[i] = d.Embedding
+		}
+	}
+	return ret, nil
+}
+
+func cosine(a, b []float32) float64 {
+
+	if len(a) != len(b) {
+		return 0
+	}
+
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
+
+func parseOptions(options []Option) Options {
+	opts := Options{}
+	for _, fn := range options {
+		fn(&opts)
+	}
+	return opts
+}